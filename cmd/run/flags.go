@@ -189,6 +189,15 @@ func bindRunFlagsFunc(flags *pflag.FlagSet) func(*cobra.Command, []string) {
 		util.MustBindPFlag("listUsersMaxResults", flags.Lookup("listUsers-max-results"))
 		util.MustBindEnv("listUsersMaxResults", "OPENFGA_LIST_USERS_MAX_RESULTS", "OPENFGA_LISTUSERSMAXRESULTS")
 
+		util.MustBindPFlag("listUsersMaxResponseBytes", flags.Lookup("listUsers-max-response-bytes"))
+		util.MustBindEnv("listUsersMaxResponseBytes", "OPENFGA_LIST_USERS_MAX_RESPONSE_BYTES", "OPENFGA_LISTUSERSMAXRESPONSEBYTES")
+
+		util.MustBindPFlag("listUsersSharedWorkerPoolSize", flags.Lookup("listUsers-shared-worker-pool-size"))
+		util.MustBindEnv("listUsersSharedWorkerPoolSize", "OPENFGA_LIST_USERS_SHARED_WORKER_POOL_SIZE", "OPENFGA_LISTUSERSSHAREDWORKERPOOLSIZE")
+
+		util.MustBindPFlag("listUsersRequestCoalescing", flags.Lookup("listUsers-request-coalescing"))
+		util.MustBindEnv("listUsersRequestCoalescing", "OPENFGA_LIST_USERS_REQUEST_COALESCING", "OPENFGA_LISTUSERSREQUESTCOALESCING")
+
 		util.MustBindPFlag("checkQueryCache.enabled", flags.Lookup("check-query-cache-enabled"))
 		util.MustBindEnv("checkQueryCache.enabled", "OPENFGA_CHECK_QUERY_CACHE_ENABLED")
 
@@ -205,6 +205,12 @@ func NewRunCommand() *cobra.Command {
 
 	flags.Uint32("listUsers-max-results", defaultConfig.ListUsersMaxResults, "the maximum results to return in ListUsers API responses. If 0, all results can be returned")
 
+	flags.Uint64("listUsers-max-response-bytes", defaultConfig.ListUsersMaxResponseBytes, "the maximum estimated size in bytes of the users returned in ListUsers API responses. If 0, the response size is only bounded by listUsers-max-results")
+
+	flags.Uint32("listUsers-shared-worker-pool-size", defaultConfig.ListUsersSharedWorkerPoolSize, "the maximum number of concurrent datastore reads across all ListUsers queries. Once reached, the queries take turns making their reads. If 0, the reads are only bounded for each query by max-concurrent-reads-for-list-users")
+
+	flags.Bool("listUsers-request-coalescing", defaultConfig.ListUsersRequestCoalescing, "enable sharing a single expansion between the identical ListUsers requests made concurrently. Requests with contextual tuples, a context or higher consistency are never coalesced")
+
 	flags.Bool("check-query-cache-enabled", defaultConfig.CheckQueryCache.Enabled, "enable caching of Check requests. For example, if you have a relation `define viewer: owner or editor`, and the query is Check(user:anne, viewer, doc:1), we'll evaluate the `owner` relation and the `editor` relation and cache both results: (user:anne, viewer, doc:1) -> allowed=true and (user:anne, owner, doc:1) -> allowed=true. The cache is stored in-memory; the cached values are overwritten on every change in the result, and cleared after the configured TTL. This flag improves latency, but turns Check and ListObjects into eventually consistent APIs.")
 
 	flags.Uint32("check-query-cache-limit", defaultConfig.CheckQueryCache.Limit, "if caching of Check and ListObjects calls is enabled, this is the size limit of the cache")
@@ -602,6 +608,9 @@ func (s *ServerContext) Run(ctx context.Context, config *serverconfig.Config) er
 		server.WithListObjectsMaxResults(config.ListObjectsMaxResults),
 		server.WithListUsersDeadline(config.ListUsersDeadline),
 		server.WithListUsersMaxResults(config.ListUsersMaxResults),
+		server.WithListUsersMaxResponseBytes(config.ListUsersMaxResponseBytes),
+		server.WithListUsersSharedWorkerPoolSize(config.ListUsersSharedWorkerPoolSize),
+		server.WithListUsersRequestCoalescing(config.ListUsersRequestCoalescing),
 		server.WithMaxConcurrentReadsForListObjects(config.MaxConcurrentReadsForListObjects),
 		server.WithMaxConcurrentReadsForCheck(config.MaxConcurrentReadsForCheck),
 		server.WithMaxConcurrentReadsForListUsers(config.MaxConcurrentReadsForListUsers),
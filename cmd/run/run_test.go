@@ -1125,6 +1125,18 @@ func TestDefaultConfig(t *testing.T) {
 	require.True(t, val.Exists())
 	require.EqualValues(t, val.Int(), cfg.ListUsersMaxResults)
 
+	val = res.Get("properties.listUsersMaxResponseBytes.default")
+	require.True(t, val.Exists())
+	require.EqualValues(t, val.Int(), cfg.ListUsersMaxResponseBytes)
+
+	val = res.Get("properties.listUsersSharedWorkerPoolSize.default")
+	require.True(t, val.Exists())
+	require.EqualValues(t, val.Int(), cfg.ListUsersSharedWorkerPoolSize)
+
+	val = res.Get("properties.listUsersRequestCoalescing.default")
+	require.True(t, val.Exists())
+	require.Equal(t, val.Bool(), cfg.ListUsersRequestCoalescing)
+
 	val = res.Get("properties.experimentals.default")
 	require.True(t, val.Exists())
 	require.Equal(t, len(val.Array()), len(cfg.Experimentals))
@@ -6,7 +6,8 @@ import (
 	"github.com/sourcegraph/conc/pool"
 )
 
-// NewPool returns a new pool where each task respects context cancellation.
+// NewPool returns a new pool where each task respects context cancellation. Tasks are given a
+// context derived from ctx, so they see all of its values.
 // Wait() will only return the first error seen.
 func NewPool(ctx context.Context, maxGoroutines int) *pool.ContextPool {
 	return pool.New().
@@ -19,6 +19,58 @@ import (
 	gomock "go.uber.org/mock/gomock"
 )
 
+// MockSnapshotReader is a mock of SnapshotReader interface.
+type MockSnapshotReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockSnapshotReaderMockRecorder
+}
+
+// MockSnapshotReaderMockRecorder is the mock recorder for MockSnapshotReader.
+type MockSnapshotReaderMockRecorder struct {
+	mock *MockSnapshotReader
+}
+
+// NewMockSnapshotReader creates a new mock instance.
+func NewMockSnapshotReader(ctrl *gomock.Controller) *MockSnapshotReader {
+	mock := &MockSnapshotReader{ctrl: ctrl}
+	mock.recorder = &MockSnapshotReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSnapshotReader) EXPECT() *MockSnapshotReaderMockRecorder {
+	return m.recorder
+}
+
+// SnapshotToken mocks base method.
+func (m *MockSnapshotReader) SnapshotToken(ctx context.Context, store string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SnapshotToken", ctx, store)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SnapshotToken indicates an expected call of SnapshotToken.
+func (mr *MockSnapshotReaderMockRecorder) SnapshotToken(ctx, store any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SnapshotToken", reflect.TypeOf((*MockSnapshotReader)(nil).SnapshotToken), ctx, store)
+}
+
+// ValidateSnapshotToken mocks base method.
+func (m *MockSnapshotReader) ValidateSnapshotToken(token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateSnapshotToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ValidateSnapshotToken indicates an expected call of ValidateSnapshotToken.
+func (mr *MockSnapshotReaderMockRecorder) ValidateSnapshotToken(token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateSnapshotToken", reflect.TypeOf((*MockSnapshotReader)(nil).ValidateSnapshotToken), token)
+}
+
 // MockTupleBackend is a mock of TupleBackend interface.
 type MockTupleBackend struct {
 	ctrl     *gomock.Controller
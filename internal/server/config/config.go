@@ -30,6 +30,9 @@ const (
 	DefaultMaxConcurrentReadsForListObjects = math.MaxUint32
 	DefaultListUsersDeadline                = 3 * time.Second
 	DefaultListUsersMaxResults              = 1000
+	DefaultListUsersMaxResponseBytes        = 0
+	DefaultListUsersSharedWorkerPoolSize    = 0
+	DefaultListUsersRequestCoalescing       = false
 	DefaultMaxConcurrentReadsForListUsers   = math.MaxUint32
 
 	DefaultWriteContextByteLimit = 32 * 1_024 // 32KB
@@ -233,6 +236,20 @@ type Config struct {
 	// This is to protect the server from misuse of the ListUsers endpoints.
 	ListUsersMaxResults uint32
 
+	// ListUsersMaxResponseBytes defines the maximum estimated size, in bytes, of the users
+	// accumulated before the ListUsers API will respond to the client. If 0, the response
+	// size is only bounded by ListUsersMaxResults.
+	ListUsersMaxResponseBytes uint64
+
+	// ListUsersSharedWorkerPoolSize defines the maximum number of datastore reads in flight across
+	// all ListUsers queries at once. If 0, the reads are only bounded for each query by
+	// MaxConcurrentReadsForListUsers.
+	ListUsersSharedWorkerPoolSize uint32
+
+	// ListUsersRequestCoalescing enables sharing a single expansion between the identical
+	// ListUsers requests made concurrently.
+	ListUsersRequestCoalescing bool
+
 	// MaxTuplesPerWrite defines the maximum number of tuples per Write endpoint.
 	MaxTuplesPerWrite int
 
@@ -539,6 +556,9 @@ func DefaultConfig() *Config {
 		ListObjectsDeadline:                       DefaultListObjectsDeadline,
 		ListObjectsMaxResults:                     DefaultListObjectsMaxResults,
 		ListUsersMaxResults:                       DefaultListUsersMaxResults,
+		ListUsersMaxResponseBytes:                 DefaultListUsersMaxResponseBytes,
+		ListUsersSharedWorkerPoolSize:             DefaultListUsersSharedWorkerPoolSize,
+		ListUsersRequestCoalescing:                DefaultListUsersRequestCoalescing,
 		ListUsersDeadline:                         DefaultListUsersDeadline,
 		RequestDurationDatastoreQueryCountBuckets: []string{"50", "200"},
 		RequestDurationDispatchCountBuckets:       []string{"50", "200"},
@@ -0,0 +1,51 @@
+package listusers
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// allowListKeys returns the keys of the users that are collected for the allow list, which are
+// the users of the allow list and the public wildcards of their types, since those may grant them
+// the relation. It returns nil if there is no allow list. See WithUserAllowList.
+func allowListKeys(allowList []string) map[string]struct{} {
+	if allowList == nil {
+		return nil
+	}
+	keys := make(map[string]struct{}, 2*len(allowList))
+	for _, userKey := range allowList {
+		keys[userKey] = struct{}{}
+		if wildcardKey := typedWildcardKey(userKey); wildcardKey != "" {
+			keys[wildcardKey] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// allowedUsers returns the users of the allow list that the results show have the relation,
+// either directly or through a public wildcard of their type, in the order of the allow list.
+// See WithUserAllowList.
+func allowedUsers(results map[string]foundUser, allowList []string) []*openfgav1.User {
+	users := make([]*openfgav1.User, 0, len(allowList))
+	seen := make(map[string]struct{}, len(allowList))
+	for _, userKey := range allowList {
+		if _, ok := seen[userKey]; ok {
+			continue
+		}
+		seen[userKey] = struct{}{}
+
+		// a user found not to have the relation, such as one excluded from a wildcard, isn't
+		// covered by the wildcard
+		fu, found := results[userKey]
+		if !found {
+			if wildcardKey := typedWildcardKey(userKey); wildcardKey != "" {
+				fu, found = results[wildcardKey]
+			}
+		}
+		if found && fu.relationshipStatus == HasRelationship {
+			users = append(users, tuple.StringToUserProto(userKey))
+		}
+	}
+	return users
+}
@@ -0,0 +1,185 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_UserAllowList(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user]
+				define viewer: [user, user:*, group#member] but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"document:2#viewer@user:*",
+		"document:2#viewer@user:jon",
+		"document:2#blocked@user:will",
+		"document:3#viewer@user:a",
+		"document:3#viewer@user:b",
+		"document:3#viewer@user:c",
+		"document:3#viewer@user:d",
+		"document:3#viewer@user:jon",
+	})
+
+	listUsers := func(objectID string, userFilters []*openfgav1.UserTypeFilter, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: objectID},
+			Relation:    "viewer",
+			UserFilters: userFilters,
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+	users := []*openfgav1.UserTypeFilter{{Type: "user"}}
+
+	usersets := []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}}
+
+	tests := []struct {
+		name      string
+		objectID  string
+		filters   []*openfgav1.UserTypeFilter
+		allowList []string
+		expected  []string
+	}{
+		{
+			name:      "without_wildcard",
+			objectID:  "1",
+			filters:   users,
+			allowList: []string{"user:jon", "user:poovam", "user:maria", "user:jon"},
+			expected:  []string{"user:jon", "user:maria"},
+		},
+		{
+			// will is blocked, so the wildcard doesn't grant him the relation
+			name:      "covering_wildcard",
+			objectID:  "2",
+			filters:   users,
+			allowList: []string{"user:jon", "user:poovam", "user:will"},
+			expected:  []string{"user:jon", "user:poovam"},
+		},
+		{
+			name:      "wildcard_returned_if_allowed",
+			objectID:  "2",
+			filters:   users,
+			allowList: []string{"user:*"},
+			expected:  []string{"user:*"},
+		},
+		{
+			name:      "wildcard_not_granted",
+			objectID:  "1",
+			filters:   users,
+			allowList: []string{"user:*"},
+			expected:  []string{},
+		},
+		{
+			name:      "usersets",
+			objectID:  "1",
+			filters:   usersets,
+			allowList: []string{"group:eng#member", "group:fga#member", "user:jon"},
+			expected:  []string{"group:eng#member"},
+		},
+		{
+			name:     "no_allow_list",
+			objectID: "2",
+			filters:  users,
+			expected: []string{"user:*", "user:jon"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ElementsMatch(t, test.expected, listUsers(test.objectID, test.filters, WithUserAllowList(test.allowList...)))
+		})
+	}
+
+	t.Run("limits_count_allowed_users", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			opts     []ListUsersQueryOption
+			expected []string
+		}{
+			{
+				name:     "max_results",
+				opts:     []ListUsersQueryOption{WithListUsersMaxResults(1)},
+				expected: []string{"user:jon"},
+			},
+			{
+				// the size of a single user
+				name:     "max_response_bytes",
+				opts:     []ListUsersQueryOption{WithListUsersMaxResponseBytes(20)},
+				expected: []string{"user:jon"},
+			},
+			{
+				name:     "sample",
+				opts:     []ListUsersQueryOption{WithReservoirSample(1)},
+				expected: []string{"user:jon"},
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				for i := 0; i < 10; i++ {
+					opts := append([]ListUsersQueryOption{WithUserAllowList("user:jon")}, test.opts...)
+					require.Equal(t, test.expected, listUsers("3", users, opts...))
+				}
+			})
+		}
+	})
+
+	t.Run("redundant_users_of_the_allowed_users", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			allowList []string
+			expected  []string
+		}{
+			{
+				// the wildcard granting jon the relation isn't allowed, so it isn't in the response
+				name:      "wildcard_not_allowed",
+				allowList: []string{"user:jon"},
+				expected:  []string{},
+			},
+			{
+				name:      "wildcard_allowed",
+				allowList: []string{"user:jon", "user:poovam", "user:*"},
+				expected:  []string{"user:jon", "user:poovam"},
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				resp, err := NewListUsersQuery(ds, WithUserAllowList(test.allowList...), WithRedundantUsersAnnotation(true)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+					StoreId:     storeID,
+					Object:      &openfgav1.Object{Type: "document", Id: "2"},
+					Relation:    "viewer",
+					UserFilters: users,
+				})
+				require.NoError(t, err)
+				require.ElementsMatch(t, test.expected, userStrings(resp.GetMetadata().RedundantUsers))
+			})
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		var found []string
+		err := NewListUsersQuery(ds, WithUserAllowList("user:poovam", "user:jon")).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: users,
+		}, func(user *openfgav1.User) error {
+			found = append(found, userStrings([]*openfgav1.User{user})...)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"user:jon"}, found)
+	})
+}
@@ -0,0 +1,59 @@
+package listusers
+
+import (
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// AnyRelation is the relation of a user filter matching the usersets of every relation of its
+// type, such as "group#*" matching both "group:eng#member" and "group:eng#owner". A filter with an
+// empty relation still only matches the objects and public wildcards of its type.
+const AnyRelation = "*"
+
+// filterMatchesUsersetRelation reports whether f, of the same type as a userset, matches the
+// userset's relation.
+func filterMatchesUsersetRelation(f *openfgav1.UserTypeFilter, relation string) bool {
+	return relation != "" && (f.GetRelation() == relation || f.GetRelation() == AnyRelation)
+}
+
+// withAnyRelationFiltersExpanded returns req with each user filter whose relation is AnyRelation
+// replaced by a filter for every relation of its type, in the order of their names, so that the
+// filters are matched as if each relation was listed. req is returned as is if it has none.
+func withAnyRelationFiltersExpanded(typesys *typesystem.TypeSystem, req *openfgav1.ListUsersRequest) *openfgav1.ListUsersRequest {
+	hasAnyRelationFilter := false
+	for _, f := range req.GetUserFilters() {
+		if f.GetRelation() == AnyRelation {
+			hasAnyRelationFilter = true
+			break
+		}
+	}
+	if !hasAnyRelationFilter {
+		return req
+	}
+
+	userFilters := make([]*openfgav1.UserTypeFilter, 0, len(req.GetUserFilters()))
+	for _, f := range req.GetUserFilters() {
+		if f.GetRelation() != AnyRelation {
+			userFilters = append(userFilters, f)
+			continue
+		}
+
+		relations, _ := typesys.GetRelations(f.GetType())
+		names := make([]string, 0, len(relations))
+		for name := range relations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			userFilters = append(userFilters, &openfgav1.UserTypeFilter{Type: f.GetType(), Relation: name})
+		}
+	}
+
+	expanded := proto.Clone(req).(*openfgav1.ListUsersRequest)
+	expanded.UserFilters = userFilters
+	return expanded
+}
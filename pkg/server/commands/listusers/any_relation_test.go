@@ -0,0 +1,120 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersAnyRelationFilter(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define owner: [user]
+				define member: [user, group#member, group#owner]
+				define admin: owner
+		type document
+			relations
+				define viewer: [user, group#member, group#admin]
+				define editor: [user]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:ops#admin",
+		"group:eng#member@group:fga#member",
+		"group:eng#member@group:fga#owner",
+		"group:fga#member@user:maria",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	listUsers := func(t *testing.T, object *openfgav1.Object, relation string, userFilters ...*openfgav1.UserTypeFilter) []string {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      object,
+			Relation:    relation,
+			UserFilters: userFilters,
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	t.Run("every_userset_relation_emitted", func(t *testing.T) {
+		users := listUsers(t, &openfgav1.Object{Type: "document", Id: "1"}, "viewer",
+			&openfgav1.UserTypeFilter{Type: "group", Relation: AnyRelation})
+		require.ElementsMatch(t, []string{
+			"group:eng#member",
+			"group:fga#member",
+			"group:fga#owner",
+			"group:ops#admin",
+			// group:ops#admin is a computed userset of group:ops#owner
+			"group:ops#owner",
+		}, users)
+
+		// the same users as those of a filter for every relation of the type
+		require.ElementsMatch(t, users, listUsers(t, &openfgav1.Object{Type: "document", Id: "1"}, "viewer",
+			&openfgav1.UserTypeFilter{Type: "group", Relation: "admin"},
+			&openfgav1.UserTypeFilter{Type: "group", Relation: "member"},
+			&openfgav1.UserTypeFilter{Type: "group", Relation: "owner"},
+		))
+	})
+
+	t.Run("combined_with_type_filters", func(t *testing.T) {
+		users := listUsers(t, &openfgav1.Object{Type: "group", Id: "eng"}, "member",
+			&openfgav1.UserTypeFilter{Type: "user"},
+			&openfgav1.UserTypeFilter{Type: "group", Relation: AnyRelation})
+		require.ElementsMatch(t, []string{
+			"user:maria",
+			"group:eng#member",
+			"group:fga#member",
+			"group:fga#owner",
+		}, users)
+	})
+
+	t.Run("type_without_relations", func(t *testing.T) {
+		users := listUsers(t, &openfgav1.Object{Type: "document", Id: "1"}, "viewer",
+			&openfgav1.UserTypeFilter{Type: "user", Relation: AnyRelation})
+		require.Empty(t, users)
+	})
+
+	t.Run("has_user", func(t *testing.T) {
+		hasUser, err := NewListUsersQuery(ds).HasUser(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: AnyRelation}},
+		}, "group:fga#owner")
+		require.NoError(t, err)
+		require.True(t, hasUser)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		validate := func(filter *openfgav1.UserTypeFilter) error {
+			return ValidateListUsersRequest(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{filter},
+			}, typesys)
+		}
+		require.NoError(t, validate(&openfgav1.UserTypeFilter{Type: "group", Relation: AnyRelation}))
+		require.ErrorContains(t, validate(&openfgav1.UserTypeFilter{Type: "user", Relation: AnyRelation}), "defines none")
+	})
+}
@@ -0,0 +1,236 @@
+package listusers
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/internal/concurrency"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// ApproximateIntersectionConfig configures the memory-bounded evaluation of intersections. See
+// WithApproximateIntersection.
+type ApproximateIntersectionConfig struct {
+	Enabled bool
+
+	// Threshold is the number of users of an intersection operand held exactly. Past it, the
+	// users of the operand are only held in a Bloom filter.
+	Threshold uint32
+
+	// ExpectedUsers is the number of users an operand held in a Bloom filter is expected to
+	// have, which sizes the filter. The false positive rate grows past it.
+	ExpectedUsers uint32
+
+	// FalsePositiveRate is the probability, between 0 and 1, that a Bloom filter reports an
+	// operand has a user it doesn't have, when it holds ExpectedUsers users.
+	FalsePositiveRate float64
+}
+
+func (c ApproximateIntersectionConfig) valid() bool {
+	return c.Enabled && c.Threshold > 0 && c.ExpectedUsers > 0 &&
+		c.FalsePositiveRate > 0 && c.FalsePositiveRate < 1
+}
+
+// bloomFilter is a set of strings which may report it has strings that it doesn't have, but
+// never reports it doesn't have strings that it has.
+type bloomFilter struct {
+	bits   []uint64
+	hashes uint32
+}
+
+// newBloomFilter returns a bloomFilter sized for n strings and a false positive rate of p.
+func newBloomFilter(n uint32, p float64) *bloomFilter {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(n)*math.Ln2))
+	return &bloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint32(k),
+	}
+}
+
+// locations returns the bit locations of s, deriving them from a single hash with double hashing.
+func (f *bloomFilter) locations(s string, fn func(bit uint64)) {
+	h := xxhash.Sum64String(s)
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	size := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		fn((h1 + i*h2) % size)
+	}
+}
+
+func (f *bloomFilter) add(s string) {
+	f.locations(s, func(bit uint64) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	})
+}
+
+func (f *bloomFilter) mayContain(s string) bool {
+	found := true
+	f.locations(s, func(bit uint64) {
+		found = found && f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+	return found
+}
+
+// operandUsers holds the users returned by an intersection operand: exactly up to a threshold,
+// and in a Bloom filter past it. Wildcards are always held exactly, since there are only as many
+// of them as user types.
+type operandUsers struct {
+	config    ApproximateIntersectionConfig
+	exact     map[string]struct{}
+	filter    *bloomFilter
+	wildcards map[string]struct{}
+}
+
+func newOperandUsers(config ApproximateIntersectionConfig) *operandUsers {
+	return &operandUsers{
+		config:    config,
+		exact:     make(map[string]struct{}),
+		wildcards: make(map[string]struct{}),
+	}
+}
+
+func (o *operandUsers) add(key string) {
+	switch {
+	case tuple.IsTypedWildcard(key):
+		o.wildcards[key] = struct{}{}
+	case o.filter != nil:
+		o.filter.add(key)
+	default:
+		o.exact[key] = struct{}{}
+		if uint32(len(o.exact)) > o.config.Threshold {
+			o.filter = newBloomFilter(o.config.ExpectedUsers, o.config.FalsePositiveRate)
+			for key := range o.exact {
+				o.filter.add(key)
+			}
+			o.exact = nil
+		}
+	}
+}
+
+// has reports whether the operand returned the user, either directly or through a wildcard of
+// its type. It may report so falsely once the operand's users are held in a Bloom filter.
+func (o *operandUsers) has(key string) bool {
+	if _, ok := o.wildcards[typedWildcardKey(key)]; ok {
+		return true
+	}
+	if o.filter != nil {
+		return o.filter.mayContain(key)
+	}
+	_, ok := o.exact[key]
+	return ok
+}
+
+// enumerable reports whether every user satisfying the intersection is among the users held
+// exactly by the operand, which requires that none of them was returned through a wildcard.
+func (o *operandUsers) enumerable() bool {
+	return o.filter == nil && len(o.wildcards) == 0
+}
+
+// expandApproximateIntersection evaluates the intersection holding the users of each operand
+// exactly only up to a threshold, and in a Bloom filter past it. The users satisfying it are
+// taken from the smallest operand held exactly and checked against the other operands, so that
+// users may be returned falsely through the false positives of the filters, but are never
+// missed. It reports false, without sending any users, if no operand can list the candidate
+// users, in which case the intersection has to be evaluated exactly.
+func (l *listUsersQuery) expandApproximateIntersection(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	rewrite *openfgav1.Userset_Intersection,
+	foundUsersChan chan<- foundUser,
+) (expandResponse, bool) {
+	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+
+	childOperands := rewrite.Intersection.GetChild()
+	operands := make([]*operandUsers, len(childOperands))
+	intersectionFoundUsersChans := make([]chan foundUser, len(childOperands))
+	for i := range childOperands {
+		operands[i] = newOperandUsers(l.approximateIntersection)
+		intersectionFoundUsersChans[i] = make(chan foundUser, 1)
+	}
+
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	wg.Add(len(childOperands))
+
+	excludedUsersMap := make(map[string]struct{}, 0)
+	for i, foundUsersChan := range intersectionFoundUsersChans {
+		go func(operand *operandUsers, foundUsersChan chan foundUser) {
+			defer wg.Done()
+			for foundUser := range foundUsersChan {
+				for _, excludedUser := range foundUser.excludedUsers {
+					key := req.interner.userKey(excludedUser)
+					mu.Lock()
+					excludedUsersMap[key] = struct{}{}
+					mu.Unlock()
+				}
+				if foundUser.relationshipStatus == NoRelationship {
+					continue
+				}
+				operand.add(req.interner.userKey(foundUser.user))
+			}
+		}(operands[i], foundUsersChan)
+	}
+
+	for i, rewrite := range childOperands {
+		i := i
+		rewrite := rewrite
+		pool.Go(l.expansionTask(req, "intersection", func(ctx context.Context) error {
+			resp := l.expandRewrite(ctx, req, rewrite, intersectionFoundUsersChans[i])
+			return resp.err
+		}))
+	}
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		err := pool.Wait()
+		for i := range intersectionFoundUsersChans {
+			close(intersectionFoundUsersChans[i])
+		}
+		errChan <- err
+		close(errChan)
+	}()
+
+	wg.Wait()
+	err := <-errChan
+
+	var candidates *operandUsers
+	for _, operand := range operands {
+		if operand.enumerable() && (candidates == nil || len(operand.exact) < len(candidates.exact)) {
+			candidates = operand
+		}
+	}
+	if candidates == nil && err == nil {
+		return expandResponse{}, false
+	}
+
+	if candidates != nil {
+		excludedUsers := []*openfgav1.User{}
+		orderedRange(req.deterministic, excludedUsersMap, func(key string, _ struct{}) {
+			excludedUsers = append(excludedUsers, tuple.StringToUserProto(key))
+		})
+
+		orderedRange(req.deterministic, candidates.exact, func(key string, _ struct{}) {
+			for _, operand := range operands {
+				if operand != candidates && !operand.has(key) {
+					return
+				}
+			}
+			fu := foundUser{
+				user:          tuple.StringToUserProto(key),
+				excludedUsers: excludedUsers,
+			}
+			trySendResult(ctx, fu, foundUsersChan)
+		})
+	}
+
+	return expandResponse{
+		err: err,
+	}, true
+}
@@ -0,0 +1,153 @@
+package listusers
+
+import (
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+
+	for _, p := range []float64{0.01, 0.001} {
+		t.Run(fmt.Sprintf("false_positive_rate_%v", p), func(t *testing.T) {
+			filter := newBloomFilter(n, p)
+			for i := 0; i < n; i++ {
+				filter.add(fmt.Sprintf("user:%d", i))
+			}
+
+			for i := 0; i < n; i++ {
+				require.True(t, filter.mayContain(fmt.Sprintf("user:%d", i)))
+			}
+
+			falsePositives := 0
+			for i := n; i < 11*n; i++ {
+				if filter.mayContain(fmt.Sprintf("user:%d", i)) {
+					falsePositives++
+				}
+			}
+			require.LessOrEqual(t, float64(falsePositives)/(10*n), 2*p)
+		})
+	}
+
+	t.Run("false_positive_rate_grows_past_expected_users", func(t *testing.T) {
+		filter := newBloomFilter(n, 0.01)
+		for i := 0; i < 4*n; i++ {
+			filter.add(fmt.Sprintf("user:%d", i))
+		}
+
+		falsePositives := 0
+		for i := 4 * n; i < 14*n; i++ {
+			if filter.mayContain(fmt.Sprintf("user:%d", i)) {
+				falsePositives++
+			}
+		}
+		require.Greater(t, float64(falsePositives)/(10*n), 0.1)
+	})
+}
+
+func TestListUsersConfig_ApproximateIntersection(t *testing.T) {
+	const (
+		candidates = 1000
+		filtered   = 5000
+	)
+
+	// document:1 is only viewed by jon, but a returns fewer users than the threshold and is held exactly,
+	// while b returns more and is held in a Bloom filter, so the users of a are all checked
+	// against the filter and those it falsely reports are returned
+	tuples := make([]string, 0, candidates+filtered+6)
+	for i := 0; i < candidates; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#a@user:a-%d", i))
+	}
+	for i := 0; i < filtered; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#b@user:b-%d", i))
+	}
+	tuples = append(tuples,
+		"document:1#a@user:jon",
+		"document:1#b@user:jon",
+		"document:2#a@user:*",
+		"document:2#b@user:maria",
+		"document:2#b@user:will",
+		"document:2#b@user:andres",
+	)
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [user, user:*]
+				define b: [user]
+				define viewer: a and b`, tuples)
+
+	listUsers := func(document string, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: document},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	config := ApproximateIntersectionConfig{
+		Enabled:           true,
+		Threshold:         2 * candidates,
+		ExpectedUsers:     filtered,
+		FalsePositiveRate: 0.01,
+	}
+
+	t.Run("exact_by_default", func(t *testing.T) {
+		require.ElementsMatch(t, []string{"user:jon"}, listUsers("1"))
+	})
+
+	t.Run("error_rate", func(t *testing.T) {
+		users := listUsers("1", WithApproximateIntersection(config))
+		require.Contains(t, users, "user:jon")
+
+		falsePositives := len(users) - 1
+		require.LessOrEqual(t, float64(falsePositives)/candidates, 2*config.FalsePositiveRate)
+		for _, user := range users {
+			require.Regexp(t, `^user:(jon|a-\d+)$`, user)
+		}
+	})
+
+	t.Run("forced_exact", func(t *testing.T) {
+		require.ElementsMatch(t,
+			[]string{"user:jon"},
+			listUsers("1", WithApproximateIntersection(config), WithExactIntersection()),
+		)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := config
+		disabled.Enabled = false
+		require.ElementsMatch(t, []string{"user:jon"}, listUsers("1", WithApproximateIntersection(disabled)))
+	})
+
+	t.Run("all_operands_past_threshold", func(t *testing.T) {
+		small := config
+		small.Threshold = 10
+		require.ElementsMatch(t, []string{"user:jon"}, listUsers("1", WithApproximateIntersection(small)))
+	})
+
+	t.Run("wildcard_operand_with_other_operands_past_threshold", func(t *testing.T) {
+		small := config
+		small.Threshold = 2
+		require.ElementsMatch(t,
+			[]string{"user:maria", "user:will", "user:andres"},
+			listUsers("2", WithApproximateIntersection(small)),
+		)
+	})
+
+	t.Run("wildcard_operand_with_other_operands_held_exactly", func(t *testing.T) {
+		require.ElementsMatch(t,
+			[]string{"user:maria", "user:will", "user:andres"},
+			listUsers("2", WithApproximateIntersection(config)),
+		)
+	})
+}
@@ -0,0 +1,130 @@
+package listusers
+
+import (
+	"context"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// caseFolder maps types and relations, matched case-insensitively, to their casing in the
+// model. See WithCaseInsensitiveMatching.
+type caseFolder struct {
+	// types maps each lowercased type to its casing in the model
+	types map[string]string
+
+	// relations maps each type, in the model's casing, and lowercased relation to the
+	// relation's casing in the model
+	relations map[string]map[string]string
+}
+
+func newCaseFolder(typesys *typesystem.TypeSystem) *caseFolder {
+	allRelations := typesys.GetAllRelations()
+	f := &caseFolder{
+		types:     make(map[string]string, len(allRelations)),
+		relations: make(map[string]map[string]string, len(allRelations)),
+	}
+	for objectType, relations := range allRelations {
+		f.types[strings.ToLower(objectType)] = objectType
+		f.relations[objectType] = make(map[string]string, len(relations))
+		for relation := range relations {
+			f.relations[objectType][strings.ToLower(relation)] = relation
+		}
+	}
+	return f
+}
+
+// objectType returns the model's casing of objectType, or objectType itself if the model doesn't
+// define it in any casing.
+func (f *caseFolder) objectType(objectType string) string {
+	if canonical, ok := f.types[strings.ToLower(objectType)]; ok {
+		return canonical
+	}
+	return objectType
+}
+
+// relation returns the model's casing of the relation of objectType, which must already be in
+// the model's casing, or relation itself if the model doesn't define it in any casing.
+func (f *caseFolder) relation(objectType, relation string) string {
+	if canonical, ok := f.relations[objectType][strings.ToLower(relation)]; ok {
+		return canonical
+	}
+	return relation
+}
+
+// user returns user, an object, a userset or a typed wildcard, with its type and relation in the
+// model's casing. Object IDs are case-sensitive, so they are left as they are. A user that doesn't
+// parse cleanly is left as it is too, so that it is still skipped rather than made valid.
+func (f *caseFolder) user(user string) string {
+	objectType, objectID, relation, ok := parseTupleUser(user)
+	if !ok {
+		return user
+	}
+
+	objectType = f.objectType(objectType)
+	if relation == "" {
+		return tuple.BuildObject(objectType, objectID)
+	}
+	return tuple.ToObjectRelationString(tuple.BuildObject(objectType, objectID), f.relation(objectType, relation))
+}
+
+// request returns a copy of req with the types and relations of its object and user filters in
+// the model's casing.
+func (f *caseFolder) request(req *openfgav1.ListUsersRequest) *openfgav1.ListUsersRequest {
+	objectType := f.objectType(req.GetObject().GetType())
+	userFilters := make([]*openfgav1.UserTypeFilter, 0, len(req.GetUserFilters()))
+	for _, userFilter := range req.GetUserFilters() {
+		filterType := f.objectType(userFilter.GetType())
+		filterRelation := userFilter.GetRelation()
+		if filterRelation != "" {
+			filterRelation = f.relation(filterType, filterRelation)
+		}
+		userFilters = append(userFilters, &openfgav1.UserTypeFilter{Type: filterType, Relation: filterRelation})
+	}
+
+	return &openfgav1.ListUsersRequest{
+		StoreId:              req.GetStoreId(),
+		AuthorizationModelId: req.GetAuthorizationModelId(),
+		Object:               &openfgav1.Object{Type: objectType, Id: req.GetObject().GetId()},
+		Relation:             f.relation(objectType, req.GetRelation()),
+		UserFilters:          userFilters,
+		ContextualTuples:     req.GetContextualTuples(),
+		Context:              req.GetContext(),
+		Consistency:          req.GetConsistency(),
+	}
+}
+
+// caseFoldingTupleIterator puts the users of the tuples of an iterator in the model's casing.
+type caseFoldingTupleIterator struct {
+	storage.TupleIterator
+	folder *caseFolder
+}
+
+var _ storage.TupleIterator = (*caseFoldingTupleIterator)(nil)
+
+func (c *caseFoldingTupleIterator) Next(ctx context.Context) (*openfgav1.Tuple, error) {
+	t, err := c.TupleIterator.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := c.folder.user(t.GetKey().GetUser())
+	if user == t.GetKey().GetUser() {
+		return t, nil
+	}
+
+	// the tuple may be shared with the datastore or a cache, so it is copied rather than changed
+	return &openfgav1.Tuple{
+		Key: &openfgav1.TupleKey{
+			Object:    t.GetKey().GetObject(),
+			Relation:  t.GetKey().GetRelation(),
+			User:      user,
+			Condition: t.GetKey().GetCondition(),
+		},
+		Timestamp: t.GetTimestamp(),
+	}, nil
+}
@@ -0,0 +1,109 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_CaseInsensitiveMatching(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@User:Jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@GROUP:eng#Member",
+		"document:1#parent@Folder:x",
+		"group:eng#member@uSeR:will",
+		"group:eng#member@User:*",
+		"folder:x#viewer@USER:poovam",
+	})
+
+	tests := []struct {
+		name     string
+		req      *openfgav1.ListUsersRequest
+		opts     []ListUsersQueryOption
+		expected []string
+	}{
+		{
+			name: "mixed_case_tuples_missed_by_default",
+			req: &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			expected: []string{"user:maria"},
+		},
+		{
+			// users are returned in the model's casing, and their IDs are left as they are
+			name: "mixed_case_tuples_matched",
+			req: &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			opts:     []ListUsersQueryOption{WithCaseInsensitiveMatching(true)},
+			expected: []string{"user:Jon", "user:maria", "user:will", "user:*", "user:poovam"},
+		},
+		{
+			name: "usersets_returned_in_model_casing",
+			req: &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			},
+			opts:     []ListUsersQueryOption{WithCaseInsensitiveMatching(true)},
+			expected: []string{"group:eng#member"},
+		},
+		{
+			name: "mixed_case_request_matched",
+			req: &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "Document", Id: "1"},
+				Relation:    "VIEWER",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "User"}},
+			},
+			opts:     []ListUsersQueryOption{WithCaseInsensitiveMatching(true)},
+			expected: []string{"user:Jon", "user:maria", "user:will", "user:*", "user:poovam"},
+		},
+		{
+			name: "contextual_tuples_matched",
+			req: &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "2"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+				ContextualTuples: []*openfgav1.TupleKey{
+					tuple.NewTupleKey("document:2", "viewer", "User:andres"),
+				},
+			},
+			opts:     []ListUsersQueryOption{WithCaseInsensitiveMatching(true)},
+			expected: []string{"user:andres"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, test.opts...).ListUsers(ctx, test.req)
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+		})
+	}
+}
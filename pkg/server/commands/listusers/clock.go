@@ -0,0 +1,43 @@
+package listusers
+
+import (
+	"time"
+)
+
+// Clock tells the time and starts the timers that ListUsers waits on, so that tests can control
+// time. See WithClock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer started by a Clock. See time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent once the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, and reports whether it did.
+	Stop() bool
+}
+
+// realClock is the Clock of the system's time.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
@@ -0,0 +1,171 @@
+package listusers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	started chan struct{} // receives each time a timer is started
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		started: make(chan struct{}, 100),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.started <- struct{}{}
+	return t
+}
+
+// Advance moves the time forward by d, firing the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// waitForTimer blocks until a timer is started.
+func (c *fakeClock) waitForTimer(t *testing.T) {
+	select {
+	case <-c.started:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "expected a timer to be started")
+	}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestListUsersConfig_Clock(t *testing.T) {
+	const numGroups = 3
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+
+	t.Run("throttled_reads_wait_for_the_clock", func(t *testing.T) {
+		clock := newFakeClock()
+		limiter := NewStoreReadRateLimiter(1, 1)
+
+		done := make(chan *listUsersResponse, 1)
+		go func() {
+			resp, err := NewListUsersQuery(ds,
+				WithClock(clock),
+				WithPerStoreReadRate(limiter),
+				WithResolveNodeBreadthLimit(1),
+			).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+			done <- resp
+		}()
+
+		// the first read is allowed right away, and each group's members are then read one
+		// second apart
+		for i := 0; i < numGroups; i++ {
+			clock.waitForTimer(t)
+			select {
+			case <-done:
+				require.FailNow(t, "expected the reads to wait for the clock")
+			default:
+			}
+			clock.Advance(time.Second)
+		}
+
+		select {
+		case resp := <-done:
+			require.Len(t, resp.GetUsers(), numGroups)
+			require.Equal(t, uint32(1+numGroups), resp.GetMetadata().DatastoreQueryCount)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "expected the request to complete")
+		}
+	})
+
+	t.Run("tokens_refill_as_the_clock_advances", func(t *testing.T) {
+		clock := newFakeClock()
+		limiter := NewStoreReadRateLimiter(1, numGroups+1)
+
+		listUsers := func() {
+			_, err := NewListUsersQuery(ds, WithClock(clock), WithPerStoreReadRate(limiter)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+		}
+
+		// the burst covers all the reads of a request, and is refilled once enough time passes
+		listUsers()
+		clock.Advance((numGroups + 1) * time.Second)
+		listUsers()
+		require.Empty(t, clock.started)
+	})
+}
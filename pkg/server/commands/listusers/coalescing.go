@@ -0,0 +1,143 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/openfga/openfga/internal/build"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+var coalescedRequestsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: build.ProjectName,
+	Name:      "list_users_coalesced_requests_count",
+	Help:      "Number of ListUsers requests that shared the expansion of an identical request in flight rather than expanding on their own",
+})
+
+// coalescedCall is an expansion shared by the identical requests made while it is in flight.
+type coalescedCall struct {
+	done chan struct{}
+	resp *listUsersResponse
+	err  error
+
+	// waiters is the number of requests waiting on the expansion, and cancel cancels it once they
+	// have all given up on it. Guarded by the lock of coalescedCalls.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalescedCallKey identifies a request among the requests with coalescing enabled. Queries
+// reading from different datastores never share an expansion.
+type coalescedCallKey struct {
+	ds      storage.RelationshipTupleReader
+	request string
+}
+
+// coalescedCalls holds the expansions in flight of the requests with coalescing enabled, by
+// request key. It is shared by every query, since each query serves a single request.
+var coalescedCalls = struct {
+	sync.Mutex
+	calls map[coalescedCallKey]*coalescedCall
+}{calls: make(map[coalescedCallKey]*coalescedCall)}
+
+// coalescingKey returns the key identifying req among the requests with coalescing enabled, and
+// whether req may be coalesced at all. The requests with contextual tuples or a context depend on
+// more than the stored tuples, and those with higher consistency expect reads made after they
+// were received, so they are never coalesced. Neither are the requests passing on the users as
+// they are found or returning pages, since those are specific to each request, nor those of a
+// query whose datastore can't be told apart from the others.
+func (l *listUsersQuery) coalescingKey(ctx context.Context, req *openfgav1.ListUsersRequest) (coalescedCallKey, bool) {
+	if len(req.GetContextualTuples()) > 0 || len(req.GetContext().GetFields()) > 0 ||
+		req.GetConsistency() == openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY ||
+		l.onFoundUser != nil || l.pageSize > 0 || l.progress != nil {
+		return coalescedCallKey{}, false
+	}
+	if l.ds == nil || !reflect.TypeOf(l.ds).Comparable() {
+		return coalescedCallKey{}, false
+	}
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return coalescedCallKey{}, false
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s/%s/%s#%s@", req.GetStoreId(), typesys.GetAuthorizationModelID(), tuple.ObjectKey(req.GetObject()), req.GetRelation())
+	for _, f := range req.GetUserFilters() {
+		fmt.Fprintf(&key, "%s#%s,", f.GetType(), f.GetRelation())
+	}
+	return coalescedCallKey{ds: l.ds, request: key.String()}, true
+}
+
+// coalescedListUsers returns the response of the expansion in flight of an identical request, if
+// any, or expands req and shares its response with the identical requests made in the meantime.
+// The expansion isn't cancelled by the request that started it, since others may be waiting on it,
+// but once every request waiting on it is done, so it is bounded by the latest of their deadlines
+// as well as by the deadline of the query. A request returns ctx.Err() if ctx is done first. Each
+// request gets its own copy of the response.
+func (l *listUsersQuery) coalescedListUsers(ctx context.Context, key coalescedCallKey, req *openfgav1.ListUsersRequest) (*listUsersResponse, error) {
+	coalescedCalls.Lock()
+	call, inFlight := coalescedCalls.calls[key]
+	if !inFlight {
+		expandCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		coalescedCalls.calls[key] = call
+
+		go func() {
+			defer func() {
+				coalescedCalls.Lock()
+				call.remove(key)
+				coalescedCalls.Unlock()
+				close(call.done)
+			}()
+			defer recoverPanic(&call.err)
+			call.resp, call.err = l.listUsers(expandCtx, req)
+		}()
+	}
+	call.waiters++
+	coalescedCalls.Unlock()
+
+	if inFlight {
+		coalescedRequestsCounter.Inc()
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		coalescedCalls.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// the identical requests made from now on start another expansion
+			call.remove(key)
+		}
+		coalescedCalls.Unlock()
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	resp := call.resp.clone()
+	if inFlight {
+		// the datastore was only queried for the request that started the expansion
+		resp.Metadata.DatastoreQueryCount = 0
+	}
+	return resp, nil
+}
+
+// remove removes the call from the calls in flight, unless another expansion replaced it already,
+// and cancels its expansion. It must be called with the lock of coalescedCalls held.
+func (c *coalescedCall) remove(key coalescedCallKey) {
+	if coalescedCalls.calls[key] == c {
+		delete(coalescedCalls.calls, key)
+	}
+	c.cancel()
+}
@@ -0,0 +1,216 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// gatedDatastore counts the reads and holds them until released.
+type gatedDatastore struct {
+	storage.OpenFGADatastore
+
+	reads   atomic.Int32
+	release chan struct{}
+}
+
+func (s *gatedDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	s.reads.Add(1)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+}
+
+func TestListUsersConfig_RequestCoalescing(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:will",
+		"group:eng#member@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	// the reads of a single expansion
+	ungatedDS := &gatedDatastore{OpenFGADatastore: ds, release: make(chan struct{})}
+	close(ungatedDS.release)
+	_, err := NewListUsersQuery(ungatedDS).ListUsers(ctx, req)
+	require.NoError(t, err)
+	expansionReads := ungatedDS.reads.Load()
+
+	// listConcurrently makes count identical requests, the first of which with leaderCtx, and
+	// releases the reads once every other request waits on the expansion of the first one.
+	listConcurrently := func(t *testing.T, leaderCtx context.Context, count int) (*gatedDatastore, []*listUsersResponse, []error) {
+		gatedDS := &gatedDatastore{OpenFGADatastore: ds, release: make(chan struct{})}
+		coalescedBefore := promtestutil.ToFloat64(coalescedRequestsCounter)
+
+		responses := make([]*listUsersResponse, count)
+		errs := make([]error, count)
+		var wg sync.WaitGroup
+		for i := 0; i < count; i++ {
+			requestCtx := ctx
+			if i == 0 {
+				requestCtx = leaderCtx
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responses[i], errs[i] = NewListUsersQuery(gatedDS, WithRequestCoalescing(true)).ListUsers(requestCtx, req)
+			}()
+			if i == 0 {
+				require.Eventually(t, func() bool { return gatedDS.reads.Load() > 0 }, time.Second, time.Millisecond)
+			}
+		}
+		require.Eventually(t, func() bool {
+			return promtestutil.ToFloat64(coalescedRequestsCounter)-coalescedBefore == float64(count-1)
+		}, time.Second, time.Millisecond)
+
+		close(gatedDS.release)
+		wg.Wait()
+		return gatedDS, responses, errs
+	}
+
+	t.Run("identical_requests_share_one_expansion", func(t *testing.T) {
+		gatedDS, responses, errs := listConcurrently(t, ctx, 20)
+		for i := range responses {
+			require.NoError(t, errs[i])
+			require.ElementsMatch(t, []string{"user:jon", "user:will", "user:maria"}, userStrings(responses[i].GetUsers()))
+		}
+		require.Equal(t, expansionReads, gatedDS.reads.Load())
+
+		// each request gets its own copy of the response
+		responses[0].Users[0].GetObject().Id = "changed"
+		for i := 1; i < len(responses); i++ {
+			require.ElementsMatch(t, []string{"user:jon", "user:will", "user:maria"}, userStrings(responses[i].GetUsers()))
+		}
+	})
+
+	t.Run("expansion_cancelled_once_every_request_is_done", func(t *testing.T) {
+		// the reads are never released, so the expansion only ends once it is cancelled
+		gatedDS := &gatedDatastore{OpenFGADatastore: ds, release: make(chan struct{})}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			requestCtx, cancel := context.WithTimeout(ctx, time.Duration(i+1)*10*time.Millisecond)
+			defer cancel()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = NewListUsersQuery(gatedDS, WithRequestCoalescing(true)).ListUsers(requestCtx, req)
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+
+		require.Eventually(t, func() bool {
+			coalescedCalls.Lock()
+			defer coalescedCalls.Unlock()
+			return len(coalescedCalls.calls) == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("expansion_outlives_the_request_starting_it", func(t *testing.T) {
+		leaderCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			cancel()
+		}()
+		defer cancel()
+
+		gatedDS, responses, errs := listConcurrently(t, leaderCtx, 3)
+		for i := 1; i < len(responses); i++ {
+			require.NoError(t, errs[i])
+			require.ElementsMatch(t, []string{"user:jon", "user:will", "user:maria"}, userStrings(responses[i].GetUsers()))
+		}
+		require.Equal(t, expansionReads, gatedDS.reads.Load())
+	})
+
+	t.Run("request_specific_inputs_not_coalesced", func(t *testing.T) {
+		q := NewListUsersQuery(ds, WithRequestCoalescing(true))
+		_, ok := q.coalescingKey(ctx, req)
+		require.True(t, ok)
+
+		withContextualTuples := &openfgav1.ListUsersRequest{
+			StoreId:          storeID,
+			Object:           req.GetObject(),
+			Relation:         req.GetRelation(),
+			UserFilters:      req.GetUserFilters(),
+			ContextualTuples: []*openfgav1.TupleKey{tuple.NewTupleKey("document:1", "viewer", "user:anne")},
+		}
+		_, ok = q.coalescingKey(ctx, withContextualTuples)
+		require.False(t, ok)
+
+		requestContext, err := structpb.NewStruct(map[string]any{"ip": "10.0.0.1"})
+		require.NoError(t, err)
+		withContext := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      req.GetObject(),
+			Relation:    req.GetRelation(),
+			UserFilters: req.GetUserFilters(),
+			Context:     requestContext,
+		}
+		_, ok = q.coalescingKey(ctx, withContext)
+		require.False(t, ok)
+
+		withHigherConsistency := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      req.GetObject(),
+			Relation:    req.GetRelation(),
+			UserFilters: req.GetUserFilters(),
+			Consistency: openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY,
+		}
+		_, ok = q.coalescingKey(ctx, withHigherConsistency)
+		require.False(t, ok)
+	})
+
+	t.Run("different_requests_not_coalesced", func(t *testing.T) {
+		q := NewListUsersQuery(ds, WithRequestCoalescing(true))
+		key, _ := q.coalescingKey(ctx, req)
+		otherKey, _ := q.coalescingKey(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "2"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NotEqual(t, key, otherKey)
+
+		// nor are the requests read from different datastores
+		otherDSKey, _ := NewListUsersQuery(&gatedDatastore{OpenFGADatastore: ds}, WithRequestCoalescing(true)).coalescingKey(ctx, req)
+		require.NotEqual(t, key, otherDSKey)
+	})
+}
@@ -0,0 +1,139 @@
+package listusers
+
+import (
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+func TestListUsersMetadata_Complete(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:anne",
+		"document:1#viewer@group:eng#member",
+		"document:1#editor@user:jon",
+		"group:eng#member@user:will",
+		"group:eng#member@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+	// blockedDS holds every read until the request ends
+	blockedDS := func() storage.RelationshipTupleReader {
+		return &gatedDatastore{OpenFGADatastore: ds, release: make(chan struct{})}
+	}
+
+	t.Run("full_listing", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 4)
+		require.True(t, resp.Metadata.Complete)
+	})
+
+	t.Run("no_possible_edges", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "editor",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+		})
+		require.NoError(t, err)
+		require.True(t, resp.Metadata.NoPossibleEdges)
+		require.True(t, resp.Metadata.Complete)
+	})
+
+	truncated := []struct {
+		name string
+		ds   storage.RelationshipTupleReader
+		opts []ListUsersQueryOption
+	}{
+		{
+			name: "max_results",
+			ds:   ds,
+			opts: []ListUsersQueryOption{WithListUsersMaxResults(2)},
+		},
+		{
+			name: "max_response_bytes",
+			ds:   ds,
+			opts: []ListUsersQueryOption{WithListUsersMaxResponseBytes(20)},
+		},
+		{
+			name: "deadline",
+			ds:   blockedDS(),
+			opts: []ListUsersQueryOption{WithListUsersDeadline(10 * time.Millisecond)},
+		},
+		{
+			name: "max_expansion_duration",
+			ds:   blockedDS(),
+			opts: []ListUsersQueryOption{
+				WithMaxExpansionDuration(10 * time.Millisecond),
+				WithMaxExpansionDurationPartialResults(true),
+			},
+		},
+		{
+			name: "relation_recursion_cap",
+			ds:   ds,
+			opts: []ListUsersQueryOption{WithRelationRecursionCap(map[string]uint32{"group#member": 1})},
+		},
+	}
+	for _, test := range truncated {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(test.ds, test.opts...).ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.Less(t, len(resp.GetUsers()), 4)
+			require.False(t, resp.Metadata.Complete)
+		})
+	}
+
+	t.Run("pages_of_a_complete_listing", func(t *testing.T) {
+		q := NewListUsersQuery(ds, WithPaging(NewUserPages(time.Minute, 0), 3))
+		resp, err := q.ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.True(t, resp.Metadata.Complete)
+
+		next, err := q.ListUsersNextPage(ctx, req, resp.Metadata.NextPageHandle)
+		require.NoError(t, err)
+		require.Len(t, next.GetUsers(), 1)
+		require.True(t, next.Metadata.Complete)
+	})
+
+	t.Run("pages_of_a_truncated_listing", func(t *testing.T) {
+		q := NewListUsersQuery(ds, WithPaging(NewUserPages(time.Minute, 0), 1), WithRelationRecursionCap(map[string]uint32{"group#member": 1}))
+		resp, err := q.ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.False(t, resp.Metadata.Complete)
+
+		next, err := q.ListUsersNextPage(ctx, req, resp.Metadata.NextPageHandle)
+		require.NoError(t, err)
+		require.False(t, next.Metadata.Complete)
+	})
+
+	t.Run("relations_complete_if_all_are", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsersForRelations(ctx, req, "viewer", "editor")
+		require.NoError(t, err)
+		require.True(t, resp.Metadata.Complete)
+
+		resp, err = NewListUsersQuery(ds, WithRelationRecursionCap(map[string]uint32{"group#member": 1})).
+			ListUsersForRelations(ctx, req, "viewer", "editor")
+		require.NoError(t, err)
+		require.False(t, resp.Metadata.Complete)
+	})
+}
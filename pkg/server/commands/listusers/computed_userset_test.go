@@ -0,0 +1,145 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersComputedUsersetOfTargetObject(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user, document#viewer]
+				define viewer: editor
+				define reader: viewer`, []string{
+		"document:1#editor@user:jon",
+		"document:1#editor@document:2#viewer",
+		"document:2#editor@user:maria",
+		"document:3#editor@document:3#viewer",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	checker := graph.NewLocalChecker()
+	t.Cleanup(checker.Close)
+
+	check := func(t *testing.T, object, relation, user string) bool {
+		resp, err := checker.ResolveCheck(
+			storage.ContextWithRelationshipTupleReader(ctx, ds),
+			&graph.ResolveCheckRequest{
+				StoreID:              storeID,
+				AuthorizationModelID: model.GetId(),
+				TupleKey:             tuple.NewTupleKey(object, relation, user),
+				RequestMetadata:      graph.NewCheckRequestMetadata(25),
+			})
+		require.NoError(t, err)
+		return resp.GetAllowed()
+	}
+
+	tests := []struct {
+		name          string
+		object        string
+		relation      string
+		filter        string
+		expectedUsers []string
+	}{
+		{
+			// the target object's userset is emitted for the relation that was requested, even
+			// though the relation is rewritten to editor before any tuple is read
+			name:          "viewer_usersets_of_viewer",
+			object:        "document:1",
+			relation:      "viewer",
+			filter:        "viewer",
+			expectedUsers: []string{"document:1#viewer", "document:2#viewer"},
+		},
+		{
+			// the target object's viewer userset isn't an editor of it unless a tuple makes it one
+			name:          "viewer_usersets_of_editor",
+			object:        "document:1",
+			relation:      "editor",
+			filter:        "viewer",
+			expectedUsers: []string{"document:2#viewer"},
+		},
+		{
+			name:          "viewer_usersets_of_editor_through_own_viewers",
+			object:        "document:3",
+			relation:      "editor",
+			filter:        "viewer",
+			expectedUsers: []string{"document:3#viewer"},
+		},
+		{
+			// every viewer of the target object is a reader of it, so its viewer userset is too
+			name:          "viewer_usersets_of_reader",
+			object:        "document:1",
+			relation:      "reader",
+			filter:        "viewer",
+			expectedUsers: []string{"document:1#viewer", "document:2#viewer"},
+		},
+		{
+			// document:2#viewer is rewritten to document:2#editor, which is then emitted too
+			name:          "editor_usersets_of_viewer",
+			object:        "document:1",
+			relation:      "viewer",
+			filter:        "editor",
+			expectedUsers: []string{"document:1#editor", "document:2#editor"},
+		},
+		{
+			name:          "reader_usersets_of_viewer",
+			object:        "document:1",
+			relation:      "viewer",
+			filter:        "reader",
+			expectedUsers: []string{},
+		},
+	}
+
+	candidates := []string{
+		"document:1#viewer", "document:2#viewer", "document:3#viewer",
+		"document:1#editor", "document:2#editor",
+		"document:1#reader", "document:2#reader",
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objectType, objectID := tuple.SplitObject(test.object)
+			resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: objectType, Id: objectID},
+				Relation:    test.relation,
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "document", Relation: test.filter}},
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+
+			// the usersets must be exactly those that Check considers to have the relation
+			var allowed []string
+			for _, candidate := range candidates {
+				if tuple.GetRelation(candidate) == test.filter && check(t, test.object, test.relation, candidate) {
+					allowed = append(allowed, candidate)
+				}
+			}
+			require.ElementsMatch(t, allowed, test.expectedUsers)
+		})
+	}
+}
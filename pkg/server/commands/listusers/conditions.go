@@ -0,0 +1,125 @@
+package listusers
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// UserConditions are the conditions under which a user has the relation through one path from
+// the object to the user: the conditions of the conditioned tuples along the path, all of which
+// must hold. See WithUserConditions.
+type UserConditions struct {
+	// Conditions are the names of the conditions. Sorted.
+	Conditions []string
+
+	// Parameters are the names of the parameters of the conditions. Sorted.
+	Parameters []string
+}
+
+// userConditionsRecorder records the conditions along the paths through which the users are
+// found. It is safe for concurrent use.
+type userConditionsRecorder struct {
+	mu sync.Mutex
+
+	// paths maps each user to the conditions of each path it was found through, keyed by the
+	// comma separated conditions
+	paths map[string]map[string][]string
+
+	// unconditional are the users found through a path without conditions
+	unconditional map[string]struct{}
+}
+
+func newUserConditionsRecorder() *userConditionsRecorder {
+	return &userConditionsRecorder{
+		paths:         make(map[string]map[string][]string),
+		unconditional: make(map[string]struct{}),
+	}
+}
+
+// record records that the user was found through a path with the conditions. A nil recorder
+// records nothing.
+func (r *userConditionsRecorder) record(user *openfgav1.User, conditions []string) {
+	if r == nil {
+		return
+	}
+
+	userKey := tuple.UserProtoToString(user)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(conditions) == 0 {
+		r.unconditional[userKey] = struct{}{}
+		return
+	}
+
+	conditions = slices.Clone(conditions)
+	sort.Strings(conditions)
+	conditions = slices.Compact(conditions)
+	if r.paths[userKey] == nil {
+		r.paths[userKey] = make(map[string][]string)
+	}
+	r.paths[userKey][strings.Join(conditions, ",")] = conditions
+}
+
+// conditions returns the conditions of the paths through which each of the users was found,
+// keyed by user. The users found through a path without conditions are left out, since they
+// have the relation whatever the conditions of the other paths.
+func (r *userConditionsRecorder) conditions(typesys *typesystem.TypeSystem, users []*openfgav1.User) map[string][]UserConditions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[string][]UserConditions)
+	for _, user := range users {
+		userKey := tuple.UserProtoToString(user)
+		if _, ok := r.unconditional[userKey]; ok {
+			continue
+		}
+
+		paths, ok := r.paths[userKey]
+		if !ok {
+			continue
+		}
+
+		pathKeys := make([]string, 0, len(paths))
+		for pathKey := range paths {
+			pathKeys = append(pathKeys, pathKey)
+		}
+		sort.Strings(pathKeys)
+
+		for _, pathKey := range pathKeys {
+			conditions := paths[pathKey]
+
+			var parameters []string
+			for _, name := range conditions {
+				if evaluableCondition, ok := typesys.GetCondition(name); ok {
+					for parameter := range evaluableCondition.GetParameters() {
+						parameters = append(parameters, parameter)
+					}
+				}
+			}
+			sort.Strings(parameters)
+
+			result[userKey] = append(result[userKey], UserConditions{
+				Conditions: conditions,
+				Parameters: slices.Compact(parameters),
+			})
+		}
+	}
+	return result
+}
+
+// withCondition returns the conditions along a path followed by a tuple with the condition, if
+// any. The conditions along the path it branches off from are left as they are.
+func withCondition(pathConditions []string, condition *openfgav1.RelationshipCondition) []string {
+	if condition.GetName() == "" {
+		return pathConditions
+	}
+	return append(slices.Clip(pathConditions), condition.GetName())
+}
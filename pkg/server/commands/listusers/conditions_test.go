@@ -0,0 +1,97 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_UserConditions(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user with ip_in_range]
+		type folder
+			relations
+				define viewer: [user, group#member, group#member with grant_active]
+		type document
+			relations
+				define parent: [folder, folder with grant_active]
+				define editor: [user]
+				define viewer: [user, user with grant_active] or viewer from parent
+				define can_edit: viewer and editor
+		condition grant_active(active: bool) {
+			active
+		}
+		condition ip_in_range(in_range: bool) {
+			in_range
+		}`, nil)
+	err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:anne", "grant_active", nil),
+		tuple.NewTupleKey("document:1", "parent", "folder:x"),
+		tuple.NewTupleKeyWithCondition("folder:x", "viewer", "group:eng#member", "grant_active", nil),
+		tuple.NewTupleKeyWithCondition("group:eng", "member", "user:anne", "ip_in_range", nil),
+		tuple.NewTupleKeyWithCondition("group:eng", "member", "user:bob", "ip_in_range", nil),
+		tuple.NewTupleKey("folder:x", "viewer", "user:jon"),
+		tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:y", "grant_active", nil),
+		tuple.NewTupleKey("folder:y", "viewer", "user:carl"),
+		tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "grant_active", nil),
+		tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
+	})
+	require.NoError(t, err)
+
+	reqContext, err := structpb.NewStruct(map[string]interface{}{"active": true, "in_range": true})
+	require.NoError(t, err)
+
+	listUsers := func(relation string, opts ...ListUsersQueryOption) (*listUsersResponse, error) {
+		return NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			Context:     reqContext,
+		})
+	}
+
+	t.Run("conditions_along_direct_and_ttu_paths", func(t *testing.T) {
+		resp, err := listUsers("viewer", WithUserConditions(true))
+		require.NoError(t, err)
+		require.ElementsMatch(t,
+			[]string{"user:anne", "user:bob", "user:jon", "user:carl", "user:maria"},
+			userStrings(resp.GetUsers()),
+		)
+
+		// jon and maria have the relation through a path without conditions
+		require.Equal(t, map[string][]UserConditions{
+			"user:anne": {
+				{Conditions: []string{"grant_active"}, Parameters: []string{"active"}},
+				{Conditions: []string{"grant_active", "ip_in_range"}, Parameters: []string{"active", "in_range"}},
+			},
+			"user:bob": {
+				{Conditions: []string{"grant_active", "ip_in_range"}, Parameters: []string{"active", "in_range"}},
+			},
+			"user:carl": {
+				{Conditions: []string{"grant_active"}, Parameters: []string{"active"}},
+			},
+		}, resp.GetMetadata().UserConditions)
+	})
+
+	t.Run("not_reported_by_default", func(t *testing.T) {
+		resp, err := listUsers("viewer")
+		require.NoError(t, err)
+		require.Nil(t, resp.GetMetadata().UserConditions)
+	})
+
+	t.Run("intersection_unsupported", func(t *testing.T) {
+		_, err := listUsers("can_edit", WithUserConditions(true))
+		require.ErrorIs(t, err, ErrUserConditionsUnsupported)
+	})
+}
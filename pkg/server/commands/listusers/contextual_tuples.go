@@ -0,0 +1,127 @@
+package listusers
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// contextualTupleIndex indexes the contextual tuples of a request by their object and relation,
+// so that each read only goes through the contextual tuples it matches.
+type contextualTupleIndex map[string][]*openfgav1.TupleKey
+
+func newContextualTupleIndex(contextualTuples []*openfgav1.TupleKey) contextualTupleIndex {
+	index := make(contextualTupleIndex, len(contextualTuples))
+	for _, ctk := range contextualTuples {
+		key := tuple.ToObjectRelationString(ctk.GetObject(), ctk.GetRelation())
+		index[key] = append(index[key], ctk)
+	}
+	return index
+}
+
+// matching returns the contextual tuples with the object and relation of tk.
+func (c contextualTupleIndex) matching(tk *openfgav1.TupleKey) []*openfgav1.TupleKey {
+	return c[tuple.ToObjectRelationString(tk.GetObject(), tk.GetRelation())]
+}
+
+// readWithContextualTuples reads the tuples matching the object and relation of tk from both the
+// contextual tuples and the datastore, following the same precedence rules as Check:
+//   - when shadowUsers is set, a contextual tuple assigning a concrete user (not a userset nor a
+//     wildcard) shadows any stored tuple assigning the same user, conditioned or not. This matches
+//     how Check reads a direct assignment with ReadUserTuple, and must only be set for the reads of
+//     the relation being expanded (not for tupleset reads).
+//   - otherwise contextual and stored tuples both apply, like they do for the usersets and
+//     wildcards in Check and for the tuplesets of a tuple to userset. A stored tuple identical to a
+//     contextual one, condition included, is skipped since it would only be processed twice.
+//
+// Contextual tuples go through the same type restriction filtering as stored tuples, so a contextual
+// tuple the model doesn't allow is ignored. That keeps them consistent with pruning, which is
+// based on the model alone.
+func readWithContextualTuples(
+	ctx context.Context,
+	ds storage.RelationshipTupleReader,
+	storeID string,
+	tk *openfgav1.TupleKey,
+	opts storage.ReadOptions,
+	contextualTuples []*openfgav1.TupleKey,
+	shadowUsers bool,
+) (storage.TupleIterator, error) {
+	var contextual []*openfgav1.Tuple
+	shadowing := make(map[string][]*openfgav1.TupleKey)
+	for _, ctk := range contextualTuples {
+		if ctk.GetObject() != tk.GetObject() || ctk.GetRelation() != tk.GetRelation() {
+			continue
+		}
+		contextual = append(contextual, &openfgav1.Tuple{Key: ctk})
+
+		key := tuple.TupleKeyToString(ctk)
+		shadowing[key] = append(shadowing[key], ctk)
+	}
+
+	stored, err := ds.Read(ctx, storeID, tk, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shadowing) == 0 {
+		return stored, nil
+	}
+
+	return storage.NewCombinedIterator(
+		storage.NewStaticTupleIterator(contextual),
+		&shadowedTupleIterator{
+			iter:        stored,
+			shadowing:   shadowing,
+			shadowUsers: shadowUsers,
+		},
+	), nil
+}
+
+// shadowedTupleIterator skips the stored tuples that are shadowed by a contextual tuple.
+type shadowedTupleIterator struct {
+	iter        storage.TupleIterator
+	shadowing   map[string][]*openfgav1.TupleKey
+	shadowUsers bool
+}
+
+var _ storage.TupleIterator = (*shadowedTupleIterator)(nil)
+
+// Next see [storage.Iterator.Next].
+func (s *shadowedTupleIterator) Next(ctx context.Context) (*openfgav1.Tuple, error) {
+	for {
+		t, err := s.iter.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !s.isShadowed(t.GetKey()) {
+			return t, nil
+		}
+	}
+}
+
+// Stop see [storage.Iterator.Stop].
+func (s *shadowedTupleIterator) Stop() {
+	s.iter.Stop()
+}
+
+func (s *shadowedTupleIterator) isShadowed(tk *openfgav1.TupleKey) bool {
+	contextual, ok := s.shadowing[tuple.TupleKeyToString(tk)]
+	if !ok {
+		return false
+	}
+
+	if s.shadowUsers && tuple.GetUserTypeFromUser(tk.GetUser()) == tuple.User {
+		return true
+	}
+
+	for _, ctk := range contextual {
+		if proto.Equal(ctk.GetCondition(), tk.GetCondition()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	"github.com/openfga/openfga/pkg/storage/storagewrappers"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersContextualTuplesPrecedence(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder, folder with is_valid]
+				define viewer: [user, user with is_valid, user:*, user:* with is_valid, group#member, group#member with is_valid] or viewer from parent
+		condition is_valid(valid: bool) {
+			valid
+		}`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"document:2#viewer@user:*",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:will",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	// all the conditioned contextual tuples below evaluate to false
+	requestContext, err := structpb.NewStruct(map[string]interface{}{"valid": false})
+	require.NoError(t, err)
+
+	checker := graph.NewLocalChecker()
+	t.Cleanup(checker.Close)
+
+	tests := []struct {
+		name             string
+		objectID         string
+		contextualTuples []*openfgav1.TupleKey
+		expected         []string
+	}{
+		{
+			name:     "no_contextual_tuples",
+			objectID: "1",
+			expected: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:     "contextual_tuple_adds_user",
+			objectID: "1",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:poovam"),
+			},
+			expected: []string{"user:jon", "user:maria", "user:will", "user:poovam"},
+		},
+		{
+			name:     "contextual_tuples_identical_to_stored",
+			objectID: "1",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+			},
+			expected: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:     "conditioned_contextual_tuple_shadows_stored_user",
+			objectID: "1",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:jon", "is_valid", nil),
+			},
+			expected: []string{"user:maria", "user:will"},
+		},
+		{
+			name:     "conditioned_contextual_tuple_does_not_shadow_stored_userset",
+			objectID: "1",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "group:eng#member", "is_valid", nil),
+			},
+			expected: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:     "conditioned_contextual_tuple_does_not_shadow_stored_tupleset",
+			objectID: "1",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "is_valid", nil),
+			},
+			expected: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:     "conditioned_contextual_tuple_does_not_shadow_stored_wildcard",
+			objectID: "2",
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:2", "viewer", "user:*", "is_valid", nil),
+			},
+			expected: []string{"user:*"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:          storeID,
+				Object:           &openfgav1.Object{Type: "document", Id: test.objectID},
+				Relation:         "viewer",
+				UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}},
+				ContextualTuples: test.contextualTuples,
+				Context:          requestContext,
+			})
+			require.NoError(t, err)
+
+			users := userStrings(resp.GetUsers())
+			require.ElementsMatch(t, test.expected, users)
+
+			// the results must agree with Check given the same contextual tuples
+			checkCtx := storage.ContextWithRelationshipTupleReader(ctx, storagewrappers.NewCombinedTupleReader(ds, test.contextualTuples))
+			for _, user := range []string{"user:jon", "user:maria", "user:will", "user:poovam"} {
+				checkResp, err := checker.ResolveCheck(checkCtx, &graph.ResolveCheckRequest{
+					StoreID:              storeID,
+					AuthorizationModelID: model.GetId(),
+					TupleKey:             tuple.NewTupleKey("document:"+test.objectID, "viewer", user),
+					ContextualTuples:     test.contextualTuples,
+					Context:              requestContext,
+					RequestMetadata:      graph.NewCheckRequestMetadata(25),
+				})
+				require.NoError(t, err)
+				listed := slices.Contains(users, user) || slices.Contains(users, "user:*")
+				require.Equal(t, checkResp.GetAllowed(), listed, user)
+			}
+		})
+	}
+
+	t.Run("identical_contextual_tuples_not_processed_twice", func(t *testing.T) {
+		listUsers := func(contextualTuples []*openfgav1.TupleKey) *listUsersResponse {
+			resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:          storeID,
+				Object:           &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:         "viewer",
+				UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}},
+				ContextualTuples: contextualTuples,
+			})
+			require.NoError(t, err)
+			return resp
+		}
+
+		withoutContextualTuples := listUsers(nil)
+		withIdenticalContextualTuples := listUsers([]*openfgav1.TupleKey{
+			tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+			tuple.NewTupleKey("document:1", "parent", "folder:x"),
+		})
+		require.Equal(t,
+			withoutContextualTuples.GetMetadata().DispatchCounter.Load(),
+			withIdenticalContextualTuples.GetMetadata().DispatchCounter.Load(),
+		)
+	})
+}
+
+func TestListUsersConfig_ContextualTupleDepth(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#parent@folder:f",
+		"group:x#member@user:stored",
+		"group:x#member@group:y#member",
+	})
+
+	// the levels at which each contextual tuple is read: document:1#viewer is expanded at level 1,
+	// folder:f#viewer and group:x#member at level 2 and group:y#member at level 3
+	contextualTuples := []*openfgav1.TupleKey{
+		tuple.NewTupleKey("document:1", "viewer", "user:a"),
+		tuple.NewTupleKey("document:1", "viewer", "group:x#member"),
+		tuple.NewTupleKey("folder:f", "viewer", "user:c"),
+		tuple.NewTupleKey("group:x", "member", "user:b"),
+		tuple.NewTupleKey("group:y", "member", "user:d"),
+	}
+
+	listUsers := func(opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:          storeID,
+			Object:           &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:         "viewer",
+			UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}},
+			ContextualTuples: contextualTuples,
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	t.Run("unbounded_by_default", func(t *testing.T) {
+		require.ElementsMatch(t, []string{"user:a", "user:b", "user:c", "user:d", "user:stored"}, listUsers())
+	})
+
+	t.Run("bounded_to_listed_relation", func(t *testing.T) {
+		// group:x#member is assigned by a contextual tuple, and still expanded from the stored
+		// tuples
+		require.ElementsMatch(t, []string{"user:a", "user:stored"}, listUsers(WithContextualTupleDepth(1)))
+	})
+
+	t.Run("bounded_to_two_levels", func(t *testing.T) {
+		require.ElementsMatch(t, []string{"user:a", "user:b", "user:c", "user:stored"}, listUsers(WithContextualTupleDepth(2)))
+	})
+
+	t.Run("bound_deeper_than_expansion", func(t *testing.T) {
+		require.ElementsMatch(t, []string{"user:a", "user:b", "user:c", "user:d", "user:stored"}, listUsers(WithContextualTupleDepth(3)))
+	})
+}
+
+// BenchmarkListUsersUnrelatedContextualTuples lists the users of an object through many groups,
+// with a growing number of contextual tuples for objects the expansion never reaches.
+func BenchmarkListUsersUnrelatedContextualTuples(b *testing.B) {
+	ds := memory.New()
+	b.Cleanup(ds.Close)
+
+	const numGroups = 100
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+
+	storeID, model := storagetest.BootstrapFGAStore(b, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(b, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	for _, numContextualTuples := range []int{0, 1000, 10000} {
+		contextualTuples := make([]*openfgav1.TupleKey, 0, numContextualTuples)
+		for i := 0; i < numContextualTuples; i++ {
+			contextualTuples = append(contextualTuples, tuple.NewTupleKey(fmt.Sprintf("document:other-%d", i), "viewer", "user:jon"))
+		}
+		req := &openfgav1.ListUsersRequest{
+			StoreId:          storeID,
+			Object:           &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:         "viewer",
+			UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}},
+			ContextualTuples: contextualTuples,
+		}
+
+		b.Run(fmt.Sprintf("contextual_tuples_%d", numContextualTuples), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+				require.NoError(b, err)
+				require.Len(b, resp.GetUsers(), numGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package listusers
+
+import (
+	"runtime"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// usersFromKeys returns the users with the given keys, in the same order. The keys are split into
+// one chunk per CPU converted concurrently if there are enough of them, since converting each key
+// is independent of the others. See WithParallelConversion.
+func (l *listUsersQuery) usersFromKeys(keys []string) []*openfgav1.User {
+	users := make([]*openfgav1.User, len(keys))
+	if l.parallelConversionMin <= 0 || len(keys) < l.parallelConversionMin {
+		for i, key := range keys {
+			users[i] = tuple.StringToUserProto(key)
+		}
+		return users
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	chunkSize := (len(keys) + workers - 1) / workers
+	p := pool.New().WithMaxGoroutines(workers)
+	for start := 0; start < len(keys); start += chunkSize {
+		end := min(start+chunkSize, len(keys))
+		p.Go(func() {
+			for i := start; i < end; i++ {
+				users[i] = tuple.StringToUserProto(keys[i])
+			}
+		})
+	}
+	p.Wait()
+	return users
+}
@@ -0,0 +1,98 @@
+package listusers
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/protobuf/proto"
+)
+
+func userKeys(n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		switch i % 3 {
+		case 0:
+			keys = append(keys, "user:"+strconv.Itoa(i))
+		case 1:
+			keys = append(keys, "group:"+strconv.Itoa(i)+"#member")
+		default:
+			keys = append(keys, "user:*")
+		}
+	}
+	return keys
+}
+
+func TestUsersFromKeys(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	serial := &listUsersQuery{}
+	parallel := &listUsersQuery{parallelConversionMin: 1}
+	for _, n := range []int{0, 1, 2, 7, 100, 1001} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			keys := userKeys(n)
+			expected := serial.usersFromKeys(keys)
+			actual := parallel.usersFromKeys(keys)
+			require.Len(t, actual, n)
+			for i := range expected {
+				require.True(t, proto.Equal(expected[i], actual[i]), "user %d differs", i)
+			}
+		})
+	}
+}
+
+func TestListUsersConfig_ParallelConversion(t *testing.T) {
+	tuples := []string{"document:1#viewer@user:*"}
+	for i := 0; i < 100; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#viewer@user:%d", i))
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user, user:*]`, tuples)
+
+	listUsers := func(opts ...ListUsersQueryOption) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds, append(opts, WithRedundantUsersAnnotation(true))...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	expected := listUsers()
+	actual := listUsers(WithParallelConversion(10))
+	require.Len(t, actual.GetUsers(), 101)
+	require.ElementsMatch(t, userStrings(expected.GetUsers()), userStrings(actual.GetUsers()))
+	require.Len(t, actual.Metadata.RedundantUsers, 100)
+	require.ElementsMatch(t, userStrings(expected.Metadata.RedundantUsers), userStrings(actual.Metadata.RedundantUsers))
+}
+
+func BenchmarkUsersFromKeys(b *testing.B) {
+	keys := userKeys(1_000_000)
+
+	b.Run("serial", func(b *testing.B) {
+		l := &listUsersQuery{}
+		for i := 0; i < b.N; i++ {
+			l.usersFromKeys(keys)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		l := &listUsersQuery{parallelConversionMin: 1}
+		for i := 0; i < b.N; i++ {
+			l.usersFromKeys(keys)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package listusers
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// usersetCandidates records the usersets assigned by the tuples read while expanding a request,
+// which are the candidates of a userset cover. It is shared by all the clones of a request.
+type usersetCandidates struct {
+	mu       sync.Mutex
+	usersets map[string]struct{}
+}
+
+func newUsersetCandidates() *usersetCandidates {
+	return &usersetCandidates{
+		usersets: make(map[string]struct{}),
+	}
+}
+
+func (u *usersetCandidates) add(userset string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.usersets[userset] = struct{}{}
+}
+
+// list returns the candidate usersets, sorted.
+func (u *usersetCandidates) list() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	usersets := make([]string, 0, len(u.usersets))
+	for userset := range u.usersets {
+		usersets = append(usersets, userset)
+	}
+	sort.Strings(usersets)
+	return usersets
+}
+
+// coverUsers returns the usersets of a greedy cover of the concrete users found for the request,
+// followed by the users that none of the candidate usersets cover, such as the users assigned the
+// relation directly. The members of each candidate userset are listed with the user filters of
+// the request, and the number of datastore queries made to do so is returned.
+func (l *listUsersQuery) coverUsers(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	candidates []string,
+	foundUsers []*openfgav1.User,
+) ([]*openfgav1.User, uint32, error) {
+	users := make([]string, 0, len(foundUsers))
+	for _, user := range foundUsers {
+		if user.GetUserset() == nil {
+			users = append(users, tuple.UserProtoToString(user))
+		}
+	}
+
+	q := *l
+	q.usersetCover = false
+	q.maxResults = 0
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.streamUnions = false
+	q.onFoundUser = nil
+	q.userAllowList = nil
+	q.expandWildcard = false
+	q.progress = nil
+	q.pageSize = 0
+	q.excludedSubject = ""
+	q.compoundUserFilters = nil
+	q.skipEmptyUsersets = false
+	q.requestCoalescing = false
+	q.observability = nil
+	q.skipResultMetrics = true
+	q.discardFoundUsers = false
+
+	var datastoreQueryCount uint32
+	members := make(map[string]map[string]struct{}, len(candidates))
+	for _, candidate := range candidates {
+		object, relation := tuple.SplitObjectRelation(candidate)
+		objectType, objectID := tuple.SplitObject(object)
+
+		resp, err := q.ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:              req.GetStoreId(),
+			AuthorizationModelId: req.GetAuthorizationModelId(),
+			Object:               &openfgav1.Object{Type: objectType, Id: objectID},
+			Relation:             relation,
+			UserFilters:          req.GetUserFilters(),
+			ContextualTuples:     req.GetContextualTuples(),
+			Context:              req.GetContext(),
+			Consistency:          req.GetConsistency(),
+		})
+		if err != nil {
+			return nil, datastoreQueryCount, err
+		}
+		datastoreQueryCount += resp.GetMetadata().DatastoreQueryCount
+
+		members[candidate] = make(map[string]struct{}, len(resp.GetUsers()))
+		for _, user := range resp.GetUsers() {
+			members[candidate][tuple.UserProtoToString(user)] = struct{}{}
+		}
+	}
+
+	cover, uncovered := greedyCover(candidates, members, users)
+
+	covered := make([]*openfgav1.User, 0, len(cover)+len(uncovered))
+	for _, userset := range cover {
+		covered = append(covered, tuple.StringToUserProto(userset))
+	}
+	for _, user := range uncovered {
+		covered = append(covered, tuple.StringToUserProto(user))
+	}
+	return covered, datastoreQueryCount, nil
+}
+
+// greedyCover picks, out of the candidates, the one whose members include the most users not
+// covered yet, until no candidate covers any more users. Finding the smallest cover is NP-hard,
+// and the greedy cover is at most a logarithmic factor larger. Ties are broken by the order of
+// the candidates. It returns the cover and the users that none of the candidates cover.
+func greedyCover(candidates []string, members map[string]map[string]struct{}, users []string) ([]string, []string) {
+	uncovered := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		uncovered[user] = struct{}{}
+	}
+
+	var cover []string
+	for len(uncovered) > 0 {
+		best, bestCount := "", 0
+		for _, candidate := range candidates {
+			count := 0
+			for member := range members[candidate] {
+				if _, ok := uncovered[member]; ok {
+					count++
+				}
+			}
+			if count > bestCount {
+				best, bestCount = candidate, count
+			}
+		}
+		if bestCount == 0 {
+			break
+		}
+
+		cover = append(cover, best)
+		for member := range members[best] {
+			delete(uncovered, member)
+		}
+	}
+
+	remaining := make([]string, 0, len(uncovered))
+	for _, user := range users {
+		if _, ok := uncovered[user]; ok {
+			remaining = append(remaining, user)
+		}
+	}
+	return cover, remaining
+}
@@ -0,0 +1,158 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestGreedyCover(t *testing.T) {
+	members := func(users ...string) map[string]struct{} {
+		m := make(map[string]struct{}, len(users))
+		for _, user := range users {
+			m[user] = struct{}{}
+		}
+		return m
+	}
+
+	tests := []struct {
+		name              string
+		candidates        []string
+		members           map[string]map[string]struct{}
+		users             []string
+		expectedCover     []string
+		expectedUncovered []string
+	}{
+		{
+			name:              "no_candidates",
+			users:             []string{"user:1"},
+			expectedUncovered: []string{"user:1"},
+		},
+		{
+			name:       "largest_first",
+			candidates: []string{"group:a#member", "group:b#member", "group:c#member"},
+			members: map[string]map[string]struct{}{
+				"group:a#member": members("user:1", "user:2"),
+				"group:b#member": members("user:1", "user:2", "user:3"),
+				"group:c#member": members("user:4"),
+			},
+			users:             []string{"user:1", "user:2", "user:3", "user:4"},
+			expectedCover:     []string{"group:b#member", "group:c#member"},
+			expectedUncovered: []string{},
+		},
+		{
+			name:       "ties_broken_by_order",
+			candidates: []string{"group:a#member", "group:b#member"},
+			members: map[string]map[string]struct{}{
+				"group:a#member": members("user:1"),
+				"group:b#member": members("user:1"),
+			},
+			users:             []string{"user:1"},
+			expectedCover:     []string{"group:a#member"},
+			expectedUncovered: []string{},
+		},
+		{
+			name:       "members_without_access_ignored",
+			candidates: []string{"group:a#member", "group:b#member"},
+			members: map[string]map[string]struct{}{
+				"group:a#member": members("user:1", "user:blocked_1", "user:blocked_2"),
+				"group:b#member": members("user:1", "user:2"),
+			},
+			users:             []string{"user:1", "user:2", "user:3"},
+			expectedCover:     []string{"group:b#member"},
+			expectedUncovered: []string{"user:3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cover, uncovered := greedyCover(test.candidates, test.members, test.users)
+			require.Equal(t, test.expectedCover, cover)
+			require.ElementsMatch(t, test.expectedUncovered, uncovered)
+		})
+	}
+}
+
+func TestListUsersConfig_UsersetCover(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define editor: [group#member]
+				define viewer: [user, group#member] or editor`, []string{
+		"document:1#viewer@user:direct",
+		"document:1#viewer@group:a#member",
+		"document:1#viewer@group:c#member",
+		"document:1#editor@group:d#member",
+		"group:a#member@user:1",
+		"group:a#member@user:2",
+		"group:a#member@user:3",
+		"group:b#member@user:1",
+		"group:b#member@user:2",
+		"group:c#member@user:3",
+		"group:c#member@user:5",
+		"group:d#member@user:4",
+		"group:d#member@user:6",
+		"group:d#member@group:b#member",
+	})
+
+	listUsers := func(object *openfgav1.Object, relation string, opts ...ListUsersQueryOption) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      object,
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	document := &openfgav1.Object{Type: "document", Id: "1"}
+	all := listUsers(document, "viewer")
+	resp := listUsers(document, "viewer", WithUsersetCover(true))
+
+	// group:d#member covers the most users, including those of the nested group:b#member, and
+	// group:c#member covers the rest but for the user assigned the relation directly
+	require.Equal(t, []string{"group:d#member", "group:c#member", "user:direct"}, userStrings(resp.GetUsers()))
+	require.Greater(t, resp.GetMetadata().DatastoreQueryCount, all.GetMetadata().DatastoreQueryCount)
+
+	// every user that has the relation is returned, or is a member of a returned userset
+	covered := map[string]struct{}{}
+	for _, user := range resp.GetUsers() {
+		userset := user.GetUserset()
+		if userset == nil {
+			covered[tuple.UserProtoToString(user)] = struct{}{}
+			continue
+		}
+		members := listUsers(&openfgav1.Object{Type: userset.GetType(), Id: userset.GetId()}, userset.GetRelation())
+		for _, member := range members.GetUsers() {
+			covered[tuple.UserProtoToString(member)] = struct{}{}
+		}
+	}
+	for _, user := range userStrings(all.GetUsers()) {
+		require.Contains(t, covered, user)
+	}
+
+	t.Run("callback_called_with_the_cover", func(t *testing.T) {
+		var users []string
+		err := NewListUsersQuery(ds, WithUsersetCover(true)).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      document,
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, func(user *openfgav1.User) error {
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"group:d#member", "group:c#member", "user:direct"}, users)
+	})
+}
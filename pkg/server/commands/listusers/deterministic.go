@@ -0,0 +1,36 @@
+package listusers
+
+import (
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// orderedRange calls fn with each key and value of m, in the order of the keys if deterministic
+// is set, and in the iteration order of the map otherwise. See WithDeterministicOrder.
+func orderedRange[V any](deterministic bool, m map[string]V, fn func(key string, value V)) {
+	if !deterministic {
+		for key, value := range m {
+			fn(key, value)
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(key, m[key])
+	}
+}
+
+// sortUsers sorts users by their string.
+func sortUsers(users []*openfgav1.User) {
+	sort.Slice(users, func(i, j int) bool {
+		return tuple.UserProtoToString(users[i]) < tuple.UserProtoToString(users[j])
+	})
+}
@@ -0,0 +1,86 @@
+package listusers
+
+import (
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOrderedRange(t *testing.T) {
+	m := map[string]int{"user:c": 3, "user:a": 1, "user:b": 2, "user:*": 0}
+
+	var keys []string
+	var values []int
+	orderedRange(true, m, func(key string, value int) {
+		keys = append(keys, key)
+		values = append(values, value)
+	})
+	require.Equal(t, []string{"user:*", "user:a", "user:b", "user:c"}, keys)
+	require.Equal(t, []int{0, 1, 2, 3}, values)
+
+	keys = nil
+	orderedRange(false, m, func(key string, _ int) {
+		keys = append(keys, key)
+	})
+	require.ElementsMatch(t, []string{"user:*", "user:a", "user:b", "user:c"}, keys)
+}
+
+func TestListUsersConfig_DeterministicOrder(t *testing.T) {
+	tuples := []string{
+		"document:1#blocked@user:will",
+		"document:1#public@user:*",
+		"document:1#allowed@user:*",
+		"document:1#editor@group:eng#member",
+	}
+	for i := 0; i < 50; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#allowed@user:%d", i),
+			fmt.Sprintf("document:1#owner@user:%d", i),
+			fmt.Sprintf("group:eng#member@user:member-%d", i),
+		)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user]
+				define public: [user:*]
+				define allowed: [user, user:*]
+				define owner: [user]
+				define editor: [group#member]
+				define viewer: ((public but not blocked) and allowed) or owner or editor`, tuples)
+
+	serializedResponse := func() []byte {
+		resp, err := NewListUsersQuery(ds,
+			WithDeterministicOrder(true),
+			WithRedundantUsersAnnotation(true),
+		).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.GetUsers())
+
+		serialized, err := proto.Marshal(&openfgav1.ListUsersResponse{
+			Users: append(resp.GetUsers(), resp.Metadata.RedundantUsers...),
+		})
+		require.NoError(t, err)
+		return serialized
+	}
+
+	expected := serializedResponse()
+	for i := 0; i < 20; i++ {
+		require.Equal(t, expected, serializedResponse())
+	}
+}
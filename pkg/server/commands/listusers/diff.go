@@ -0,0 +1,106 @@
+package listusers
+
+import (
+	"context"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openfga/openfga/pkg/telemetry"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// ListUsersDiff is the difference between the users of an object under two authorization models.
+// See DiffListUsers.
+type ListUsersDiff struct {
+	// Added are the users that only have the relation under the second model. Sorted.
+	Added []*openfgav1.User
+
+	// Removed are the users that only have the relation under the first model. Sorted.
+	Removed []*openfgav1.User
+}
+
+// DiffListUsers lists the users of the request under modelA and under modelB, against the same
+// tuples, and returns the users that modelB grants the relation to and modelA doesn't, and the
+// other way around. It is meant for validating that a model change doesn't grant or revoke access
+// unexpectedly before rolling it out. The authorization model ID of the request is ignored.
+func (l *listUsersQuery) DiffListUsers(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	modelA, modelB *typesystem.TypeSystem,
+) (*ListUsersDiff, error) {
+	ctx, span := tracer.Start(ctx, "DiffListUsers", trace.WithAttributes(
+		attribute.String("model_a", modelA.GetAuthorizationModelID()),
+		attribute.String("model_b", modelB.GetAuthorizationModelID()),
+	))
+	defer span.End()
+
+	usersA, err := l.listUsersWithModel(ctx, req, modelA)
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+	usersB, err := l.listUsersWithModel(ctx, req, modelB)
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	return &ListUsersDiff{
+		Added:   usersDifference(usersB, usersA),
+		Removed: usersDifference(usersA, usersB),
+	}, nil
+}
+
+// listUsersWithModel lists the users of the request under the model, and returns them keyed by
+// their string.
+func (l *listUsersQuery) listUsersWithModel(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	typesys *typesystem.TypeSystem,
+) (map[string]*openfgav1.User, error) {
+	modelReq := &openfgav1.ListUsersRequest{
+		StoreId:              req.GetStoreId(),
+		AuthorizationModelId: typesys.GetAuthorizationModelID(),
+		Object:               req.GetObject(),
+		Relation:             req.GetRelation(),
+		UserFilters:          req.GetUserFilters(),
+		ContextualTuples:     req.GetContextualTuples(),
+		Context:              req.GetContext(),
+		Consistency:          req.GetConsistency(),
+	}
+
+	// ListUsers wraps the datastore of its query, so each model gets a query of its own
+	q := *l
+	q.pageSize = 0
+	resp, err := q.ListUsers(typesystem.ContextWithTypesystem(ctx, typesys), modelReq)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*openfgav1.User, len(resp.GetUsers()))
+	for _, user := range resp.GetUsers() {
+		users[tuple.UserProtoToString(user)] = user
+	}
+	return users, nil
+}
+
+// usersDifference returns the users of a that aren't in b, sorted by their string.
+func usersDifference(a, b map[string]*openfgav1.User) []*openfgav1.User {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	users := make([]*openfgav1.User, 0, len(keys))
+	for _, key := range keys {
+		users = append(users, a[key])
+	}
+	return users
+}
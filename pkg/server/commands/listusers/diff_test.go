@@ -0,0 +1,95 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/testutils"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestDiffListUsers(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define blocked: [user]
+				define editor: [user]
+				define viewer: [user, user:*] but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#editor@user:will",
+		"document:1#blocked@user:maria",
+		"document:2#viewer@user:*",
+	})
+	modelA, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+
+	// viewer no longer excludes blocked users, and editors are now viewers
+	modelB, err := typesystem.NewAndValidate(context.Background(), testutils.MustTransformDSLToProtoWithID(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define blocked: [user]
+				define editor: [user]
+				define viewer: [user, user:*] or editor`))
+	require.NoError(t, err)
+
+	diffListUsers := func(objectID string, a, b *typesystem.TypeSystem) *ListUsersDiff {
+		diff, err := NewListUsersQuery(ds).DiffListUsers(context.Background(), &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: objectID},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, a, b)
+		require.NoError(t, err)
+		return diff
+	}
+
+	t.Run("users_added_and_removed", func(t *testing.T) {
+		diff := diffListUsers("1", modelA, modelB)
+		require.Equal(t, []string{"user:maria", "user:will"}, userStrings(diff.Added))
+		require.Empty(t, diff.Removed)
+
+		diff = diffListUsers("1", modelB, modelA)
+		require.Empty(t, diff.Added)
+		require.Equal(t, []string{"user:maria", "user:will"}, userStrings(diff.Removed))
+	})
+
+	t.Run("no_difference", func(t *testing.T) {
+		diff := diffListUsers("2", modelA, modelB)
+		require.Empty(t, diff.Added)
+		require.Empty(t, diff.Removed)
+
+		diff = diffListUsers("1", modelA, modelA)
+		require.Empty(t, diff.Added)
+		require.Empty(t, diff.Removed)
+	})
+
+	t.Run("error_returned", func(t *testing.T) {
+		_, err := NewListUsersQuery(ds, WithMaxExpansionSteps(1)).DiffListUsers(context.Background(), &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, modelA, modelB)
+		require.ErrorIs(t, err, ErrMaxExpansionStepsExceeded)
+	})
+}
@@ -0,0 +1,18 @@
+package listusers
+
+import (
+	"github.com/cespare/xxhash/v2"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// resultDigest returns a digest of a set of users that doesn't depend on their order: the sum,
+// wrapping around, of the xxhash of each user's string. See WithResultDigest.
+func resultDigest(users []*openfgav1.User) uint64 {
+	var digest uint64
+	for _, user := range users {
+		digest += xxhash.Sum64String(tuple.UserProtoToString(user))
+	}
+	return digest
+}
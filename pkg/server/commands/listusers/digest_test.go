@@ -0,0 +1,78 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestResultDigest(t *testing.T) {
+	users := func(userStrs ...string) []*openfgav1.User {
+		result := make([]*openfgav1.User, 0, len(userStrs))
+		for _, userStr := range userStrs {
+			result = append(result, tuple.StringToUserProto(userStr))
+		}
+		return result
+	}
+
+	digest := resultDigest(users("user:jon", "user:*", "group:eng#member"))
+	require.Equal(t, digest, resultDigest(users("group:eng#member", "user:jon", "user:*")))
+	require.NotEqual(t, digest, resultDigest(users("user:jon", "user:*")))
+	require.NotEqual(t, digest, resultDigest(users("user:jon", "user:*", "group:eng#member", "user:maria")))
+	require.Zero(t, resultDigest(nil))
+}
+
+func TestListUsersConfig_ResultDigest(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@user:will",
+	})
+
+	listUsers := func(opts ...ListUsersQueryOption) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("not_set_by_default", func(t *testing.T) {
+		require.Zero(t, listUsers().GetMetadata().ResultDigest)
+	})
+
+	resp := listUsers(WithResultDigest(true))
+	digest := resp.GetMetadata().ResultDigest
+	require.Equal(t, resultDigest(resp.GetUsers()), digest)
+
+	t.Run("identical_across_runs", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			require.Equal(t, digest, listUsers(WithResultDigest(true)).GetMetadata().ResultDigest)
+		}
+	})
+
+	t.Run("differs_when_user_added", func(t *testing.T) {
+		err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+			tuple.NewTupleKey("group:eng", "member", "user:poovam"),
+		})
+		require.NoError(t, err)
+		require.NotEqual(t, digest, listUsers(WithResultDigest(true)).GetMetadata().ResultDigest)
+	})
+}
@@ -0,0 +1,44 @@
+package listusers
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// verifiesDirect reports whether the direct assignments of a relation defined by rewrite must be
+// checked before they are returned with WithDirectOnly. A direct assignment grants the relation
+// on its own if the relation is only directly assignable or is a union of the direct assignments
+// and other operands, but the other operands of an intersection or an exclusion can deny it.
+func verifiesDirect(rewrite *openfgav1.Userset) bool {
+	switch rewrite := rewrite.GetUserset().(type) {
+	case *openfgav1.Userset_This:
+		return false
+	case *openfgav1.Userset_Union:
+		for _, child := range rewrite.Union.GetChild() {
+			if _, ok := child.GetUserset().(*openfgav1.Userset_This); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// verifyDirectResults returns the channel to send the direct assignments of the relation of req
+// to, and the function closing it once they are all sent. Each user assigned the relation is
+// checked against the relation before it is forwarded to foundUsersChan, and dropped if the check
+// finds it denied by the other operands of the relation. The function returned waits for the
+// checks and returns the first error of any of them. See WithDirectOnly.
+func (l *listUsersQuery) verifyDirectResults(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	foundUsersChan chan<- foundUser,
+) (chan<- foundUser, func() error) {
+	checks := func(fu foundUser) bool {
+		return fu.relationshipStatus != NoRelationship
+	}
+	forward := func(fu foundUser, allowed bool) (foundUser, bool) {
+		return fu, allowed
+	}
+	return l.checkResults(ctx, req, "direct_verification", req.GetRelation(), req.GetConsistency(), foundUsersChan, checks, forward)
+}
@@ -0,0 +1,72 @@
+package listusers
+
+import (
+	"context"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// nonEmptyUsersetPredicate returns a ResultPredicate accepting the users and wildcards, and the
+// usersets that have at least one member of any type, such as a user or a wildcard, as found by
+// HasUsers. The members are listed with the contextual tuples and the context of req. The users
+// accepted must also satisfy next, if any. See WithSkipEmptyUsersets.
+func (l *listUsersQuery) nonEmptyUsersetPredicate(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	next ResultPredicate,
+) ResultPredicate {
+	memberTypes := make([]string, 0, len(typesys.GetAllRelations()))
+	for objectType := range typesys.GetAllRelations() {
+		memberTypes = append(memberTypes, objectType)
+	}
+	sort.Strings(memberTypes)
+	memberFilters := make([]*openfgav1.UserTypeFilter, 0, len(memberTypes))
+	for _, memberType := range memberTypes {
+		memberFilters = append(memberFilters, &openfgav1.UserTypeFilter{Type: memberType})
+	}
+
+	q := *l
+	q.skipEmptyUsersets = false
+	q.resultPredicate = nil
+	q.compoundUserFilters = nil
+	q.usersetCover = false
+	q.usersetsOnly = false
+	q.directOnly = false
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.onFoundUser = nil
+	q.userAllowList = nil
+	q.expandWildcard = false
+	q.progress = nil
+	q.pageSize = 0
+	q.excludedSubject = ""
+	q.requestCoalescing = false
+	q.observability = nil
+	q.skipResultMetrics = true
+	q.discardFoundUsers = false
+
+	return func(ctx context.Context, user *openfgav1.User) (bool, error) {
+		if userset := user.GetUserset(); userset != nil {
+			hasMembers, err := q.HasUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:              req.GetStoreId(),
+				AuthorizationModelId: req.GetAuthorizationModelId(),
+				Object:               &openfgav1.Object{Type: userset.GetType(), Id: userset.GetId()},
+				Relation:             userset.GetRelation(),
+				UserFilters:          memberFilters,
+				ContextualTuples:     req.GetContextualTuples(),
+				Context:              req.GetContext(),
+				Consistency:          req.GetConsistency(),
+			})
+			if err != nil || !hasMembers {
+				return false, err
+			}
+		}
+		if next == nil {
+			return true, nil
+		}
+		return next(ctx, user)
+	}
+}
@@ -0,0 +1,93 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_SkipEmptyUsersets(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:empty#member",
+		"document:1#viewer@group:public#member",
+		"document:1#viewer@group:parent#member",
+		"document:1#viewer@group:nested_empty#member",
+		"group:eng#member@user:will",
+		"group:public#member@user:*",
+		// group:parent only has members through group:eng
+		"group:parent#member@group:eng#member",
+		// group:nested_empty only has the empty group as a member
+		"group:nested_empty#member@group:empty#member",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:  storeID,
+		Object:   &openfgav1.Object{Type: "document", Id: "1"},
+		Relation: "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{
+			{Type: "user"},
+			{Type: "group", Relation: "member"},
+		},
+	}
+
+	t.Run("empty_usersets_skipped", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithSkipEmptyUsersets(true)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"user:jon",
+			"user:will",
+			"user:*",
+			"group:eng#member",
+			"group:public#member",
+			"group:parent#member",
+		}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("contextual_members", func(t *testing.T) {
+		withContextualTuples := &openfgav1.ListUsersRequest{
+			StoreId:          req.GetStoreId(),
+			Object:           req.GetObject(),
+			Relation:         req.GetRelation(),
+			UserFilters:      req.GetUserFilters(),
+			ContextualTuples: []*openfgav1.TupleKey{tuple.NewTupleKey("group:empty", "member", "user:anne")},
+		}
+		resp, err := NewListUsersQuery(ds, WithSkipEmptyUsersets(true)).ListUsers(ctx, withContextualTuples)
+		require.NoError(t, err)
+		require.Subset(t, userStrings(resp.GetUsers()), []string{"group:empty#member", "group:nested_empty#member"})
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		var users []*openfgav1.User
+		err := NewListUsersQuery(ds, WithSkipEmptyUsersets(true), WithUsersetsOnly(true)).
+			ListUsersCallback(ctx, req, func(user *openfgav1.User) error {
+				users = append(users, user)
+				return nil
+			})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"group:eng#member",
+			"group:public#member",
+			"group:parent#member",
+		}, userStrings(users))
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Subset(t, userStrings(resp.GetUsers()), []string{"group:empty#member", "group:nested_empty#member"})
+	})
+}
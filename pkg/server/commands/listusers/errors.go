@@ -0,0 +1,173 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// ErrUnsupportedModelFeature is returned when the relation being listed depends on a
+// model feature that ListUsers cannot resolve correctly.
+var ErrUnsupportedModelFeature = errors.New("model feature not supported by ListUsers")
+
+// ErrTraversalBudgetExceeded is returned when expanding a request costs more than the
+// traversal budget allows. See WithTraversalBudget.
+var ErrTraversalBudgetExceeded = errors.New("ListUsers traversal budget exceeded")
+
+// ErrMaxExpansionStepsExceeded is returned when expanding a request evaluates more rewrites
+// than the max expansion steps allow. See WithMaxExpansionSteps.
+var ErrMaxExpansionStepsExceeded = errors.New("ListUsers max expansion steps exceeded")
+
+// ErrMaxExpansionDurationExceeded is returned when expanding a request takes longer than the max
+// expansion duration allows. See WithMaxExpansionDuration.
+var ErrMaxExpansionDurationExceeded = errors.New("ListUsers max expansion duration exceeded")
+
+// ErrNoProgress is returned when an expansion neither finds a user nor makes a datastore query for
+// longer than the no progress timeout allows. See WithNoProgressTimeout.
+var ErrNoProgress = errors.New("ListUsers expansion made no progress")
+
+// ErrMaxSubtractSetSizeExceeded is returned when the subtract of an exclusion yields more users
+// than the max subtract set size allows. See WithMaxSubtractSetSize.
+var ErrMaxSubtractSetSizeExceeded = errors.New("ListUsers max subtract set size exceeded")
+
+// ErrUserConditionsUnsupported is returned when user conditions are requested for a relation
+// that reaches an intersection or an exclusion. See WithUserConditions.
+var ErrUserConditionsUnsupported = errors.New("ListUsers user conditions not supported for relations reaching an intersection or exclusion")
+
+// ErrUsersByGrantingUsersetUnsupported is returned when the users are requested by granting
+// userset for a relation that reaches an intersection or exclusion. See
+// WithUsersByGrantingUserset.
+var ErrUsersByGrantingUsersetUnsupported = errors.New("ListUsers users by granting userset not supported for relations reaching an intersection or exclusion")
+
+// ErrIncompleteResults is returned, once the users found are passed on, when a limit such as the
+// max results or the deadline cut the listing short, so that they are only some of the users with
+// the relation. See ListUsersSequenced and ListUsersSorted.
+var ErrIncompleteResults = errors.New("ListUsers results are incomplete")
+
+// ErrInvalidPageHandle is returned when the next page of users is requested with a handle that
+// is unknown, already used, expired or returned for another request. See WithPaging.
+var ErrInvalidPageHandle = errors.New("ListUsers page handle is invalid or expired")
+
+// ErrRelationNotEnumerable is returned when the relation being listed is flagged as not safe to
+// enumerate. See typesystem.TypeSystem.WithNonEnumerableRelations.
+var ErrRelationNotEnumerable = errors.New("relation is not enumerable by ListUsers")
+
+// ErrExpansionPanicked is returned when a goroutine expanding a request panics. It wraps the
+// unknown error, so that the request fails with an internal error.
+var ErrExpansionPanicked = fmt.Errorf("%w: ListUsers expansion panicked", openfgaErrors.ErrUnknown)
+
+// UnsupportedModelFeatureError describes the model feature, and where it was found, that
+// prevents ListUsers from resolving a request. It unwraps to ErrUnsupportedModelFeature.
+type UnsupportedModelFeatureError struct {
+	ObjectType string
+	Relation   string
+	Feature    string
+}
+
+func (e *UnsupportedModelFeatureError) Error() string {
+	return fmt.Sprintf("%s: %s in relation '%s#%s'", ErrUnsupportedModelFeature, e.Feature, e.ObjectType, e.Relation)
+}
+
+func (e *UnsupportedModelFeatureError) Unwrap() error {
+	return ErrUnsupportedModelFeature
+}
+
+// RelationNotEnumerableError describes the relation, flagged as not safe to enumerate, that
+// ListUsers refused to list. It unwraps to ErrRelationNotEnumerable.
+type RelationNotEnumerableError struct {
+	ObjectType string
+	Relation   string
+}
+
+func (e *RelationNotEnumerableError) Error() string {
+	return fmt.Sprintf("%s: '%s#%s'", ErrRelationNotEnumerable, e.ObjectType, e.Relation)
+}
+
+func (e *RelationNotEnumerableError) Unwrap() error {
+	return ErrRelationNotEnumerable
+}
+
+// PanicError describes the panic of a goroutine expanding a request, along with the stack of the
+// goroutine when it panicked. It unwraps to ErrExpansionPanicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrExpansionPanicked, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrExpansionPanicked
+}
+
+// DatastoreError describes the failure of a datastore read made while expanding a request, such as
+// the datastore being unreachable, as opposed to an error in the model or the request. The end of
+// the request, by its deadline or its cancellation, is returned as is instead. It unwraps to the
+// error of the datastore.
+type DatastoreError struct {
+	Err error
+}
+
+func (e *DatastoreError) Error() string {
+	return fmt.Sprintf("ListUsers datastore read failed: %v", e.Err)
+}
+
+func (e *DatastoreError) Unwrap() error {
+	return e.Err
+}
+
+// wrapDatastoreError wraps err, returned by a datastore read, in a DatastoreError, unless it ends
+// the iteration or the request, rejects read options the datastore can't serve, or is wrapped
+// already.
+func wrapDatastoreError(err error) error {
+	if err == nil ||
+		errors.Is(err, storage.ErrIteratorDone) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, storage.ErrCancelled) ||
+		errors.Is(err, storage.ErrDeadlineExceeded) ||
+		errors.Is(err, storage.ErrSnapshotsNotSupported) ||
+		errors.Is(err, storage.ErrPartitionsNotSupported) ||
+		errors.Is(err, storage.ErrInvalidSnapshotToken) {
+		return err
+	}
+	var datastoreErr *DatastoreError
+	if errors.As(err, &datastoreErr) {
+		return err
+	}
+	return &DatastoreError{Err: err}
+}
+
+// datastoreErrorIterator wraps the errors of the iterator of a datastore read in a DatastoreError.
+type datastoreErrorIterator struct {
+	storage.TupleIterator
+}
+
+func (i *datastoreErrorIterator) Next(ctx context.Context) (*openfgav1.Tuple, error) {
+	t, err := i.TupleIterator.Next(ctx)
+	return t, wrapDatastoreError(err)
+}
+
+// ModelError describes an error in the model found while expanding a request, such as a relation
+// rewritten with a type the model doesn't define, as opposed to a datastore failure. It unwraps to
+// the error of the typesystem.
+type ModelError struct {
+	ObjectType string
+	Relation   string
+	Err        error
+}
+
+func (e *ModelError) Error() string {
+	return fmt.Sprintf("ListUsers cannot resolve relation '%s#%s': %v", e.ObjectType, e.Relation, e.Err)
+}
+
+func (e *ModelError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,135 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/internal/condition"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+var errDatastoreDown = errors.New("datastore down")
+
+// failingDatastore fails the reads of the members of group:eng, either right away or while
+// iterating over them.
+type failingDatastore struct {
+	storage.OpenFGADatastore
+
+	failIteration bool
+}
+
+func (s *failingDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	if tupleKey.GetObject() != "group:eng" {
+		return s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+	}
+	if s.failIteration {
+		return &failingIterator{}, nil
+	}
+	return nil, errDatastoreDown
+}
+
+type failingIterator struct{}
+
+func (i *failingIterator) Next(context.Context) (*openfgav1.Tuple, error) {
+	return nil, errDatastoreDown
+}
+
+func (i *failingIterator) Stop() {}
+
+func TestListUsersErrorTypes(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]
+				define editor: [user with in_office]
+		condition in_office(ip: ipaddress) {
+			ip.in_cidr("10.0.0.0/8")
+		}`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:will",
+	})
+	err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKeyWithCondition("document:1", "editor", "user:anne", "in_office", nil),
+	})
+	require.NoError(t, err)
+
+	listUsers := func(ctx context.Context, ds storage.RelationshipTupleReader, objectType, relation string) error {
+		_, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: objectType, Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		return err
+	}
+
+	t.Run("datastore_read", func(t *testing.T) {
+		err := listUsers(ctx, &failingDatastore{OpenFGADatastore: ds}, "document", "viewer")
+		var datastoreErr *DatastoreError
+		require.ErrorAs(t, err, &datastoreErr)
+		require.ErrorIs(t, err, errDatastoreDown)
+	})
+
+	t.Run("datastore_iteration", func(t *testing.T) {
+		err := listUsers(ctx, &failingDatastore{OpenFGADatastore: ds, failIteration: true}, "document", "viewer")
+		var datastoreErr *DatastoreError
+		require.ErrorAs(t, err, &datastoreErr)
+		require.ErrorIs(t, err, errDatastoreDown)
+	})
+
+	t.Run("cancellation_not_a_datastore_error", func(t *testing.T) {
+		require.ErrorIs(t, wrapDatastoreError(context.Canceled), context.Canceled)
+		require.False(t, errors.As(wrapDatastoreError(storage.ErrDeadlineExceeded), new(*DatastoreError)))
+		require.False(t, errors.As(wrapDatastoreError(storage.ErrIteratorDone), new(*DatastoreError)))
+		require.False(t, errors.As(wrapDatastoreError(storage.ErrSnapshotsNotSupported), new(*DatastoreError)))
+		require.False(t, errors.As(wrapDatastoreError(storage.ErrPartitionsNotSupported), new(*DatastoreError)))
+
+		wrapped := wrapDatastoreError(errDatastoreDown)
+		require.Same(t, wrapped, wrapDatastoreError(wrapped))
+	})
+
+	t.Run("model", func(t *testing.T) {
+		// requests for undefined types are rejected by their validation, so the expansion is
+		// reached directly, as through a userset of a type missing from the model
+		foundUsersCh := make(chan foundUser, 1)
+		resp := NewListUsersQuery(ds).expand(ctx, fromListUsersRequest(&openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "folder", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, nil, nil), foundUsersCh)
+		close(foundUsersCh)
+		err := resp.err
+		var modelErr *ModelError
+		require.ErrorAs(t, err, &modelErr)
+		require.Equal(t, "folder", modelErr.ObjectType)
+		require.ErrorIs(t, err, typesystem.ErrObjectTypeUndefined)
+		require.False(t, errors.As(err, new(*DatastoreError)))
+	})
+
+	t.Run("condition_evaluation", func(t *testing.T) {
+		// the ip of the condition is missing from the request context
+		err := listUsers(ctx, ds, "document", "editor")
+		require.ErrorIs(t, err, condition.ErrEvaluationFailed)
+		require.False(t, errors.As(err, new(*DatastoreError)))
+		require.False(t, errors.As(err, new(*ModelError)))
+	})
+}
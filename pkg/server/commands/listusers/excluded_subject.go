@@ -0,0 +1,18 @@
+package listusers
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// withoutUser returns users without the user with the given key. See WithExcludedSubject.
+func withoutUser(users []*openfgav1.User, userKey string) []*openfgav1.User {
+	kept := make([]*openfgav1.User, 0, len(users))
+	for _, user := range users {
+		if tuple.UserProtoToString(user) != userKey {
+			kept = append(kept, user)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,130 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_ExcludedSubject(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, user:*, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@user:jon",
+		"document:2#viewer@user:*",
+		"document:2#viewer@user:jon",
+		"document:2#viewer@user:will",
+	})
+
+	request := func(objectID string, userFilters ...*openfgav1.UserTypeFilter) *openfgav1.ListUsersRequest {
+		return &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: objectID},
+			Relation:    "viewer",
+			UserFilters: userFilters,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		opts          []ListUsersQueryOption
+		req           *openfgav1.ListUsersRequest
+		expectedUsers []string
+	}{
+		{
+			name:          "subject_found_through_several_paths",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon")},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+		{
+			name:          "wildcard_still_returned",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon")},
+			req:           request("2", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:*", "user:will"},
+		},
+		{
+			name:          "userset_subject",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("group:eng#member")},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "group", Relation: "member"}),
+			expectedUsers: []string{},
+		},
+		{
+			name:          "subject_without_the_relation",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:anne")},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:jon", "user:maria"},
+		},
+		{
+			name:          "subject_not_counted_towards_max_results",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon"), WithListUsersMaxResults(1)},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+		{
+			// the size of a single user, which the subject doesn't take up
+			name:          "subject_not_counted_towards_max_response_bytes",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon"), WithListUsersMaxResponseBytes(15)},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+		{
+			name:          "subject_not_sampled",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon"), WithReservoirSample(2)},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+		{
+			name: "subject_dropped_along_with_the_other_collection_options",
+			opts: []ListUsersQueryOption{
+				WithExcludedSubject("user:jon"),
+				WithUserAllowList("user:jon", "user:maria"),
+				WithReservoirSample(1),
+				WithListUsersMaxResults(1),
+			},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+		{
+			name:          "subject_not_added_back_by_expanded_wildcards",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("user:jon"), WithExpandWildcard(true)},
+			req:           request("2", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:will", "user:maria"},
+		},
+		{
+			name:          "subject_folded_to_the_model_casing",
+			opts:          []ListUsersQueryOption{WithExcludedSubject("USER:jon"), WithCaseInsensitiveMatching(true)},
+			req:           request("1", &openfgav1.UserTypeFilter{Type: "user"}),
+			expectedUsers: []string{"user:maria"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, test.opts...).ListUsers(ctx, test.req)
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+		})
+	}
+
+	t.Run("callback", func(t *testing.T) {
+		var users []*openfgav1.User
+		err := NewListUsersQuery(ds, WithExcludedSubject("user:jon")).ListUsersCallback(ctx, request("1", &openfgav1.UserTypeFilter{Type: "user"}), func(user *openfgav1.User) error {
+			users = append(users, user)
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria"}, userStrings(users))
+	})
+}
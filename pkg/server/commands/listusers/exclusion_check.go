@@ -0,0 +1,175 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/openfga/openfga/internal/concurrency"
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/storagewrappers"
+	"github.com/openfga/openfga/pkg/telemetry"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// ExclusionStrategy is how the exclusions are evaluated. See WithExclusionStrategy.
+type ExclusionStrategy int
+
+const (
+	// ExclusionStrategyExpand expands both the base and the subtract of an exclusion, and holds
+	// the users of the subtract to take them out of those of the base.
+	ExclusionStrategyExpand ExclusionStrategy = iota
+
+	// ExclusionStrategyCheck expands the base of an exclusion only, and checks whether each of its
+	// users has the subtract relation as they are found.
+	ExclusionStrategyCheck
+)
+
+// expandExclusionWithCheck evaluates an exclusion whose subtract is the relation subtractRelation
+// of the object by streaming the users of the base and checking the subtract relation for each of
+// them, so that the users of the subtract are never held. The base users the check can't resolve
+// on their own, which are the wildcards, the usersets and the users already found not to have the
+// relation under the base, are held until the base is fully expanded and then evaluated against
+// the expanded subtract, the same way as with ExclusionStrategyExpand.
+func (l *listUsersQuery) expandExclusionWithCheck(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	rewrite *openfgav1.Userset_Difference,
+	subtractRelation string,
+	foundUsersChan chan<- foundUser,
+) expandResponse {
+	ctx, span := startStepSpan(ctx, "expandExclusionWithCheck")
+	defer span.End()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	baseFoundUsersCh := make(chan foundUser, 1)
+	var baseError error
+	go func() {
+		resp := recoverExpansion(func() expandResponse {
+			return l.expandRewrite(ctx, req, rewrite.Difference.GetBase(), baseFoundUsersCh)
+		})
+		baseError = resp.err
+		close(baseFoundUsersCh)
+	}()
+
+	// the checks read the stored and the contextual tuples, like the Check API does
+	typesys, _ := typesystem.TypesystemFromContext(ctx)
+	checkCtx := storage.ContextWithRelationshipTupleReader(ctx,
+		storagewrappers.NewCombinedTupleReader(l.pinned(l.ds, req.snapshotToken), req.GetContextualTuples()),
+	)
+	checker := graph.NewLocalChecker()
+	defer checker.Close()
+	consistency := req.GetConsistency()
+	if l.verifiesExclusion(req, rewrite.Difference.GetSubtract()) {
+		consistency = openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY
+	}
+
+	heldBackUsers := make(map[string]foundUser)
+	checkedUsers := make(map[string]struct{})
+	pool := concurrency.NewPool(checkCtx, int(l.resolveNodeBreadthLimit))
+	for fu := range baseFoundUsersCh {
+		userKey := req.interner.userKey(fu.user)
+		if fu.user.GetObject() == nil || fu.relationshipStatus == NoRelationship || len(fu.excludedUsers) > 0 {
+			heldBackUsers[userKey] = fu
+			continue
+		}
+		if _, checked := checkedUsers[userKey]; checked {
+			continue
+		}
+		checkedUsers[userKey] = struct{}{}
+
+		pool.Go(l.expansionTask(req, "exclusion_check", func(ctx context.Context) error {
+			resp, err := checker.ResolveCheck(ctx, &graph.ResolveCheckRequest{
+				StoreID:              req.GetStoreId(),
+				AuthorizationModelID: typesys.GetAuthorizationModelID(),
+				TupleKey:             tuple.NewTupleKey(tuple.ObjectKey(req.GetObject()), subtractRelation, userKey),
+				ContextualTuples:     req.GetContextualTuples(),
+				Context:              req.GetContext(),
+				RequestMetadata:      graph.NewCheckRequestMetadata(l.resolveNodeLimit),
+				Consistency:          consistency,
+			})
+			if err != nil {
+				return err
+			}
+			req.datastoreQueryCount.Add(resp.GetResolutionMetadata().DatastoreQueryCount)
+
+			relationshipStatus := HasRelationship
+			if resp.GetAllowed() {
+				relationshipStatus = NoRelationship
+			}
+			trySendResult(ctx, foundUser{
+				user:               tuple.StringToUserProto(userKey),
+				relationshipStatus: relationshipStatus,
+			}, foundUsersChan)
+			return nil
+		}))
+	}
+	checkError := pool.Wait()
+
+	var subtractError error
+	if len(heldBackUsers) > 0 && checkError == nil {
+		span.SetAttributes(attribute.Int("held_back_users", len(heldBackUsers)))
+		subtractError = l.sendHeldBackExclusionResults(ctx, req, rewrite, heldBackUsers, foundUsersChan)
+	}
+
+	errs := errors.Join(baseError, checkError, subtractError)
+	if errs != nil {
+		telemetry.TraceError(span, errs)
+	}
+	return expandResponse{
+		err: errs,
+	}
+}
+
+// sendHeldBackExclusionResults expands the subtract of an exclusion and sends the results for the
+// base users held back by expandExclusionWithCheck.
+func (l *listUsersQuery) sendHeldBackExclusionResults(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	rewrite *openfgav1.Userset_Difference,
+	heldBackUsers map[string]foundUser,
+	foundUsersChan chan<- foundUser,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	subtractFoundUsersCh := make(chan foundUser, 1)
+	var resp expandResponse
+	go func() {
+		resp = recoverExpansion(func() expandResponse {
+			return l.expandRewrite(ctx, req, rewrite.Difference.GetSubtract(), subtractFoundUsersCh)
+		})
+		close(subtractFoundUsersCh)
+	}()
+
+	subtractFoundUsersMap := make(map[string]foundUser)
+	subtractSetSizeExceeded := false
+	for fu := range subtractFoundUsersCh {
+		if subtractSetSizeExceeded {
+			continue
+		}
+		subtractFoundUsersMap[req.interner.userKey(fu.user)] = fu
+		if l.maxSubtractSetSize != 0 && len(subtractFoundUsersMap) > int(l.maxSubtractSetSize) {
+			subtractSetSizeExceeded = true
+			cancel()
+		}
+	}
+	if subtractSetSizeExceeded {
+		return ErrMaxSubtractSetSizeExceeded
+	}
+	if resp.err != nil || resp.hasCycle {
+		// like ExclusionStrategyExpand, an exclusion whose subtract has a cycle has no users
+		return resp.err
+	}
+
+	orderedRange(req.deterministic, heldBackUsers, func(userKey string, fu foundUser) {
+		_, baseWildcardExists := heldBackUsers[typedWildcardKey(userKey)]
+		sendExclusionResults(ctx, req, userKey, fu, baseWildcardExists, subtractFoundUsersMap, foundUsersChan)
+	})
+	return nil
+}
@@ -0,0 +1,159 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_ExclusionStrategy(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [user, user:*, employee, group#member]
+		type folder
+			relations
+				define viewer: [user, user:*]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user, user:*, employee, group#member]
+				define allowed: [user, user:*, employee, group#member]
+				define muted: [user] but not allowed
+				define viewer: allowed but not blocked
+				define reader: (allowed or viewer from parent) but not blocked
+				define nested: viewer but not muted
+				define inherited_block: allowed but not viewer from parent`, []string{
+		// document:1 has no wildcard
+		"document:1#allowed@user:jon",
+		"document:1#allowed@user:maria",
+		"document:1#allowed@employee:andres",
+		"document:1#allowed@group:eng#member",
+		"document:1#blocked@user:maria",
+		"document:1#blocked@group:ops#member",
+		"group:eng#member@user:will",
+		"group:eng#member@user:poovam",
+		"group:ops#member@user:poovam",
+
+		// document:2 has a wildcard in the base only
+		"document:2#allowed@user:*",
+		"document:2#allowed@user:jon",
+		"document:2#blocked@user:maria",
+		"document:2#blocked@employee:andres",
+		"document:2#allowed@employee:andres",
+
+		// document:3 has a wildcard in the subtract only
+		"document:3#allowed@user:jon",
+		"document:3#allowed@employee:andres",
+		"document:3#blocked@user:*",
+
+		// document:4 has wildcards in both
+		"document:4#allowed@user:*",
+		"document:4#allowed@user:jon",
+		"document:4#blocked@user:*",
+
+		// document:5 has a wildcard granted through a group and a TTU
+		"document:5#allowed@group:all#member",
+		"group:all#member@user:*",
+		"document:5#parent@folder:x",
+		"folder:x#viewer@user:*",
+		"folder:x#viewer@user:bob",
+		"document:5#blocked@user:jon",
+		"document:5#blocked@group:ops#member",
+
+		// document:6 has exclusions nested under the subtract
+		"document:6#allowed@user:*",
+		"document:6#allowed@user:jon",
+		"document:6#muted@user:jon",
+		"document:6#muted@user:maria",
+		"document:6#muted@user:will",
+		"document:6#allowed@user:will",
+		"document:6#blocked@user:bob",
+	})
+
+	filters := map[string][]*openfgav1.UserTypeFilter{
+		"user":              {{Type: "user"}},
+		"employee":          {{Type: "employee"}},
+		"user_employee":     {{Type: "user"}, {Type: "employee"}},
+		"group_member":      {{Type: "group", Relation: "member"}},
+		"user_group_member": {{Type: "user"}, {Type: "group", Relation: "member"}},
+	}
+
+	listUsers := func(t *testing.T, req *openfgav1.ListUsersRequest, strategy ExclusionStrategy) []string {
+		resp, err := NewListUsersQuery(ds, WithExclusionStrategy(strategy)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	for _, objectID := range []string{"1", "2", "3", "4", "5", "6"} {
+		for _, relation := range []string{"viewer", "reader", "nested", "inherited_block"} {
+			for filterName, userFilters := range filters {
+				t.Run(tuple.ToObjectRelationString("document:"+objectID, relation)+"/"+filterName, func(t *testing.T) {
+					req := &openfgav1.ListUsersRequest{
+						StoreId:     storeID,
+						Object:      &openfgav1.Object{Type: "document", Id: objectID},
+						Relation:    relation,
+						UserFilters: userFilters,
+					}
+					require.ElementsMatch(t, listUsers(t, req, ExclusionStrategyExpand), listUsers(t, req, ExclusionStrategyCheck))
+				})
+			}
+		}
+	}
+
+	t.Run("expected_users", func(t *testing.T) {
+		users := listUsers(t, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, ExclusionStrategyCheck)
+		require.ElementsMatch(t, []string{"user:jon", "user:will"}, users)
+	})
+
+	t.Run("contextual_tuples_checked", func(t *testing.T) {
+		users := listUsers(t, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			ContextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "blocked", "user:jon"),
+			},
+		}, ExclusionStrategyCheck)
+		require.ElementsMatch(t, []string{"user:will"}, users)
+	})
+
+	t.Run("subtract_not_expanded", func(t *testing.T) {
+		var mu sync.Mutex
+		var readRelations []string
+		interceptor := func(_ context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+			mu.Lock()
+			defer mu.Unlock()
+			readRelations = append(readRelations, tupleKey.GetRelation())
+			return nil
+		}
+		resp, err := NewListUsersQuery(ds,
+			WithExclusionStrategy(ExclusionStrategyCheck),
+			WithReadInterceptor(interceptor),
+		).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:will"}, userStrings(resp.GetUsers()))
+		require.NotContains(t, readRelations, "blocked")
+		require.Positive(t, resp.Metadata.DatastoreQueryCount)
+	})
+}
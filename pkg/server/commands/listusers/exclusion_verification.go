@@ -0,0 +1,113 @@
+package listusers
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/internal/concurrency"
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/storagewrappers"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// verifiesExclusion reports whether the results of an exclusion whose subtract is subtract are
+// verified for req. Only the subtracts that are a relation of the object can be checked, and the
+// reads of a request at higher consistency are fresh already.
+func (l *listUsersQuery) verifiesExclusion(req *internalListUsersRequest, subtract *openfgav1.Userset) bool {
+	return l.exclusionVerification &&
+		subtract.GetComputedUserset() != nil &&
+		req.GetConsistency() != openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY
+}
+
+// verifyExclusionResults returns the channel to send the results of an exclusion whose subtract is
+// the relation subtractRelation of the object to, and the function closing it once they are all
+// sent. Each user the results find to have the relation is checked against subtractRelation at
+// higher consistency before it is forwarded to foundUsersChan, and is forwarded as not having the
+// relation if the check finds it subtracted after all. The other results are forwarded as is. The
+// function returned waits for the checks and returns the first error of any of them. See
+// WithExclusionVerification.
+func (l *listUsersQuery) verifyExclusionResults(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	subtractRelation string,
+	foundUsersChan chan<- foundUser,
+) (chan<- foundUser, func() error) {
+	checks := func(fu foundUser) bool {
+		return fu.user.GetObject() != nil && fu.relationshipStatus != NoRelationship && len(fu.excludedUsers) == 0
+	}
+	forward := func(fu foundUser, allowed bool) (foundUser, bool) {
+		if allowed {
+			return foundUser{user: fu.user, relationshipStatus: NoRelationship}, true
+		}
+		return fu, true
+	}
+	return l.checkResults(ctx, req, "exclusion_verification", subtractRelation, openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY, foundUsersChan, checks, forward)
+}
+
+// checkResults returns the channel to send results to, and the function closing it once they are
+// all sent, running the checks as tasks named task. The users of the results for which checks returns true are checked against the
+// relation of the object at the consistency given, and the results are forwarded to
+// foundUsersChan as returned by forward, unless it returns false. The other results are forwarded
+// as is. The function returned waits for the checks and returns the first error of any of them.
+func (l *listUsersQuery) checkResults(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	task string,
+	relation string,
+	consistency openfgav1.ConsistencyPreference,
+	foundUsersChan chan<- foundUser,
+	checks func(foundUser) bool,
+	forward func(fu foundUser, allowed bool) (foundUser, bool),
+) (chan<- foundUser, func() error) {
+	// the checks read the stored and the contextual tuples, like the Check API does
+	typesys, _ := typesystem.TypesystemFromContext(ctx)
+	checkCtx := storage.ContextWithRelationshipTupleReader(ctx,
+		storagewrappers.NewCombinedTupleReader(l.pinned(l.ds, req.snapshotToken), req.GetContextualTuples()),
+	)
+	checker := graph.NewLocalChecker()
+	pool := concurrency.NewPool(checkCtx, int(l.resolveNodeBreadthLimit))
+
+	resultsCh := make(chan foundUser, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for fu := range resultsCh {
+			if !checks(fu) {
+				trySendResult(ctx, fu, foundUsersChan)
+				continue
+			}
+
+			pool.Go(l.expansionTask(req, task, func(ctx context.Context) error {
+				resp, err := checker.ResolveCheck(ctx, &graph.ResolveCheckRequest{
+					StoreID:              req.GetStoreId(),
+					AuthorizationModelID: typesys.GetAuthorizationModelID(),
+					TupleKey:             tuple.NewTupleKey(tuple.ObjectKey(req.GetObject()), relation, tuple.UserProtoToString(fu.user)),
+					ContextualTuples:     req.GetContextualTuples(),
+					Context:              req.GetContext(),
+					RequestMetadata:      graph.NewCheckRequestMetadata(l.resolveNodeLimit),
+					Consistency:          consistency,
+				})
+				if err != nil {
+					return err
+				}
+				req.datastoreQueryCount.Add(resp.GetResolutionMetadata().DatastoreQueryCount)
+
+				if fu, ok := forward(fu, resp.GetAllowed()); ok {
+					trySendResult(ctx, fu, foundUsersChan)
+				}
+				return nil
+			}))
+		}
+	}()
+
+	return resultsCh, func() error {
+		close(resultsCh)
+		<-done
+		err := pool.Wait()
+		checker.Close()
+		return err
+	}
+}
@@ -0,0 +1,162 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// staleDatastore hides the stale tuples from the reads that aren't at higher consistency, as a
+// replica lagging behind the writes would, and counts the reads at higher consistency.
+type staleDatastore struct {
+	storage.OpenFGADatastore
+
+	stale map[string]struct{}
+
+	mu                        sync.Mutex
+	higherConsistencyTuples   []string
+	higherConsistencyReadKeys []string
+}
+
+func (s *staleDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	iter, err := s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Consistency.Preference == openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY {
+		s.mu.Lock()
+		s.higherConsistencyReadKeys = append(s.higherConsistencyReadKeys, tuple.TupleKeyToString(tupleKey))
+		s.mu.Unlock()
+		return iter, nil
+	}
+	defer iter.Stop()
+
+	var tuples []*openfgav1.Tuple
+	for {
+		t, err := iter.Next(ctx)
+		if err != nil {
+			if errors.Is(err, storage.ErrIteratorDone) {
+				break
+			}
+			return nil, err
+		}
+		if _, stale := s.stale[tuple.TupleKeyToString(t.GetKey())]; !stale {
+			tuples = append(tuples, t)
+		}
+	}
+	return storage.NewStaticTupleIterator(tuples), nil
+}
+
+func (s *staleDatastore) ReadUserTuple(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadUserTupleOptions,
+) (*openfgav1.Tuple, error) {
+	if options.Consistency.Preference == openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY {
+		s.mu.Lock()
+		s.higherConsistencyTuples = append(s.higherConsistencyTuples, tuple.TupleKeyToString(tupleKey))
+		s.mu.Unlock()
+	} else if _, stale := s.stale[tuple.TupleKeyToString(tupleKey)]; stale {
+		return nil, storage.ErrNotFound
+	}
+	return s.OpenFGADatastore.ReadUserTuple(ctx, storeID, tupleKey, options)
+}
+
+func TestListUsersConfig_ExclusionVerification(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define blocked: [user]
+				define member: [user, user:*]
+				define viewer: member but not blocked`, []string{
+		"document:1#member@user:jon",
+		"document:1#member@user:anne",
+		"document:1#member@user:will",
+		"document:1#blocked@user:will",
+		"document:1#blocked@user:anne",
+		"document:2#member@user:*",
+		"document:2#blocked@user:anne",
+	})
+
+	// anne was blocked after the replicas were last updated
+	newDatastore := func() *staleDatastore {
+		return &staleDatastore{
+			OpenFGADatastore: ds,
+			stale: map[string]struct{}{
+				"document:1#blocked@user:anne": {},
+				"document:2#blocked@user:anne": {},
+			},
+		}
+	}
+	listUsers := func(ds storage.RelationshipTupleReader, objectID string, consistency openfgav1.ConsistencyPreference, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: objectID},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			Consistency: consistency,
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	t.Run("stale_without_verification", func(t *testing.T) {
+		staleDS := newDatastore()
+		require.ElementsMatch(t, []string{"user:jon", "user:anne"}, listUsers(staleDS, "1", openfgav1.ConsistencyPreference_UNSPECIFIED))
+		require.Empty(t, staleDS.higherConsistencyTuples)
+	})
+
+	for name, strategy := range map[string]ExclusionStrategy{
+		"verified_with_expand_strategy": ExclusionStrategyExpand,
+		"verified_with_check_strategy":  ExclusionStrategyCheck,
+	} {
+		t.Run(name, func(t *testing.T) {
+			staleDS := newDatastore()
+			users := listUsers(staleDS, "1", openfgav1.ConsistencyPreference_UNSPECIFIED,
+				WithExclusionVerification(true),
+				WithExclusionStrategy(strategy),
+			)
+			require.ElementsMatch(t, []string{"user:jon"}, users)
+
+			// with the expand strategy, will is subtracted by the stale reads already
+			expectedChecks := []string{"document:1#blocked@user:jon", "document:1#blocked@user:anne"}
+			if strategy == ExclusionStrategyCheck {
+				expectedChecks = append(expectedChecks, "document:1#blocked@user:will")
+			}
+			require.ElementsMatch(t, expectedChecks, staleDS.higherConsistencyTuples)
+			require.Empty(t, staleDS.higherConsistencyReadKeys)
+		})
+	}
+
+	t.Run("wildcard_base", func(t *testing.T) {
+		// the wildcard is returned as is, and so are its exclusions, as they are found by the
+		// expansion of the subtract
+		staleDS := newDatastore()
+		users := listUsers(staleDS, "2", openfgav1.ConsistencyPreference_UNSPECIFIED, WithExclusionVerification(true))
+		require.ElementsMatch(t, []string{"user:*"}, users)
+		require.Empty(t, staleDS.higherConsistencyTuples)
+	})
+
+	t.Run("not_verified_at_higher_consistency", func(t *testing.T) {
+		staleDS := newDatastore()
+		users := listUsers(staleDS, "1", openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY, WithExclusionVerification(true))
+		require.ElementsMatch(t, []string{"user:jon"}, users)
+		require.Empty(t, staleDS.higherConsistencyTuples)
+	})
+}
@@ -0,0 +1,251 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// expandBenchmark is a model and the tuples of a store it is seeded with, along with the number
+// of users document:1#viewer has in it.
+type expandBenchmark struct {
+	name   string
+	model  string
+	tuples func() []string
+	users  int
+}
+
+var expandBenchmarks = []expandBenchmark{
+	{
+		// 10000 users assigned directly
+		name: "wide_direct",
+		model: `
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define viewer: [user]`,
+		tuples: func() []string {
+			tuples := make([]string, 0, 10000)
+			for u := 0; u < 10000; u++ {
+				tuples = append(tuples, fmt.Sprintf("document:1#viewer@user:%d", u))
+			}
+			return tuples
+		},
+		users: 10000,
+	},
+	{
+		// a chain of 20 nested groups of 10 users each, within the default resolve node limit
+		name: "deep_group_nesting",
+		model: `
+			model
+				schema 1.1
+			type user
+			type group
+				relations
+					define member: [user, group#member]
+			type document
+				relations
+					define viewer: [group#member]`,
+		tuples: func() []string {
+			tuples := []string{"document:1#viewer@group:0#member"}
+			for g := 0; g < 20; g++ {
+				if g > 0 {
+					tuples = append(tuples, fmt.Sprintf("group:%d#member@group:%d#member", g-1, g))
+				}
+				for u := 0; u < 10; u++ {
+					tuples = append(tuples, fmt.Sprintf("group:%d#member@user:%d-%d", g, g, u))
+				}
+			}
+			return tuples
+		},
+		users: 200,
+	},
+	{
+		// 500 parent folders of 10 viewers each
+		name: "heavy_ttu",
+		model: `
+			model
+				schema 1.1
+			type user
+			type folder
+				relations
+					define viewer: [user]
+			type document
+				relations
+					define parent: [folder]
+					define viewer: [user] or viewer from parent`,
+		tuples: func() []string {
+			var tuples []string
+			for f := 0; f < 500; f++ {
+				tuples = append(tuples, fmt.Sprintf("document:1#parent@folder:%d", f))
+				for u := 0; u < 10; u++ {
+					tuples = append(tuples, fmt.Sprintf("folder:%d#viewer@user:%d-%d", f, f, u))
+				}
+			}
+			return tuples
+		},
+		users: 5000,
+	},
+	{
+		// 20 operands of 500 users each, every operand sharing half of its users with the next
+		name: "wide_union",
+		model: `
+			model
+				schema 1.1
+			type user
+			type document
+				relations` + numberedRelations(20, "[user]") + `
+					define viewer: ` + strings.Join(numberedRelationNames(20), " or "),
+		tuples: func() []string {
+			var tuples []string
+			for r := 0; r < 20; r++ {
+				for u := 0; u < 500; u++ {
+					tuples = append(tuples, fmt.Sprintf("document:1#r%d@user:%d", r, r*250+u))
+				}
+			}
+			return tuples
+		},
+		users: 19*250 + 500,
+	},
+	{
+		// two operands of 5000 users each, half of which are in both
+		name: "intersection",
+		model: `
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define allowed: [user]
+					define member: [user]
+					define viewer: member and allowed`,
+		tuples: func() []string {
+			var tuples []string
+			for u := 0; u < 5000; u++ {
+				tuples = append(tuples,
+					fmt.Sprintf("document:1#member@user:%d", u),
+					fmt.Sprintf("document:1#allowed@user:%d", u+2500),
+				)
+			}
+			return tuples
+		},
+		users: 2500,
+	},
+	{
+		// 5000 users, half of which are blocked
+		name: "exclusion",
+		model: `
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define blocked: [user]
+					define member: [user]
+					define viewer: member but not blocked`,
+		tuples: func() []string {
+			var tuples []string
+			for u := 0; u < 5000; u++ {
+				tuples = append(tuples, fmt.Sprintf("document:1#member@user:%d", u))
+				if u%2 == 0 {
+					tuples = append(tuples, fmt.Sprintf("document:1#blocked@user:%d", u))
+				}
+			}
+			return tuples
+		},
+		users: 2500,
+	},
+}
+
+func numberedRelationNames(count int) []string {
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		names = append(names, fmt.Sprintf("r%d", i))
+	}
+	return names
+}
+
+func numberedRelations(count int, typeRestrictions string) string {
+	var relations strings.Builder
+	for _, name := range numberedRelationNames(count) {
+		relations.WriteString(fmt.Sprintf("\n\t\t\t\t\tdefine %s: %s", name, typeRestrictions))
+	}
+	return relations.String()
+}
+
+// BenchmarkListUsersExpand lists the users of models exercising each kind of rewrite, as the
+// baseline of the expansion's performance. Besides the time and allocations, it reports the
+// datastore reads of each listing.
+func BenchmarkListUsersExpand(b *testing.B) {
+	for _, bm := range expandBenchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ds := memory.New()
+			b.Cleanup(ds.Close)
+
+			storeID, model := storagetest.BootstrapFGAStore(b, ds, bm.model, bm.tuples())
+			typesys, err := typesystem.NewAndValidate(context.Background(), model)
+			require.NoError(b, err)
+			ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+			req := &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			}
+
+			var reads uint32
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				resp, err := NewListUsersQuery(ds, WithListUsersMaxResults(0)).ListUsers(ctx, req)
+				require.NoError(b, err)
+				require.Len(b, resp.GetUsers(), bm.users)
+				reads += resp.GetMetadata().DatastoreQueryCount
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// BenchmarkListUsersDedupCollector deduplicates 2 million users found, like the collector of
+// ListUsers does, out of 200000 unique users whose IDs come in pairs differing by their last
+// character only, each of them found 10 times.
+func BenchmarkListUsersDedupCollector(b *testing.B) {
+	const (
+		uniqueUsers = 200000
+		repeats     = 10
+	)
+
+	users := make([]*openfgav1.User, 0, uniqueUsers)
+	for u := 0; u < uniqueUsers/2; u++ {
+		users = append(users,
+			tuple.StringToUserProto(fmt.Sprintf("user:employee-%08d-a", u)),
+			tuple.StringToUserProto(fmt.Sprintf("user:employee-%08d-b", u)),
+		)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		interner := newUserKeyInterner()
+		foundUsersUnique := newUniqueUserSet(interner, 0)
+		for r := 0; r < repeats; r++ {
+			for _, user := range users {
+				foundUsersUnique.put(interner.userKey(user), foundUser{user: user})
+			}
+		}
+		require.Equal(b, uniqueUsers, foundUsersUnique.len())
+	}
+}
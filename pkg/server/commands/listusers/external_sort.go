@@ -0,0 +1,281 @@
+package listusers
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+const defaultExternalSortRunSize = 100000
+
+// ExternalSortConfig configures how ListUsersSorted sorts the users it finds.
+type ExternalSortConfig struct {
+	// Dir is the directory the sorted runs are written to. Defaults to os.TempDir.
+	Dir string
+
+	// RunSize is the number of users held in memory before they are sorted and written to disk
+	// as a run. Defaults to 100000.
+	RunSize int
+}
+
+// errSortedLimitReached stops the merge of ListUsersSorted once enough users are returned.
+var errSortedLimitReached = errors.New("sorted results limit reached")
+
+// ListUsersSorted calls callback with each unique user that has the relation with the object, in
+// the ascending order of their string. The users are sorted with an external merge sort: as they
+// are found, they are written to disk in sorted runs of ExternalSortConfig.RunSize users, which
+// are merged once the expansion is complete, so that sorting a large number of users doesn't
+// require holding them all in memory. The runs are removed before it returns.
+//
+// Like with ListUsersCallback, the users are only streamed to the runs if no exclusion is
+// reachable from the relation and neither a userset cover, a user allow list nor expanded
+// wildcards are requested. Otherwise they are all found first, and then sorted the same way. A
+// maximum number of results applies to the sorted users, so the first ones in order are
+// returned, whereas the maximum size of the response doesn't apply. If the max results or a limit
+// such as the deadline cut the listing short, ErrIncompleteResults is returned once the users
+// found are passed on.
+func (l *listUsersQuery) ListUsersSorted(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(*openfgav1.User) error,
+) error {
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	sorter := newExternalSorter(l.externalSort)
+	defer sorter.close()
+
+	q := *l
+	q.maxResults = 0
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.pageSize = 0
+	q.skipResultMetrics = true
+	q.requestCoalescing = false
+	if l.streamsFoundUsers(typesys, req) {
+		q.streamUnions = true
+		q.onFoundUser = sorter.add
+		q.discardFoundUsers = true
+	}
+	resp, err := q.ListUsers(ctx, req)
+	if err != nil {
+		return err
+	}
+	for _, user := range resp.GetUsers() {
+		if err := sorter.add(user); err != nil {
+			return err
+		}
+	}
+
+	var returned uint32
+	err = sorter.merge(func(key string) error {
+		if l.maxResults > 0 && returned >= l.maxResults {
+			return errSortedLimitReached
+		}
+		returned++
+		return callback(tuple.StringToUserProto(key))
+	})
+	if errors.Is(err, errSortedLimitReached) {
+		l.observeResultSize(req, int(returned), true)
+		return ErrIncompleteResults
+	}
+	if err != nil {
+		return err
+	}
+	l.observeResultSize(req, int(returned), false)
+	if !resp.Metadata.Complete {
+		return ErrIncompleteResults
+	}
+	return nil
+}
+
+// externalSorter sorts and deduplicates user strings, spilling them to sorted runs on disk once
+// more than a run of them are held in memory. It isn't safe for concurrent use.
+type externalSorter struct {
+	dir     string
+	runSize int
+	keys    []string
+	runs    []*os.File
+}
+
+func newExternalSorter(config ExternalSortConfig) *externalSorter {
+	runSize := config.RunSize
+	if runSize <= 0 {
+		runSize = defaultExternalSortRunSize
+	}
+	return &externalSorter{
+		dir:     config.Dir,
+		runSize: runSize,
+	}
+}
+
+// add adds the user, and spills the users held in memory to a run if there is a run of them.
+func (s *externalSorter) add(user *openfgav1.User) error {
+	s.keys = append(s.keys, tuple.UserProtoToString(user))
+	if len(s.keys) >= s.runSize {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the users held in memory to a new run, sorted and without duplicates, each one
+// prefixed with its length.
+func (s *externalSorter) spill() error {
+	f, err := os.CreateTemp(s.dir, "listusers-run-*")
+	if err != nil {
+		return fmt.Errorf("failed to create a sorted run: %w", err)
+	}
+	s.runs = append(s.runs, f)
+
+	w := bufio.NewWriter(f)
+	var length [binary.MaxVarintLen64]byte
+	for _, key := range sortedUnique(s.keys) {
+		n := binary.PutUvarint(length[:], uint64(len(key)))
+		if _, err := w.Write(length[:n]); err != nil {
+			return fmt.Errorf("failed to write a sorted run: %w", err)
+		}
+		if _, err := w.WriteString(key); err != nil {
+			return fmt.Errorf("failed to write a sorted run: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write a sorted run: %w", err)
+	}
+
+	s.keys = s.keys[:0]
+	return nil
+}
+
+// merge calls fn with each unique user added, in ascending order, and stops at the first error.
+func (s *externalSorter) merge(fn func(key string) error) error {
+	if len(s.runs) == 0 {
+		for _, key := range sortedUnique(s.keys) {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(s.keys) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	runs := make(sortedRunHeap, 0, len(s.runs))
+	for _, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read a sorted run: %w", err)
+		}
+		run := &sortedRun{r: bufio.NewReader(f)}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			runs = append(runs, run)
+		}
+	}
+	heap.Init(&runs)
+
+	last := ""
+	for runs.Len() > 0 {
+		run := runs[0]
+		// the same user may be in several runs, but only once in each
+		if run.key != last {
+			last = run.key
+			if err := fn(last); err != nil {
+				return err
+			}
+		}
+
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&runs, 0)
+		} else {
+			heap.Pop(&runs)
+		}
+	}
+	return nil
+}
+
+// close removes the runs written to disk.
+func (s *externalSorter) close() {
+	for _, f := range s.runs {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	s.runs = nil
+}
+
+// sortedUnique sorts keys in place and returns them without duplicates.
+func sortedUnique(keys []string) []string {
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// sortedRun reads the users of a run written by externalSorter.spill.
+type sortedRun struct {
+	r   *bufio.Reader
+	key string
+}
+
+// next reads the next user of the run into key, and reports whether there was one.
+func (r *sortedRun) next() (bool, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read a sorted run: %w", err)
+	}
+
+	key := make([]byte, length)
+	if _, err := io.ReadFull(r.r, key); err != nil {
+		return false, fmt.Errorf("failed to read a sorted run: %w", err)
+	}
+	r.key = string(key)
+	return true, nil
+}
+
+// sortedRunHeap orders runs by their current user.
+type sortedRunHeap []*sortedRun
+
+func (h sortedRunHeap) Len() int           { return len(h) }
+func (h sortedRunHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h sortedRunHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *sortedRunHeap) Push(x any) {
+	*h = append(*h, x.(*sortedRun))
+}
+
+func (h *sortedRunHeap) Pop() any {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
@@ -0,0 +1,133 @@
+package listusers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestExternalSorter(t *testing.T) {
+	dir := t.TempDir()
+	sorter := newExternalSorter(ExternalSortConfig{Dir: dir, RunSize: 3})
+
+	for _, user := range []string{"user:c", "user:a", "user:c", "user:b", "user:e", "user:a", "user:d", "user:b"} {
+		require.NoError(t, sorter.add(tuple.StringToUserProto(user)))
+	}
+	require.Len(t, sorter.runs, 2)
+
+	var merged []string
+	require.NoError(t, sorter.merge(func(key string) error {
+		merged = append(merged, key)
+		return nil
+	}))
+	require.Equal(t, []string{"user:a", "user:b", "user:c", "user:d", "user:e"}, merged)
+
+	sorter.close()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestListUsersConfig_ExternalSort(t *testing.T) {
+	const numGroups = 10
+	const usersPerGroup = 20
+	tuples := []string{}
+	expected := map[string]struct{}{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#viewer@group:%d#member", i))
+		for j := 0; j < usersPerGroup; j++ {
+			// consecutive groups share half of their users
+			user := fmt.Sprintf("user:%03d", i*usersPerGroup/2+j)
+			tuples = append(tuples, fmt.Sprintf("group:%d#member@%s", i, user))
+			expected[user] = struct{}{}
+		}
+	}
+	tuples = append(tuples,
+		"document:1#blocked@user:000",
+		"document:1#blocked@user:050",
+	)
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user]
+				define viewer: [group#member]
+				define allowed: viewer but not blocked`, tuples)
+
+	expectedUsers := make([]string, 0, len(expected))
+	for user := range expected {
+		expectedUsers = append(expectedUsers, user)
+	}
+	sort.Strings(expectedUsers)
+
+	listUsersSorted := func(t *testing.T, relation string, opts ...ListUsersQueryOption) ([]string, error) {
+		dir := t.TempDir()
+		opts = append(opts, WithExternalSort(ExternalSortConfig{Dir: dir, RunSize: 7}))
+
+		var users []string
+		err := NewListUsersQuery(ds, opts...).ListUsersSorted(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, func(user *openfgav1.User) error {
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+
+		entries, readErr := os.ReadDir(dir)
+		require.NoError(t, readErr)
+		require.Empty(t, entries)
+		return users, err
+	}
+
+	t.Run("globally_sorted_and_deduplicated", func(t *testing.T) {
+		users, err := listUsersSorted(t, "viewer")
+		require.NoError(t, err)
+		require.Equal(t, expectedUsers, users)
+	})
+
+	t.Run("exclusion_reachable", func(t *testing.T) {
+		allowed := append(append([]string{}, expectedUsers[1:50]...), expectedUsers[51:]...)
+		users, err := listUsersSorted(t, "allowed")
+		require.NoError(t, err)
+		require.Equal(t, allowed, users)
+	})
+
+	t.Run("max_results_returns_the_first_users", func(t *testing.T) {
+		users, err := listUsersSorted(t, "viewer", WithListUsersMaxResults(5))
+		require.ErrorIs(t, err, ErrIncompleteResults)
+		require.Equal(t, expectedUsers[:5], users)
+	})
+
+	t.Run("max_results_not_reached", func(t *testing.T) {
+		users, err := listUsersSorted(t, "viewer", WithListUsersMaxResults(uint32(len(expectedUsers))))
+		require.NoError(t, err)
+		require.Equal(t, expectedUsers, users)
+	})
+
+	t.Run("callback_error_returned", func(t *testing.T) {
+		callbackErr := fmt.Errorf("callback failed")
+		err := NewListUsersQuery(ds, WithExternalSort(ExternalSortConfig{Dir: t.TempDir(), RunSize: 7})).ListUsersSorted(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, func(*openfgav1.User) error {
+			return callbackErr
+		})
+		require.ErrorIs(t, err, callbackErr)
+	})
+}
@@ -0,0 +1,222 @@
+package listusers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// SupportsListUsers reports whether ListUsers can fully resolve the users of objectType#relation
+// matching userFilters in the model, and if it can't, the reason why. It only analyzes the model,
+// without reading any tuples, so that clients can find out up front whether a request would fail
+// rather than issue it. The requests it reports as unsupported are those for an undefined type or
+// relation, those with a user filter on an undefined type or relation, those for a relation that
+// isn't enumerable, and those depending on a construct rejected by the model feature checks.
+func SupportsListUsers(
+	typesys *typesystem.TypeSystem,
+	objectType, relation string,
+	userFilters []*openfgav1.UserTypeFilter,
+) (bool, string) {
+	if _, ok := typesys.GetTypeDefinition(objectType); !ok {
+		return false, fmt.Sprintf("type '%s' is not defined", objectType)
+	}
+	if _, err := typesys.GetRelation(objectType, relation); err != nil {
+		return false, fmt.Sprintf("relation '%s#%s' is not defined", objectType, relation)
+	}
+
+	for _, filter := range userFilters {
+		if _, ok := typesys.GetTypeDefinition(filter.GetType()); !ok {
+			return false, fmt.Sprintf("user filter type '%s' is not defined", filter.GetType())
+		}
+		if filter.GetRelation() == "" || filter.GetRelation() == AnyRelation {
+			continue
+		}
+		if _, err := typesys.GetRelation(filter.GetType(), filter.GetRelation()); err != nil {
+			return false, fmt.Sprintf("user filter relation '%s#%s' is not defined", filter.GetType(), filter.GetRelation())
+		}
+	}
+
+	if !typesys.IsRelationEnumerable(objectType, relation) {
+		return false, fmt.Sprintf("relation '%s#%s' is not enumerable", objectType, relation)
+	}
+
+	if err := checkModelFeatures(typesys, objectType, relation); err != nil {
+		var unsupportedErr *UnsupportedModelFeatureError
+		if errors.As(err, &unsupportedErr) {
+			return false, fmt.Sprintf("%s in relation '%s#%s'", unsupportedErr.Feature, unsupportedErr.ObjectType, unsupportedErr.Relation)
+		}
+		return false, err.Error()
+	}
+
+	return true, ""
+}
+
+// maxCheckedModelFeatures is the number of relations whose features checkedModelFeatures holds
+// before it is cleared.
+const maxCheckedModelFeatures = 10000
+
+type modelFeaturesKey struct {
+	typesys              *typesystem.TypeSystem
+	objectType, relation string
+}
+
+// checkedModelFeatures memoizes checkModelFeatures by typesystem, since a typesystem never changes
+// and the server reuses the typesystem of a model across its requests. It is cleared once full, so
+// that it doesn't hold on to the typesystems of the models no longer used.
+var checkedModelFeatures = struct {
+	sync.Mutex
+	errs map[modelFeaturesKey]error
+}{errs: make(map[modelFeaturesKey]error)}
+
+// checkModelFeaturesOnce returns the error of checkModelFeatures, walking the relations of a
+// typesystem only the first time objectType#relation is listed.
+func checkModelFeaturesOnce(typesys *typesystem.TypeSystem, objectType, relation string) error {
+	key := modelFeaturesKey{typesys: typesys, objectType: objectType, relation: relation}
+	checkedModelFeatures.Lock()
+	err, ok := checkedModelFeatures.errs[key]
+	checkedModelFeatures.Unlock()
+	if ok {
+		return err
+	}
+
+	err = checkModelFeatures(typesys, objectType, relation)
+
+	checkedModelFeatures.Lock()
+	defer checkedModelFeatures.Unlock()
+	if len(checkedModelFeatures.errs) >= maxCheckedModelFeatures {
+		clear(checkedModelFeatures.errs)
+	}
+	checkedModelFeatures.errs[key] = err
+	return err
+}
+
+// checkModelFeatures walks every relation reachable from objectType#relation and returns an
+// *UnsupportedModelFeatureError for the first construct that ListUsers cannot resolve correctly.
+// Failing up front is preferred over returning wrong or empty results. The constructs rejected are:
+//   - models with an unsupported schema version
+//   - rewrites that don't define any userset
+//   - computed usersets and tuplesets that reference a specific object (schema 1.0 only)
+//   - tupleset relations whose type restrictions include usersets or wildcards
+func checkModelFeatures(typesys *typesystem.TypeSystem, objectType, relation string) error {
+	if !typesystem.IsSchemaVersionSupported(typesys.GetSchemaVersion()) {
+		return &UnsupportedModelFeatureError{
+			ObjectType: objectType,
+			Relation:   relation,
+			Feature:    fmt.Sprintf("schema version '%s'", typesys.GetSchemaVersion()),
+		}
+	}
+
+	return checkRelationFeatures(typesys, objectType, relation, map[string]struct{}{})
+}
+
+func checkRelationFeatures(typesys *typesystem.TypeSystem, objectType, relation string, visited map[string]struct{}) error {
+	key := tuple.ToObjectRelationString(objectType, relation)
+	if _, ok := visited[key]; ok {
+		return nil
+	}
+	visited[key] = struct{}{}
+
+	rel, err := typesys.GetRelation(objectType, relation)
+	if err != nil {
+		if errors.Is(err, typesystem.ErrObjectTypeUndefined) || errors.Is(err, typesystem.ErrRelationUndefined) {
+			// expansion treats undefined relations as having no users
+			return nil
+		}
+		return err
+	}
+
+	return checkRewriteFeatures(typesys, objectType, relation, rel.GetRewrite(), visited)
+}
+
+func checkRewriteFeatures(
+	typesys *typesystem.TypeSystem,
+	objectType, relation string,
+	rewrite *openfgav1.Userset,
+	visited map[string]struct{},
+) error {
+	unsupported := func(feature string) error {
+		return &UnsupportedModelFeatureError{
+			ObjectType: objectType,
+			Relation:   relation,
+			Feature:    feature,
+		}
+	}
+
+	switch rw := rewrite.GetUserset().(type) {
+	case *openfgav1.Userset_This:
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, relation)
+		if err != nil {
+			return err
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if relatedType.GetRelation() == "" {
+				continue
+			}
+			if err := checkRelationFeatures(typesys, relatedType.GetType(), relatedType.GetRelation(), visited); err != nil {
+				return err
+			}
+		}
+	case *openfgav1.Userset_ComputedUserset:
+		if rw.ComputedUserset.GetObject() != "" {
+			return unsupported("computed userset referencing an object")
+		}
+		return checkRelationFeatures(typesys, objectType, rw.ComputedUserset.GetRelation(), visited)
+	case *openfgav1.Userset_TupleToUserset:
+		tupleset := rw.TupleToUserset.GetTupleset()
+		if tupleset.GetObject() != "" || rw.TupleToUserset.GetComputedUserset().GetObject() != "" {
+			return unsupported("tuple to userset referencing an object")
+		}
+
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, tupleset.GetRelation())
+		if err != nil {
+			if errors.Is(err, typesystem.ErrRelationUndefined) {
+				return nil
+			}
+			return err
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if relatedType.GetRelation() != "" || relatedType.GetWildcard() != nil {
+				return unsupported(fmt.Sprintf(
+					"tupleset relation '%s' with type restriction '%s'",
+					tupleset.GetRelation(),
+					typesystem.GetRelationReferenceAsString(relatedType),
+				))
+			}
+			if err := checkRelationFeatures(typesys, relatedType.GetType(), rw.TupleToUserset.GetComputedUserset().GetRelation(), visited); err != nil {
+				return err
+			}
+		}
+	case *openfgav1.Userset_Union:
+		return checkChildrenFeatures(typesys, objectType, relation, rw.Union.GetChild(), visited)
+	case *openfgav1.Userset_Intersection:
+		return checkChildrenFeatures(typesys, objectType, relation, rw.Intersection.GetChild(), visited)
+	case *openfgav1.Userset_Difference:
+		return checkChildrenFeatures(typesys, objectType, relation, []*openfgav1.Userset{
+			rw.Difference.GetBase(),
+			rw.Difference.GetSubtract(),
+		}, visited)
+	default:
+		return unsupported("rewrite without a userset")
+	}
+
+	return nil
+}
+
+func checkChildrenFeatures(
+	typesys *typesystem.TypeSystem,
+	objectType, relation string,
+	children []*openfgav1.Userset,
+	visited map[string]struct{},
+) error {
+	for _, child := range children {
+		if err := checkRewriteFeatures(typesys, objectType, relation, child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/testutils"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestCheckModelFeatures(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	documentWithRelations := func(schemaVersion string, relations map[string]*openfgav1.Userset, metadata map[string]*openfgav1.RelationMetadata) *openfgav1.AuthorizationModel {
+		return &openfgav1.AuthorizationModel{
+			Id:            "01HVMMBCMGZNT3SED4Z17ECXCA",
+			SchemaVersion: schemaVersion,
+			TypeDefinitions: []*openfgav1.TypeDefinition{
+				{Type: "user"},
+				{
+					Type: "group",
+					Relations: map[string]*openfgav1.Userset{
+						"member": typesystem.This(),
+					},
+					Metadata: &openfgav1.Metadata{
+						Relations: map[string]*openfgav1.RelationMetadata{
+							"member": {DirectlyRelatedUserTypes: []*openfgav1.RelationReference{
+								typesystem.DirectRelationReference("user", ""),
+							}},
+						},
+					},
+				},
+				{
+					Type:      "document",
+					Relations: relations,
+					Metadata:  &openfgav1.Metadata{Relations: metadata},
+				},
+			},
+		}
+	}
+
+	directUsers := &openfgav1.RelationMetadata{
+		DirectlyRelatedUserTypes: []*openfgav1.RelationReference{
+			typesystem.DirectRelationReference("user", ""),
+		},
+	}
+
+	testCases := map[string]struct {
+		model           *openfgav1.AuthorizationModel
+		expectedFeature string
+	}{
+		`supported_model`: {
+			model: testutils.MustTransformDSLToProtoWithID(`
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define member: [user, group#member]
+				type folder
+					relations
+						define viewer: [user, user:*, group#member]
+				type document
+					relations
+						define parent: [folder]
+						define blocked: [user]
+						define allowed: [user]
+						define viewer: (viewer from parent or allowed) but not blocked
+						define editor: viewer and allowed`),
+		},
+		`unsupported_schema_version`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_0, map[string]*openfgav1.Userset{
+				"viewer": typesystem.This(),
+			}, nil),
+			expectedFeature: "schema version '1.0'",
+		},
+		`rewrite_without_userset`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"viewer": {},
+			}, nil),
+			expectedFeature: "rewrite without a userset",
+		},
+		`rewrite_without_userset_nested_in_union`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"viewer": typesystem.Union(typesystem.This(), &openfgav1.Userset{}),
+			}, map[string]*openfgav1.RelationMetadata{
+				"viewer": directUsers,
+			}),
+			expectedFeature: "rewrite without a userset",
+		},
+		`computed_userset_referencing_an_object`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"owner": typesystem.This(),
+				"viewer": {Userset: &openfgav1.Userset_ComputedUserset{
+					ComputedUserset: &openfgav1.ObjectRelation{Object: "document:1", Relation: "owner"},
+				}},
+			}, map[string]*openfgav1.RelationMetadata{
+				"owner": directUsers,
+			}),
+			expectedFeature: "computed userset referencing an object",
+		},
+		`tuple_to_userset_referencing_an_object`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"parent": typesystem.This(),
+				"viewer": {Userset: &openfgav1.Userset_TupleToUserset{
+					TupleToUserset: &openfgav1.TupleToUserset{
+						Tupleset:        &openfgav1.ObjectRelation{Object: "document:1", Relation: "parent"},
+						ComputedUserset: &openfgav1.ObjectRelation{Relation: "member"},
+					},
+				}},
+			}, map[string]*openfgav1.RelationMetadata{
+				"parent": {DirectlyRelatedUserTypes: []*openfgav1.RelationReference{
+					typesystem.DirectRelationReference("group", ""),
+				}},
+			}),
+			expectedFeature: "tuple to userset referencing an object",
+		},
+		`tupleset_with_userset_type_restriction`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"parent": typesystem.This(),
+				"viewer": typesystem.TupleToUserset("parent", "member"),
+			}, map[string]*openfgav1.RelationMetadata{
+				"parent": {DirectlyRelatedUserTypes: []*openfgav1.RelationReference{
+					typesystem.DirectRelationReference("group", "member"),
+				}},
+			}),
+			expectedFeature: "tupleset relation 'parent' with type restriction 'group#member'",
+		},
+		`tupleset_with_wildcard_type_restriction`: {
+			model: documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+				"parent": typesystem.This(),
+				"viewer": typesystem.Intersection(typesystem.This(), typesystem.TupleToUserset("parent", "member")),
+			}, map[string]*openfgav1.RelationMetadata{
+				"viewer": directUsers,
+				"parent": {DirectlyRelatedUserTypes: []*openfgav1.RelationReference{
+					typesystem.WildcardRelationReference("group"),
+				}},
+			}),
+			expectedFeature: "tupleset relation 'parent' with type restriction 'group:*'",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			typesys := typesystem.New(test.model)
+
+			err := checkModelFeatures(typesys, "document", "viewer")
+			if test.expectedFeature == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrUnsupportedModelFeature)
+			var unsupportedErr *UnsupportedModelFeatureError
+			require.True(t, errors.As(err, &unsupportedErr))
+			require.Equal(t, test.expectedFeature, unsupportedErr.Feature)
+			require.Equal(t, "document", unsupportedErr.ObjectType)
+		})
+	}
+
+	t.Run("list_users_returns_error", func(t *testing.T) {
+		ds := memory.New()
+		t.Cleanup(ds.Close)
+
+		typesys := typesystem.New(documentWithRelations(typesystem.SchemaVersion1_1, map[string]*openfgav1.Userset{
+			"viewer": {},
+		}, nil))
+		ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     "01HVMMBCMGZNT3SED4Z17ECXCA",
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.Nil(t, resp)
+		require.ErrorIs(t, err, ErrUnsupportedModelFeature)
+		require.ErrorContains(t, err, "rewrite without a userset in relation 'document#viewer'")
+
+		// the model is only checked by the first request
+		checkedModelFeatures.Lock()
+		memoized := checkedModelFeatures.errs[modelFeaturesKey{typesys: typesys, objectType: "document", relation: "viewer"}]
+		checkedModelFeatures.Unlock()
+		require.Equal(t, err, memoized)
+	})
+}
+
+func TestListUsersNonEnumerableRelation(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define public: [user:*]
+				define viewer: [user] or public`, []string{
+		"document:1#public@user:*",
+		"document:1#viewer@user:jon",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	typesys = typesys.WithNonEnumerableRelations("document#public")
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	listUsers := func(relation string) ([]string, error) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		return userStrings(resp.GetUsers()), err
+	}
+
+	t.Run("flagged_relation_refused", func(t *testing.T) {
+		users, err := listUsers("public")
+		require.Empty(t, users)
+		require.ErrorIs(t, err, ErrRelationNotEnumerable)
+		var notEnumerableErr *RelationNotEnumerableError
+		require.True(t, errors.As(err, &notEnumerableErr))
+		require.Equal(t, "document", notEnumerableErr.ObjectType)
+		require.Equal(t, "public", notEnumerableErr.Relation)
+	})
+
+	t.Run("relation_reaching_flagged_relation_listed", func(t *testing.T) {
+		users, err := listUsers("viewer")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:*"}, users)
+	})
+
+	t.Run("flagged_relation_still_checked", func(t *testing.T) {
+		checker := graph.NewLocalChecker()
+		t.Cleanup(checker.Close)
+
+		checkResp, err := checker.ResolveCheck(storage.ContextWithRelationshipTupleReader(ctx, ds), &graph.ResolveCheckRequest{
+			StoreID:              storeID,
+			AuthorizationModelID: model.GetId(),
+			TupleKey:             tuple.NewTupleKey("document:1", "public", "user:maria"),
+			RequestMetadata:      graph.NewCheckRequestMetadata(25),
+		})
+		require.NoError(t, err)
+		require.True(t, checkResp.GetAllowed())
+	})
+
+	t.Run("flag_not_set_on_original_typesystem", func(t *testing.T) {
+		original, err := typesystem.NewAndValidate(context.Background(), model)
+		require.NoError(t, err)
+		flagged := original.WithNonEnumerableRelations("document#public")
+		require.True(t, original.IsRelationEnumerable("document", "public"))
+		require.False(t, flagged.IsRelationEnumerable("document", "public"))
+		require.True(t, flagged.IsRelationEnumerable("document", "viewer"))
+	})
+}
+
+func TestSupportsListUsers(t *testing.T) {
+	model := testutils.MustTransformDSLToProtoWithID(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type team
+			relations
+				define member: [group#member]
+		type document
+			relations
+				define parent: [folder]
+				define team: [team#member]
+				define owner: [user]
+				define blocked: [user]
+				define allowed: [user]
+				define direct: [user, user:*, group#member]
+				define computed: owner
+				define inherited: viewer from parent
+				define any: owner or inherited
+				define all: owner and allowed
+				define not_blocked: direct but not blocked
+				define nested: (inherited or direct) but not (blocked and allowed)
+				define via_team: member from team
+				define computed_via_team: via_team
+				define secret: [user]`)
+
+	tests := []struct {
+		name           string
+		relation       string
+		userFilters    []*openfgav1.UserTypeFilter
+		expectedReason string
+	}{
+		{name: "direct", relation: "direct", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "direct_userset_filter", relation: "direct", userFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}}},
+		{name: "computed_userset", relation: "computed", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "tuple_to_userset", relation: "inherited", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "union", relation: "any", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "intersection", relation: "all", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "exclusion", relation: "not_blocked", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{name: "nested_rewrites", relation: "nested", userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}}},
+		{
+			name:           "tupleset_with_userset_type_restriction",
+			relation:       "via_team",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedReason: "tupleset relation 'team' with type restriction 'team#member' in relation 'document#via_team'",
+		},
+		{
+			name:           "unsupported_construct_reached_through_computed_userset",
+			relation:       "computed_via_team",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedReason: "tupleset relation 'team' with type restriction 'team#member' in relation 'document#via_team'",
+		},
+		{
+			name:           "undefined_relation",
+			relation:       "editor",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedReason: "relation 'document#editor' is not defined",
+		},
+		{
+			name:           "undefined_filter_type",
+			relation:       "direct",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "employee"}},
+			expectedReason: "user filter type 'employee' is not defined",
+		},
+		{
+			name:           "undefined_filter_relation",
+			relation:       "direct",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "group", Relation: "owner"}},
+			expectedReason: "user filter relation 'group#owner' is not defined",
+		},
+		{
+			name:           "not_enumerable",
+			relation:       "secret",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedReason: "relation 'document#secret' is not enumerable",
+		},
+	}
+
+	typesys := typesystem.New(model).WithNonEnumerableRelations("document#secret")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			supported, reason := SupportsListUsers(typesys, "document", test.relation, test.userFilters)
+			require.Equal(t, test.expectedReason == "", supported)
+			require.Equal(t, test.expectedReason, reason)
+		})
+	}
+
+	t.Run("undefined_type", func(t *testing.T) {
+		supported, reason := SupportsListUsers(typesys, "report", "viewer", []*openfgav1.UserTypeFilter{{Type: "user"}})
+		require.False(t, supported)
+		require.Equal(t, "type 'report' is not defined", reason)
+	})
+
+	t.Run("unsupported_schema_version", func(t *testing.T) {
+		typesys := typesystem.New(&openfgav1.AuthorizationModel{
+			SchemaVersion: typesystem.SchemaVersion1_0,
+			TypeDefinitions: []*openfgav1.TypeDefinition{
+				{Type: "user"},
+				{Type: "document", Relations: map[string]*openfgav1.Userset{"viewer": typesystem.This()}},
+			},
+		})
+		supported, reason := SupportsListUsers(typesys, "document", "viewer", []*openfgav1.UserTypeFilter{{Type: "user"}})
+		require.False(t, supported)
+		require.Equal(t, "schema version '1.0' in relation 'document#viewer'", reason)
+	})
+}
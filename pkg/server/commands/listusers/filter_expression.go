@@ -0,0 +1,165 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openfga/openfga/internal/graph"
+	serverErrors "github.com/openfga/openfga/pkg/server/errors"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/storagewrappers"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// CompoundUserFilter matches the users that match UserFilter AND satisfy Constraint, such as the
+// usersets "group:<id>#member" of the groups whose kind is "subtype:engineering".
+type CompoundUserFilter struct {
+	UserFilter *openfgav1.UserTypeFilter
+	Constraint ReachabilityConstraint
+}
+
+// ReachabilityConstraint is satisfied by a user whose object has Relation with User, as decided by
+// a Check of the object, the relation and the user. For "group:eng#member", the object is
+// "group:eng". A public wildcard never satisfies it, since the relation would have to hold for
+// every object of its type.
+type ReachabilityConstraint struct {
+	Relation string
+	User     string
+}
+
+// filterMatchesSubject reports whether f matches the users of the type and relation of subject.
+func filterMatchesSubject(f *openfgav1.UserTypeFilter, subject Subject) bool {
+	if f.GetType() != subject.Type {
+		return false
+	}
+	if subject.IsUserset() {
+		return filterMatchesUsersetRelation(f, subject.Relation)
+	}
+	return f.GetRelation() == ""
+}
+
+// compoundUserFiltersOfType returns the compound filters whose user filter is of filterType.
+func compoundUserFiltersOfType(filters []CompoundUserFilter, filterType string) []CompoundUserFilter {
+	var ofType []CompoundUserFilter
+	for _, f := range filters {
+		if f.UserFilter.GetType() == filterType {
+			ofType = append(ofType, f)
+		}
+	}
+	return ofType
+}
+
+// validateCompoundUserFilters validates the types and relations of the compound user filters
+// against the model, the same way as those of the user filters of a request.
+func validateCompoundUserFilters(typesys *typesystem.TypeSystem, filters []CompoundUserFilter) error {
+	for _, f := range filters {
+		if err := validateUserFilter(typesys, f.UserFilter); err != nil {
+			return err
+		}
+
+		constraint := f.Constraint
+		if constraint.Relation == "" || !tuple.IsValidUser(constraint.User) {
+			return serverErrors.ValidationError(fmt.Errorf("invalid reachability constraint '%s@%s' for user filter '%s'", constraint.Relation, constraint.User, f.UserFilter.GetType()))
+		}
+		if _, err := typesys.GetRelation(f.UserFilter.GetType(), constraint.Relation); err != nil {
+			return serverErrors.RelationNotFound(constraint.Relation, f.UserFilter.GetType(), nil)
+		}
+	}
+
+	return nil
+}
+
+// withCompoundUserFilters returns req with the user filters of the compound filters added to its
+// own, so that the users they match are expanded. req is returned as is if there are none to add.
+func withCompoundUserFilters(req *openfgav1.ListUsersRequest, filters []CompoundUserFilter) *openfgav1.ListUsersRequest {
+	userFilters := req.GetUserFilters()
+	for _, f := range filters {
+		alreadyListed := false
+		for _, userFilter := range userFilters {
+			if userFilter.GetType() == f.UserFilter.GetType() && userFilter.GetRelation() == f.UserFilter.GetRelation() {
+				alreadyListed = true
+				break
+			}
+		}
+		if !alreadyListed {
+			userFilters = append(userFilters[:len(userFilters):len(userFilters)], f.UserFilter)
+		}
+	}
+	if len(userFilters) == len(req.GetUserFilters()) {
+		return req
+	}
+
+	withFilters := proto.Clone(req).(*openfgav1.ListUsersRequest)
+	withFilters.UserFilters = userFilters
+	return withFilters
+}
+
+// compoundFilterPredicate returns a ResultPredicate accepting the users that match one of
+// userFilters, the plain user filters of the request, or that match a compound filter and satisfy
+// its constraint. The users accepted must also satisfy next, if any. The constraints are checked
+// against the stored and the contextual tuples of req, like the Check API does.
+func (l *listUsersQuery) compoundFilterPredicate(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	userFilters []*openfgav1.UserTypeFilter,
+	checker graph.CheckResolver,
+	next ResultPredicate,
+) ResultPredicate {
+	ds := storagewrappers.NewCombinedTupleReader(l.pinned(l.ds, req.snapshotToken), req.GetContextualTuples())
+	return func(ctx context.Context, user *openfgav1.User) (bool, error) {
+		ok, err := l.matchesCompoundFilters(storage.ContextWithRelationshipTupleReader(ctx, ds), typesys, req, userFilters, checker, user)
+		if err != nil || !ok || next == nil {
+			return ok, err
+		}
+		return next(ctx, user)
+	}
+}
+
+func (l *listUsersQuery) matchesCompoundFilters(
+	ctx context.Context,
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	userFilters []*openfgav1.UserTypeFilter,
+	checker graph.CheckResolver,
+	user *openfgav1.User,
+) (bool, error) {
+	subject := SubjectFromUser(user)
+	for _, f := range userFilters {
+		if filterMatchesSubject(f, subject) {
+			return true, nil
+		}
+	}
+	if subject.IsWildcard() {
+		return false, nil
+	}
+
+	object := tuple.BuildObject(subject.Type, subject.ID)
+	for _, f := range l.compoundUserFilters {
+		if !filterMatchesSubject(f.UserFilter, subject) {
+			continue
+		}
+
+		resp, err := checker.ResolveCheck(ctx, &graph.ResolveCheckRequest{
+			StoreID:              req.GetStoreId(),
+			AuthorizationModelID: typesys.GetAuthorizationModelID(),
+			TupleKey:             tuple.NewTupleKey(object, f.Constraint.Relation, f.Constraint.User),
+			ContextualTuples:     req.GetContextualTuples(),
+			Context:              req.GetContext(),
+			RequestMetadata:      graph.NewCheckRequestMetadata(l.resolveNodeLimit),
+			Consistency:          req.GetConsistency(),
+		})
+		if err != nil {
+			return false, err
+		}
+		req.datastoreQueryCount.Add(resp.GetResolutionMetadata().DatastoreQueryCount)
+		if resp.GetAllowed() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,108 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_CompoundUserFilters(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type subtype
+		type group
+			relations
+				define kind: [subtype]
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:sales#member",
+		"group:eng#kind@subtype:engineering",
+		"group:sales#kind@subtype:sales",
+		"group:eng#member@user:will",
+		"group:sales#member@user:anne",
+	})
+
+	engineeringGroups := CompoundUserFilter{
+		UserFilter: &openfgav1.UserTypeFilter{Type: "group", Relation: "member"},
+		Constraint: ReachabilityConstraint{Relation: "kind", User: "subtype:engineering"},
+	}
+	req := func(userFilters ...*openfgav1.UserTypeFilter) *openfgav1.ListUsersRequest {
+		return &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: userFilters,
+		}
+	}
+
+	t.Run("type_and_relation_and_constraint", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithCompoundUserFilters(engineeringGroups)).ListUsers(ctx, req(&openfgav1.UserTypeFilter{Type: "user"}))
+		require.NoError(t, err)
+		// group:sales#member has the relation and matches the user filter, but not the constraint
+		require.ElementsMatch(t, []string{
+			"user:jon",
+			"user:will",
+			"user:anne",
+			"group:eng#member",
+		}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("ored_with_plain_filters", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithCompoundUserFilters(engineeringGroups)).ListUsers(ctx, req(
+			&openfgav1.UserTypeFilter{Type: "group", Relation: "member"},
+		))
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"group:eng#member", "group:sales#member"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("constraint_met_by_contextual_tuple", func(t *testing.T) {
+		r := req(&openfgav1.UserTypeFilter{Type: "user"})
+		r.ContextualTuples = []*openfgav1.TupleKey{
+			tuple.NewTupleKey("group:sales", "kind", "subtype:engineering"),
+		}
+		resp, err := NewListUsersQuery(ds, WithCompoundUserFilters(engineeringGroups)).ListUsers(ctx, r)
+		require.NoError(t, err)
+		require.Subset(t, userStrings(resp.GetUsers()), []string{"group:eng#member", "group:sales#member"})
+	})
+
+	t.Run("failing_users_not_counted_towards_max_results", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithCompoundUserFilters(engineeringGroups),
+			WithListUsersMaxResults(1),
+		).ListUsers(ctx, req(&openfgav1.UserTypeFilter{Type: "subtype"}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"group:eng#member"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("type_grouped_streaming", func(t *testing.T) {
+		var users []string
+		err := NewListUsersQuery(ds,
+			WithCompoundUserFilters(engineeringGroups),
+			WithTypeGroupedStreaming(true),
+		).ListUsersCallback(ctx, req(&openfgav1.UserTypeFilter{Type: "user"}), func(user *openfgav1.User) error {
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, users, 4)
+		require.ElementsMatch(t, []string{"user:jon", "user:will", "user:anne"}, users[:3])
+		require.Equal(t, "group:eng#member", users[3])
+	})
+
+	t.Run("constraint_relation_undefined", func(t *testing.T) {
+		_, err := NewListUsersQuery(ds, WithCompoundUserFilters(CompoundUserFilter{
+			UserFilter: &openfgav1.UserTypeFilter{Type: "group", Relation: "member"},
+			Constraint: ReachabilityConstraint{Relation: "owner", User: "subtype:engineering"},
+		})).ListUsers(ctx, req(&openfgav1.UserTypeFilter{Type: "user"}))
+		require.ErrorContains(t, err, "relation 'group#owner' not found")
+	})
+}
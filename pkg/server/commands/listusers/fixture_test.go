@@ -0,0 +1,32 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// newTestStore verifies that the test leaks no goroutine and bootstraps a store with model and
+// tuples in a new memory datastore. It returns the datastore, the ID of the store and a context
+// carrying the typesystem of the model, as ListUsers expects.
+func newTestStore(t *testing.T, model string, tuples []string) (storage.OpenFGADatastore, string, context.Context) {
+	t.Helper()
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, authModel := storagetest.BootstrapFGAStore(t, ds, model, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), authModel)
+	require.NoError(t, err)
+	return ds, storeID, typesystem.ContextWithTypesystem(context.Background(), typesys)
+}
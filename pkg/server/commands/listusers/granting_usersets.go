@@ -0,0 +1,62 @@
+package listusers
+
+import (
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// grantingUsersetRecorder records the nearest userset through which each concrete user is found,
+// which is the userset of the tuple assigning the user. It is safe for concurrent use.
+type grantingUsersetRecorder struct {
+	mu sync.Mutex
+
+	// users maps each userset to the keys of the users it granted
+	users map[string]map[string]struct{}
+}
+
+func newGrantingUsersetRecorder() *grantingUsersetRecorder {
+	return &grantingUsersetRecorder{
+		users: make(map[string]map[string]struct{}),
+	}
+}
+
+// record records that the user was granted by the userset. Only the concrete users are recorded,
+// since the wildcards and usersets aren't members of a userset. A nil recorder records nothing.
+func (r *grantingUsersetRecorder) record(userset string, user *openfgav1.User) {
+	if r == nil || user.GetObject() == nil {
+		return
+	}
+
+	userKey := tuple.UserProtoToString(user)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users[userset] == nil {
+		r.users[userset] = make(map[string]struct{})
+	}
+	r.users[userset][userKey] = struct{}{}
+}
+
+// usersByUserset returns the users granted by each userset, sorted, out of users. A user granted by
+// several usersets is listed under each of them, and the usersets granting none of the users are
+// left out.
+func (r *grantingUsersetRecorder) usersByUserset(users []*openfgav1.User) map[string][]*openfgav1.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[string][]*openfgav1.User)
+	for _, user := range users {
+		userKey := tuple.UserProtoToString(user)
+		for userset, granted := range r.users {
+			if _, ok := granted[userKey]; ok {
+				result[userset] = append(result[userset], user)
+			}
+		}
+	}
+	for _, granted := range result {
+		sortUsers(granted)
+	}
+	return result
+}
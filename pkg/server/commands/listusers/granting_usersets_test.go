@@ -0,0 +1,95 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_UsersByGrantingUserset(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user]
+				define viewer: [user, group#member] or viewer from parent
+				define allowed_viewer: viewer but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:sales#member",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:will",
+		"group:eng#member@user:maria",
+		"group:sales#member@user:maria",
+		"group:sales#member@group:fga#member",
+		"group:fga#member@user:anne",
+		"folder:x#viewer@user:poovam",
+	})
+
+	listUsers := func(relation string, opts ...ListUsersQueryOption) (*listUsersResponse, error) {
+		return NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+	}
+	grouped := func(usersByUserset map[string][]*openfgav1.User) map[string][]string {
+		result := make(map[string][]string, len(usersByUserset))
+		for userset, users := range usersByUserset {
+			result[userset] = userStrings(users)
+		}
+		return result
+	}
+
+	t.Run("grouped_by_nearest_userset", func(t *testing.T) {
+		resp, err := listUsers("viewer", WithUsersByGrantingUserset(true))
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"user:jon",
+			"user:will",
+			"user:maria",
+			"user:anne",
+			"user:poovam",
+		}, userStrings(resp.GetUsers()))
+		require.Equal(t, map[string][]string{
+			"document:1#viewer": {"user:jon"},
+			// user:maria is a member of both groups
+			"group:eng#member":   {"user:maria", "user:will"},
+			"group:sales#member": {"user:maria"},
+			// the members of a nested group are under the nested group
+			"group:fga#member": {"user:anne"},
+			"folder:x#viewer":  {"user:poovam"},
+		}, grouped(resp.Metadata.UsersByGrantingUserset))
+	})
+
+	t.Run("only_users_returned", func(t *testing.T) {
+		resp, err := listUsers("viewer", WithUsersByGrantingUserset(true), WithUserAllowList("user:maria"))
+		require.NoError(t, err)
+		require.Equal(t, map[string][]string{
+			"group:eng#member":   {"user:maria"},
+			"group:sales#member": {"user:maria"},
+		}, grouped(resp.Metadata.UsersByGrantingUserset))
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		resp, err := listUsers("viewer")
+		require.NoError(t, err)
+		require.Nil(t, resp.Metadata.UsersByGrantingUserset)
+	})
+
+	t.Run("exclusion_unsupported", func(t *testing.T) {
+		_, err := listUsers("allowed_viewer", WithUsersByGrantingUserset(true))
+		require.ErrorIs(t, err, ErrUsersByGrantingUsersetUnsupported)
+	})
+}
@@ -0,0 +1,225 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// HasUsers reports whether any user matching the user filters has the relation with the object.
+//
+// The expansion stops as soon as the first user is found, unless an exclusion is reachable from
+// the relation. A user found under an exclusion may still be excluded by results found later on,
+// so those requests are fully expanded. Only the users of the allow list count, if one is set with
+// WithUserAllowList, while the options trimming the response, such as the max response bytes or
+// a sample, are ignored. Unlike ListUsers, running out of time before any user is found is
+// reported as an error rather than as an empty result.
+func (l *listUsersQuery) HasUsers(ctx context.Context, req *openfgav1.ListUsersRequest) (bool, error) {
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	if l.deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.deadline)
+		defer cancel()
+	}
+
+	q := *l
+	// the deadline is enforced above so that it can be told apart from an empty result
+	q.deadline = 0
+	q.maxResults = 1
+	// the options trimming the response don't change whether it has users
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.pageSize = 0
+	q.streamUnions = true
+	q.requestCoalescing = false
+	// the max results only count the users of the allow list, but a public wildcard found first
+	// may not be expanded to any user
+	if l.expandWildcard || hasReachableExclusion(typesys, req.GetObject().GetType(), req.GetRelation()) {
+		q.maxResults = 0
+		q.streamUnions = false
+	}
+
+	resp, err := q.ListUsers(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	if len(resp.GetUsers()) > 0 {
+		return true, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// errTargetUserFound stops the expansion of HasUser once its user is found.
+var errTargetUserFound = errors.New("target user found")
+
+// HasUser reports whether user, such as "user:jon" or "group:eng#member", matches one of the user
+// filters and has the relation with the object, like a Check made through ListUsers.
+//
+// Only the user filters that user matches are expanded, and the expansion is cancelled as soon as
+// user, or the public wildcard of its type, is found to have the relation. Users of an
+// intersection are only found once they are in every operand, so they are confirmed by then, but
+// a user found under an exclusion may still be excluded by results found later on, so the
+// requests reaching an exclusion are fully expanded. Like HasUsers, running out of time before
+// user is found is reported as an error rather than as a missing relation.
+func (l *listUsersQuery) HasUser(ctx context.Context, req *openfgav1.ListUsersRequest, user string) (bool, error) {
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	userObject, userRelation := tuple.SplitObjectRelation(user)
+	userType, userID := tuple.SplitObject(userObject)
+	var userFilters []*openfgav1.UserTypeFilter
+	for _, f := range req.GetUserFilters() {
+		if f.GetType() == userType && (f.GetRelation() == userRelation || filterMatchesUsersetRelation(f, userRelation)) {
+			userFilters = append(userFilters, f)
+		}
+	}
+	if len(userFilters) == 0 {
+		return false, nil
+	}
+	userReq := proto.Clone(req).(*openfgav1.ListUsersRequest)
+	userReq.UserFilters = userFilters
+
+	if l.deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.deadline)
+		defer cancel()
+	}
+
+	q := *l
+	// the deadline is enforced above so that it can be told apart from a missing relation
+	q.deadline = 0
+	// none of the users found before user may keep it from being returned
+	q.maxResults = 0
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.pageSize = 0
+	q.requestCoalescing = false
+	q.usersetCover = false
+	q.expandWildcard = false
+	q.exactIntersection = true
+	q.userAllowList = []string{user}
+	if !hasReachableExclusion(typesys, req.GetObject().GetType(), req.GetRelation()) {
+		wildcardKey := ""
+		if userRelation == "" && userID != tuple.Wildcard {
+			wildcardKey = tuple.TypedPublicWildcard(userType)
+		}
+		q.streamUnions = true
+		q.onFoundUser = func(found *openfgav1.User) error {
+			if key := tuple.UserProtoToString(found); key == user || key == wildcardKey {
+				return errTargetUserFound
+			}
+			return nil
+		}
+	}
+
+	resp, err := q.ListUsers(ctx, userReq)
+	if errors.Is(err, errTargetUserFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(resp.GetUsers()) > 0 {
+		return true, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// hasReachableExclusion reports whether an exclusion is reachable from objectType#relation.
+// It errs on the side of reporting one when the model can't be walked.
+func hasReachableExclusion(typesys *typesystem.TypeSystem, objectType, relation string) bool {
+	return relationHasExclusion(typesys, objectType, relation, false, map[string]struct{}{})
+}
+
+// hasReachableIntersectionOrExclusion reports whether an intersection or an exclusion is reachable
+// from objectType#relation. It errs on the side of reporting one when the model can't be walked.
+func hasReachableIntersectionOrExclusion(typesys *typesystem.TypeSystem, objectType, relation string) bool {
+	return relationHasExclusion(typesys, objectType, relation, true, map[string]struct{}{})
+}
+
+func relationHasExclusion(typesys *typesystem.TypeSystem, objectType, relation string, orIntersection bool, visited map[string]struct{}) bool {
+	key := tuple.ToObjectRelationString(objectType, relation)
+	if _, ok := visited[key]; ok {
+		return false
+	}
+	visited[key] = struct{}{}
+
+	rel, err := typesys.GetRelation(objectType, relation)
+	if err != nil {
+		// undefined relations have no users, checkModelFeatures reports the other errors
+		return false
+	}
+
+	return rewriteHasExclusion(typesys, objectType, relation, rel.GetRewrite(), orIntersection, visited)
+}
+
+func rewriteHasExclusion(
+	typesys *typesystem.TypeSystem,
+	objectType, relation string,
+	rewrite *openfgav1.Userset,
+	orIntersection bool,
+	visited map[string]struct{},
+) bool {
+	switch rw := rewrite.GetUserset().(type) {
+	case *openfgav1.Userset_This:
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, relation)
+		if err != nil {
+			return true
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if relatedType.GetRelation() != "" && relationHasExclusion(typesys, relatedType.GetType(), relatedType.GetRelation(), orIntersection, visited) {
+				return true
+			}
+		}
+	case *openfgav1.Userset_ComputedUserset:
+		return relationHasExclusion(typesys, objectType, rw.ComputedUserset.GetRelation(), orIntersection, visited)
+	case *openfgav1.Userset_TupleToUserset:
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, rw.TupleToUserset.GetTupleset().GetRelation())
+		if err != nil {
+			return true
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if relationHasExclusion(typesys, relatedType.GetType(), rw.TupleToUserset.GetComputedUserset().GetRelation(), orIntersection, visited) {
+				return true
+			}
+		}
+	case *openfgav1.Userset_Union:
+		for _, child := range rw.Union.GetChild() {
+			if rewriteHasExclusion(typesys, objectType, relation, child, orIntersection, visited) {
+				return true
+			}
+		}
+	case *openfgav1.Userset_Intersection:
+		if orIntersection {
+			return true
+		}
+		for _, child := range rw.Intersection.GetChild() {
+			if rewriteHasExclusion(typesys, objectType, relation, child, orIntersection, visited) {
+				return true
+			}
+		}
+	case *openfgav1.Userset_Difference:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,307 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/testutils"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestHasUsers(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent
+				define allowed: [user]
+				define editor: [user] and allowed
+				define blocked: [user, user:*, group#member]
+				define can_view: viewer but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#parent@folder:x",
+		"folder:x#viewer@user:maria",
+		"document:1#editor@user:jon",
+		"document:1#allowed@user:maria",
+		"document:2#viewer@group:eng#member",
+		"group:eng#member@user:jon",
+		"group:eng#member@user:maria",
+		"document:2#blocked@user:jon",
+		"document:3#viewer@group:fga#member",
+		"group:fga#member@user:*",
+		"document:3#blocked@user:*",
+	})
+
+	tests := []struct {
+		name     string
+		objectID string
+		relation string
+		expected bool
+	}{
+		{name: "direct", objectID: "1", relation: "viewer", expected: true},
+		{name: "direct_without_users", objectID: "4", relation: "viewer", expected: false},
+		{name: "intersection_not_satisfied", objectID: "1", relation: "editor", expected: false},
+		{name: "exclusion_with_remaining_users", objectID: "2", relation: "can_view", expected: true},
+		{name: "exclusion_of_all_users", objectID: "3", relation: "can_view", expected: false},
+		{name: "exclusion_without_base_users", objectID: "1", relation: "blocked", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hasUsers, err := NewListUsersQuery(ds).HasUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: test.objectID},
+				Relation:    test.relation,
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, hasUsers)
+		})
+	}
+
+	t.Run("with_options", func(t *testing.T) {
+		// jon is found directly and maria through the parent folder
+		tests := []struct {
+			name     string
+			opts     []ListUsersQueryOption
+			expected bool
+		}{
+			{name: "allow_list_with_first_user", opts: []ListUsersQueryOption{WithUserAllowList("user:jon")}, expected: true},
+			{name: "allow_list_with_other_user", opts: []ListUsersQueryOption{WithUserAllowList("user:maria")}, expected: true},
+			{name: "allow_list_without_users", opts: []ListUsersQueryOption{WithUserAllowList("user:poovam")}, expected: false},
+			{name: "max_response_bytes", opts: []ListUsersQueryOption{WithListUsersMaxResponseBytes(1)}, expected: true},
+			{name: "reservoir_sample", opts: []ListUsersQueryOption{WithReservoirSample(1)}, expected: true},
+			{
+				name:     "allow_list_and_max_results",
+				opts:     []ListUsersQueryOption{WithUserAllowList("user:maria"), WithListUsersMaxResults(1)},
+				expected: true,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				for i := 0; i < 10; i++ {
+					hasUsers, err := NewListUsersQuery(ds, test.opts...).HasUsers(ctx, &openfgav1.ListUsersRequest{
+						StoreId:     storeID,
+						Object:      &openfgav1.Object{Type: "document", Id: "1"},
+						Relation:    "viewer",
+						UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+					})
+					require.NoError(t, err)
+					require.Equal(t, test.expected, hasUsers)
+				}
+			})
+		}
+	})
+
+	t.Run("stops_after_first_user", func(t *testing.T) {
+		parentReadCancelled := make(chan struct{})
+		start := time.Now()
+		hasUsers, err := NewListUsersQuery(ds,
+			WithReadInterceptor(func(ctx context.Context, _ string, tk *openfgav1.TupleKey) error {
+				if tk.GetRelation() != "parent" {
+					return nil
+				}
+				// the parent branch never finishes on its own
+				<-ctx.Done()
+				close(parentReadCancelled)
+				return ctx.Err()
+			}),
+		).HasUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.True(t, hasUsers)
+		<-parentReadCancelled
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("deadline_before_first_user", func(t *testing.T) {
+		hasUsers, err := NewListUsersQuery(ds,
+			WithListUsersDeadline(10*time.Millisecond),
+			WithReadInterceptor(func(ctx context.Context, _ string, _ *openfgav1.TupleKey) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+		).HasUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, hasUsers)
+	})
+}
+
+func TestHasUser(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent
+				define allowed: [user]
+				define editor: [user] and allowed
+				define blocked: [user, user:*, group#member]
+				define can_view: viewer but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#parent@folder:x",
+		"folder:x#viewer@user:maria",
+		"document:1#editor@user:jon",
+		"document:1#editor@user:maria",
+		"document:1#allowed@user:maria",
+		"document:2#viewer@group:eng#member",
+		"group:eng#member@user:jon",
+		"group:eng#member@user:maria",
+		"group:eng#member@group:fga#member",
+		"document:2#blocked@user:jon",
+		"document:3#viewer@group:fga#member",
+		"group:fga#member@user:*",
+		"document:3#blocked@user:will",
+	})
+
+	userFilters := []*openfgav1.UserTypeFilter{
+		{Type: "user"},
+		{Type: "group", Relation: "member"},
+	}
+
+	tests := []struct {
+		name     string
+		objectID string
+		relation string
+		user     string
+		expected bool
+	}{
+		{name: "direct", objectID: "1", relation: "viewer", user: "user:jon", expected: true},
+		{name: "tuple_to_userset", objectID: "1", relation: "viewer", user: "user:maria", expected: true},
+		{name: "missing", objectID: "1", relation: "viewer", user: "user:will", expected: false},
+		{name: "through_userset", objectID: "2", relation: "viewer", user: "user:maria", expected: true},
+		{name: "userset", objectID: "2", relation: "viewer", user: "group:fga#member", expected: true},
+		{name: "userset_relation_not_filtered", objectID: "2", relation: "viewer", user: "group:eng#owner", expected: false},
+		{name: "type_not_filtered", objectID: "1", relation: "viewer", user: "folder:x", expected: false},
+		{name: "wildcard", objectID: "3", relation: "viewer", user: "user:anne", expected: true},
+		{name: "intersection_satisfied", objectID: "1", relation: "editor", user: "user:maria", expected: true},
+		{name: "intersection_not_satisfied", objectID: "1", relation: "editor", user: "user:jon", expected: false},
+		{name: "exclusion_of_user", objectID: "2", relation: "can_view", user: "user:jon", expected: false},
+		{name: "exclusion_of_other_user", objectID: "2", relation: "can_view", user: "user:maria", expected: true},
+		{name: "exclusion_from_wildcard", objectID: "3", relation: "can_view", user: "user:will", expected: false},
+		{name: "wildcard_with_exclusion", objectID: "3", relation: "can_view", user: "user:anne", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hasUser, err := NewListUsersQuery(ds, WithListUsersMaxResults(1)).HasUser(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: test.objectID},
+				Relation:    test.relation,
+				UserFilters: userFilters,
+			}, test.user)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, hasUser)
+		})
+	}
+
+	t.Run("stops_once_user_found", func(t *testing.T) {
+		parentReadCancelled := make(chan struct{})
+		start := time.Now()
+		hasUser, err := NewListUsersQuery(ds,
+			WithReadInterceptor(func(ctx context.Context, _ string, tk *openfgav1.TupleKey) error {
+				if tk.GetRelation() != "parent" {
+					return nil
+				}
+				// the parent branch never finishes on its own
+				<-ctx.Done()
+				close(parentReadCancelled)
+				return ctx.Err()
+			}),
+		).HasUser(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: userFilters,
+		}, "user:jon")
+		require.NoError(t, err)
+		require.True(t, hasUser)
+		<-parentReadCancelled
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("deadline_before_user_found", func(t *testing.T) {
+		hasUser, err := NewListUsersQuery(ds,
+			WithListUsersDeadline(10*time.Millisecond),
+			WithReadInterceptor(func(ctx context.Context, _ string, _ *openfgav1.TupleKey) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+		).HasUser(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: userFilters,
+		}, "user:jon")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, hasUser)
+	})
+}
+
+func TestHasReachableExclusion(t *testing.T) {
+	model := testutils.MustTransformDSLToProtoWithID(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user] but not banned
+				define banned: [user]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define editor: [user] and owner
+				define viewer: [user] or editor
+				define folder_viewer: viewer from parent
+				define blocked: [user]
+				define can_view: viewer but not blocked`)
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+
+	require.False(t, hasReachableExclusion(typesys, "document", "owner"))
+	require.False(t, hasReachableExclusion(typesys, "document", "viewer"))
+	require.True(t, hasReachableExclusion(typesys, "document", "can_view"))
+	require.True(t, hasReachableExclusion(typesys, "document", "folder_viewer"))
+	require.True(t, hasReachableExclusion(typesys, "group", "member"))
+	require.False(t, hasReachableExclusion(typesys, "document", "undefined"))
+
+	require.False(t, hasReachableIntersectionOrExclusion(typesys, "document", "owner"))
+	require.True(t, hasReachableIntersectionOrExclusion(typesys, "document", "editor"))
+	require.True(t, hasReachableIntersectionOrExclusion(typesys, "document", "viewer"))
+	require.True(t, hasReachableIntersectionOrExclusion(typesys, "document", "can_view"))
+	require.False(t, hasReachableIntersectionOrExclusion(typesys, "folder", "undefined"))
+}
@@ -0,0 +1,106 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_MaxHops(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@group:backend#member",
+		"group:backend#member@user:will",
+		"group:backend#member@group:db#member",
+		"group:db#member@user:poovam",
+		"document:1#parent@folder:x",
+		"folder:x#viewer@user:anne",
+		"folder:x#viewer@group:ops#member",
+		"group:ops#member@user:bob",
+	})
+
+	tests := []struct {
+		name          string
+		maxHops       uint32
+		userFilters   []*openfgav1.UserTypeFilter
+		expectedUsers []string
+	}{
+		{
+			name:          "no_limit",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers: []string{"user:jon", "user:maria", "user:will", "user:poovam", "user:anne", "user:bob"},
+		},
+		{
+			name:          "direct_users_and_members_of_direct_groups",
+			maxHops:       1,
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers: []string{"user:jon", "user:maria", "user:anne"},
+		},
+		{
+			name:          "two_hops",
+			maxHops:       2,
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers: []string{"user:jon", "user:maria", "user:will", "user:anne", "user:bob"},
+		},
+		{
+			name:          "limit_beyond_the_deepest_user",
+			maxHops:       10,
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers: []string{"user:jon", "user:maria", "user:will", "user:poovam", "user:anne", "user:bob"},
+		},
+		{
+			name:          "usersets_past_the_limit_still_returned",
+			maxHops:       1,
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			expectedUsers: []string{"group:eng#member", "group:backend#member", "group:ops#member"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, WithMaxHops(test.maxHops)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: test.userFilters,
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+		})
+	}
+
+	t.Run("truncated_before_the_depth_limit_fails", func(t *testing.T) {
+		_, err := NewListUsersQuery(ds, WithResolveNodeLimit(3)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.Error(t, err)
+
+		resp, err := NewListUsersQuery(ds, WithResolveNodeLimit(3), WithMaxHops(1)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria", "user:anne"}, userStrings(resp.GetUsers()))
+	})
+}
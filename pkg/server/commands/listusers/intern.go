@@ -0,0 +1,74 @@
+package listusers
+
+import (
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// userIdentity identifies a user by the fields of its proto, so that its key can be looked up
+// without building the string of the user first.
+type userIdentity struct {
+	objectType string
+	objectID   string
+	relation   string
+	wildcard   bool
+}
+
+// userKeyInterner returns the same key for every occurrence of a user. The same user is
+// usually found through many branches of a rewrite and is keyed into several maps along the
+// way (union, intersection, exclusion and the final result set). Formatting its string for each
+// of them would allocate one copy per branch, whereas the interner builds it on the first lookup
+// only. Later lookups are keyed by the fields of the proto, which the user already holds, so they
+// don't allocate, and they only take a read lock, so the branches don't contend on one another.
+//
+// An interner is scoped to a single ListUsers request and is garbage collected along with it.
+// It holds one key per user found, which the set of the users found holds anyway.
+type userKeyInterner struct {
+	mu   sync.RWMutex
+	keys map[userIdentity]string
+}
+
+func newUserKeyInterner() *userKeyInterner {
+	return &userKeyInterner{
+		keys: make(map[userIdentity]string),
+	}
+}
+
+// userKey returns the string representation of the user, built once per user. It is safe for
+// concurrent use, and a nil interner builds it on every call.
+func (i *userKeyInterner) userKey(user *openfgav1.User) string {
+	if i == nil {
+		return tuple.UserProtoToString(user)
+	}
+
+	var id userIdentity
+	switch u := user.GetUser().(type) {
+	case *openfgav1.User_Object:
+		id = userIdentity{objectType: u.Object.GetType(), objectID: u.Object.GetId()}
+	case *openfgav1.User_Userset:
+		id = userIdentity{objectType: u.Userset.GetType(), objectID: u.Userset.GetId(), relation: u.Userset.GetRelation()}
+	case *openfgav1.User_Wildcard:
+		id = userIdentity{objectType: u.Wildcard.GetType(), wildcard: true}
+	default:
+		return tuple.UserProtoToString(user)
+	}
+
+	i.mu.RLock()
+	key, ok := i.keys[id]
+	i.mu.RUnlock()
+	if ok {
+		return key
+	}
+
+	key = tuple.UserProtoToString(user)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if interned, ok := i.keys[id]; ok {
+		return interned
+	}
+	i.keys[id] = key
+	return key
+}
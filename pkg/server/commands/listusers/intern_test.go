@@ -0,0 +1,152 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestUserKeyInterner(t *testing.T) {
+	t.Run("user_key", func(t *testing.T) {
+		tests := []struct {
+			name string
+			user string
+		}{
+			{name: "object", user: "user:jon"},
+			{name: "userset", user: "group:eng#member"},
+			{name: "wildcard", user: "user:*"},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				i := newUserKeyInterner()
+
+				a := i.userKey(tuple.StringToUserProto(test.user))
+				b := i.userKey(tuple.StringToUserProto(test.user))
+				require.Equal(t, test.user, a)
+				require.Same(t, unsafe.StringData(a), unsafe.StringData(b))
+			})
+		}
+	})
+
+	t.Run("distinct_users", func(t *testing.T) {
+		i := newUserKeyInterner()
+
+		// the same fields make distinct users depending on the kind of user
+		require.Equal(t, "user:*", i.userKey(tuple.StringToUserProto("user:*")))
+		require.Equal(t, "group:eng", i.userKey(tuple.StringToUserProto("group:eng")))
+		require.Equal(t, "group:eng#member", i.userKey(tuple.StringToUserProto("group:eng#member")))
+		require.Len(t, i.keys, 3)
+	})
+
+	t.Run("lookup_does_not_allocate", func(t *testing.T) {
+		i := newUserKeyInterner()
+		user := tuple.StringToUserProto("group:eng#member")
+		i.userKey(user)
+		require.Zero(t, testing.AllocsPerRun(100, func() {
+			i.userKey(user)
+		}))
+	})
+
+	t.Run("nil_interner_builds_the_key", func(t *testing.T) {
+		var i *userKeyInterner
+		require.Equal(t, "user:jon", i.userKey(tuple.StringToUserProto("user:jon")))
+	})
+
+	t.Run("concurrent_use", func(t *testing.T) {
+		i := newUserKeyInterner()
+
+		var wg sync.WaitGroup
+		for n := 0; n < 10; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for u := 0; u < 100; u++ {
+					i.userKey(tuple.StringToUserProto(fmt.Sprintf("user:%d", u)))
+				}
+			}()
+		}
+		wg.Wait()
+		require.Len(t, i.keys, 100)
+	})
+
+	t.Run("scoped_to_request", func(t *testing.T) {
+		req := fromListUsersRequest(&openfgav1.ListUsersRequest{}, nil, nil)
+		require.Same(t, req.interner, req.clone().interner)
+
+		other := fromListUsersRequest(&openfgav1.ListUsersRequest{}, nil, nil)
+		require.NotSame(t, req.interner, other.interner)
+	})
+}
+
+// BenchmarkListUsersRepeatedUsersAcrossBranches exercises a union where every
+// branch returns the same set of users, so every user string is found once per branch.
+func BenchmarkListUsersRepeatedUsersAcrossBranches(b *testing.B) {
+	const (
+		numBranches = 10
+		numUsers    = 10000
+	)
+
+	ds := memory.New()
+	b.Cleanup(ds.Close)
+
+	var relations, rewrite strings.Builder
+	for i := 0; i < numBranches; i++ {
+		relations.WriteString(fmt.Sprintf("\n\t\t\t\tdefine r%d: [user]", i))
+		if i > 0 {
+			rewrite.WriteString(" or ")
+		}
+		rewrite.WriteString(fmt.Sprintf("r%d", i))
+	}
+
+	storeID, model := storagetest.BootstrapFGAStore(b, ds, fmt.Sprintf(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations%s
+				define viewer: %s`, relations.String(), rewrite.String()), nil)
+
+	tuples := make([]*openfgav1.TupleKey, 0, numBranches*numUsers)
+	for i := 0; i < numBranches; i++ {
+		for u := 0; u < numUsers; u++ {
+			tuples = append(tuples, tuple.NewTupleKey("document:1", fmt.Sprintf("r%d", i), fmt.Sprintf("user:%d", u)))
+		}
+	}
+
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(b, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		// contextual tuples avoid the cost of writing this many tuples to the memory datastore
+		ContextualTuples: tuples,
+	}
+
+	for _, interning := range []bool{true, false} {
+		b.Run(fmt.Sprintf("interning=%t", interning), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				q := NewListUsersQuery(ds, WithListUsersMaxResults(0))
+				q.noInterning = !interning
+				resp, err := q.ListUsers(ctx, req)
+				require.NoError(b, err)
+				require.Len(b, resp.GetUsers(), numUsers)
+			}
+		})
+	}
+}
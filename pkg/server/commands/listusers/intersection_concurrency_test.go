@@ -0,0 +1,96 @@
+package listusers
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersConfig_IntersectionOperandConcurrency(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	// viewer is the intersection of 200 relations, all of which user:jon has and only some of
+	// which user:will has
+	const operands = 200
+	var model strings.Builder
+	model.WriteString(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+`)
+	var tuples, viewerOperands []string
+	for i := 0; i < operands; i++ {
+		relation := "r" + strconv.Itoa(i)
+		model.WriteString("\t\t\t\tdefine " + relation + ": [user]\n")
+		viewerOperands = append(viewerOperands, relation)
+		tuples = append(tuples, "document:1#"+relation+"@user:jon")
+		if i%2 == 0 {
+			tuples = append(tuples, "document:1#"+relation+"@user:will")
+		}
+	}
+	model.WriteString("\t\t\t\tdefine viewer: " + strings.Join(viewerOperands, " and ") + "\n")
+
+	storeID, authzModel := storagetest.BootstrapFGAStore(t, ds, model.String(), tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), authzModel)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	inFlightDS := &inFlightDatastore{OpenFGADatastore: ds}
+	baseline := runtime.NumGoroutine()
+
+	// sample the goroutines running while the intersection is expanded
+	var maxGoroutines atomic.Int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(100 * time.Microsecond):
+			}
+			if goroutines := int64(runtime.NumGoroutine()); goroutines > maxGoroutines.Load() {
+				maxGoroutines.Store(goroutines)
+			}
+		}
+	}()
+
+	resp, err := NewListUsersQuery(inFlightDS,
+		WithIntersectionOperandConcurrency(4),
+		WithResolveNodeBreadthLimit(operands),
+		WithListUsersMaxConcurrentReads(operands),
+	).ListUsers(ctx, &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	})
+	close(stop)
+	<-sampled
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"user:jon"}, userStrings(resp.GetUsers()))
+	require.LessOrEqual(t, inFlightDS.maxInFlight.Load(), int32(4))
+	// a goroutine per operand would add hundreds of them
+	require.Less(t, maxGoroutines.Load()-int64(baseline), int64(50))
+}
@@ -2,10 +2,15 @@ package listusers
 
 import (
 	"maps"
+	"slices"
 	"sync/atomic"
 
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
 )
 
 type listUsersRequest interface {
@@ -32,9 +37,94 @@ type internalListUsersRequest struct {
 	// or endless cycle of recursion.
 	depth uint32
 
+	// hops is the number of relationship hops followed from the object of the request to the
+	// current object, through usersets assigned by tuples and tupleset tuples. See WithMaxHops.
+	hops uint32
+
 	datastoreQueryCount *atomic.Uint32
 
 	dispatchCount *atomic.Uint32
+
+	// interner is shared by all the clones of a request so that the string of a user found
+	// across branches is only built once.
+	interner *userKeyInterner
+
+	// budgetSpent is the number of traversal budget units consumed so far. It is shared by all
+	// the clones of a request.
+	budgetSpent *atomic.Uint64
+
+	// expansionSteps is the number of rewrites expanded so far. It is shared by all the clones
+	// of a request.
+	expansionSteps *atomic.Uint32
+
+	// prunedBranches records the union operands skipped because they could not yield users
+	// matching the user filters. It is shared by all the clones of a request.
+	prunedBranches *prunedBranches
+
+	// possibleEdges memoizes the possible edges found by the EdgePruner. It is shared by all the
+	// clones of a request.
+	possibleEdges *possibleEdges
+
+	// cappedRelations records the relations whose members weren't all followed because of
+	// WithRelationRecursionCap. It is shared by all the clones of a request.
+	cappedRelations *cappedRelations
+
+	// ds is the datastore the request reads from, bounding the reads in flight to the max
+	// concurrent reads of the query. It is shared by all the clones of a request, and read falls
+	// back to the datastore of the query when it is nil.
+	ds storage.RelationshipTupleReader
+
+	// snapshotToken is the snapshot every read of the request is pinned to, set with
+	// WithSnapshotToken or taken as the request starts with WithSnapshotReads, and is empty
+	// otherwise. It is shared by all the clones of a request.
+	snapshotToken string
+
+	// workerQueue queues the reads of the request for a worker of the SharedWorkerPool set with
+	// WithSharedWorkerPool, and is nil otherwise. It is shared by all the clones of a request.
+	workerQueue *workerQueue
+
+	// memory estimates the memory held by the users of the request, and is nil for the requests
+	// listing the objects of a type. It is shared by all the clones of a request.
+	memory *memoryEstimate
+
+	// usersetCandidates records the usersets assigned by tuples if a userset cover is requested
+	// with WithUsersetCover, and is nil otherwise. It is shared by all the clones of a request.
+	usersetCandidates *usersetCandidates
+
+	// profile accumulates the profile of the request if it is listed with ListUsersWithProfile,
+	// and is nil otherwise. It is shared by all the clones of a request.
+	profile *expansionProfile
+
+	// caseFolder puts the users of the tuples read in the model's casing if matching is
+	// case-insensitive, and is nil otherwise. See WithCaseInsensitiveMatching.
+	caseFolder *caseFolder
+
+	// contextualTuples indexes the contextual tuples of the request by object and relation. It
+	// is shared by all the clones of a request, and read falls back to going through all the
+	// contextual tuples when it is nil.
+	contextualTuples contextualTupleIndex
+
+	// pathConditions are the conditions of the conditioned tuples followed from the object of the
+	// request to the current object. See WithUserConditions.
+	pathConditions []string
+
+	// userConditions records the conditions along the paths to the users found if they are
+	// reported with WithUserConditions, and is nil otherwise. It is shared by all the clones of a
+	// request.
+	userConditions *userConditionsRecorder
+
+	// grantingUserset is the userset whose tuples the request reads, starting with the object and
+	// relation of the top-level request, and changing at each tuple followed to another object.
+	// See WithUsersByGrantingUserset.
+	grantingUserset string
+
+	// grantingUsersets records the usersets granting the users found if they are reported with
+	// WithUsersByGrantingUserset, and is nil otherwise. It is shared by all the clones of a request.
+	grantingUsersets *grantingUsersetRecorder
+
+	// deterministic orders the iteration over the users held by the expansion steps. See
+	// WithDeterministicOrder.
+	deterministic bool
 }
 
 var _ listUsersRequest = (*internalListUsersRequest)(nil)
@@ -118,6 +208,78 @@ type listUsersResponseMetadata struct {
 
 	// WasThrottled indicates whether the request was throttled
 	WasThrottled *atomic.Bool
+
+	// Complete indicates that the users are all the users with the relation, so that the response
+	// is authoritative. It is false if any limit cut the listing short, which is:
+	//  - the max results, once reached,
+	//  - the max response bytes (see WasTruncated),
+	//  - the deadline, or the caller's context ending, before the expansion is over,
+	//  - the max expansion duration, if WithMaxExpansionDurationPartialResults is enabled (see
+	//    ExpansionDurationExceeded),
+	//  - a relation recursion cap (see CappedRelations).
+	// The limits that fail the request instead, such as the traversal budget, the max expansion
+	// steps, the resolution depth or the no progress timeout, return no response at all. A page or
+	// a reservoir sample holds a subset of the users by design, and is complete if the listing it
+	// is taken from is.
+	Complete bool
+
+	// WasTruncated indicates whether accumulating results stopped early because
+	// the max response bytes limit was reached.
+	WasTruncated bool
+
+	// PeakMemoryEstimateBytes is a rough estimate of the peak memory held by the users of the
+	// request at once, counting the set deduplicating them and the maps of the intersections and
+	// exclusions, to tell the requests approaching the memory limits apart. It is sampled, so it
+	// may miss short-lived spikes.
+	PeakMemoryEstimateBytes int64
+
+	// NoPossibleEdges indicates that the request wasn't expanded at all because the model shows
+	// that no user matching the user filters can have the relation with an object of its type, as
+	// opposed to expanding the request and finding no users.
+	NoPossibleEdges bool
+
+	// ExpansionDurationExceeded indicates that the expansion was stopped by the max expansion
+	// duration, so the users are partial. Only set if WithMaxExpansionDurationPartialResults is
+	// enabled, since an error is returned otherwise.
+	ExpansionDurationExceeded bool
+
+	// RedundantUsers are the concrete users in the response that are also covered by a public
+	// wildcard of their type in the response. Only set if WithRedundantUsersAnnotation is enabled.
+	RedundantUsers []*openfgav1.User
+
+	// PrunedBranches are the union operands that were skipped because the relationship graph
+	// shows they cannot yield users matching the user filters, formatted as
+	// "objectType#relation: operand", e.g. "document#viewer: viewer from parent". Sorted.
+	PrunedBranches []string
+
+	// CappedRelations are the relations, formatted as "objectType#relation", of which some members
+	// weren't followed because of WithRelationRecursionCap, so the users may be partial. Sorted.
+	CappedRelations []string
+
+	// ResultDigest is a digest of the users in the response, which only changes if the set of
+	// users does, whatever their order. Only set if WithResultDigest is enabled.
+	ResultDigest uint64
+
+	// UserConditions maps the users in the response that only have the relation through
+	// conditioned tuples to the conditions of each path they have it through. A user has the
+	// relation while all the conditions of any one path hold. Only set if WithUserConditions is
+	// enabled.
+	UserConditions map[string][]UserConditions
+
+	// UsersByGrantingUserset maps each userset, such as "group:eng#member", to the concrete users
+	// in the response it granted the relation to, as the userset of the tuples assigning them. The
+	// users assigned to the object of the request itself are under its own userset, such as
+	// "document:1#viewer". A user granted by several usersets is under each of them. Only set if
+	// WithUsersByGrantingUserset is enabled.
+	UsersByGrantingUserset map[string][]*openfgav1.User
+
+	// NextPageHandle is the handle of the next page of users, to pass to ListUsersNextPage, if
+	// there are users left. Only set if WithPaging is enabled.
+	NextPageHandle string
+
+	// UserRelations maps each user in the response to the relations, among those requested, that
+	// it has with the object, in the order they were requested. Only set by ListUsersForRelations.
+	UserRelations map[string][]string
 }
 
 func (r *listUsersResponse) GetUsers() []*openfgav1.User {
@@ -127,6 +289,63 @@ func (r *listUsersResponse) GetUsers() []*openfgav1.User {
 	return r.Users
 }
 
+// clone returns a deep copy of the response.
+func (r *listUsersResponse) clone() *listUsersResponse {
+	v := *r
+	v.Users = cloneUsers(r.Users)
+
+	m := &v.Metadata
+	if r.Metadata.DispatchCounter != nil {
+		m.DispatchCounter = new(atomic.Uint32)
+		m.DispatchCounter.Store(r.Metadata.DispatchCounter.Load())
+	}
+	if r.Metadata.WasThrottled != nil {
+		m.WasThrottled = new(atomic.Bool)
+		m.WasThrottled.Store(r.Metadata.WasThrottled.Load())
+	}
+	m.RedundantUsers = cloneUsers(r.Metadata.RedundantUsers)
+	m.PrunedBranches = slices.Clone(r.Metadata.PrunedBranches)
+	m.CappedRelations = slices.Clone(r.Metadata.CappedRelations)
+	if r.Metadata.UserConditions != nil {
+		m.UserConditions = make(map[string][]UserConditions, len(r.Metadata.UserConditions))
+		for user, paths := range r.Metadata.UserConditions {
+			clonedPaths := make([]UserConditions, len(paths))
+			for i, path := range paths {
+				clonedPaths[i] = UserConditions{
+					Conditions: slices.Clone(path.Conditions),
+					Parameters: slices.Clone(path.Parameters),
+				}
+			}
+			m.UserConditions[user] = clonedPaths
+		}
+	}
+	if r.Metadata.UsersByGrantingUserset != nil {
+		m.UsersByGrantingUserset = make(map[string][]*openfgav1.User, len(r.Metadata.UsersByGrantingUserset))
+		for userset, users := range r.Metadata.UsersByGrantingUserset {
+			m.UsersByGrantingUserset[userset] = cloneUsers(users)
+		}
+	}
+	if r.Metadata.UserRelations != nil {
+		m.UserRelations = make(map[string][]string, len(r.Metadata.UserRelations))
+		for user, relations := range r.Metadata.UserRelations {
+			m.UserRelations[user] = slices.Clone(relations)
+		}
+	}
+	return &v
+}
+
+// cloneUsers returns a deep copy of users.
+func cloneUsers(users []*openfgav1.User) []*openfgav1.User {
+	if users == nil {
+		return nil
+	}
+	cloned := make([]*openfgav1.User, len(users))
+	for i, user := range users {
+		cloned[i] = proto.Clone(user).(*openfgav1.User)
+	}
+	return cloned
+}
+
 func (r *listUsersResponse) GetMetadata() listUsersResponseMetadata {
 	if r == nil {
 		return listUsersResponseMetadata{}
@@ -156,13 +375,81 @@ func fromListUsersRequest(o listUsersRequest, datastoreQueryCount *atomic.Uint32
 		depth:               0,
 		datastoreQueryCount: datastoreQueryCount,
 		dispatchCount:       dispatchCount,
+		interner:            newUserKeyInterner(),
+		budgetSpent:         new(atomic.Uint64),
+		expansionSteps:      new(atomic.Uint32),
+		prunedBranches:      newPrunedBranches(),
+		possibleEdges:       newPossibleEdges(),
+		cappedRelations:     newCappedRelations(),
+	}
+}
+
+// normalizeUserFilters returns the user filters with duplicates removed, keeping the first
+// occurrence of each. Two filters are only equivalent if both their type and relation match:
+// a type-only filter such as 'group' matches objects of that type whereas 'group#member'
+// matches usersets, so neither subsumes the other and both are kept.
+func normalizeUserFilters(filters []*openfgav1.UserTypeFilter) []*openfgav1.UserTypeFilter {
+	if len(filters) <= 1 {
+		return filters
+	}
+
+	seen := make(map[string]struct{}, len(filters))
+	normalized := make([]*openfgav1.UserTypeFilter, 0, len(filters))
+	for _, f := range filters {
+		key := tuple.ToObjectRelationString(f.GetType(), f.GetRelation())
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		normalized = append(normalized, f)
 	}
+	return normalized
 }
 
 // clone creates a copy of the request. Note that some fields are not deep-cloned.
 func (r *internalListUsersRequest) clone() *internalListUsersRequest {
-	v := fromListUsersRequest(r, r.datastoreQueryCount, r.dispatchCount)
-	v.visitedUsersetsMap = maps.Clone(r.visitedUsersetsMap)
-	v.depth = r.depth
-	return v
+	// the counters are only missing from the requests built without fromListUsersRequest
+	datastoreQueryCount, dispatchCount := r.datastoreQueryCount, r.dispatchCount
+	if datastoreQueryCount == nil {
+		datastoreQueryCount = new(atomic.Uint32)
+	}
+	if dispatchCount == nil {
+		dispatchCount = new(atomic.Uint32)
+	}
+	return &internalListUsersRequest{
+		ListUsersRequest: &openfgav1.ListUsersRequest{
+			StoreId:              r.GetStoreId(),
+			AuthorizationModelId: r.GetAuthorizationModelId(),
+			Object:               r.GetObject(),
+			Relation:             r.GetRelation(),
+			UserFilters:          r.GetUserFilters(),
+			ContextualTuples:     r.GetContextualTuples(),
+			Context:              r.GetContext(),
+			Consistency:          r.GetConsistency(),
+		},
+		visitedUsersetsMap:  maps.Clone(r.visitedUsersetsMap),
+		depth:               r.depth,
+		hops:                r.hops,
+		datastoreQueryCount: datastoreQueryCount,
+		dispatchCount:       dispatchCount,
+		interner:            r.interner,
+		budgetSpent:         r.budgetSpent,
+		expansionSteps:      r.expansionSteps,
+		prunedBranches:      r.prunedBranches,
+		possibleEdges:       r.possibleEdges,
+		cappedRelations:     r.cappedRelations,
+		ds:                  r.ds,
+		snapshotToken:       r.snapshotToken,
+		workerQueue:         r.workerQueue,
+		memory:              r.memory,
+		usersetCandidates:   r.usersetCandidates,
+		profile:             r.profile,
+		caseFolder:          r.caseFolder,
+		contextualTuples:    r.contextualTuples,
+		pathConditions:      r.pathConditions,
+		userConditions:      r.userConditions,
+		grantingUserset:     r.grantingUserset,
+		grantingUsersets:    r.grantingUsersets,
+		deterministic:       r.deterministic,
+	}
 }
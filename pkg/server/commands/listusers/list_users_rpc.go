@@ -4,15 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"runtime/pprof"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sourcegraph/conc/pool"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/openfga/openfga/internal/build"
 	openfgaErrors "github.com/openfga/openfga/internal/errors"
 
 	"github.com/openfga/openfga/internal/concurrency"
@@ -37,17 +45,145 @@ import (
 
 var tracer = otel.Tracer("openfga/pkg/server/commands/list_users")
 
+var invalidTupleUsersSkippedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: build.ProjectName,
+	Name:      "list_users_invalid_tuple_users_skipped_count",
+	Help:      "Number of tuples skipped while expanding a ListUsers request because their user couldn't be parsed",
+})
+
+var invalidTuplesetTuplesSkippedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: build.ProjectName,
+	Name:      "list_users_invalid_tupleset_tuples_skipped_count",
+	Help:      "Number of tupleset tuples skipped while expanding a ListUsers request because they are invalid according to the model, such as those of a type it no longer defines",
+})
+
+var resultSizeHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace:                       build.ProjectName,
+	Name:                            "list_users_result_size",
+	Help:                            "Number of unique users returned by a ListUsers request, labeled by store, object type and relation",
+	Buckets:                         []float64{0, 1, 5, 10, 50, 100, 500, 1000, 5000, 10000},
+	NativeHistogramBucketFactor:     1.1,
+	NativeHistogramMaxBucketNumber:  100,
+	NativeHistogramMinResetDuration: time.Hour,
+}, []string{"store_id", "object_type", "relation"})
+
+var truncatedResponsesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: build.ProjectName,
+	Name:      "list_users_truncated_responses_count",
+	Help:      "Number of ListUsers responses that stopped accumulating users early because the max results or max response bytes were reached, labeled by store, object type and relation",
+}, []string{"store_id", "object_type", "relation"})
+
 type listUsersQuery struct {
-	logger                  logger.Logger
-	ds                      storage.RelationshipTupleReader
-	resolveNodeBreadthLimit uint32
-	resolveNodeLimit        uint32
-	maxResults              uint32
-	maxConcurrentReads      uint32
-	deadline                time.Duration
-	dispatchThrottlerConfig threshold.Config
+	logger                   logger.Logger
+	ds                       storage.RelationshipTupleReader
+	resolveNodeBreadthLimit  uint32
+	resolveNodeLimit         uint32
+	maxResults               uint32
+	maxResponseBytes         uint64
+	maxConcurrentReads       uint32
+	deadline                 time.Duration
+	dispatchThrottlerConfig  threshold.Config
+	pruner                   EdgePruner
+	fairTypeScheduling       bool
+	stopOnWildcard           bool
+	readInterceptor          ReadInterceptor
+	storeReadRateLimiter     *StoreReadRateLimiter
+	clock                    Clock
+	usersetCover             bool
+	resultPredicate          ResultPredicate
+	compoundUserFilters      []CompoundUserFilter
+	requestCoalescing        bool
+	traversalBudget          uint64
+	maxExpansionSteps        uint32
+	annotateRedundantUsers   bool
+	profilerLabels           bool
+	reservoirSampleSize      uint32
+	reservoirSampleSeed      int64
+	traceSamplingRate        float64
+	directOnly               bool
+	usersetsOnly             bool
+	modules                  map[string]struct{}
+	snapshotReads            bool
+	maxExpansionDuration     time.Duration
+	maxDurationPartial       bool
+	caseInsensitiveMatching  bool
+	maxSubtractSetSize       uint32
+	resultDigest             bool
+	userAllowList            []string
+	additionalTupleFilters   []storage.TupleKeyFilterFunc
+	userConditions           bool
+	usersByGrantingUserset   bool
+	intersectionConcurrency  uint32
+	contextualTupleDepth     uint32
+	userPages                *UserPages
+	pageSize                 uint32
+	approximateIntersection  ApproximateIntersectionConfig
+	exactIntersection        bool
+	expandWildcard           bool
+	deterministicOrder       bool
+	progress                 chan<- Progress
+	progressInterval         time.Duration
+	maxHops                  uint32
+	excludedSubject          string
+	referenceTimeParameter   string
+	referenceTime            time.Time
+	parallelConversionMin    int
+	exclusionStrategy        ExclusionStrategy
+	observability            ObservabilityInterceptor
+	externalSort             ExternalSortConfig
+	relationRecursionCaps    map[string]uint32
+	typeGroupedStreaming     bool
+	noProgressTimeout        time.Duration
+	maxObjectTypeResults     uint32
+	collapseWildcardCoverage bool
+	snapshotToken            string
+	partition                string
+	skipEmptyUsersets        bool
+	sharedWorkerPool         *SharedWorkerPool
+	exclusionVerification    bool
+
+	// skipResultMetrics keeps the requests made on behalf of another listing, whose users aren't
+	// returned as they are, out of the result metrics.
+	skipResultMetrics bool
+
+	// snapshotTokenErr is the error validating the snapshot token against the datastore the query
+	// was created with, which is wrapped by the time a request is expanded.
+	snapshotTokenErr error
+
+	// streamingExclusionThreshold is the largest number of subtracted users for which
+	// exclusions stream their base users. See WithStreamingExclusion.
+	streamingExclusionThreshold uint32
+
+	// streamUnions makes unions forward each user as soon as it is found instead of once all
+	// of their operands are expanded. It is only correct when no exclusion is reachable, since
+	// the users found under an exclusion carry the users it excluded.
+	streamUnions bool
+
+	// profile, if set, accumulates the profile of the request. See ListUsersWithProfile.
+	profile *expansionProfile
+
+	// onFoundUser, if set, is called with each unique user found to have the relation as soon
+	// as it is found. An error stops the expansion and is returned by ListUsers.
+	onFoundUser func(*openfgav1.User) error
+
+	// discardFoundUsers makes the requests pass every user found to have the relation to
+	// onFoundUser without keeping nor interning them, for callers that deduplicate them on their
+	// own. See ListUsersSorted.
+	discardFoundUsers bool
+
+	// noInterning makes the requests key the users by a string built for each of them rather than
+	// by an interned one, which only the benchmarks do, to compare the two.
+	noInterning bool
 }
 
+// ReadInterceptor is invoked before each datastore read made while expanding a ListUsers
+// request. It may block to inject latency, and returning an error fails the read with it.
+type ReadInterceptor func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error
+
+// ResultPredicate decides whether a user found to have the relation is returned. It may
+// for example Check the user against a second relation.
+type ResultPredicate func(ctx context.Context, user *openfgav1.User) (bool, error)
+
 type expandResponse struct {
 	hasCycle bool
 	err      error
@@ -95,6 +231,13 @@ func WithListUsersMaxResults(max uint32) ListUsersQueryOption {
 	}
 }
 
+// WithListUsersMaxResponseBytes see server.WithListUsersMaxResponseBytes.
+func WithListUsersMaxResponseBytes(max uint64) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxResponseBytes = max
+	}
+}
+
 // WithListUsersDeadline see server.WithListUsersDeadline.
 func WithListUsersDeadline(t time.Duration) ListUsersQueryOption {
 	return func(d *listUsersQuery) {
@@ -102,6 +245,25 @@ func WithListUsersDeadline(t time.Duration) ListUsersQueryOption {
 	}
 }
 
+// WithMaxExpansionDuration caps how long the expansion of a request may run, regardless of the
+// deadline of the caller's context, so the expansion runs for at most the shorter of the two.
+// Exceeding it fails the request with ErrMaxExpansionDurationExceeded, unless
+// WithMaxExpansionDurationPartialResults is enabled. A duration of 0 disables the cap.
+func WithMaxExpansionDuration(duration time.Duration) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxExpansionDuration = duration
+	}
+}
+
+// WithMaxExpansionDurationPartialResults returns the users found so far when the max expansion
+// duration is exceeded, like when the max results are reached, instead of an error. The response
+// metadata then reports ExpansionDurationExceeded.
+func WithMaxExpansionDurationPartialResults(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxDurationPartial = enabled
+	}
+}
+
 // WithResolveNodeLimit see server.WithResolveNodeLimit.
 func WithResolveNodeLimit(limit uint32) ListUsersQueryOption {
 	return func(d *listUsersQuery) {
@@ -148,6 +310,611 @@ func WithDispatchThrottlerConfig(config threshold.Config) ListUsersQueryOption {
 	}
 }
 
+// WithFairTypeScheduling enables expanding each user filter type independently, reserving an
+// equal share of the breadth limit for each type. This prevents a type that is cheap to reach
+// from starving the others, which improves the latency to the first result of the slower types.
+func WithFairTypeScheduling(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.fairTypeScheduling = enabled
+	}
+}
+
+// WithStopOnWildcard enables stopping the expansion of a user filter type as soon as a public
+// wildcard of that type is found to definitively have the relation, for callers that only need
+// to know whether the object is public. The wildcard is returned along with any concrete users
+// found before it. Wildcards found under an intersection or exclusion only stop the expansion
+// once the intersection or exclusion is satisfied.
+func WithStopOnWildcard(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.stopOnWildcard = enabled
+	}
+}
+
+// WithReadInterceptor sets a ReadInterceptor, which is meant for injecting faults in tests.
+func WithReadInterceptor(interceptor ReadInterceptor) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.readInterceptor = interceptor
+	}
+}
+
+// WithPerStoreReadRate rate limits the datastore reads made while expanding a request with the
+// limiter, which holds the rate of each store. When a store's reads are saturated, further reads
+// block until they are allowed or the request is done.
+func WithPerStoreReadRate(limiter *StoreReadRateLimiter) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.storeReadRateLimiter = limiter
+	}
+}
+
+// WithResultPredicate sets a ResultPredicate which every user found to have the relation must
+// also satisfy to be returned. The predicate is evaluated once per user, with at most the
+// breadth limit evaluations running concurrently, and results that fail it do not count
+// towards the max results.
+func WithResultPredicate(predicate ResultPredicate) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.resultPredicate = predicate
+	}
+}
+
+// WithTraversalBudget limits the total cost of expanding a request to the given number of units,
+// failing the request with ErrTraversalBudgetExceeded once they are spent. Every dispatched
+// expansion costs 1 unit and every tuple read from the datastore costs 1 unit, so the budget
+// bounds the depth, breadth and reads of a request all at once. A budget of 0 means no limit.
+func WithTraversalBudget(units uint64) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.traversalBudget = units
+	}
+}
+
+// WithMaxExpansionSteps limits the total number of rewrites expanded per request, failing the
+// request with ErrMaxExpansionStepsExceeded once more are needed. Every relation, union operand,
+// intersection operand and exclusion base or subtract expanded counts as a step, which bounds
+// the blowup of deeply nested compound rewrites that stay within the depth and breadth limits.
+// A limit of 0 means no limit.
+func WithMaxExpansionSteps(n uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxExpansionSteps = n
+	}
+}
+
+// WithRedundantUsersAnnotation enables reporting, in the response metadata, the concrete users
+// that are returned alongside a public wildcard of their type. Those users have the relation
+// regardless, so a UI may choose to render them as "Everyone (+1 explicit)" instead of listing
+// them next to the wildcard.
+func WithRedundantUsersAnnotation(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.annotateRedundantUsers = enabled
+	}
+}
+
+// WithProfilerLabels enables attaching pprof labels to the goroutines spawned while expanding a
+// request, so that CPU profiles can be grouped by the store, object type, relation and rewrite
+// that spawned them.
+func WithProfilerLabels(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.profilerLabels = enabled
+	}
+}
+
+// WithReservoirSample makes ListUsers return a uniformly random sample of at most k of the users
+// found instead of all of them, retaining only k users at a time while the users are found. When
+// sampling, all the users are considered so the max results and max response bytes limits don't
+// apply, but the deadline does.
+func WithReservoirSample(k uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.reservoirSampleSize = k
+	}
+}
+
+// WithReservoirSampleSeed sets the seed of the sample taken with WithReservoirSample. The same
+// seed always yields the same sample out of the same set of users. Defaults to a random seed.
+func WithReservoirSampleSeed(seed int64) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.reservoirSampleSeed = seed
+	}
+}
+
+// WithDirectOnly limits ListUsers to the users directly assigned the relation by a tuple, for
+// callers that distinguish direct grants from inherited ones. Only the direct assignments of the
+// requested relation are read, and usersets, tuple to usersets and computed usersets are not
+// expanded, so a userset assigned the relation is only returned if it matches a userset filter.
+// A relation defined with an intersection or an exclusion can still deny its direct assignments,
+// so they are then checked against the relation before they are returned.
+func WithDirectOnly(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.directOnly = enabled
+	}
+}
+
+// WithUsersetsOnly makes ListUsers return the usersets that grant the relation, such as the
+// teams that can edit a document, rather than their members. The expansion follows computed
+// usersets and tuple to usersets as usual, but stops at each userset assigned by a tuple whose
+// members could match the user filters and returns it without reading its members. Users and
+// wildcards assigned directly are not returned. Usersets found under an intersection or exclusion
+// are combined as if they were users.
+func WithUsersetsOnly(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.usersetsOnly = enabled
+	}
+}
+
+// WithModules scopes ListUsers to the given modules of a modular model, for tenant isolation
+// built on modules. Computed usersets and tuple to usersets are only followed to relations
+// defined in one of the modules, so edges to relations of other modules, or of types that aren't
+// part of any module, are skipped. The requested relation itself is always expanded, and so are
+// the usersets assigned by tuples. Defaults to traversing all modules.
+func WithModules(modules ...string) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		if len(modules) == 0 {
+			d.modules = nil
+			return
+		}
+		d.modules = make(map[string]struct{}, len(modules))
+		for _, module := range modules {
+			d.modules[module] = struct{}{}
+		}
+	}
+}
+
+// WithSnapshotReads pins every datastore read of each ListUsers request to the snapshot of the
+// store taken as the request starts, so that the base and the subtracted side of an exclusion, and
+// the reads of the checks, all observe the same tuples even if they are written to in between.
+// Requests fail with an error wrapping storage.ErrSnapshotsNotSupported if the datastore doesn't
+// implement storage.SnapshotReader. A snapshot token set with WithSnapshotToken takes precedence.
+func WithSnapshotReads(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.snapshotReads = enabled
+	}
+}
+
+// WithStreamingExclusion makes exclusions send the users found under their base as soon as they
+// are confirmed, instead of once the base is fully expanded, as long as the subtract yields at most
+// maxSubtractUsers users. The subtract is always fully expanded first, since no base user can be
+// confirmed before. Exclusions whose subtract yields more users buffer the base as well. Defaults
+// to 0, which always buffers the base.
+func WithStreamingExclusion(maxSubtractUsers uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.streamingExclusionThreshold = maxSubtractUsers
+	}
+}
+
+// WithClock sets the clock that ListUsers tells the time with and waits on, such as when
+// throttling reads with WithPerStoreReadRate, so that tests can control time. Deadlines are
+// enforced by the request's context, on the system's time. Defaults to the system's time.
+func WithClock(clock Clock) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.clock = clock
+	}
+}
+
+// WithUsersetCover makes ListUsers return a small set of usersets whose members include every
+// concrete user found, for views that explain access by groups, instead of the users themselves.
+// The candidates are the usersets assigned by the tuples read while expanding the request, and
+// the members of each are listed with the same user filters. The cover is computed greedily, so it
+// may not be the smallest one. The users that no candidate covers, such as those assigned the
+// relation directly, are returned after the cover.
+func WithUsersetCover(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.usersetCover = enabled
+	}
+}
+
+// WithCaseInsensitiveMatching makes ListUsers match the types and relations of tuple users, and
+// of the request's object and user filters, to the model case-insensitively, and return users
+// with the types and relations cased as in the model. It is a compatibility shim for data
+// imported with inconsistent casing, and should not be enabled otherwise: it costs a pass over the
+// model per request, it can merge types or relations that only differ in casing, and the objects
+// and relations of the tuples read are still matched exactly, since they are the keys the
+// datastore is read by. Object IDs are always case-sensitive.
+func WithCaseInsensitiveMatching(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.caseInsensitiveMatching = enabled
+	}
+}
+
+// WithMaxSubtractSetSize sets the largest number of users that the subtract of an exclusion may
+// yield, since they are all held in memory to exclude them from the base. An exclusion whose
+// subtract yields more stops expanding right away and fails the request with
+// ErrMaxSubtractSetSizeExceeded. A size of 0, the default, means no limit.
+func WithMaxSubtractSetSize(size uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxSubtractSetSize = size
+	}
+}
+
+// WithResultDigest enables reporting, in the response metadata, a digest of the users in the
+// response. Clients polling for changes to the users of an object can compare digests instead of
+// lists, and only fetch the users again when the digest changes. The digest is stable across
+// requests and processes for the same set of users, and doesn't depend on the order they are
+// found in.
+func WithResultDigest(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.resultDigest = enabled
+	}
+}
+
+// WithUserAllowList makes ListUsers only return the users of the allow list, such as
+// "user:jon" or "group:eng#member", that have the relation, as if a Check were made for each of
+// them but in a single expansion. A public wildcard of a type grants the relation to every user of
+// that type in the allow list that isn't excluded from it. The wildcard itself is only returned if
+// it is in the allow list too. The allow list is applied as the users are collected, so the max
+// results and max response bytes only count the users of the allow list and the public wildcards
+// of their types. Defaults to returning all the users.
+func WithUserAllowList(users ...string) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		if len(users) == 0 {
+			d.userAllowList = nil
+			return
+		}
+		d.userAllowList = users
+	}
+}
+
+// WithAdditionalTupleFilters adds filters that the tuples read while expanding a request must
+// pass, on top of the standard filter dropping the tuples the model doesn't allow. A tuple is
+// skipped unless every filter returns true for it. The filters are called concurrently, for both
+// the stored and the contextual tuples, and must not block.
+func WithAdditionalTupleFilters(filters ...storage.TupleKeyFilterFunc) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.additionalTupleFilters = append(d.additionalTupleFilters, filters...)
+	}
+}
+
+// WithUserConditions enables reporting, in the response metadata, the conditions under which each
+// user returned has the relation, for the users that only have it through conditioned tuples.
+// The conditions of the tuples along a path from the object to a user must all hold for the user
+// to have the relation through it, so each path is reported with its conditions and their
+// parameters. Only the conditions that held given the request context are reported, since the
+// other paths aren't followed. Requests for relations reaching an intersection or an exclusion
+// fail with ErrUserConditionsUnsupported.
+func WithUserConditions(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.userConditions = enabled
+	}
+}
+
+// WithUsersByGrantingUserset enables reporting, in the response metadata, the concrete users
+// returned grouped by the nearest userset that granted them the relation, such as the members of
+// group:eng under "group:eng#member" and those of group:sales under "group:sales#member". The
+// nearest userset of a user is that of the tuple assigning it, so the members of a nested group
+// are under the nested group. Requests for relations reaching an intersection or an exclusion
+// fail with ErrUsersByGrantingUsersetUnsupported, since the usersets of their operands don't
+// grant the relation on their own.
+func WithUsersByGrantingUserset(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.usersByGrantingUserset = enabled
+	}
+}
+
+// WithIntersectionOperandConcurrency bounds the number of operands of an intersection expanded at
+// once, each with the goroutines expanding and draining it, so that a very wide intersection
+// doesn't run all of its operands at the same time. The users of each operand are held until all
+// of them are expanded either way. Defaults to the resolve node breadth limit.
+func WithIntersectionOperandConcurrency(limit uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.intersectionConcurrency = limit
+	}
+}
+
+// WithContextualTupleDepth bounds how deep into the expansion contextual tuples apply, to keep the
+// cost of simulating changes with them bounded. The relation being listed is expanded at level 1,
+// and every relation followed from there, through a computed userset, a tuple to userset or a
+// userset assigned by a tuple, is expanded one level deeper than the relation it's followed from.
+// Contextual tuples are only read along with the stored tuples at the first depth levels: deeper
+// down only the stored tuples apply, and they are no longer shadowed by contextual tuples. A
+// userset or tupleset object assigned by a contextual tuple within the levels is still expanded
+// beyond them, but from the stored tuples only. A depth of 0, the default, applies contextual
+// tuples at every level.
+func WithContextualTupleDepth(depth uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.contextualTupleDepth = depth
+	}
+}
+
+// WithPaging makes ListUsers return at most pageSize users, along with the handle of the next
+// page of users if there are more of them. The users left are held in pages until they are
+// fetched with ListUsersNextPage, so that the following pages don't expand the request again. The
+// order of the users is arbitrary but the pages never overlap. The result digest, if enabled, is
+// that of all the users. A page size of 0, the default, returns all the users at once.
+func WithPaging(pages *UserPages, pageSize uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.userPages = pages
+		d.pageSize = pageSize
+	}
+}
+
+// WithApproximateIntersection bounds the memory used by intersections with large operands. Past
+// the configured threshold, the users of an operand are only held in a Bloom filter, which may
+// report the operand has users that it doesn't have, at about the configured false positive rate.
+// Intersections may then return users that don't satisfy them, though they never miss users that
+// do. Since an extra user is a false grant, it should only be enabled where that is acceptable, and
+// WithExactIntersection should be used where correctness is paramount. An intersection is still
+// evaluated exactly whenever every operand is past the threshold or returned a wildcard, since the
+// users satisfying it can then not be listed from any of them, at the cost of expanding it twice.
+func WithApproximateIntersection(config ApproximateIntersectionConfig) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.approximateIntersection = config
+	}
+}
+
+// WithExactIntersection makes intersections be evaluated exactly, regardless of
+// WithApproximateIntersection.
+func WithExactIntersection() ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.exactIntersection = true
+	}
+}
+
+// WithExpandWildcard makes ListUsers return, instead of a public wildcard of a type the user
+// filters ask for without a relation, the users of that type known to the store: those that are
+// the object or the user of a stored or contextual tuple, except for those excluded from the
+// wildcard. Since there is no index of the users by type, every tuple of the store is read, and
+// the users returned can be very many. They are still limited by the max results.
+func WithExpandWildcard(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.expandWildcard = enabled
+	}
+}
+
+// WithDeterministicOrder makes the expansion steps that hold users, such as intersections,
+// unions and exclusions, go through them in a fixed order, and sorts the users returned, so that
+// two runs over the same tuples return identical responses. The order in which concurrent
+// branches find users is still arbitrary. It costs a sort of the users held by each of those
+// steps, so it is meant for tests and debugging.
+func WithDeterministicOrder(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.deterministicOrder = enabled
+	}
+}
+
+// WithProgressChannel makes ListUsers send the progress of the expansion to progress at each
+// progress interval, and once more when the expansion is over, for tools that show the progress of
+// long requests. A progress report is dropped if progress isn't ready to receive it, so a slow
+// receiver never holds up the expansion. The channel is never closed.
+func WithProgressChannel(progress chan<- Progress) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.progress = progress
+	}
+}
+
+// WithProgressInterval sets how often the progress is reported with WithProgressChannel.
+// Defaults to every second.
+func WithProgressInterval(interval time.Duration) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.progressInterval = interval
+	}
+}
+
+// WithMaxHops limits the expansion to the users reachable within maxHops relationship hops of the
+// object, where following a userset assigned by a tuple or a tupleset tuple is a hop. The users
+// assigned directly to the relation are reached without any hop, so that a limit of 1 lists them
+// along with the members of the usersets assigned to the relation, but not those of the usersets
+// nested within them. Unlike the resolution depth limit, which fails the request, the branches
+// exceeding the limit are truncated. A userset reached past the limit is still returned if it
+// matches a user filter. A limit of 0, the default, doesn't limit the hops.
+func WithMaxHops(maxHops uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxHops = maxHops
+	}
+}
+
+// WithExcludedSubject leaves the subject, such as "user:jon" or "group:eng#member", out of the
+// users returned, such as the subject on whose behalf the users are listed. The subject is dropped
+// as the users are collected, so it doesn't count towards the max results nor reach the callback
+// of ListUsersCallback. A public wildcard granting the relation to the subject is still returned.
+// Defaults to leaving no subject out.
+func WithExcludedSubject(subject string) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.excludedSubject = subject
+	}
+}
+
+// WithReferenceTime evaluates the conditions of the tuples as of the time at, to list the users
+// that had the relation at that time, such as for an audit of the access granted in the past. The
+// models conditioning grants on time take the current time as a timestamp parameter of their
+// conditions, and the parameter is set to at in the request context, in place of any value the
+// request sets it to. Combined with a datastore serving the tuples as they were at that time, the
+// users are those that had the relation then. Defaults to using the request context as it is.
+func WithReferenceTime(parameter string, at time.Time) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.referenceTimeParameter = parameter
+		d.referenceTime = at
+	}
+}
+
+// WithParallelConversion converts the users found into the users returned across goroutines, one
+// per CPU, once at least minUsers are found, rather than one after the other. This spreads the
+// cost of building the users of a large result over the CPUs. A minimum of 0, the default,
+// always converts them one after the other.
+func WithParallelConversion(minUsers int) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.parallelConversionMin = minUsers
+	}
+}
+
+// WithExclusionStrategy sets how the exclusions are evaluated. ExclusionStrategyExpand, the default,
+// holds the users of the subtract of every exclusion in memory. ExclusionStrategyCheck streams the
+// users of the base instead, and runs a Check of the subtract relation for each of them, which
+// suits exclusions with many base users and a subtract that is cheap to check. It only applies to
+// exclusions whose subtract is a relation of the object, such as "viewer but not blocked", and the
+// checks read the datastore directly, so that WithReadInterceptor and the like don't apply to
+// them, though they read as of the same snapshot as the expansion.
+func WithExclusionStrategy(strategy ExclusionStrategy) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.exclusionStrategy = strategy
+	}
+}
+
+// WithObservabilityInterceptor sets an ObservabilityInterceptor notified when each request starts
+// and ends, when each relation is expanded and before each read of the datastore. The requests
+// made to build a userset cover aren't reported. Defaults to no interceptor.
+func WithObservabilityInterceptor(interceptor ObservabilityInterceptor) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.observability = interceptor
+	}
+}
+
+// WithExternalSort sets how ListUsersSorted spills the users it sorts to disk. See
+// ExternalSortConfig for the defaults.
+func WithExternalSort(config ExternalSortConfig) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.externalSort = config
+	}
+}
+
+// WithRelationRecursionCap limits the number of members followed when expanding the relations,
+// keyed by "objectType#relation", to the given number per object, so that the expansion of
+// relations known to be huge, such as the members of a group of all the employees, can be bounded.
+// A cap of 0 skips the members of the relation altogether. The relations capped are reported in
+// the CappedRelations of the response metadata, since their users are partial then. A relation
+// capped under the subtract of an exclusion may let users that are excluded through it be returned.
+func WithRelationRecursionCap(caps map[string]uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.relationRecursionCaps = caps
+	}
+}
+
+// WithTypeGroupedStreaming makes ListUsersCallback pass on all the users of a type before those of
+// the next one, in the order of the types of the user filters. The users of a type are then only
+// passed on as they are found while the types before it are all complete, and are otherwise held
+// and passed on sorted once they are. Disabled by default.
+func WithTypeGroupedStreaming(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.typeGroupedStreaming = enabled
+	}
+}
+
+// WithNoProgressTimeout fails requests with ErrNoProgress once their expansion goes on for the
+// timeout without finding any user nor making any datastore query, which tells a stalled expansion,
+// such as one waiting on a datastore that stopped responding, apart from a slow one that still
+// makes progress. Defaults to 0, which never times out.
+func WithNoProgressTimeout(timeout time.Duration) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.noProgressTimeout = timeout
+	}
+}
+
+// WithMaxObjectTypeResults limits the number of users ListUsersForObjectType returns across all
+// the objects of the type, on top of the max results of each object. The listing stops once it is
+// reached. Defaults to 0, which doesn't limit them.
+func WithMaxObjectTypeResults(max uint32) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.maxObjectTypeResults = max
+	}
+}
+
+// WithCollapseWildcardCoverage enables dropping, from the users returned, the concrete users of
+// a type when the public wildcard of that type is returned as well, since the wildcard already
+// grants the relation to every user of its type. Usersets are never dropped, and neither are the
+// users of a type whose wildcard isn't returned, such as one left out by the user allow list.
+// Since whether a user is covered is only known once the expansion is complete, the users aren't
+// streamed as they are found.
+func WithCollapseWildcardCoverage(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.collapseWildcardCoverage = enabled
+	}
+}
+
+// WithSnapshotToken makes every datastore read of a request observe the tuples as of the snapshot
+// identified by token, as returned by storage.SnapshotReader, so that a series of related queries
+// made with the same token all observe the same tuples. Requests fail with an error wrapping
+// storage.ErrSnapshotsNotSupported if the datastore doesn't implement storage.SnapshotReader, or
+// wrapping storage.ErrInvalidSnapshotToken if the token is malformed.
+func WithSnapshotToken(token string) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.snapshotToken = token
+	}
+}
+
+// WithPartition restricts every datastore read of a request to the tuples tagged for partition,
+// such as the caller's region in a deployment partitioning the tuples by region for data
+// residency, so that the expansion never traverses the tuples of other partitions. The
+// contextual tuples aren't partitioned. An empty partition, the default, reads all partitions.
+// Requests fail with an error wrapping storage.ErrPartitionsNotSupported if the datastore doesn't
+// partition tuples.
+func WithPartition(partition string) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.partition = partition
+	}
+}
+
+// WithExclusionVerification makes ListUsers verify the users it finds not to be subtracted by an
+// exclusion, for exclusions where stale data is dangerous, such as "viewer but not blocked". Each
+// user the base of an exclusion yields and the subtract doesn't exclude is checked against the
+// subtract relation at higher consistency before it is returned, so that the strongly consistent
+// reads are limited to the candidate users rather than the whole subtract. It only applies to
+// exclusions whose subtract is a relation of the object, and to requests that don't ask for
+// higher consistency already. With ExclusionStrategyCheck, the checks of the subtract are made at
+// higher consistency instead. Disabled by default.
+func WithExclusionVerification(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.exclusionVerification = enabled
+	}
+}
+
+// WithSkipEmptyUsersets makes ListUsers leave out the usersets without any member, such as an
+// empty group, for callers listing the groups with access. Before a userset is returned, its
+// members of any type are listed until the first one is found, so each userset found costs a
+// bounded expansion of its own. The users and wildcards are returned as usual. Disabled by
+// default.
+func WithSkipEmptyUsersets(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.skipEmptyUsersets = enabled
+	}
+}
+
+// WithSharedWorkerPool makes the datastore reads of every request go through pool, which bounds
+// the reads in flight across all the requests it is passed to. Each request still makes at most
+// the max concurrent reads at once. A nil pool leaves the reads unbounded across requests.
+func WithSharedWorkerPool(pool *SharedWorkerPool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.sharedWorkerPool = pool
+	}
+}
+
+// WithCompoundUserFilters makes ListUsers also return the users matching any of the compound
+// filters, each of which requires a user to match its user filter AND its reachability
+// constraint. The users of the user filters of a request are still returned whether or not they
+// satisfy a constraint, so the compound filters are OR'd with them. The constraints are checked
+// once the users are found, as with WithResultPredicate, and the users failing them do not count
+// towards the max results. The compound filters are validated against the model of each request.
+func WithCompoundUserFilters(filters ...CompoundUserFilter) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.compoundUserFilters = filters
+	}
+}
+
+// WithRequestCoalescing makes identical requests made concurrently share a single expansion, whose
+// response they all get a copy of, rather than each expanding on its own. Requests are identical
+// if they are read from the same datastore and have the same store, model, object, relation and
+// user filters, and the requests with contextual tuples, a context or higher consistency are never
+// coalesced. The shared expansion runs until the last of the requests waiting on it is done. Since the options aren't part of
+// what makes requests identical, every query coalescing its requests must be made with the same
+// options, as the queries of a server are. Defaults to false.
+func WithRequestCoalescing(enabled bool) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.requestCoalescing = enabled
+	}
+}
+
+// WithTraceSampling sets the fraction of requests, between 0 and 1, whose expansion steps get
+// spans of their own. The other requests only get their top level span, which keeps tracing
+// affordable at high throughput. Requests whose trace isn't sampled never get step spans.
+// Defaults to 1, tracing every request in detail.
+func WithTraceSampling(rate float64) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.traceSamplingRate = rate
+	}
+}
+
+// WithPruner sets the EdgePruner used to decide whether a request is worth expanding
+// at all. Defaults to pruning based on the relationship graph of the model.
+func WithPruner(pruner EdgePruner) ListUsersQueryOption {
+	return func(d *listUsersQuery) {
+		d.pruner = pruner
+	}
+}
+
 // NewListUsersQuery is not meant to be shared.
 func NewListUsersQuery(ds storage.RelationshipTupleReader, opts ...ListUsersQueryOption) *listUsersQuery {
 	l := &listUsersQuery{
@@ -158,12 +925,33 @@ func NewListUsersQuery(ds storage.RelationshipTupleReader, opts ...ListUsersQuer
 		deadline:                serverconfig.DefaultListUsersDeadline,
 		maxResults:              serverconfig.DefaultListUsersMaxResults,
 		maxConcurrentReads:      serverconfig.DefaultMaxConcurrentReadsForListUsers,
+		pruner:                  relationshipGraphPruner{},
+		reservoirSampleSeed:     rand.Int64(),
+		traceSamplingRate:       1,
+		clock:                   realClock{},
+		progressInterval:        defaultProgressInterval,
 	}
 
 	for _, opt := range opts {
 		opt(l)
 	}
 
+	if l.progressInterval <= 0 {
+		l.progressInterval = defaultProgressInterval
+	}
+
+	if l.snapshotToken != "" {
+		l.snapshotTokenErr = validateSnapshotToken(ds, l.snapshotToken)
+	} else if _, ok := ds.(storage.SnapshotReader); l.snapshotReads && !ok {
+		l.snapshotTokenErr = storage.ErrSnapshotsNotSupported
+	}
+
+	// a pool limited to zero goroutines never runs anything, which would hang every request
+	if l.resolveNodeBreadthLimit == 0 {
+		l.logger.Warn("resolve node breadth limit must be at least 1, using 1")
+		l.resolveNodeBreadthLimit = 1
+	}
+
 	return l
 }
 
@@ -171,41 +959,158 @@ func NewListUsersQuery(ds storage.RelationshipTupleReader, opts ...ListUsersQuer
 func (l *listUsersQuery) ListUsers(
 	ctx context.Context,
 	req *openfgav1.ListUsersRequest,
+) (*listUsersResponse, error) {
+	if l.observability == nil {
+		return l.listUsersCoalesced(ctx, req)
+	}
+
+	start := l.clock.Now()
+	object := tuple.ObjectKey(req.GetObject())
+	l.observability.OnRequestStart(ctx, RequestStartEvent{
+		StoreID:     req.GetStoreId(),
+		Object:      object,
+		Relation:    req.GetRelation(),
+		UserFilters: req.GetUserFilters(),
+	})
+
+	resp, err := l.listUsersCoalesced(ctx, req)
+	l.observability.OnRequestEnd(ctx, RequestEndEvent{
+		StoreID:             req.GetStoreId(),
+		Object:              object,
+		Relation:            req.GetRelation(),
+		UserCount:           len(resp.GetUsers()),
+		DatastoreQueryCount: resp.GetMetadata().DatastoreQueryCount,
+		Duration:            l.clock.Now().Sub(start),
+		Err:                 err,
+	})
+	return resp, err
+}
+
+// listUsersCoalesced lists the users of req, sharing the expansion of an identical request in
+// flight if request coalescing is enabled.
+func (l *listUsersQuery) listUsersCoalesced(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+) (*listUsersResponse, error) {
+	if l.requestCoalescing {
+		if key, ok := l.coalescingKey(ctx, req); ok {
+			return l.coalescedListUsers(ctx, key, req)
+		}
+	}
+	return l.listUsers(ctx, req)
+}
+
+func (l *listUsersQuery) listUsers(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
 ) (*listUsersResponse, error) {
 	ctx, span := tracer.Start(ctx, "ListUsers")
 	defer span.End()
 
+	if !l.detailedTracing(ctx) {
+		span.SetAttributes(attribute.Bool("coarse_tracing", true))
+		ctx = contextWithCoarseTracing(ctx)
+	}
+
+	if l.snapshotTokenErr != nil {
+		telemetry.TraceError(span, l.snapshotTokenErr)
+		return nil, l.snapshotTokenErr
+	}
+
 	cancellableCtx, cancelCtx := context.WithCancel(ctx)
 	if l.deadline != 0 {
 		cancellableCtx, cancelCtx = context.WithTimeout(cancellableCtx, l.deadline)
 		defer cancelCtx()
 	}
 	defer cancelCtx()
+	if l.maxExpansionDuration != 0 {
+		var cancelExpansion context.CancelFunc
+		cancellableCtx, cancelExpansion = context.WithTimeoutCause(cancellableCtx, l.maxExpansionDuration, ErrMaxExpansionDurationExceeded)
+		defer cancelExpansion()
+	}
+	cancelNoProgress := func(error) {}
+	if l.noProgressTimeout != 0 {
+		var cancelCause context.CancelCauseFunc
+		cancellableCtx, cancelCause = context.WithCancelCause(cancellableCtx)
+		defer cancelCause(nil)
+		cancelNoProgress = cancelCause
+	}
 
-	l.ds = storagewrappers.NewCombinedTupleReader(
-		storagewrappers.NewBoundedConcurrencyTupleReader(l.ds, l.maxConcurrentReads),
-		req.GetContextualTuples(),
-	)
 	typesys, ok := typesystem.TypesystemFromContext(cancellableCtx)
 	if !ok {
 		return nil, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
 	}
 
+	// the empty relation would otherwise only fail once the expansion looks it up
+	if err := validateTargetRelationNotEmpty(req); err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	if err := validateCompoundUserFilters(typesys, l.compoundUserFilters); err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	var folder *caseFolder
+	if l.caseInsensitiveMatching {
+		folder = newCaseFolder(typesys)
+		req = folder.request(req)
+	}
+
+	// the users of the plain user filters are returned without checking any constraint
+	plainUserFilters := req.GetUserFilters()
+	req = withCompoundUserFilters(req, l.compoundUserFilters)
+	req = withAnyRelationFiltersExpanded(typesys, req)
+	if len(req.GetUserFilters()) == 0 {
+		// only filters for any relation of types without relations, which no userset matches
+		return &listUsersResponse{
+			Users: []*openfgav1.User{},
+			Metadata: listUsersResponseMetadata{
+				DispatchCounter: new(atomic.Uint32),
+				Complete:        true,
+			},
+		}, nil
+	}
+
+	if l.referenceTimeParameter != "" {
+		req = withReferenceTime(req, l.referenceTimeParameter, l.referenceTime)
+	}
+
+	excludedSubject := l.excludedSubject
+	if folder != nil && excludedSubject != "" {
+		excludedSubject = folder.user(excludedSubject)
+	}
+
+	if !typesys.IsRelationEnumerable(req.GetObject().GetType(), req.GetRelation()) {
+		err := &RelationNotEnumerableError{ObjectType: req.GetObject().GetType(), Relation: req.GetRelation()}
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	if err := checkModelFeaturesOnce(typesys, req.GetObject().GetType(), req.GetRelation()); err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
 	userFilter := req.GetUserFilters()[0]
 	isReflexiveUserset := userFilter.GetType() == req.GetObject().GetType() && userFilter.GetRelation() == req.GetRelation()
 
 	if !isReflexiveUserset {
-		hasPossibleEdges, err := doesHavePossibleEdges(typesys, req)
+		hasPossibleEdges, err := l.doesHavePossibleEdges(typesys, req)
 		if err != nil {
 			return nil, err
 		}
 		if !hasPossibleEdges {
 			span.SetAttributes(attribute.Bool("no_possible_edges", true))
+			l.observeResultSize(req, 0, false)
 			return &listUsersResponse{
 				Users: []*openfgav1.User{},
 				Metadata: listUsersResponseMetadata{
 					DatastoreQueryCount: 0,
 					DispatchCounter:     new(atomic.Uint32),
+					Complete:            true,
+					NoPossibleEdges:     true,
 				},
 			}, nil
 		}
@@ -217,31 +1122,178 @@ func (l *listUsersQuery) ListUsers(
 	foundUsersCh := l.buildResultsChannel()
 	expandErrCh := make(chan error, 1)
 
-	foundUsersUnique := make(map[tuple.UserString]foundUser, 1000)
+	internalRequest := fromListUsersRequest(req, &datastoreQueryCount, &dispatchCount)
+	if l.discardFoundUsers || l.noInterning {
+		internalRequest.interner = nil
+	}
+	foundUsersUnique := newUniqueUserSet(internalRequest.interner, 1000)
+	defer l.startProgressReports(foundUsersUnique, &datastoreQueryCount)()
+	var foundUsersCount atomic.Uint64
+	defer l.startNoProgressWatchdog(cancelNoProgress, &foundUsersCount, &datastoreQueryCount)()
+	// duplicate user filters would only cause redundant work and duplicate results
+	internalRequest.UserFilters = normalizeUserFilters(internalRequest.UserFilters)
+	// contextual tuples are merged in by read
+	internalRequest.ds = storagewrappers.NewBoundedConcurrencyTupleReader(l.ds, l.maxConcurrentReads)
+	snapshotToken, err := l.snapshotTokenFor(cancellableCtx, req.GetStoreId())
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+	internalRequest.snapshotToken = snapshotToken
+	if l.sharedWorkerPool != nil {
+		internalRequest.workerQueue = l.sharedWorkerPool.queue()
+	}
+	internalRequest.memory = newMemoryEstimate()
+	if l.usersetCover {
+		internalRequest.usersetCandidates = newUsersetCandidates()
+	}
+	internalRequest.profile = l.profile
+	internalRequest.caseFolder = folder
+	internalRequest.contextualTuples = newContextualTupleIndex(req.GetContextualTuples())
+	internalRequest.deterministic = l.deterministicOrder
+	if l.userConditions {
+		if hasReachableIntersectionOrExclusion(typesys, req.GetObject().GetType(), req.GetRelation()) {
+			telemetry.TraceError(span, ErrUserConditionsUnsupported)
+			return nil, ErrUserConditionsUnsupported
+		}
+		internalRequest.userConditions = newUserConditionsRecorder()
+	}
+	if l.usersByGrantingUserset {
+		if hasReachableIntersectionOrExclusion(typesys, req.GetObject().GetType(), req.GetRelation()) {
+			telemetry.TraceError(span, ErrUsersByGrantingUsersetUnsupported)
+			return nil, ErrUsersByGrantingUsersetUnsupported
+		}
+		internalRequest.grantingUserset = tuple.ToObjectRelationString(tuple.ObjectKey(req.GetObject()), req.GetRelation())
+		internalRequest.grantingUsersets = newGrantingUsersetRecorder()
+	}
+
+	var responseBytes uint64
+	var wasTruncated, maxResultsReached bool
+	var callbackErr error
+
+	// users are sampled as they are found, unless an exclusion is reachable and they may still be
+	// excluded later on, in which case they are only sampled once all of them are found. A
+	// userset cover is sampled once it is computed, and allowed users once they are selected.
+	var sampler *reservoirSampler
+	streamSample := false
+	if l.reservoirSampleSize > 0 {
+		sampler = newReservoirSampler(l.reservoirSampleSize, l.reservoirSampleSeed)
+		streamSample = l.streamsFoundUsers(typesys, req)
+	}
+
+	allowedKeys := allowListKeys(l.userAllowList)
 
 	doneWithFoundUsersCh := make(chan struct{}, 1)
 	go func() {
+		collectedUsers := 0
 		for foundUser := range foundUsersCh {
-			foundUsersUnique[tuple.UserProtoToString(foundUser.user)] = foundUser
+			foundUsersCount.Add(1)
+			key := foundUsersUnique.key(foundUser.user)
+			if excludedSubject != "" && key == excludedSubject {
+				continue
+			}
+			// the users found not to have the relation are kept, since they may still override others
+			if allowedKeys != nil && foundUser.relationshipStatus == HasRelationship {
+				if _, ok := allowedKeys[key]; !ok {
+					continue
+				}
+			}
+
+			if streamSample {
+				if foundUser.relationshipStatus == HasRelationship {
+					sampler.add(key, foundUser.user)
+				}
+				continue
+			}
+
+			if l.maxResponseBytes > 0 && sampler == nil {
+				if !foundUsersUnique.contains(key) {
+					size := uint64(proto.Size(foundUser.user))
+					if responseBytes+size > l.maxResponseBytes {
+						span.SetAttributes(attribute.Bool("max_response_bytes_exceeded", true))
+						wasTruncated = true
+						break
+					}
+					responseBytes += size
+				}
+			}
+
+			isNew := true
+			if !l.discardFoundUsers {
+				isNew = foundUsersUnique.put(key, foundUser)
+				if isNew {
+					collectedUsers++
+					if collectedUsers%memoryEstimateSampleInterval == 0 {
+						internalRequest.memory.sampleFoundUsers(collectedUsers)
+					}
+				}
+			}
+
+			if l.onFoundUser != nil && isNew && foundUser.relationshipStatus == HasRelationship {
+				if err := l.onFoundUser(foundUser.user); err != nil {
+					callbackErr = err
+					break
+				}
+			}
 
-			if l.maxResults > 0 {
-				if uint32(len(foundUsersUnique)) >= l.maxResults {
+			if l.maxResults > 0 && sampler == nil {
+				if uint32(foundUsersUnique.len()) >= l.maxResults {
 					span.SetAttributes(attribute.Bool("max_results_found", true))
+					maxResultsReached = true
 					break
 				}
 			}
 		}
 
+		internalRequest.memory.sampleFoundUsers(collectedUsers)
 		doneWithFoundUsersCh <- struct{}{}
 	}()
 
+	resultPredicate := l.resultPredicate
+	if l.skipEmptyUsersets {
+		resultPredicate = l.nonEmptyUsersetPredicate(typesys, internalRequest, resultPredicate)
+	}
+	if len(l.compoundUserFilters) > 0 {
+		checker := graph.NewLocalChecker()
+		defer checker.Close()
+		resultPredicate = l.compoundFilterPredicate(typesys, internalRequest, plainUserFilters, checker, resultPredicate)
+	}
+
+	expandCtx := cancellableCtx
+	expandedUsersCh := foundUsersCh
+	expandedErrCh := expandErrCh
+	if resultPredicate != nil {
+		var cancelExpand context.CancelFunc
+		expandCtx, cancelExpand = context.WithCancel(cancellableCtx)
+		defer cancelExpand()
+
+		expandedUsersCh = l.buildResultsChannel()
+		expandedErrCh = make(chan error, 1)
+		go func() {
+			err := l.filterResults(cancellableCtx, cancelExpand, internalRequest, resultPredicate, expandedUsersCh, foundUsersCh)
+			// a predicate error cancels the expansion, so it takes precedence over the expansion error
+			select {
+			case expandErr := <-expandedErrCh:
+				if err == nil {
+					err = expandErr
+				}
+			default:
+			}
+			if err != nil {
+				expandErrCh <- err
+			}
+			close(foundUsersCh)
+		}()
+	}
+
 	go func() {
-		internalRequest := fromListUsersRequest(req, &datastoreQueryCount, &dispatchCount)
-		resp := l.expand(cancellableCtx, internalRequest, foundUsersCh)
+		resp := recoverExpansion(func() expandResponse {
+			return l.expandRoot(expandCtx, internalRequest, expandedUsersCh)
+		})
 		if resp.err != nil {
-			expandErrCh <- resp.err
+			expandedErrCh <- resp.err
 		}
-		close(foundUsersCh)
+		close(expandedUsersCh)
 	}()
 
 	deadlineExceeded := false
@@ -251,59 +1303,415 @@ func (l *listUsersQuery) ListUsers(
 		break
 	case <-cancellableCtx.Done():
 		deadlineExceeded = true
-		// to avoid a race on the 'foundUsersUnique' map below, wait for the range over the channel to close
+		// to avoid a race on the results of 'foundUsersUnique' below, wait for the range over the channel to close
 		<-doneWithFoundUsersCh
 		break
 	}
 
+	if callbackErr != nil {
+		telemetry.TraceError(span, callbackErr)
+		return nil, callbackErr
+	}
+
+	expansionDurationExceeded := false
 	select {
 	case err := <-expandErrCh:
-		if deadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		if deadlineExceeded || errors.Is(err, context.DeadlineExceeded) || errors.Is(context.Cause(cancellableCtx), ErrNoProgress) {
 			// We skip the error because we want to send at least partial results to the user (but we should probably set response headers)
+			deadlineExceeded = true
 			break
 		}
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			l.logger.Error("ListUsers expansion panicked",
+				zap.Error(err),
+				zap.ByteString("stack", panicErr.Stack),
+			)
+		}
 		telemetry.TraceError(span, err)
 		return nil, err
 	default:
 		break
 	}
 
+	if deadlineExceeded && errors.Is(context.Cause(cancellableCtx), ErrMaxExpansionDurationExceeded) {
+		if !l.maxDurationPartial {
+			telemetry.TraceError(span, ErrMaxExpansionDurationExceeded)
+			return nil, ErrMaxExpansionDurationExceeded
+		}
+		span.SetAttributes(attribute.Bool("max_expansion_duration_exceeded", true))
+		expansionDurationExceeded = true
+	}
+
+	if deadlineExceeded && errors.Is(context.Cause(cancellableCtx), ErrNoProgress) {
+		telemetry.TraceError(span, ErrNoProgress)
+		return nil, ErrNoProgress
+	}
+
 	cancelCtx()
 
-	foundUsers := make([]*openfgav1.User, 0, len(foundUsersUnique))
-	for foundUserKey, foundUser := range foundUsersUnique {
+	results := foundUsersUnique.results()
+	foundUserKeys := make([]string, 0, len(results))
+	for foundUserKey, foundUser := range results {
 		if foundUser.relationshipStatus == NoRelationship {
 			continue
 		}
+		foundUserKeys = append(foundUserKeys, foundUserKey)
+	}
+
+	foundUsers := l.usersFromKeys(foundUserKeys)
+	if l.userAllowList != nil {
+		foundUsers = allowedUsers(results, l.userAllowList)
+	}
+
+	// the users and the wildcards annotated are those of the response, so they are only known
+	// once the allow list is applied
+	var redundantUsers []*openfgav1.User
+	if l.annotateRedundantUsers {
+		redundantUsers = wildcardCoveredUsers(foundUsers)
+	}
+
+	if l.expandWildcard {
+		expanded, err := l.expandWildcards(ctx, internalRequest, results, foundUsers)
+		if err != nil {
+			telemetry.TraceError(span, err)
+			return nil, err
+		}
+		foundUsers = expanded
+	}
+
+	if l.usersetCover {
+		covered, coverQueryCount, err := l.coverUsers(ctx, req, internalRequest.usersetCandidates.list(), foundUsers)
+		if err != nil {
+			telemetry.TraceError(span, err)
+			return nil, err
+		}
+		datastoreQueryCount.Add(coverQueryCount)
+		foundUsers = covered
+	}
+
+	if excludedSubject != "" {
+		// the subject may be added back by the wildcards expanded or the cover
+		foundUsers = withoutUser(foundUsers, excludedSubject)
+	}
+
+	if l.collapseWildcardCoverage {
+		foundUsers = withoutWildcardCoveredUsers(foundUsers)
+	}
+
+	if sampler != nil {
+		if !streamSample {
+			for _, user := range foundUsers {
+				sampler.add(tuple.UserProtoToString(user), user)
+			}
+		}
+		foundUsers = sampler.users()
+	}
+
+	if l.deterministicOrder {
+		sortUsers(foundUsers)
+		sortUsers(redundantUsers)
+	}
+
+	span.SetAttributes(
+		attribute.Int("result_count", len(foundUsers)),
+		attribute.Int64("peak_memory_estimate_bytes", internalRequest.memory.peakBytes()),
+	)
+	if !l.discardFoundUsers {
+		l.observeResultSize(req, len(foundUsers), wasTruncated || maxResultsReached)
+	}
+
+	var digest uint64
+	if l.resultDigest {
+		digest = resultDigest(foundUsers)
+	}
+
+	cappedRelations := internalRequest.cappedRelations.list()
+	complete := !maxResultsReached && !wasTruncated && !deadlineExceeded && !expansionDurationExceeded && len(cappedRelations) == 0
+	span.SetAttributes(attribute.Bool("complete", complete))
 
-		foundUsers = append(foundUsers, tuple.StringToUserProto(foundUserKey))
+	foundUsers, nextPageHandle := l.paginate(pageRequestKey(req, typesys), foundUsers, complete)
+
+	var userConditions map[string][]UserConditions
+	if internalRequest.userConditions != nil {
+		userConditions = internalRequest.userConditions.conditions(typesys, foundUsers)
 	}
 
-	span.SetAttributes(attribute.Int("result_count", len(foundUsers)))
+	var usersByGrantingUserset map[string][]*openfgav1.User
+	if internalRequest.grantingUsersets != nil {
+		usersByGrantingUserset = internalRequest.grantingUsersets.usersByUserset(foundUsers)
+	}
 
 	return &listUsersResponse{
 		Users: foundUsers,
 		Metadata: listUsersResponseMetadata{
-			DatastoreQueryCount: datastoreQueryCount.Load(),
-			DispatchCounter:     &dispatchCount,
+			DatastoreQueryCount:       datastoreQueryCount.Load(),
+			DispatchCounter:           &dispatchCount,
+			PeakMemoryEstimateBytes:   internalRequest.memory.peakBytes(),
+			Complete:                  complete,
+			WasTruncated:              wasTruncated,
+			ExpansionDurationExceeded: expansionDurationExceeded,
+			RedundantUsers:            redundantUsers,
+			PrunedBranches:            internalRequest.prunedBranches.list(),
+			CappedRelations:           cappedRelations,
+			ResultDigest:              digest,
+			UserConditions:            userConditions,
+			UsersByGrantingUserset:    usersByGrantingUserset,
+			NextPageHandle:            nextPageHandle,
 		},
 	}, nil
 }
 
-func doesHavePossibleEdges(typesys *typesystem.TypeSystem, req *openfgav1.ListUsersRequest) (bool, error) {
-	g := graph.New(typesys)
+// observeResultSize records the number of users returned for req, and whether accumulating them
+// stopped early, in the result metrics.
+func (l *listUsersQuery) observeResultSize(req *openfgav1.ListUsersRequest, size int, truncated bool) {
+	if l.skipResultMetrics {
+		return
+	}
+	labels := []string{req.GetStoreId(), req.GetObject().GetType(), req.GetRelation()}
+	resultSizeHistogram.WithLabelValues(labels...).Observe(float64(size))
+	if truncated {
+		truncatedResponsesCounter.WithLabelValues(labels...).Inc()
+	}
+}
 
-	userFilters := req.GetUserFilters()
+// ListUsersCallback calls callback with each unique user that has the relation with the object
+// instead of returning them all at once. An error returned by the callback stops the expansion
+// and is returned.
+//
+// Users are passed to the callback as soon as they are found, unless an exclusion is reachable
+// from the relation. A user found under an exclusion may still be excluded by results found later
+// on, so in that case the callback is only called once the expansion is complete. The same goes
+// for a userset cover, which can only be computed once all the users are found, and for a user
+// allow list, since a wildcard found later on may still grant the relation to allowed users, and
+// for expanded wildcards. See WithTypeGroupedStreaming to pass on the users grouped by type.
+func (l *listUsersQuery) ListUsersCallback(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(*openfgav1.User) error,
+) error {
+	_, err := l.listUsersCallback(ctx, req, callback)
+	return err
+}
 
-	source := typesystem.DirectRelationReference(userFilters[0].GetType(), userFilters[0].GetRelation())
-	target := typesystem.DirectRelationReference(req.GetObject().GetType(), req.GetRelation())
+// listUsersCallback is ListUsersCallback, but also reports whether the users passed on are all the
+// users with the relation. See listUsersResponseMetadata.Complete.
+func (l *listUsersQuery) listUsersCallback(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(*openfgav1.User) error,
+) (bool, error) {
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	q := *l
+	q.pageSize = 0
+	if !l.streamsFoundUsers(typesys, req) {
+		resp, err := q.ListUsers(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		users := resp.GetUsers()
+		if l.typeGroupedStreaming {
+			sortUsersByFilterType(users, req.GetUserFilters())
+		}
+		for _, user := range users {
+			if err := callback(user); err != nil {
+				return false, err
+			}
+		}
+		return resp.Metadata.Complete, nil
+	}
 
-	edges, err := g.GetPrunedRelationshipEdges(target, source)
+	q.streamUnions = true
+	if l.typeGroupedStreaming {
+		return q.listUsersGroupedByType(ctx, req, callback)
+	}
+	q.onFoundUser = callback
+	resp, err := q.ListUsers(ctx, req)
 	if err != nil {
 		return false, err
 	}
+	return resp.Metadata.Complete, nil
+}
+
+// streamsFoundUsers reports whether the users found for the request can be passed on as soon as
+// they are found, rather than once all of them are.
+func (l *listUsersQuery) streamsFoundUsers(typesys *typesystem.TypeSystem, req *openfgav1.ListUsersRequest) bool {
+	return !l.usersetCover && l.userAllowList == nil && !l.expandWildcard && !l.collapseWildcardCoverage &&
+		!hasReachableExclusion(typesys, req.GetObject().GetType(), req.GetRelation())
+}
+
+// filterResults forwards the users received on in to out, dropping the users that have the
+// relation but do not satisfy predicate. Users without the relation are always
+// forwarded since they may still need to override other results. If the predicate fails,
+// cancel is called to stop the expansion feeding in.
+func (l *listUsersQuery) filterResults(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	req *internalListUsersRequest,
+	predicate ResultPredicate,
+	in <-chan foundUser,
+	out chan<- foundUser,
+) error {
+	evaluated := newUniqueUserSet(req.interner, 0)
+
+	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+	for foundUser := range in {
+		if foundUser.relationshipStatus == NoRelationship {
+			trySendResult(ctx, foundUser, out)
+			continue
+		}
+
+		if !evaluated.add(foundUser.user) {
+			continue
+		}
+
+		pool.Go(l.expansionTask(req, "result_predicate", func(ctx context.Context) error {
+			ok, err := predicate(ctx, foundUser.user)
+			if err != nil {
+				cancel()
+				return err
+			}
+			if ok {
+				trySendResult(ctx, foundUser, out)
+			}
+			return nil
+		}))
+	}
+
+	return pool.Wait()
+}
+
+// doesHavePossibleEdges reports whether the users of any of the user filters of req may have the
+// relation, such as those of the compound filters added to the filters of the request.
+func (l *listUsersQuery) doesHavePossibleEdges(typesys *typesystem.TypeSystem, req *openfgav1.ListUsersRequest) (bool, error) {
+	target := typesystem.DirectRelationReference(req.GetObject().GetType(), req.GetRelation())
+	for _, userFilter := range req.GetUserFilters() {
+		source := typesystem.DirectRelationReference(userFilter.GetType(), userFilter.GetRelation())
+		hasPossibleEdges, _, err := l.pruner.HasPossibleEdges(typesys, target, source)
+		if err != nil || hasPossibleEdges {
+			return hasPossibleEdges, err
+		}
+	}
+
+	return false, nil
+}
+
+// expandRoot expands the top-level request, splitting it by user filter type if fair
+// type scheduling or stopping on wildcards is enabled.
+func (l *listUsersQuery) expandRoot(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	foundUsersChan chan<- foundUser,
+) expandResponse {
+	if !l.fairTypeScheduling && !l.stopOnWildcard {
+		return l.expand(ctx, req, foundUsersChan)
+	}
+
+	filterTypes, filtersByType := groupUserFiltersByType(req.GetUserFilters())
+	if len(filterTypes) <= 1 && !l.stopOnWildcard {
+		return l.expand(ctx, req, foundUsersChan)
+	}
+
+	// Users of different types never match each other, so each type can be expanded
+	// independently (including under intersection and exclusion) and the results merged.
+	scheduled := l
+	if l.fairTypeScheduling && len(filterTypes) > 1 {
+		fair := *l
+		fair.resolveNodeBreadthLimit = max(1, l.resolveNodeBreadthLimit/uint32(len(filterTypes)))
+		scheduled = &fair
+	}
+
+	pool := concurrency.NewPool(ctx, len(filterTypes))
+	for _, filterType := range filterTypes {
+		typeReq := req.clone()
+		typeReq.UserFilters = filtersByType[filterType]
+		pool.Go(l.expansionTask(req, "root", func(ctx context.Context) error {
+			if l.stopOnWildcard && hasTypeOnlyFilter(typeReq.UserFilters) {
+				return scheduled.expandUntilWildcard(ctx, typeReq, filterType, foundUsersChan)
+			}
+			return scheduled.expand(ctx, typeReq, foundUsersChan).err
+		}))
+	}
+
+	return expandResponse{
+		err: pool.Wait(),
+	}
+}
+
+// expandUntilWildcard expands a request whose user filters are all of filterType, and cancels
+// the expansion once the public wildcard of filterType is found. Results reaching this point
+// have already been resolved by any intersection or exclusion they were found under, so a
+// wildcard with a relationship is definitive.
+func (l *listUsersQuery) expandUntilWildcard(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	filterType string,
+	foundUsersChan chan<- foundUser,
+) error {
+	expandCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	typeFoundUsersCh := make(chan foundUser, 1)
+	var resp expandResponse
+	go func() {
+		resp = recoverExpansion(func() expandResponse {
+			return l.expand(expandCtx, req, typeFoundUsersCh)
+		})
+		close(typeFoundUsersCh)
+	}()
+
+	wildcardKey := tuple.TypedPublicWildcard(filterType)
+	wildcardFound := false
+	for fu := range typeFoundUsersCh {
+		if wildcardFound {
+			// drain until the cancelled expansion returns
+			continue
+		}
+
+		trySendResult(ctx, fu, foundUsersChan)
+		if fu.relationshipStatus == HasRelationship && req.interner.userKey(fu.user) == wildcardKey {
+			wildcardFound = true
+			cancel()
+		}
+	}
+
+	if wildcardFound {
+		// errors caused by cancelling the expansion are expected
+		return nil
+	}
+	return resp.err
+}
+
+func hasTypeOnlyFilter(filters []*openfgav1.UserTypeFilter) bool {
+	for _, f := range filters {
+		if f.GetRelation() == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// canReachUserFilters reports whether expanding the request could yield a user matching
+// one of its user filters. The possible edges are memoized for the request, so that dispatching
+// the same relation for many objects walks the relationship graph once.
+func (l *listUsersQuery) canReachUserFilters(typesys *typesystem.TypeSystem, req *internalListUsersRequest) (bool, error) {
+	target := typesystem.DirectRelationReference(req.GetObject().GetType(), req.GetRelation())
+	for _, f := range req.GetUserFilters() {
+		if f.GetType() == target.GetType() && f.GetRelation() == target.GetRelation() {
+			return true, nil
+		}
 
-	return len(edges) > 0, err
+		source := typesystem.DirectRelationReference(f.GetType(), f.GetRelation())
+		hasPossibleEdges, err := l.hasPossibleEdges(typesys, req, target, source)
+		if err != nil || hasPossibleEdges {
+			return hasPossibleEdges, err
+		}
+	}
+	return false, nil
 }
 
 func (l *listUsersQuery) dispatch(
@@ -311,6 +1719,26 @@ func (l *listUsersQuery) dispatch(
 	req *internalListUsersRequest,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
+	if l.fairTypeScheduling {
+		// with fair scheduling each type only spends its share of the breadth
+		// limit on the branches that can reach it
+		typesys, _ := typesystem.TypesystemFromContext(ctx)
+		canReach, err := l.canReachUserFilters(typesys, req)
+		if err != nil {
+			if errors.Is(err, typesystem.ErrRelationUndefined) {
+				return expandResponse{}
+			}
+			return expandResponse{err: err}
+		}
+		if !canReach {
+			return expandResponse{}
+		}
+	}
+
+	if err := l.spendBudget(req, 1); err != nil {
+		return expandResponse{err: err}
+	}
+
 	newcount := req.dispatchCount.Add(1)
 	if l.dispatchThrottlerConfig.Enabled {
 		l.throttle(ctx, newcount)
@@ -324,7 +1752,7 @@ func (l *listUsersQuery) expand(
 	req *internalListUsersRequest,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expand")
+	ctx, span := startStepSpan(ctx, "expand")
 	defer span.End()
 	span.SetAttributes(attribute.Int("depth", int(req.depth)))
 	if req.depth >= l.resolveNodeLimit {
@@ -334,6 +1762,14 @@ func (l *listUsersQuery) expand(
 	}
 	req.depth++
 
+	if l.observability != nil {
+		l.observability.OnExpand(ctx, ExpandEvent{
+			Object:   tuple.ObjectKey(req.GetObject()),
+			Relation: req.GetRelation(),
+			Depth:    req.depth,
+		})
+	}
+
 	if enteredCycle(req) {
 		span.SetAttributes(attribute.Bool("cycle_detected", true))
 		return expandResponse{
@@ -345,22 +1781,33 @@ func (l *listUsersQuery) expand(
 	reqObjectID := req.GetObject().GetId()
 	reqRelation := req.GetRelation()
 
+	// The object's userset is emitted for the relation it is expanded with, before that relation is
+	// rewritten. Like Check, which considers `document:1#viewer` a viewer of document:1 even if
+	// viewer is a computed userset of editor, the userset of a relation has that relation, and a
+	// computed userset dispatches its own relation, so each relation reached is emitted as declared.
 	for _, userFilter := range req.GetUserFilters() {
 		if reqObjectType == userFilter.GetType() && reqRelation == userFilter.GetRelation() {
-			trySendResult(ctx, foundUser{
-				user: &openfgav1.User{
-					User: &openfgav1.User_Userset{
-						Userset: &openfgav1.UsersetUser{
-							Type:     reqObjectType,
-							Id:       reqObjectID,
-							Relation: reqRelation,
-						},
+			user := &openfgav1.User{
+				User: &openfgav1.User_Userset{
+					Userset: &openfgav1.UsersetUser{
+						Type:     reqObjectType,
+						Id:       reqObjectID,
+						Relation: reqRelation,
 					},
 				},
+			}
+			req.userConditions.record(user, req.pathConditions)
+			trySendResult(ctx, foundUser{
+				user: user,
 			}, foundUsersChan)
 		}
 	}
 
+	if l.maxHops != 0 && req.hops > l.maxHops {
+		span.SetAttributes(attribute.Bool("max_hops_reached", true))
+		return expandResponse{}
+	}
+
 	typesys, _ := typesystem.TypesystemFromContext(ctx)
 
 	targetObjectType := req.GetObject().GetType()
@@ -368,13 +1815,31 @@ func (l *listUsersQuery) expand(
 
 	relation, err := typesys.GetRelation(targetObjectType, targetRelation)
 	if err != nil {
+		// a relation that the current type doesn't define has no users, just like Check considers it
 		var relationUndefinedError *typesystem.RelationUndefinedError
 		if errors.As(err, &relationUndefinedError) {
 			return expandResponse{}
 		}
 		return expandResponse{
-			err: err,
+			err: &ModelError{ObjectType: targetObjectType, Relation: targetRelation, Err: err},
+		}
+	}
+
+	if l.directOnly {
+		if !typesys.IsDirectlyAssignable(relation) {
+			return expandResponse{}
+		}
+		verifyResults := func() error { return nil }
+		if verifiesDirect(relation.GetRewrite()) {
+			span.SetAttributes(attribute.Bool("verified", true))
+			foundUsersChan, verifyResults = l.verifyDirectResults(ctx, req, foundUsersChan)
+		}
+		resp := l.expandDirect(ctx, req, foundUsersChan)
+		resp.err = errors.Join(resp.err, verifyResults())
+		if resp.err != nil {
+			telemetry.TraceError(span, resp.err)
 		}
+		return resp
 	}
 
 	relationRewrite := relation.GetRewrite()
@@ -391,16 +1856,33 @@ func (l *listUsersQuery) expandRewrite(
 	rewrite *openfgav1.Userset,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandRewrite")
+	ctx, span := startStepSpan(ctx, "expandRewrite")
 	defer span.End()
 
+	if l.maxExpansionSteps != 0 && req.expansionSteps.Add(1) > l.maxExpansionSteps {
+		telemetry.TraceError(span, ErrMaxExpansionStepsExceeded)
+		return expandResponse{
+			err: ErrMaxExpansionStepsExceeded,
+		}
+	}
+
 	var resp expandResponse
 	switch rewrite := rewrite.GetUserset().(type) {
 	case *openfgav1.Userset_This:
 		resp = l.expandDirect(ctx, req, foundUsersChan)
 	case *openfgav1.Userset_ComputedUserset:
+		// A computed userset always refers to a relation on the type of the object currently being
+		// expanded, never on the type of the user filter. After a TTU hop the current object is the
+		// tupleset's user, so a chain such as `can_view: reader`, `reader: can_view from parent`
+		// resolves each link against the type of the object it was reached on.
+		defer req.profile.track(RewriteKindComputedUserset)()
+		computedRelation := rewrite.ComputedUserset.GetRelation()
+		typesys, _ := typesystem.TypesystemFromContext(ctx)
+		if !l.traversesRelation(typesys, req.GetObject().GetType(), computedRelation) {
+			break
+		}
 		rewrittenReq := req.clone()
-		rewrittenReq.Relation = rewrite.ComputedUserset.GetRelation()
+		rewrittenReq.Relation = computedRelation
 		resp = l.dispatch(ctx, rewrittenReq, foundUsersChan)
 	case *openfgav1.Userset_TupleToUserset:
 		resp = l.expandTTU(ctx, req, rewrite, foundUsersChan)
@@ -425,8 +1907,9 @@ func (l *listUsersQuery) expandDirect(
 	req *internalListUsersRequest,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandDirect")
+	ctx, span := startStepSpan(ctx, "expandDirect")
 	defer span.End()
+	defer req.profile.track(RewriteKindDirect)()
 	typesys, _ := typesystem.TypesystemFromContext(ctx)
 
 	opts := storage.ReadOptions{
@@ -434,10 +1917,10 @@ func (l *listUsersQuery) expandDirect(
 			Preference: req.GetConsistency(),
 		},
 	}
-	iter, err := l.ds.Read(ctx, req.GetStoreId(), &openfgav1.TupleKey{
+	iter, err := l.read(ctx, req, &openfgav1.TupleKey{
 		Object:   tuple.ObjectKey(req.GetObject()),
 		Relation: req.GetRelation(),
-	}, opts)
+	}, opts, true)
 	if err != nil {
 		telemetry.TraceError(span, err)
 		return expandResponse{
@@ -446,14 +1929,28 @@ func (l *listUsersQuery) expandDirect(
 	}
 	defer iter.Stop()
 	req.datastoreQueryCount.Add(1)
+	req.profile.addDatastoreQuery(RewriteKindDirect)
 
+	// the users that can't be parsed are counted before the validation of the tuples skips them
+	isValidTuple := validation.FilterInvalidTuples(typesys)
 	filteredIter := storage.NewFilteredTupleKeyIterator(
 		storage.NewTupleKeyIteratorFromTupleIterator(iter),
-		validation.FilterInvalidTuples(typesys),
+		l.withAdditionalTupleFilters(func(tupleKey *openfgav1.TupleKey) bool {
+			if _, _, _, ok := parseTupleUser(tupleKey.GetUser()); !ok {
+				invalidTupleUsersSkippedCounter.Inc()
+				return false
+			}
+			return isValidTuple(tupleKey)
+		}),
 	)
 	defer filteredIter.Stop()
 
-	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+	// the pool is only created once a userset is dispatched, since in sparse stores most objects
+	// have no tuples for the relation, or only tuples assigning users directly
+	var dispatchPool *pool.ContextPool
+
+	membersCap, isCapped := l.relationRecursionCap(req.GetObject().GetType(), req.GetRelation())
+	var followedMembers uint32
 
 	var errs error
 	var hasCycle atomic.Bool
@@ -468,6 +1965,11 @@ LoopOnIterator:
 			break LoopOnIterator
 		}
 
+		if err := l.spendBudget(req, 1); err != nil {
+			errs = errors.Join(errs, err)
+			break LoopOnIterator
+		}
+
 		condEvalResult, err := eval.EvaluateTupleCondition(ctx, tupleKey, typesys, req.GetContext())
 		if err != nil {
 			errs = errors.Join(errs, err)
@@ -488,14 +1990,32 @@ LoopOnIterator:
 		}
 
 		tupleKeyUser := tupleKey.GetUser()
-		userObject, userRelation := tuple.SplitObjectRelation(tupleKeyUser)
-		userObjectType, userObjectID := tuple.SplitObject(userObject)
+		userObjectType, userObjectID, userRelation, ok := parseTupleUser(tupleKeyUser)
+		if !ok {
+			invalidTupleUsersSkippedCounter.Inc()
+			continue
+		}
+
+		if isCapped && followedMembers >= membersCap {
+			span.SetAttributes(attribute.Bool("relation_recursion_capped", true))
+			req.cappedRelations.add(req.GetObject().GetType(), req.GetRelation())
+			break LoopOnIterator
+		}
+		followedMembers++
+
+		if userRelation == "" && l.usersetsOnly {
+			continue
+		}
+
+		pathConditions := withCondition(req.pathConditions, tupleKey.GetCondition())
 
 		if userRelation == "" {
 			for _, f := range req.GetUserFilters() {
 				if f.GetType() == userObjectType {
 					user := tuple.StringToUserProto(tuple.BuildObject(userObjectType, userObjectID))
 
+					req.userConditions.record(user, pathConditions)
+					req.grantingUsersets.record(req.grantingUserset, user)
 					trySendResult(ctx, foundUser{
 						user: user,
 					}, foundUsersChan)
@@ -504,26 +2024,172 @@ LoopOnIterator:
 			continue
 		}
 
-		pool.Go(func(ctx context.Context) error {
-			rewrittenReq := req.clone()
-			rewrittenReq.Object = &openfgav1.Object{Type: userObjectType, Id: userObjectID}
-			rewrittenReq.Relation = userRelation
-			resp := l.dispatch(ctx, rewrittenReq, foundUsersChan)
-			if resp.hasCycle {
-				hasCycle.Store(true)
-			}
-			return resp.err
-		})
+		if l.usersetsOnly {
+			if l.relationCanReachUserFilters(typesys, req, userObjectType, userRelation, req.GetUserFilters()) {
+				req.userConditions.record(tuple.StringToUserProto(tupleKeyUser), pathConditions)
+				trySendResult(ctx, foundUser{
+					user: tuple.StringToUserProto(tupleKeyUser),
+				}, foundUsersChan)
+			}
+			continue
+		}
+
+		if l.directOnly {
+			for _, f := range req.GetUserFilters() {
+				if f.GetType() == userObjectType && f.GetRelation() == userRelation {
+					req.userConditions.record(tuple.StringToUserProto(tupleKeyUser), pathConditions)
+					trySendResult(ctx, foundUser{
+						user: tuple.StringToUserProto(tupleKeyUser),
+					}, foundUsersChan)
+				}
+			}
+			continue
+		}
+
+		if req.usersetCandidates != nil {
+			req.usersetCandidates.add(tupleKeyUser)
+		}
+
+		if dispatchPool == nil {
+			dispatchPool = concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+		}
+		dispatchPool.Go(l.expansionTask(req, "direct", func(ctx context.Context) error {
+			rewrittenReq := req.clone()
+			rewrittenReq.Object = &openfgav1.Object{Type: userObjectType, Id: userObjectID}
+			rewrittenReq.Relation = userRelation
+			rewrittenReq.pathConditions = pathConditions
+			rewrittenReq.grantingUserset = tupleKeyUser
+			rewrittenReq.hops++
+			resp := l.dispatch(ctx, rewrittenReq, foundUsersChan)
+			if resp.hasCycle {
+				hasCycle.Store(true)
+			}
+			return resp.err
+		}))
+	}
+
+	if dispatchPool != nil {
+		errs = errors.Join(errs, dispatchPool.Wait())
+	}
+	if errs != nil {
+		telemetry.TraceError(span, errs)
+	}
+	return expandResponse{
+		err:      errs,
+		hasCycle: hasCycle.Load(),
+	}
+}
+
+// withAdditionalTupleFilters returns a filter that only passes the tuples passing filter and then
+// every filter added with WithAdditionalTupleFilters.
+func (l *listUsersQuery) withAdditionalTupleFilters(filter storage.TupleKeyFilterFunc) storage.TupleKeyFilterFunc {
+	if len(l.additionalTupleFilters) == 0 {
+		return filter
+	}
+
+	return func(tupleKey *openfgav1.TupleKey) bool {
+		if !filter(tupleKey) {
+			return false
+		}
+		for _, additionalFilter := range l.additionalTupleFilters {
+			if !additionalFilter(tupleKey) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// expansionTask wraps fn, run by a pool of the expansion, so that a panic in it is returned as a
+// *PanicError rather than crashing the process, and so that it runs with pprof labels describing
+// the request and the kind of rewrite being expanded, if profiler labels are enabled.
+func (l *listUsersQuery) expansionTask(
+	req *internalListUsersRequest,
+	rewriteKind string,
+	fn func(ctx context.Context) error,
+) func(ctx context.Context) error {
+	fn = recoverPanics(fn)
+	if !l.profilerLabels {
+		return fn
+	}
+
+	labels := pprof.Labels(
+		"store_id", req.GetStoreId(),
+		"object_type", req.GetObject().GetType(),
+		"relation", req.GetRelation(),
+		"rewrite", rewriteKind,
+	)
+	return func(ctx context.Context) error {
+		var err error
+		pprof.Do(ctx, labels, func(ctx context.Context) {
+			err = fn(ctx)
+		})
+		return err
+	}
+}
+
+// spendBudget consumes units of the traversal budget, if any, and returns
+// ErrTraversalBudgetExceeded once the budget is exhausted.
+func (l *listUsersQuery) spendBudget(req *internalListUsersRequest, units uint64) error {
+	if l.traversalBudget == 0 {
+		return nil
+	}
+	if req.budgetSpent.Add(units) > l.traversalBudget {
+		return ErrTraversalBudgetExceeded
+	}
+	return nil
+}
+
+// read reads the stored and contextual tuples matching the object and relation of tupleKey. See
+// readWithContextualTuples for how shadowUsers applies.
+func (l *listUsersQuery) read(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	tupleKey *openfgav1.TupleKey,
+	opts storage.ReadOptions,
+	shadowUsers bool,
+) (storage.TupleIterator, error) {
+	if l.observability != nil {
+		l.observability.OnDatastoreRead(ctx, DatastoreReadEvent{StoreID: req.GetStoreId(), TupleKey: tupleKey})
+	}
+
+	if l.readInterceptor != nil {
+		if err := l.readInterceptor(ctx, req.GetStoreId(), tupleKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.storeReadRateLimiter != nil {
+		if err := l.storeReadRateLimiter.wait(ctx, l.clock, req.GetStoreId()); err != nil {
+			return nil, err
+		}
 	}
 
-	errs = errors.Join(errs, pool.Wait())
-	if errs != nil {
-		telemetry.TraceError(span, errs)
+	opts.SnapshotToken = req.snapshotToken
+	opts.Partition = l.partition
+	ds := req.ds
+	if ds == nil {
+		ds = l.ds
 	}
-	return expandResponse{
-		err:      errs,
-		hasCycle: hasCycle.Load(),
+	if req.workerQueue != nil {
+		ds = &sharedPoolTupleReader{RelationshipTupleReader: ds, queue: req.workerQueue}
+	}
+	contextualTuples := req.GetContextualTuples()
+	if req.contextualTuples != nil {
+		contextualTuples = req.contextualTuples.matching(tupleKey)
+	}
+	if l.contextualTupleDepth != 0 && req.depth > l.contextualTupleDepth {
+		contextualTuples = nil
+	}
+	iter, err := readWithContextualTuples(ctx, ds, req.GetStoreId(), tupleKey, opts, contextualTuples, shadowUsers)
+	if err != nil {
+		return nil, wrapDatastoreError(err)
+	}
+	iter = &datastoreErrorIterator{TupleIterator: iter}
+	if req.caseFolder == nil {
+		return iter, nil
 	}
+	return &caseFoldingTupleIterator{TupleIterator: iter, folder: req.caseFolder}, nil
 }
 
 func (l *listUsersQuery) expandIntersection(
@@ -532,50 +2198,61 @@ func (l *listUsersQuery) expandIntersection(
 	rewrite *openfgav1.Userset_Intersection,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandIntersection")
+	ctx, span := startStepSpan(ctx, "expandIntersection")
 	defer span.End()
-	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+	defer req.profile.track(RewriteKindIntersection)()
 
-	childOperands := rewrite.Intersection.GetChild()
-	intersectionFoundUsersChans := make([]chan foundUser, len(childOperands))
-	for i, rewrite := range childOperands {
-		i := i
-		rewrite := rewrite
-		intersectionFoundUsersChans[i] = make(chan foundUser, 1)
-		pool.Go(func(ctx context.Context) error {
-			resp := l.expandRewrite(ctx, req, rewrite, intersectionFoundUsersChans[i])
-			return resp.err
-		})
+	// operands that can't yield users of a common filter type have no user in common
+	typesys, _ := typesystem.TypesystemFromContext(ctx)
+	canReach := rewriteReachable(req, rewrite.Intersection, req.GetUserFilters(), func() bool {
+		return l.operandsCanReachCommonFilter(typesys, req, rewrite.Intersection.GetChild(), req.GetUserFilters())
+	})
+	if !canReach {
+		span.SetAttributes(attribute.Bool("disjoint_operands", true))
+		return expandResponse{}
 	}
 
-	errChan := make(chan error, 1)
-
-	go func() {
-		err := pool.Wait()
-		for i := range intersectionFoundUsersChans {
-			close(intersectionFoundUsersChans[i])
+	if !l.exactIntersection && l.approximateIntersection.valid() {
+		if resp, ok := l.expandApproximateIntersection(ctx, req, rewrite, foundUsersChan); ok {
+			return resp
 		}
-		errChan <- err
-		close(errChan)
-	}()
+	}
 
-	var mu sync.Mutex
+	operandConcurrency := l.resolveNodeBreadthLimit
+	if l.intersectionConcurrency != 0 {
+		operandConcurrency = l.intersectionConcurrency
+	}
+	pool := concurrency.NewPool(ctx, int(operandConcurrency))
 
-	var wg sync.WaitGroup
-	wg.Add(len(childOperands))
+	childOperands := rewrite.Intersection.GetChild()
+
+	var mu sync.Mutex
 
-	wildcardCount := atomic.Uint32{}
-	wildcardKey := tuple.TypedPublicWildcard(req.GetUserFilters()[0].GetType())
+	// wildcardCountMap tracks, per typed public wildcard, the number of operands that
+	// returned it. Wildcards are counted per type since with multiple user filters each
+	// operand may return the wildcards of several types.
+	wildcardCountMap := make(map[string]uint32, 0)
 	foundUsersCountMap := make(map[string]uint32, 0)
 	excludedUsersMap := make(map[string]struct{}, 0)
-	for _, foundUsersChan := range intersectionFoundUsersChans {
-		go func(foundUsersChan chan foundUser) {
-			defer wg.Done()
+
+	// each operand is drained by the task expanding it, so that a wide intersection only has as
+	// many operands, and goroutines draining them, as the pool runs at once
+	for _, rewrite := range childOperands {
+		pool.Go(l.expansionTask(req, "intersection", func(ctx context.Context) error {
+			operandFoundUsersChan := make(chan foundUser, 1)
+			var resp expandResponse
+			go func() {
+				resp = recoverExpansion(func() expandResponse {
+					return l.expandRewrite(ctx, req, rewrite, operandFoundUsersChan)
+				})
+				close(operandFoundUsersChan)
+			}()
+
 			foundUsersMap := make(map[string]uint32, 0)
-			for foundUser := range foundUsersChan {
-				key := tuple.UserProtoToString(foundUser.user)
+			for foundUser := range operandFoundUsersChan {
+				key := req.interner.userKey(foundUser.user)
 				for _, excludedUser := range foundUser.excludedUsers {
-					key := tuple.UserProtoToString(excludedUser)
+					key := req.interner.userKey(excludedUser)
 					mu.Lock()
 					excludedUsersMap[key] = struct{}{}
 					mu.Unlock()
@@ -586,47 +2263,54 @@ func (l *listUsersQuery) expandIntersection(
 				foundUsersMap[key]++
 			}
 
-			_, wildcardExists := foundUsersMap[wildcardKey]
-			if wildcardExists {
-				wildcardCount.Add(1)
+			mu.Lock()
+			defer mu.Unlock()
+			for userKey := range foundUsersMap {
+				if tuple.IsTypedWildcard(userKey) {
+					wildcardCountMap[userKey]++
+				}
 			}
 			for userKey := range foundUsersMap {
-				mu.Lock()
-				// Increment the count for a user but decrement if a wildcard
-				// also exists to prevent double counting. This ensures accurate
-				// tracking for intersection criteria, avoiding inflated counts
-				// when both a user and a wildcard are present.
-				foundUsersCountMap[userKey]++
-				if wildcardExists {
-					foundUsersCountMap[userKey]--
+				// Count the operand for a user only if it didn't also return a wildcard
+				// of the same type, since the wildcard is counted for it already. The
+				// user is still recorded so that the operands returning it only through
+				// a wildcard count for it too.
+				count := foundUsersCountMap[userKey]
+				if _, wildcardExists := foundUsersMap[typedWildcardKey(userKey)]; !wildcardExists {
+					count++
 				}
-				mu.Unlock()
+				foundUsersCountMap[userKey] = count
 			}
-		}(foundUsersChan)
+			return resp.err
+		}))
 	}
-	wg.Wait()
+
+	err := pool.Wait()
+	defer req.memory.hold(len(foundUsersCountMap) + len(wildcardCountMap) + len(excludedUsersMap))()
 
 	excludedUsers := []*openfgav1.User{}
-	for key := range excludedUsersMap {
+	orderedRange(req.deterministic, excludedUsersMap, func(key string, _ struct{}) {
 		excludedUsers = append(excludedUsers, tuple.StringToUserProto(key))
-	}
+	})
 
-	for key, count := range foundUsersCountMap {
+	orderedRange(req.deterministic, foundUsersCountMap, func(key string, count uint32) {
 		// Compare the number of times the specific user was returned for
-		// all intersection operands plus the number of wildcards.
+		// all intersection operands plus the number of wildcards of its type.
 		// If this summed value equals the number of operands, the user satisfies
-		// the intersection expression and can be sent on `foundUsersChan`
-		if (count + wildcardCount.Load()) == uint32(len(childOperands)) {
+		// the intersection expression and can be sent on `foundUsersChan`. Each
+		// operand counts at most once towards the sum, so it can't exceed the number
+		// of operands, and it is compared as an int so that it can't wrap around.
+		if int(count)+int(wildcardCountMap[typedWildcardKey(key)]) == len(childOperands) {
 			fu := foundUser{
 				user:          tuple.StringToUserProto(key),
 				excludedUsers: excludedUsers,
 			}
 			trySendResult(ctx, fu, foundUsersChan)
 		}
-	}
+	})
 
 	return expandResponse{
-		err: <-errChan,
+		err: err,
 	}
 }
 
@@ -636,76 +2320,124 @@ func (l *listUsersQuery) expandUnion(
 	rewrite *openfgav1.Userset_Union,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandUnion")
+	ctx, span := startStepSpan(ctx, "expandUnion")
 	defer span.End()
+	defer req.profile.track(RewriteKindUnion)()
 	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
 
-	childOperands := rewrite.Union.GetChild()
+	// operands that can't yield users of the filter types are skipped altogether; they would
+	// contribute no users, just like an operand with no tuples
+	typesys, _ := typesystem.TypesystemFromContext(ctx)
+	operands := flattenUnion(rewrite.Union)
+	childOperands := make([]*openfgav1.Userset, 0, len(operands))
+	for _, child := range operands {
+		if !l.rewriteCanReachUserFilters(typesys, req, child) {
+			req.prunedBranches.add(typesys, req.GetObject().GetType(), req.GetRelation(), child)
+			continue
+		}
+		childOperands = append(childOperands, child)
+	}
+	span.SetAttributes(attribute.Int("pruned_operands", len(operands)-len(childOperands)))
 	unionFoundUsersChans := make([]chan foundUser, len(childOperands))
-	for i, rewrite := range childOperands {
-		i := i
-		rewrite := rewrite
+	for i := range childOperands {
 		unionFoundUsersChans[i] = make(chan foundUser, 1)
-		pool.Go(func(ctx context.Context) error {
-			resp := l.expandRewrite(ctx, req, rewrite, unionFoundUsersChans[i])
-			return resp.err
-		})
 	}
 
-	errChan := make(chan error, 1)
-
-	go func() {
-		err := pool.Wait()
-		for i := range unionFoundUsersChans {
-			close(unionFoundUsersChans[i])
-		}
-		errChan <- err
-		close(errChan)
-	}()
-
 	var mu sync.Mutex
 
 	var wg sync.WaitGroup
 	wg.Add(len(childOperands))
 
 	foundUsersMap := make(map[string]struct{}, 0)
-	excludedUsersCountMap := make(map[string]uint32, 0)
-	for _, foundUsersChan := range unionFoundUsersChans {
-		go func(foundUsersChan chan foundUser) {
+	// the users each operand excluded, and the wildcards each operand returned, to tell which
+	// users are excluded from the wildcards of the union as a whole
+	operandExcludedUsers := make([]map[string]struct{}, len(childOperands))
+	operandWildcards := make([]map[string]struct{}, len(childOperands))
+	for i, operandFoundUsersChan := range unionFoundUsersChans {
+		operandExcludedUsers[i] = make(map[string]struct{})
+		operandWildcards[i] = make(map[string]struct{})
+		go func(operandFoundUsersChan chan foundUser, excludedUsers, wildcards map[string]struct{}) {
 			defer wg.Done()
 
-			for foundUser := range foundUsersChan {
-				key := tuple.UserProtoToString(foundUser.user)
+			for foundUser := range operandFoundUsersChan {
+				key := req.interner.userKey(foundUser.user)
 				for _, excludedUser := range foundUser.excludedUsers {
-					key := tuple.UserProtoToString(excludedUser)
-					mu.Lock()
-					excludedUsersCountMap[key]++
-					mu.Unlock()
+					excludedUsers[req.interner.userKey(excludedUser)] = struct{}{}
 				}
 				if foundUser.relationshipStatus == NoRelationship {
 					continue
 				}
+				if tuple.IsTypedWildcard(key) {
+					wildcards[key] = struct{}{}
+				}
 				mu.Lock()
+				_, seen := foundUsersMap[key]
 				foundUsersMap[key] = struct{}{}
 				mu.Unlock()
+				if l.streamUnions && !seen {
+					trySendResult(ctx, foundUser, foundUsersChan)
+				}
 			}
-		}(foundUsersChan)
+		}(operandFoundUsersChan, operandExcludedUsers[i], operandWildcards[i])
+	}
+
+	// submit the operands only once their results are being consumed, otherwise an operand
+	// blocked on sending its results holds a pool slot the other operands are waiting on
+	for i, rewrite := range childOperands {
+		i := i
+		rewrite := rewrite
+		pool.Go(l.expansionTask(req, "union", func(ctx context.Context) error {
+			resp := l.expandRewrite(ctx, req, rewrite, unionFoundUsersChans[i])
+			return resp.err
+		}))
 	}
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		err := pool.Wait()
+		for i := range unionFoundUsersChans {
+			close(unionFoundUsersChans[i])
+		}
+		errChan <- err
+		close(errChan)
+	}()
+
 	wg.Wait()
 
-	excludedUsers := []*openfgav1.User{}
-	for key, count := range excludedUsersCountMap {
-		if count == uint32(len(childOperands)) {
-			excludedUsers = append(excludedUsers, tuple.StringToUserProto(key))
+	// a user is excluded from the union if no operand found it, and every operand that returned
+	// the wildcard of its type excluded it
+	excludedUsersMap := make(map[string]struct{}, 0)
+	for _, operandExcluded := range operandExcludedUsers {
+	excludedUsers:
+		for key := range operandExcluded {
+			if _, found := foundUsersMap[key]; found {
+				continue
+			}
+			for i, wildcards := range operandWildcards {
+				if _, ok := wildcards[typedWildcardKey(key)]; !ok {
+					continue
+				}
+				if _, ok := operandExcludedUsers[i][key]; !ok {
+					continue excludedUsers
+				}
+			}
+			excludedUsersMap[key] = struct{}{}
 		}
 	}
+	excludedUsers := make([]*openfgav1.User, 0, len(excludedUsersMap))
+	orderedRange(req.deterministic, excludedUsersMap, func(key string, _ struct{}) {
+		excludedUsers = append(excludedUsers, tuple.StringToUserProto(key))
+	})
 
-	for key := range foundUsersMap {
-		fu := foundUser{
-			user:          tuple.StringToUserProto(key),
-			excludedUsers: excludedUsers,
-		}
-		trySendResult(ctx, fu, foundUsersChan)
+	if !l.streamUnions {
+		orderedRange(req.deterministic, foundUsersMap, func(key string, _ struct{}) {
+			fu := foundUser{
+				user:          tuple.StringToUserProto(key),
+				excludedUsers: excludedUsers,
+			}
+			trySendResult(ctx, fu, foundUsersChan)
+		})
 	}
 
 	return expandResponse{
@@ -713,47 +2445,128 @@ func (l *listUsersQuery) expandUnion(
 	}
 }
 
+// flattenUnion returns the leaf operands of a union, recursively inlining the operands of any
+// nested union. A rewrite such as `a or (b or (c or d))` is therefore expanded as `a or b or c or d`.
+//
+// Without flattening, every nested union would create its own pool (each bounded by the breadth limit),
+// so deeply nested unions would grow goroutines multiplicatively. Flattening dispatches all the leaves
+// on a single pool, which keeps the concurrency bounded by resolveNodeBreadthLimit and still honors
+// cancellation through the pool's context. The result is equivalent because union is associative, and
+// a user excluded under every operand of a nested union is excluded under every leaf of it.
+func flattenUnion(union *openfgav1.Usersets) []*openfgav1.Userset {
+	children := union.GetChild()
+	flattened := make([]*openfgav1.Userset, 0, len(children))
+	for _, child := range children {
+		if nested, ok := child.GetUserset().(*openfgav1.Userset_Union); ok {
+			flattened = append(flattened, flattenUnion(nested.Union)...)
+			continue
+		}
+		flattened = append(flattened, child)
+	}
+	return flattened
+}
+
 func (l *listUsersQuery) expandExclusion(
 	ctx context.Context,
 	req *internalListUsersRequest,
 	rewrite *openfgav1.Userset_Difference,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandExclusion")
+	ctx, span := startStepSpan(ctx, "expandExclusion")
 	defer span.End()
+	defer req.profile.track(RewriteKindExclusion)()
+
+	// a subtract that can't yield users of the filter types can't exclude any, so it isn't expanded
+	typesys, _ := typesystem.TypesystemFromContext(ctx)
+	subtractRewrite := rewrite.Difference.GetSubtract()
+	skipSubtract := !rewriteReachable(req, subtractRewrite, req.GetUserFilters(), func() bool {
+		return l.rewriteCanReachUserFilters(typesys, req, subtractRewrite)
+	})
+
+	if l.exclusionStrategy == ExclusionStrategyCheck && !skipSubtract {
+		if subtract := rewrite.Difference.GetSubtract().GetComputedUserset(); subtract != nil {
+			return l.expandExclusionWithCheck(ctx, req, rewrite, subtract.GetRelation(), foundUsersChan)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	baseFoundUsersCh := make(chan foundUser, 1)
 	subtractFoundUsersCh := make(chan foundUser, 1)
 
 	var baseError error
 	go func() {
-		resp := l.expandRewrite(ctx, req, rewrite.Difference.GetBase(), baseFoundUsersCh)
+		resp := recoverExpansion(func() expandResponse {
+			return l.expandRewrite(ctx, req, rewrite.Difference.GetBase(), baseFoundUsersCh)
+		})
 		baseError = resp.err
 		close(baseFoundUsersCh)
 	}()
 
 	var subtractError error
 	var subtractHasCycle bool
-	go func() {
-		resp := l.expandRewrite(ctx, req, rewrite.Difference.GetSubtract(), subtractFoundUsersCh)
-		subtractError = resp.err
-		subtractHasCycle = resp.hasCycle
+	if skipSubtract {
+		span.SetAttributes(attribute.Bool("subtract_skipped", true))
 		close(subtractFoundUsersCh)
-	}()
-
-	baseFoundUsersMap := make(map[string]foundUser, 0)
-	for fu := range baseFoundUsersCh {
-		key := tuple.UserProtoToString(fu.user)
-		baseFoundUsersMap[key] = fu
+	} else {
+		go func() {
+			resp := recoverExpansion(func() expandResponse {
+				return l.expandRewrite(ctx, req, rewrite.Difference.GetSubtract(), subtractFoundUsersCh)
+			})
+			subtractError = resp.err
+			subtractHasCycle = resp.hasCycle
+			close(subtractFoundUsersCh)
+		}()
 	}
 
-	subtractFoundUsersMap := make(map[string]foundUser, len(baseFoundUsersMap))
+	// the base users found while the subtract is still being expanded are queued
+	var pendingBaseUsers []foundUser
+	subtractFoundUsersMap := make(map[string]foundUser, 0)
+	subtractSetSizeExceeded := false
+	baseCh, subtractCh := baseFoundUsersCh, subtractFoundUsersCh
+	for subtractCh != nil {
+		select {
+		case fu, ok := <-subtractCh:
+			if !ok {
+				subtractCh = nil
+				continue
+			}
+			if subtractSetSizeExceeded {
+				continue
+			}
+			key := req.interner.userKey(fu.user)
+			subtractFoundUsersMap[key] = fu
+			if l.maxSubtractSetSize != 0 && len(subtractFoundUsersMap) > int(l.maxSubtractSetSize) {
+				// both expansions are cancelled, and drained until they complete
+				subtractSetSizeExceeded = true
+				subtractFoundUsersMap, pendingBaseUsers = nil, nil
+				cancel()
+			}
+		case fu, ok := <-baseCh:
+			if !ok {
+				baseCh = nil
+				continue
+			}
+			if !subtractSetSizeExceeded {
+				pendingBaseUsers = append(pendingBaseUsers, fu)
+			}
+		}
+	}
 
-	for fu := range subtractFoundUsersCh {
-		key := tuple.UserProtoToString(fu.user)
-		subtractFoundUsersMap[key] = fu
+	if subtractSetSizeExceeded {
+		for range baseFoundUsersCh {
+		}
+		telemetry.TraceError(span, ErrMaxSubtractSetSizeExceeded)
+		return expandResponse{
+			err: ErrMaxSubtractSetSizeExceeded,
+		}
 	}
 
 	if subtractHasCycle {
+		// the base expansion must still be drained so that it can complete
+		for range baseFoundUsersCh {
+		}
+
 		// Because exclusion contains the only bespoke treatment of
 		// cycle, everywhere else we consider it a falsey outcome.
 		// Once we make a determination within the exclusion handler, we're
@@ -764,82 +2577,185 @@ func (l *listUsersQuery) expandExclusion(
 		}
 	}
 
-	wildcardKey := tuple.TypedPublicWildcard(req.GetUserFilters()[0].GetType())
+	verifyResults := func() error { return nil }
+	if !skipSubtract && l.verifiesExclusion(req, rewrite.Difference.GetSubtract()) {
+		span.SetAttributes(attribute.Bool("verified", true))
+		subtractRelation := rewrite.Difference.GetSubtract().GetComputedUserset().GetRelation()
+		foundUsersChan, verifyResults = l.verifyExclusionResults(ctx, req, subtractRelation, foundUsersChan)
+	}
 
-	_, baseWildcardExists := baseFoundUsersMap[wildcardKey]
-	_, subtractWildcardExists := subtractFoundUsersMap[wildcardKey]
+	defer req.memory.hold(len(subtractFoundUsersMap) + len(pendingBaseUsers))()
+	if skipSubtract || (l.streamingExclusionThreshold != 0 && len(subtractFoundUsersMap) <= int(l.streamingExclusionThreshold)) {
+		span.SetAttributes(attribute.Bool("streaming", true))
+		streamExclusionBase(ctx, req, pendingBaseUsers, baseFoundUsersCh, subtractFoundUsersMap, foundUsersChan)
+	} else {
+		baseFoundUsersMap := make(map[string]foundUser, len(pendingBaseUsers))
+		for _, fu := range pendingBaseUsers {
+			key := req.interner.userKey(fu.user)
+			baseFoundUsersMap[key] = fu
+		}
+		for fu := range baseFoundUsersCh {
+			key := req.interner.userKey(fu.user)
+			baseFoundUsersMap[key] = fu
+		}
+		defer req.memory.hold(len(baseFoundUsersMap))()
 
-	for userKey, fu := range baseFoundUsersMap {
-		subtractedUser, userIsSubtracted := subtractFoundUsersMap[userKey]
-		_, wildcardSubtracted := subtractFoundUsersMap[wildcardKey]
+		orderedRange(req.deterministic, baseFoundUsersMap, func(userKey string, fu foundUser) {
+			_, baseWildcardExists := baseFoundUsersMap[typedWildcardKey(userKey)]
+			sendExclusionResults(ctx, req, userKey, fu, baseWildcardExists, subtractFoundUsersMap, foundUsersChan)
+		})
+	}
 
-		switch {
-		case baseWildcardExists:
-			if !userIsSubtracted && !wildcardSubtracted {
-				trySendResult(ctx, foundUser{
-					user: tuple.StringToUserProto(userKey),
-				}, foundUsersChan)
-			}
+	errs := errors.Join(baseError, subtractError, verifyResults())
+	if errs != nil {
+		telemetry.TraceError(span, errs)
+	}
+	return expandResponse{
+		err: errs,
+	}
+}
 
-			for subtractedUserKey, subtractedFu := range subtractFoundUsersMap {
-				if tuple.IsTypedWildcard(subtractedUserKey) {
-					if !userIsSubtracted {
-						trySendResult(ctx, foundUser{
-							user:               tuple.StringToUserProto(userKey),
-							relationshipStatus: NoRelationship,
-						}, foundUsersChan)
-					}
-					continue
-				}
+// streamExclusionBase sends the results for the users found under the base of an exclusion as
+// they are received, once the subtract is fully expanded. The results for a user only depend on
+// whether the base also contains the wildcard of its type when the user is neither subtracted nor
+// has the relation, so only those users are held back until the base is fully expanded. When the
+// wildcard of a type is received, the results for the users of that type received before it are
+// sent again as if it had been there all along.
+func streamExclusionBase(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	pendingBaseUsers []foundUser,
+	baseFoundUsersCh <-chan foundUser,
+	subtractFoundUsersMap map[string]foundUser,
+	foundUsersChan chan<- foundUser,
+) {
+	baseFoundUsersMap := make(map[string]foundUser, len(pendingBaseUsers))
+	heldBackUsers := make(map[string]struct{})
+
+	receive := func(fu foundUser) {
+		userKey := req.interner.userKey(fu.user)
+		_, seen := baseFoundUsersMap[userKey]
+		baseFoundUsersMap[userKey] = fu
+		if seen {
+			return
+		}
 
-				if subtractedFu.relationshipStatus == NoRelationship {
-					trySendResult(ctx, foundUser{
-						user:               tuple.StringToUserProto(subtractedUserKey),
-						relationshipStatus: HasRelationship,
-					}, foundUsersChan)
+		wildcardKey := typedWildcardKey(userKey)
+		if userKey == wildcardKey {
+			orderedRange(req.deterministic, baseFoundUsersMap, func(otherUserKey string, otherFu foundUser) {
+				if typedWildcardKey(otherUserKey) == wildcardKey {
+					sendExclusionResults(ctx, req, otherUserKey, otherFu, true, subtractFoundUsersMap, foundUsersChan)
+					delete(heldBackUsers, otherUserKey)
 				}
+			})
+			return
+		}
+
+		if _, baseWildcardExists := baseFoundUsersMap[wildcardKey]; baseWildcardExists {
+			sendExclusionResults(ctx, req, userKey, fu, true, subtractFoundUsersMap, foundUsersChan)
+			return
+		}
+
+		_, userIsSubtracted := subtractFoundUsersMap[userKey]
+		_, wildcardSubtracted := subtractFoundUsersMap[wildcardKey]
+		if wildcardKey != "" && !userIsSubtracted && !wildcardSubtracted && fu.relationshipStatus == NoRelationship {
+			heldBackUsers[userKey] = struct{}{}
+			return
+		}
+		sendExclusionResults(ctx, req, userKey, fu, false, subtractFoundUsersMap, foundUsersChan)
+	}
+
+	for _, fu := range pendingBaseUsers {
+		receive(fu)
+	}
+	for fu := range baseFoundUsersCh {
+		receive(fu)
+	}
+
+	orderedRange(req.deterministic, heldBackUsers, func(userKey string, _ struct{}) {
+		sendExclusionResults(ctx, req, userKey, baseFoundUsersMap[userKey], false, subtractFoundUsersMap, foundUsersChan)
+	})
+}
+
+// sendExclusionResults sends the results for a user found under the base of an exclusion, given
+// whether the base also contains the wildcard of its type. Wildcards are evaluated per user type,
+// since with multiple user filters the base and the subtract may contain the wildcards of several
+// types. A wildcard of one type never affects users of another type.
+func sendExclusionResults(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	userKey string,
+	fu foundUser,
+	baseWildcardExists bool,
+	subtractFoundUsersMap map[string]foundUser,
+	foundUsersChan chan<- foundUser,
+) {
+	subtractedUser, userIsSubtracted := subtractFoundUsersMap[userKey]
+	wildcardKey := typedWildcardKey(userKey)
+	_, wildcardSubtracted := subtractFoundUsersMap[wildcardKey]
+
+	switch {
+	case baseWildcardExists:
+		if !userIsSubtracted && !wildcardSubtracted {
+			trySendResult(ctx, foundUser{
+				user: tuple.StringToUserProto(userKey),
+			}, foundUsersChan)
+		}
+
+		orderedRange(req.deterministic, subtractFoundUsersMap, func(subtractedUserKey string, subtractedFu foundUser) {
+			if typedWildcardKey(subtractedUserKey) != wildcardKey {
+				return
+			}
 
-				// a found user under the subtracted branch causes the subtracted user to have a negated relationship with respect
-				// to the base relation and is excluded since a wildcard is contained under the base branch.
-				if subtractedFu.relationshipStatus == HasRelationship {
+			if tuple.IsTypedWildcard(subtractedUserKey) {
+				if !userIsSubtracted {
 					trySendResult(ctx, foundUser{
-						user:               tuple.StringToUserProto(subtractedUserKey),
+						user:               tuple.StringToUserProto(userKey),
 						relationshipStatus: NoRelationship,
-						excludedUsers: []*openfgav1.User{
-							tuple.StringToUserProto(subtractedUserKey),
-						},
 					}, foundUsersChan)
 				}
+				return
 			}
-		case subtractWildcardExists, userIsSubtracted:
-			if subtractedUser.relationshipStatus == HasRelationship {
+
+			if subtractedFu.relationshipStatus == NoRelationship {
 				trySendResult(ctx, foundUser{
-					user:               tuple.StringToUserProto(userKey),
-					relationshipStatus: NoRelationship,
+					user:               tuple.StringToUserProto(subtractedUserKey),
+					relationshipStatus: HasRelationship,
 				}, foundUsersChan)
 			}
 
-			if subtractedUser.relationshipStatus == NoRelationship {
+			// a found user under the subtracted branch causes the subtracted user to have a negated relationship with respect
+			// to the base relation and is excluded since a wildcard is contained under the base branch.
+			if subtractedFu.relationshipStatus == HasRelationship {
 				trySendResult(ctx, foundUser{
-					user:               tuple.StringToUserProto(userKey),
-					relationshipStatus: HasRelationship,
+					user:               tuple.StringToUserProto(subtractedUserKey),
+					relationshipStatus: NoRelationship,
+					excludedUsers: []*openfgav1.User{
+						tuple.StringToUserProto(subtractedUserKey),
+					},
 				}, foundUsersChan)
 			}
+		})
+	case wildcardSubtracted, userIsSubtracted:
+		if subtractedUser.relationshipStatus == HasRelationship {
+			trySendResult(ctx, foundUser{
+				user:               tuple.StringToUserProto(userKey),
+				relationshipStatus: NoRelationship,
+			}, foundUsersChan)
+		}
 
-		default:
+		if subtractedUser.relationshipStatus == NoRelationship {
 			trySendResult(ctx, foundUser{
 				user:               tuple.StringToUserProto(userKey),
-				relationshipStatus: fu.relationshipStatus,
+				relationshipStatus: HasRelationship,
 			}, foundUsersChan)
 		}
-	}
 
-	errs := errors.Join(baseError, subtractError)
-	if errs != nil {
-		telemetry.TraceError(span, errs)
-	}
-	return expandResponse{
-		err: errs,
+	default:
+		trySendResult(ctx, foundUser{
+			user:               tuple.StringToUserProto(userKey),
+			relationshipStatus: fu.relationshipStatus,
+		}, foundUsersChan)
 	}
 }
 
@@ -849,22 +2765,27 @@ func (l *listUsersQuery) expandTTU(
 	rewrite *openfgav1.Userset_TupleToUserset,
 	foundUsersChan chan<- foundUser,
 ) expandResponse {
-	ctx, span := tracer.Start(ctx, "expandTTU")
+	ctx, span := startStepSpan(ctx, "expandTTU")
 	defer span.End()
+	defer req.profile.track(RewriteKindTupleToUserset)()
 	tuplesetRelation := rewrite.TupleToUserset.GetTupleset().GetRelation()
 	computedRelation := rewrite.TupleToUserset.GetComputedUserset().GetRelation()
 
 	typesys, _ := typesystem.TypesystemFromContext(ctx)
 
+	if !l.traversesRelation(typesys, req.GetObject().GetType(), tuplesetRelation) {
+		return expandResponse{}
+	}
+
 	opts := storage.ReadOptions{
 		Consistency: storage.ConsistencyOptions{
 			Preference: req.GetConsistency(),
 		},
 	}
-	iter, err := l.ds.Read(ctx, req.GetStoreId(), &openfgav1.TupleKey{
+	iter, err := l.read(ctx, req, &openfgav1.TupleKey{
 		Object:   tuple.ObjectKey(req.GetObject()),
 		Relation: tuplesetRelation,
-	}, opts)
+	}, opts, false)
 	if err != nil {
 		telemetry.TraceError(span, err)
 		return expandResponse{
@@ -873,15 +2794,32 @@ func (l *listUsersQuery) expandTTU(
 	}
 	defer iter.Stop()
 	req.datastoreQueryCount.Add(1)
+	req.profile.addDatastoreQuery(RewriteKindTupleToUserset)
 
+	// the tupleset tuples of types that the model no longer defines are invalid, so they are
+	// skipped rather than expanded on an undefined type
+	isValidTuple := validation.FilterInvalidTuples(typesys)
 	filteredIter := storage.NewFilteredTupleKeyIterator(
 		storage.NewTupleKeyIteratorFromTupleIterator(iter),
-		validation.FilterInvalidTuples(typesys),
+		l.withAdditionalTupleFilters(func(tupleKey *openfgav1.TupleKey) bool {
+			if _, _, _, ok := parseTupleUser(tupleKey.GetUser()); !ok {
+				invalidTupleUsersSkippedCounter.Inc()
+				return false
+			}
+			if !isValidTuple(tupleKey) {
+				invalidTuplesetTuplesSkippedCounter.Inc()
+				return false
+			}
+			return true
+		}),
 	)
 	defer filteredIter.Stop()
 
 	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
 
+	membersCap, isCapped := l.relationRecursionCap(req.GetObject().GetType(), tuplesetRelation)
+	var followedMembers uint32
+
 	var errs error
 
 LoopOnIterator:
@@ -895,6 +2833,11 @@ LoopOnIterator:
 			break LoopOnIterator
 		}
 
+		if err := l.spendBudget(req, 1); err != nil {
+			errs = errors.Join(errs, err)
+			break LoopOnIterator
+		}
+
 		condEvalResult, err := eval.EvaluateTupleCondition(ctx, tupleKey, typesys, req.GetContext())
 		if err != nil {
 			errs = errors.Join(errs, err)
@@ -914,16 +2857,48 @@ LoopOnIterator:
 			continue
 		}
 
-		userObject := tupleKey.GetUser()
-		userObjectType, userObjectID := tuple.SplitObject(userObject)
+		// a tupleset user must be an object, since the computed relation is expanded on it
+		userObjectType, userObjectID, userRelation, ok := parseTupleUser(tupleKey.GetUser())
+		if !ok || userRelation != "" {
+			invalidTupleUsersSkippedCounter.Inc()
+			continue
+		}
+
+		// Like Check, skip the tupleset objects whose type doesn't define the computed relation,
+		// since a tupleset relation may relate types where only some of them define it.
+		if _, err := typesys.GetRelation(userObjectType, computedRelation); err != nil {
+			var relationUndefinedError *typesystem.RelationUndefinedError
+			if errors.As(err, &relationUndefinedError) {
+				continue
+			}
+			errs = errors.Join(errs, &ModelError{ObjectType: userObjectType, Relation: computedRelation, Err: err})
+			break LoopOnIterator
+		}
+
+		if !l.traversesRelation(typesys, userObjectType, computedRelation) {
+			continue
+		}
+
+		if isCapped && followedMembers >= membersCap {
+			span.SetAttributes(attribute.Bool("relation_recursion_capped", true))
+			req.cappedRelations.add(req.GetObject().GetType(), tuplesetRelation)
+			break LoopOnIterator
+		}
+		followedMembers++
 
-		pool.Go(func(ctx context.Context) error {
+		pathConditions := withCondition(req.pathConditions, tupleKey.GetCondition())
+		pool.Go(l.expansionTask(req, "tuple_to_userset", func(ctx context.Context) error {
 			rewrittenReq := req.clone()
 			rewrittenReq.Object = &openfgav1.Object{Type: userObjectType, Id: userObjectID}
 			rewrittenReq.Relation = computedRelation
+			rewrittenReq.pathConditions = pathConditions
+			if req.grantingUsersets != nil {
+				rewrittenReq.grantingUserset = tuple.ToObjectRelationString(tuple.BuildObject(userObjectType, userObjectID), computedRelation)
+			}
+			rewrittenReq.hops++
 			resp := l.dispatch(ctx, rewrittenReq, foundUsersChan)
 			return resp.err
-		})
+		}))
 	}
 
 	errs = errors.Join(pool.Wait(), errs)
@@ -935,6 +2910,56 @@ LoopOnIterator:
 	}
 }
 
+// parseTupleUser splits the user of a tuple read while expanding a request into its object type,
+// object id and relation. It reports false for users that don't parse cleanly, such as a missing
+// type or id or extra separators, which must be skipped rather than expanded.
+func parseTupleUser(user string) (objectType, objectID, relation string, ok bool) {
+	if !tuple.IsValidUser(user) {
+		return "", "", "", false
+	}
+
+	object, relation := tuple.SplitObjectRelation(user)
+	objectType, objectID = tuple.SplitObject(object)
+	if objectType == "" || objectID == "" {
+		return "", "", "", false
+	}
+	return objectType, objectID, relation, true
+}
+
+// typedWildcardKey returns the typed public wildcard that covers the given user, or an
+// empty string for usersets since they are never covered by a wildcard.
+// wildcardCoveredUsers returns the concrete users among users that a public wildcard of their type
+// among users also covers.
+func wildcardCoveredUsers(users []*openfgav1.User) []*openfgav1.User {
+	wildcards := make(map[string]struct{})
+	for _, user := range users {
+		if wildcard := user.GetWildcard(); wildcard != nil {
+			wildcards[tuple.TypedPublicWildcard(wildcard.GetType())] = struct{}{}
+		}
+	}
+	if len(wildcards) == 0 {
+		return nil
+	}
+
+	var covered []*openfgav1.User
+	for _, user := range users {
+		if user.GetObject() == nil {
+			continue
+		}
+		if _, ok := wildcards[tuple.TypedPublicWildcard(user.GetObject().GetType())]; ok {
+			covered = append(covered, user)
+		}
+	}
+	return covered
+}
+
+func typedWildcardKey(userKey string) string {
+	if tuple.IsObjectRelation(userKey) {
+		return ""
+	}
+	return tuple.TypedPublicWildcard(tuple.GetType(userKey))
+}
+
 func enteredCycle(req *internalListUsersRequest) bool {
 	key := fmt.Sprintf("%s#%s", tuple.ObjectKey(req.GetObject()), req.Relation)
 	if _, loaded := req.visitedUsersetsMap[key]; loaded {
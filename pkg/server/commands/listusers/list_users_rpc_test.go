@@ -3,6 +3,12 @@ package listusers
 import (
 	"context"
 	"fmt"
+	"math"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -10,17 +16,25 @@ import (
 	"github.com/oklog/ulid/v2"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	parser "github.com/openfga/language/pkg/go/transformer"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/openfga/openfga/pkg/dispatch"
 	"github.com/openfga/openfga/pkg/storage"
 
 	"github.com/openfga/openfga/internal/graph"
 	"github.com/openfga/openfga/internal/mocks"
+	"github.com/openfga/openfga/internal/throttler"
 	"github.com/openfga/openfga/internal/throttler/threshold"
 
+	"github.com/openfga/openfga/pkg/logger"
 	"github.com/openfga/openfga/pkg/storage/memory"
 	"github.com/openfga/openfga/pkg/storage/storagewrappers"
 	storagetest "github.com/openfga/openfga/pkg/storage/test"
@@ -240,48 +254,45 @@ func TestListUsersComputedRelationship(t *testing.T) {
 			tuples:        []*openfgav1.TupleKey{},
 			expectedUsers: []string{"user:will", "user:maria"},
 		},
-	}
-	tests.runListUsersTestCases(t)
-}
-
-func TestListUsersUsersets(t *testing.T) {
-	t.Cleanup(func() {
-		goleak.VerifyNone(t)
-	})
-	model := `
-		model
-			schema 1.1
-		type user
-		type group
-			relations
-				define member: [user]
-		type document
-			relations
-				define viewer: [group#member]`
-
-	tests := ListUsersTests{
 		{
-			name: "userset_user_granularity",
+			name: "computed_relationship_chain_spanning_types_through_ttu",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "can_view",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
 			},
-			model: model,
+			model: `
+				model
+					schema 1.1
+				type user
+				type org
+					relations
+						define member: [user]
+						define admin: member
+				type folder
+					relations
+						define parent: [org]
+						define viewer: admin from parent
+						define can_view: viewer
+				type document
+					relations
+						define parent: [folder]
+						define reader: can_view from parent
+						define can_view: reader`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("group:marketing", "viewer", "user:jon"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "parent", "org:acme"),
+				tuple.NewTupleKey("org:acme", "member", "user:will"),
+				tuple.NewTupleKey("org:other", "member", "user:jon"),
 			},
-			expectedUsers: []string{"user:will", "user:maria"},
+			expectedUsers: []string{"user:will"},
 		},
 		{
-			name: "userset_group_granularity",
+			name: "computed_relationship_resolved_against_current_object_type_not_filter_type",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -292,45 +303,64 @@ func TestListUsersUsersets(t *testing.T) {
 					},
 				},
 			},
-			model: model,
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define editor: [user, group#member]
+						define member: [user, group#member] or editor
+				type document
+					relations
+						define editor: [group#member]
+						define viewer: editor`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("group:marketing", "viewer", "user:jon"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "editor", "group:eng#member"),
+				tuple.NewTupleKey("group:eng", "editor", "group:other#member"),
+				tuple.NewTupleKey("group:eng", "member", "group:fga#member"),
 			},
-			expectedUsers: []string{"group:eng#member"},
+			expectedUsers: []string{"group:eng#member", "group:fga#member", "group:other#member"},
 		},
 		{
-			name: "userset_group_granularity_with_incorrect_user_filter",
+			name: "computed_relationship_on_ttu_target_type",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "group",
-						Relation: "", // Would return results if "member"
+						Type: "user",
 					},
 				},
 			},
-			model: model,
+			model: `
+				model
+					schema 1.1
+				type user
+				type folder
+					relations
+						define owner: [user]
+						define viewer: owner
+				type document
+					relations
+						define owner: [user]
+						define parent: [folder]
+						define viewer: viewer from parent`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("group:marketing", "member", "user:jon"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "owner", "user:jon"),
+				tuple.NewTupleKey("folder:x", "owner", "user:will"),
 			},
-			expectedUsers: []string{},
+			expectedUsers: []string{"user:will"},
 		},
 		{
-			name: "userset_group_granularity_with_direct_user_relationships",
+			name: "computed_relationship_only_on_some_ttu_target_types",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "group",
-						Relation: "member",
+						Type: "user",
 					},
 				},
 			},
@@ -338,27 +368,37 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
-				type group
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
 					relations
 						define member: [user]
 				type document
 					relations
-						define viewer: [ user, group#member ]`,
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("group:marketing", "member", "user:jon"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
-
-				tuple.NewTupleKey("document:1", "viewer", "user:poovam"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"group:eng#member"},
+			expectedUsers: []string{"user:jon", "user:maria"},
 		},
 		{
-			name: "userset_multiple_usersets",
+			name: "computed_relationship_only_on_other_ttu_target_types",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "member",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
@@ -369,31 +409,40 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
-				type group
+				type folder
 					relations
-						define member: [user, group#member]
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
 				type document
 					relations
-						define viewer: [group#member]`,
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:hawker"),
-				tuple.NewTupleKey("group:fga", "member", "user:jon"),
-				tuple.NewTupleKey("group:eng", "member", "group:fga#member"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
-				tuple.NewTupleKey("document:1", "viewer", "group:other#member"),
-				tuple.NewTupleKey("group:other", "member", "user:will"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"user:jon", "user:hawker", "user:will"},
+			expectedUsers: []string{"user:maria", "user:will"},
 		},
 		{
-			name: "userset_multiple_usersets_group_granularity",
+			name: "computed_relationship_undefined_on_all_reached_types",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Object:   &openfgav1.Object{Type: "document", Id: "2"},
+				Relation: "member",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "group",
-						Relation: "member",
+						Type: "user",
 					},
 				},
 			},
@@ -401,72 +450,122 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
-				type group
+				type folder
 					relations
-						define member: [user, group#member]
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
 				type document
 					relations
-						define viewer: [group#member]`,
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:hawker"),
-				tuple.NewTupleKey("group:eng", "member", "group:fga#member"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
-				tuple.NewTupleKey("document:1", "viewer", "group:other#member"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"group:fga#member", "group:eng#member", "group:other#member"},
+			expectedUsers: []string{},
 		},
 		{
-			name: "userset_user_granularity_with_contextual_tuples",
+			name: "union_of_computed_relationships_on_different_ttu_target_types",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "can_view",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				ContextualTuples: []*openfgav1.TupleKey{
-					tuple.NewTupleKey("group:marketing", "member", "user:jon"),
-					tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
-				},
 			},
-			model: model,
+			model: `
+				model
+					schema 1.1
+				type user
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
+				type document
+					relations
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"user:will", "user:maria"},
+			expectedUsers: []string{"user:jon", "user:maria", "user:will"},
 		},
 		{
-			name: "userset_user_assigned_multiple_groups",
+			name: "intersection_of_computed_relationships_on_different_ttu_target_types",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "can_edit",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				ContextualTuples: []*openfgav1.TupleKey{},
 			},
-			model: model,
+			model: `
+				model
+					schema 1.1
+				type user
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
+				type document
+					relations
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("group:eng", "member", "user:will"),
-				tuple.NewTupleKey("group:fga", "member", "user:will"),
-				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
-				tuple.NewTupleKey("document:1", "viewer", "group:fga#member"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"user:will", "user:maria"},
+			expectedUsers: []string{"user:maria"},
 		},
 		{
-			name: "tuple_defines_itself",
+			name: "intersection_with_computed_relationship_undefined_on_reached_types",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Object:   &openfgav1.Object{Type: "document", Id: "2"},
+				Relation: "can_edit",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "document",
+						Type: "user",
 					},
 				},
 			},
@@ -474,22 +573,40 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
 				type document
 					relations
-						define viewer: [user]
-			`,
-			tuples:        []*openfgav1.TupleKey{},
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
+			},
 			expectedUsers: []string{},
 		},
 		{
-			name: "userset_defines_itself",
+			name: "exclusion_of_computed_relationships_on_different_ttu_target_types",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "restricted",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "document",
-						Relation: "viewer",
+						Type: "user",
 					},
 				},
 			},
@@ -497,22 +614,40 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
+					relations
+						define member: [user]
 				type document
 					relations
-						define viewer: [user]
-			`,
-			tuples:        []*openfgav1.TupleKey{},
-			expectedUsers: []string{"document:1#viewer"},
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
+			},
+			expectedUsers: []string{"user:jon"},
 		},
 		{
-			name: "evaluate_userset_in_computed_relation_of_ttu",
+			name: "exclusion_with_computed_relationship_undefined_on_reached_types",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "repo", Id: "fga"},
-				Relation: "reader",
+				Object:   &openfgav1.Object{Type: "document", Id: "2"},
+				Relation: "restricted",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "org",
-						Relation: "member",
+						Type: "user",
 					},
 				},
 			},
@@ -520,61 +655,37 @@ func TestListUsersUsersets(t *testing.T) {
 				model
 					schema 1.1
 				type user
-
-				type org
+				type folder
+					relations
+						define editor: [user]
+						define viewer: editor
+				type team
 					relations
 						define member: [user]
-						define admin: [org#member]
-
-				type repo
+				type document
 					relations
-						define owner: [org]
-						define reader: admin from owner`,
+						define parent: [folder, team]
+						define viewer: viewer from parent
+						define member: member from parent
+						define can_view: viewer or member
+						define can_edit: viewer and member
+						define restricted: viewer but not member`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("repo:fga", "owner", "org:x"),
-				tuple.NewTupleKey("org:x", "admin", "org:x#member"),
-				tuple.NewTupleKey("org:x", "member", "user:will"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("document:1", "parent", "team:a"),
+				tuple.NewTupleKey("document:2", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "editor", "user:jon"),
+				tuple.NewTupleKey("folder:x", "editor", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:maria"),
+				tuple.NewTupleKey("team:a", "member", "user:will"),
 			},
-			expectedUsers: []string{"org:x#member"},
-		},
-		{
-			name: "userset_with_intersection_in_computed_relation_of_ttu",
-			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "repo", Id: "fga"},
-				Relation: "reader",
-				UserFilters: []*openfgav1.UserTypeFilter{
-					{
-						Type:     "org",
-						Relation: "member",
-					},
-				},
-			},
-			model: `
-				model
-					schema 1.1
-				type user
-
-				type org
-					relations
-						define member: [user]
-						define admin: [org#member]
-				type repo
-					relations
-						define owner: [org]
-						define allowed: [user]
-						define reader: admin from owner and allowed`,
-			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("repo:x", "owner", "org:fga"),
-				tuple.NewTupleKey("org:fga", "admin", "org:fga#member"),
-				tuple.NewTupleKey("repo:x", "allowed", "user:will"),
-			},
-			expectedUsers: []string{},
+			expectedUsers: []string{"user:jon", "user:maria"},
 		},
 	}
 	tests.runListUsersTestCases(t)
 }
 
-func TestListUsersTTU(t *testing.T) {
+func TestListUsersUsersets(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
 	})
@@ -582,19 +693,16 @@ func TestListUsersTTU(t *testing.T) {
 		model
 			schema 1.1
 		type user
-
-		type folder
+		type group
 			relations
-				define viewer: [user]
-
+				define member: [user]
 		type document
 			relations
-				define parent: [folder]
-				define viewer: viewer from parent`
+				define viewer: [group#member]`
 
 	tests := ListUsersTests{
 		{
-			name: "ttu_user_granularity",
+			name: "userset_user_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -606,39 +714,64 @@ func TestListUsersTTU(t *testing.T) {
 			},
 			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "parent", "folder:x"),
-				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
-				tuple.NewTupleKey("folder:no-doc", "viewer", "user:maria"),
-				tuple.NewTupleKey("document:1", "parent", "folder:no-user"),
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("group:marketing", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
 			},
-			expectedUsers: []string{"user:maria"},
+			expectedUsers: []string{"user:will", "user:maria"},
 		},
 		{
-			name: "ttu_folder_granularity",
+			name: "userset_group_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "folder",
+						Type:     "group",
+						Relation: "member",
 					},
 				},
 			},
 			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "parent", "folder:x"),
-				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("group:marketing", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+			},
+			expectedUsers: []string{"group:eng#member"},
+		},
+		{
+			name: "userset_group_granularity_with_incorrect_user_filter",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type:     "group",
+						Relation: "", // Would return results if "member"
+					},
+				},
+			},
+			model: model,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("group:marketing", "member", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
 			},
 			expectedUsers: []string{},
 		},
 		{
-			name: "ttu_with_computed_relation_user_granularity",
+			name: "userset_group_granularity_with_direct_user_relationships",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "user",
+						Type:     "group",
+						Relation: "member",
 					},
 				},
 			},
@@ -646,35 +779,26 @@ func TestListUsersTTU(t *testing.T) {
 				model
 					schema 1.1
 				type user
-
-				type folder
+				type group
 					relations
-						define owner: [user]
-						define editor: [user] or owner
-						define viewer: [user] or owner or editor
-						define unrelated_not_computed: [user]
-
+						define member: [user]
 				type document
 					relations
-						define parent: [folder]
-						define viewer: viewer from parent`,
-
+						define viewer: [ user, group#member ]`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "parent", "folder:x"),
-				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
-				tuple.NewTupleKey("folder:x", "editor", "user:will"),
-				tuple.NewTupleKey("folder:x", "owner", "user:jon"),
-				tuple.NewTupleKey("folder:x", "unrelated_not_computed", "user:poovam"),
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("group:marketing", "member", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
 
-				tuple.NewTupleKey("folder:no-doc", "viewer", "user:maria"),
-				tuple.NewTupleKey("document:1", "parent", "folder:no-user"),
+				tuple.NewTupleKey("document:1", "viewer", "user:poovam"),
 			},
-			expectedUsers: []string{"user:maria", "user:will", "user:jon"},
+			expectedUsers: []string{"group:eng#member"},
 		},
 		{
-			name: "ttu_multiple_levels",
+			name: "userset_multiple_usersets",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "folder", Id: "c"},
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
@@ -686,38 +810,31 @@ func TestListUsersTTU(t *testing.T) {
 				model
 					schema 1.1
 				type user
-				type folder
+				type group
 					relations
-						define parent: [folder]
-						define viewer: [user] or viewer from parent`,
+						define member: [user, group#member]
+				type document
+					relations
+						define viewer: [group#member]`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("folder:a", "viewer", "user:will"),
-				tuple.NewTupleKey("folder:b", "parent", "folder:a"),
-				tuple.NewTupleKey("folder:c", "parent", "folder:b"),
-
-				tuple.NewTupleKey("folder:c", "parent", "folder:other"),
-				tuple.NewTupleKey("folder:other", "viewer", "user:jon"),
+				tuple.NewTupleKey("group:eng", "member", "user:hawker"),
+				tuple.NewTupleKey("group:fga", "member", "user:jon"),
+				tuple.NewTupleKey("group:eng", "member", "group:fga#member"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "viewer", "group:other#member"),
+				tuple.NewTupleKey("group:other", "member", "user:will"),
 			},
-			expectedUsers: []string{"user:will", "user:jon"},
+			expectedUsers: []string{"user:jon", "user:hawker", "user:will"},
 		},
-	}
-
-	tests.runListUsersTestCases(t)
-}
-
-func TestListUsersCycles(t *testing.T) {
-	t.Cleanup(func() {
-		goleak.VerifyNone(t)
-	})
-	tests := ListUsersTests{
 		{
-			name: "cycle_materialized_by_tuples",
+			name: "userset_multiple_usersets_group_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "user",
+						Type:     "group",
+						Relation: "member",
 					},
 				},
 			},
@@ -725,50 +842,74 @@ func TestListUsersCycles(t *testing.T) {
 				model
 					schema 1.1
 				type user
+				type group
+					relations
+						define member: [user, group#member]
 				type document
 					relations
-						define viewer: [user, document#viewer]`,
+						define viewer: [group#member]`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "document:1#viewer"),
+				tuple.NewTupleKey("group:eng", "member", "user:hawker"),
+				tuple.NewTupleKey("group:eng", "member", "group:fga#member"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "viewer", "group:other#member"),
 			},
-			expectedUsers: []string{},
+			expectedUsers: []string{"group:fga#member", "group:eng#member", "group:other#member"},
 		},
 		{
-			name: "cycle_and_union",
+			name: "userset_user_granularity_with_contextual_tuples",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "can_view",
+				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
+				ContextualTuples: []*openfgav1.TupleKey{
+					tuple.NewTupleKey("group:marketing", "member", "user:jon"),
+					tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				},
 			},
-			model: `
-				model
-					schema 1.1
-				type user
-				type document
-					relations
-						define viewer1: [user, document#viewer1]
-						define viewer2: [user, document#viewer2]
-						define can_view: viewer1 or viewer2`,
+			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer1", "document:1#viewer1"),
-				tuple.NewTupleKey("document:1", "viewer2", "document:1#viewer2"),
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
 			},
-			expectedUsers: []string{},
+			expectedUsers: []string{"user:will", "user:maria"},
 		},
 		{
-			name: "cycle_and_intersection",
+			name: "userset_user_assigned_multiple_groups",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "can_view",
+				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
+				ContextualTuples: []*openfgav1.TupleKey{},
+			},
+			model: model,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("group:eng", "member", "user:will"),
+				tuple.NewTupleKey("group:fga", "member", "user:will"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+				tuple.NewTupleKey("document:1", "viewer", "group:fga#member"),
+			},
+			expectedUsers: []string{"user:will", "user:maria"},
+		},
+		{
+			name: "tuple_defines_itself",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "document",
+					},
+				},
 			},
 			model: `
 				model
@@ -776,52 +917,105 @@ func TestListUsersCycles(t *testing.T) {
 				type user
 				type document
 					relations
-						define viewer1: [user, document#viewer1]
-						define viewer2: [user, document#viewer2]
-						define can_view: viewer1 and viewer2`,
-			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer1", "document:1#viewer1"),
-				tuple.NewTupleKey("document:1", "viewer2", "document:1#viewer2"),
-			},
+						define viewer: [user]
+			`,
+			tuples:        []*openfgav1.TupleKey{},
 			expectedUsers: []string{},
 		},
 		{
-			name: "cycle_when_model_has_two_parallel_edges",
+			name: "userset_defines_itself",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "transition", Id: "1"},
-				Relation: "can_view_3",
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "user",
+						Type:     "document",
+						Relation: "viewer",
 					},
 				},
 			},
 			model: `
 				model
 					schema 1.1
-
 				type user
-
-				type state
-					relations
-						define can_view: [user] or can_view_3 from associated_transition
-						define associated_transition: [transition]
-
-				type transition
+				type document
 					relations
-						define start: [state]
-						define end: [state]
-						define can_view: can_view from start or can_view from end
-						define can_view_2: can_view
-						define can_view_3: can_view_2`,
+						define viewer: [user]
+			`,
 			tuples:        []*openfgav1.TupleKey{},
+			expectedUsers: []string{"document:1#viewer"},
+		},
+		{
+			name: "evaluate_userset_in_computed_relation_of_ttu",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "repo", Id: "fga"},
+				Relation: "reader",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type:     "org",
+						Relation: "member",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+
+				type org
+					relations
+						define member: [user]
+						define admin: [org#member]
+
+				type repo
+					relations
+						define owner: [org]
+						define reader: admin from owner`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("repo:fga", "owner", "org:x"),
+				tuple.NewTupleKey("org:x", "admin", "org:x#member"),
+				tuple.NewTupleKey("org:x", "member", "user:will"),
+			},
+			expectedUsers: []string{"org:x#member"},
+		},
+		{
+			name: "userset_with_intersection_in_computed_relation_of_ttu",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "repo", Id: "fga"},
+				Relation: "reader",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type:     "org",
+						Relation: "member",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+
+				type org
+					relations
+						define member: [user]
+						define admin: [org#member]
+				type repo
+					relations
+						define owner: [org]
+						define allowed: [user]
+						define reader: admin from owner and allowed`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("repo:x", "owner", "org:fga"),
+				tuple.NewTupleKey("org:fga", "admin", "org:fga#member"),
+				tuple.NewTupleKey("repo:x", "allowed", "user:will"),
+			},
 			expectedUsers: []string{},
 		},
 	}
 	tests.runListUsersTestCases(t)
 }
 
-func TestListUsersConditions(t *testing.T) {
+func TestListUsersTTU(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
 	})
@@ -830,17 +1024,18 @@ func TestListUsersConditions(t *testing.T) {
 			schema 1.1
 		type user
 
-		type document
+		type folder
 			relations
-				define viewer: [user with isTrue]
+				define viewer: [user]
 
-		condition isTrue(param: bool) {
-			param
-		}`
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent`
 
 	tests := ListUsersTests{
 		{
-			name: "conditions_with_true_evaluation",
+			name: "ttu_user_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -849,115 +1044,115 @@ func TestListUsersConditions(t *testing.T) {
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:jon", "isTrue", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
+				tuple.NewTupleKey("folder:no-doc", "viewer", "user:maria"),
+				tuple.NewTupleKey("document:1", "parent", "folder:no-user"),
 			},
-			expectedUsers: []string{"user:jon", "user:maria"},
+			expectedUsers: []string{"user:maria"},
 		},
 		{
-			name: "conditions_with_false_evaluation",
+			name: "ttu_folder_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "user",
+						Type: "folder",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": false}),
 			},
 			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:jon", "isTrue", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
 			},
 			expectedUsers: []string{},
 		},
 		{
-			name: "conditions_with_usersets",
+			name: "ttu_with_computed_relation_user_granularity",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type:     "group",
-						Relation: "member",
+						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
-
 				type user
 
-				type group
+				type folder
 					relations
-						define member: [user]
+						define owner: [user]
+						define editor: [user] or owner
+						define viewer: [user] or owner or editor
+						define unrelated_not_computed: [user]
 
 				type document
 					relations
-						define viewer: [group#member with isTrue, user]
+						define parent: [folder]
+						define viewer: viewer from parent`,
 
-				condition isTrue(param: bool) {
-					param
-				}`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "group:eng#member", "isTrue", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "group:fga#member", "isTrue", nil),
-				tuple.NewTupleKey("group:eng", "member", "user:jon"),
-				tuple.NewTupleKey("group:eng", "member", "user:maria"),
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				tuple.NewTupleKey("folder:x", "viewer", "user:maria"),
+				tuple.NewTupleKey("folder:x", "editor", "user:will"),
+				tuple.NewTupleKey("folder:x", "owner", "user:jon"),
+				tuple.NewTupleKey("folder:x", "unrelated_not_computed", "user:poovam"),
+
+				tuple.NewTupleKey("folder:no-doc", "viewer", "user:maria"),
+				tuple.NewTupleKey("document:1", "parent", "folder:no-user"),
 			},
-			expectedUsers: []string{"group:eng#member", "group:fga#member"},
+			expectedUsers: []string{"user:maria", "user:will", "user:jon"},
 		},
 		{
-			name: "conditions_with_computed_relationships",
+			name: "ttu_multiple_levels",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Object:   &openfgav1.Object{Type: "folder", Id: "c"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
-
 				type user
-
-				type group
-					relations
-						define member: [user]
-
-				type document
+				type folder
 					relations
-						define owner: [user]
-						define editor: [user] or owner
-						define viewer: [user with isTrue] or editor or owner
-
-				condition isTrue(param: bool) {
-					param
-				}`,
+						define parent: [folder]
+						define viewer: [user] or viewer from parent`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
-				tuple.NewTupleKey("document:1", "owner", "user:will"),
-				tuple.NewTupleKey("document:1", "editor", "user:poovam"),
+				tuple.NewTupleKey("folder:a", "viewer", "user:will"),
+				tuple.NewTupleKey("folder:b", "parent", "folder:a"),
+				tuple.NewTupleKey("folder:c", "parent", "folder:b"),
+
+				tuple.NewTupleKey("folder:c", "parent", "folder:other"),
+				tuple.NewTupleKey("folder:other", "viewer", "user:jon"),
 			},
-			expectedUsers: []string{"user:will", "user:poovam", "user:maria"},
+			expectedUsers: []string{"user:will", "user:jon"},
 		},
+	}
+
+	tests.runListUsersTestCases(t)
+}
+
+func TestListUsersCycles(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+	tests := ListUsersTests{
 		{
-			name: "conditions_with_ttu",
+			name: "cycle_materialized_by_tuples",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -966,138 +1161,147 @@ func TestListUsersConditions(t *testing.T) {
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
 				type user
-
-				type folder
-					relations
-						define viewer: [user]
-
 				type document
 					relations
-					define parent: [folder with isTrue]
-					define viewer: viewer from parent
-
-				condition isTrue(param: bool) {
-					param
-				}`,
+						define viewer: [user, document#viewer]`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "isTrue", nil),
-				tuple.NewTupleKey("folder:x", "viewer", "user:jon"),
-				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:y", "isTrue", nil),
-				tuple.NewTupleKey("folder:y", "viewer", "user:maria"),
+				tuple.NewTupleKey("document:1", "viewer", "document:1#viewer"),
 			},
-			expectedUsers: []string{"user:jon", "user:maria"},
+			expectedUsers: []string{},
 		},
 		{
-			name: "multiple_conditions_no_param_provided",
+			name: "cycle_and_union",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "can_view",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{}),
 			},
 			model: `
 				model
 					schema 1.1
-
 				type user
-
 				type document
 					relations
-						define viewer: [user]
-
-				condition isEqualToFive(param1: int) {
-					param1 == 5
-				}
-
-				condition isEqualToTen(param2: int) {
-					param2 == 10
-				}`,
+						define viewer1: [user, document#viewer1]
+						define viewer2: [user, document#viewer2]
+						define can_view: viewer1 or viewer2`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
+				tuple.NewTupleKey("document:1", "viewer1", "document:1#viewer1"),
+				tuple.NewTupleKey("document:1", "viewer2", "document:1#viewer2"),
 			},
 			expectedUsers: []string{},
 		},
 		{
-			name: "multiple_conditions_some_params_provided",
+			name: "cycle_and_intersection",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Relation: "can_view",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param1": 5}),
 			},
 			model: `
 				model
 					schema 1.1
 				type user
-
 				type document
 					relations
-						define viewer: [user with isEqualToFive, user with isEqualToTen]
-
-				condition isEqualToFive(param1: int) {
-					param1 == 5
-				}
-
-				condition isEqualToTen(param2: int) {
-					param2 == 10
-				}`,
+						define viewer1: [user, document#viewer1]
+						define viewer2: [user, document#viewer2]
+						define can_view: viewer1 and viewer2`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
+				tuple.NewTupleKey("document:1", "viewer1", "document:1#viewer1"),
+				tuple.NewTupleKey("document:1", "viewer2", "document:1#viewer2"),
 			},
-			expectedErrorMsg: "failed to evaluate relationship condition: 'isEqualToTen' - context is missing parameters '[param2]'",
+			expectedUsers: []string{},
 		},
 		{
-			name: "multiple_conditions_all_params_provided",
+			name: "cycle_when_model_has_two_parallel_edges",
 			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
+				Object:   &openfgav1.Object{Type: "transition", Id: "1"},
+				Relation: "can_view_3",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"param1": 5, "param2": 10}),
 			},
 			model: `
 				model
 					schema 1.1
+
 				type user
 
-				type document
+				type state
 					relations
-						define viewer: [user with isEqualToFive, user with isEqualToTen]
+						define can_view: [user] or can_view_3 from associated_transition
+						define associated_transition: [transition]
 
-				condition isEqualToFive(param1: int) {
-					param1 == 5
-				}
+				type transition
+					relations
+						define start: [state]
+						define end: [state]
+						define can_view: can_view from start or can_view from end
+						define can_view_2: can_view
+						define can_view_3: can_view_2`,
+			tuples:        []*openfgav1.TupleKey{},
+			expectedUsers: []string{},
+		},
+	}
+	tests.runListUsersTestCases(t)
+}
 
-				condition isEqualToTen(param2: int) {
-					param2 == 10
-				}`,
+func TestListUsersConditions(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+	model := `
+		model
+			schema 1.1
+		type user
+
+		type document
+			relations
+				define viewer: [user with isTrue]
+
+		condition isTrue(param: bool) {
+			param
+		}`
+
+	tests := ListUsersTests{
+		{
+			name: "conditions_with_true_evaluation",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
+			},
+			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:jon", "isTrue", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
 			},
-			expectedUsers: []string{"user:will", "user:maria"},
+			expectedUsers: []string{"user:jon", "user:maria"},
 		},
 		{
-			name: "error_in_direct_eval",
+			name: "conditions_with_false_evaluation",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1106,68 +1310,57 @@ func TestListUsersConditions(t *testing.T) {
 						Type: "user",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"x": "1.79769313486231570814527423731704356798070e+309"}),
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": false}),
 			},
-			model: `
-				model
-					schema 1.1
-				type user
-
-				type document
-					relations
-						define viewer: [user with condFloat]
-
-				condition condFloat(x: double) {
-					x > 0.0
-				}`,
+			model: model,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "condFloat", nil),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:jon", "isTrue", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
 			},
-			expectedErrorMsg: "failed to evaluate relationship condition: parameter type error on condition 'condFloat' - failed to convert context parameter 'x': number cannot be represented as a float64: 1.797693135e+309",
+			expectedUsers: []string{},
 		},
 		{
-			name: "error_in_ttu_eval",
+			name: "conditions_with_usersets",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
 				UserFilters: []*openfgav1.UserTypeFilter{
 					{
-						Type: "user",
+						Type:     "group",
+						Relation: "member",
 					},
 				},
-				Context: testutils.MustNewStruct(t, map[string]interface{}{"x": "1.79769313486231570814527423731704356798070e+309"}),
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
+
 				type user
-				type folder
+
+				type group
 					relations
-						define viewer: [user with condFloat]
+						define member: [user]
+
 				type document
 					relations
-						define parent: [folder with condFloat]
-						define viewer: viewer from parent
+						define viewer: [group#member with isTrue, user]
 
-				condition condFloat(x: double) {
-					x > 0.0
+				condition isTrue(param: bool) {
+					param
 				}`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "condFloat", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "group:eng#member", "isTrue", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "group:fga#member", "isTrue", nil),
+				tuple.NewTupleKey("group:eng", "member", "user:jon"),
+				tuple.NewTupleKey("group:eng", "member", "user:maria"),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
 			},
-			expectedErrorMsg: "failed to evaluate relationship condition: parameter type error on condition 'condFloat' - failed to convert context parameter 'x': number cannot be represented as a float64: 1.797693135e+309",
+			expectedUsers: []string{"group:eng#member", "group:fga#member"},
 		},
-	}
-	tests.runListUsersTestCases(t)
-}
-
-func TestListUsersIntersection(t *testing.T) {
-	t.Cleanup(func() {
-		goleak.VerifyNone(t)
-	})
-	tests := ListUsersTests{
 		{
-			name: "intersection",
+			name: "conditions_with_computed_relationships",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1176,28 +1369,36 @@ func TestListUsersIntersection(t *testing.T) {
 						Type: "user",
 					},
 				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
+
 				type user
+
+				type group
+					relations
+						define member: [user]
+
 				type document
 					relations
-						define required: [user]
-						define required_other: [user]
-						define viewer: required and required_other`,
+						define owner: [user]
+						define editor: [user] or owner
+						define viewer: [user with isTrue] or editor or owner
 
+				condition isTrue(param: bool) {
+					param
+				}`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "required", "user:will"),
-				tuple.NewTupleKey("document:1", "required_other", "user:will"),
-
-				tuple.NewTupleKey("document:1", "required", "user:jon"),
-				tuple.NewTupleKey("document:1", "required_other", "user:maria"),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isTrue", nil),
+				tuple.NewTupleKey("document:1", "owner", "user:will"),
+				tuple.NewTupleKey("document:1", "editor", "user:poovam"),
 			},
-			expectedUsers: []string{"user:will"},
+			expectedUsers: []string{"user:will", "user:poovam", "user:maria"},
 		},
 		{
-			name: "intersection_multiple",
+			name: "conditions_with_ttu",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1206,37 +1407,35 @@ func TestListUsersIntersection(t *testing.T) {
 						Type: "user",
 					},
 				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param": true}),
 			},
 			model: `
 				model
 					schema 1.1
 				type user
+
+				type folder
+					relations
+						define viewer: [user]
+
 				type document
 					relations
-						define required_1: [user]
-						define required_2: [user]
-						define required_3: [user]
-						define viewer: [user] and required_1 and required_2 and required_3`,
+					define parent: [folder with isTrue]
+					define viewer: viewer from parent
 
+				condition isTrue(param: bool) {
+					param
+				}`,
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
-				tuple.NewTupleKey("document:1", "required_1", "user:will"),
-				tuple.NewTupleKey("document:1", "required_2", "user:will"),
-				tuple.NewTupleKey("document:1", "required_3", "user:will"),
-
-				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
-				tuple.NewTupleKey("document:1", "required_1", "user:jon"),
-				tuple.NewTupleKey("document:1", "required_2", "user:jon"),
-
-				tuple.NewTupleKey("document:1", "viewer", "user:maria"),
-				tuple.NewTupleKey("document:1", "required_1", "user:maria"),
-
-				tuple.NewTupleKey("document:1", "viewer", "user:poovam"),
+				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "isTrue", nil),
+				tuple.NewTupleKey("folder:x", "viewer", "user:jon"),
+				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:y", "isTrue", nil),
+				tuple.NewTupleKey("folder:y", "viewer", "user:maria"),
 			},
-			expectedUsers: []string{"user:will"},
+			expectedUsers: []string{"user:jon", "user:maria"},
 		},
 		{
-			name: "intersection_at_multiple_levels",
+			name: "multiple_conditions_no_param_provided",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1245,35 +1444,33 @@ func TestListUsersIntersection(t *testing.T) {
 						Type: "user",
 					},
 				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{}),
 			},
 			model: `
 				model
 					schema 1.1
+
 				type user
+
 				type document
 					relations
-						define required: [user]
-						define owner: [user] and required
-						define editor: [user] and owner
-						define viewer: [user] and editor`,
-			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "required", "user:will"),
-				tuple.NewTupleKey("document:1", "owner", "user:will"),
-				tuple.NewTupleKey("document:1", "editor", "user:will"),
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+						define viewer: [user]
 
-				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
-				tuple.NewTupleKey("document:1", "owner", "user:jon"),
-				tuple.NewTupleKey("document:1", "editor", "user:jon"),
+				condition isEqualToFive(param1: int) {
+					param1 == 5
+				}
 
-				tuple.NewTupleKey("document:1", "viewer", "user:maria"),
-				tuple.NewTupleKey("document:1", "owner", "user:maria"),
-				tuple.NewTupleKey("document:1", "required", "user:maria"),
+				condition isEqualToTen(param2: int) {
+					param2 == 10
+				}`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
 			},
-			expectedUsers: []string{"user:will"},
+			expectedUsers: []string{},
 		},
 		{
-			name: "intersection_and_ttu",
+			name: "multiple_conditions_some_params_provided",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1282,32 +1479,32 @@ func TestListUsersIntersection(t *testing.T) {
 						Type: "user",
 					},
 				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param1": 5}),
 			},
 			model: `
 				model
 					schema 1.1
 				type user
-				type folder
-					relations
-						define viewer: [user]
+
 				type document
 					relations
-						define required: [user]
-						define parent: [folder]
-						define viewer: (viewer from parent) and required`,
+						define viewer: [user with isEqualToFive, user with isEqualToTen]
 
-			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "required", "user:will"),
-				tuple.NewTupleKey("folder:x", "viewer", "user:will"),
-				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+				condition isEqualToFive(param1: int) {
+					param1 == 5
+				}
 
-				tuple.NewTupleKey("document:1", "required", "user:maria"),
-				tuple.NewTupleKey("folder:x", "viewer", "user:jon"),
+				condition isEqualToTen(param2: int) {
+					param2 == 10
+				}`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
 			},
-			expectedUsers: []string{"user:will"},
+			expectedErrorMsg: "failed to evaluate relationship condition: 'isEqualToTen' - context is missing parameters '[param2]'",
 		},
 		{
-			name: "excluded_subjects_of_subtracted_branches_propagate",
+			name: "multiple_conditions_all_params_provided",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "viewer",
@@ -1316,6 +1513,7 @@ func TestListUsersIntersection(t *testing.T) {
 						Type: "user",
 					},
 				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"param1": 5, "param2": 10}),
 			},
 			model: `
 				model
@@ -1324,8 +1522,251 @@ func TestListUsersIntersection(t *testing.T) {
 
 				type document
 					relations
-						define viewer: viewer1 and viewer2
-						define viewer1: [user,user:*] but not blocked
+						define viewer: [user with isEqualToFive, user with isEqualToTen]
+
+				condition isEqualToFive(param1: int) {
+					param1 == 5
+				}
+
+				condition isEqualToTen(param2: int) {
+					param2 == 10
+				}`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:will", "isEqualToFive", nil),
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "isEqualToTen", nil),
+			},
+			expectedUsers: []string{"user:will", "user:maria"},
+		},
+		{
+			name: "error_in_direct_eval",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"x": "1.79769313486231570814527423731704356798070e+309"}),
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+
+				type document
+					relations
+						define viewer: [user with condFloat]
+
+				condition condFloat(x: double) {
+					x > 0.0
+				}`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "condFloat", nil),
+			},
+			expectedErrorMsg: "failed to evaluate relationship condition: parameter type error on condition 'condFloat' - failed to convert context parameter 'x': number cannot be represented as a float64: 1.797693135e+309",
+		},
+		{
+			name: "error_in_ttu_eval",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+				Context: testutils.MustNewStruct(t, map[string]interface{}{"x": "1.79769313486231570814527423731704356798070e+309"}),
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type folder
+					relations
+						define viewer: [user with condFloat]
+				type document
+					relations
+						define parent: [folder with condFloat]
+						define viewer: viewer from parent
+
+				condition condFloat(x: double) {
+					x > 0.0
+				}`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "condFloat", nil),
+			},
+			expectedErrorMsg: "failed to evaluate relationship condition: parameter type error on condition 'condFloat' - failed to convert context parameter 'x': number cannot be represented as a float64: 1.797693135e+309",
+		},
+	}
+	tests.runListUsersTestCases(t)
+}
+
+func TestListUsersIntersection(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+	tests := ListUsersTests{
+		{
+			name: "intersection",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define required: [user]
+						define required_other: [user]
+						define viewer: required and required_other`,
+
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "required", "user:will"),
+				tuple.NewTupleKey("document:1", "required_other", "user:will"),
+
+				tuple.NewTupleKey("document:1", "required", "user:jon"),
+				tuple.NewTupleKey("document:1", "required_other", "user:maria"),
+			},
+			expectedUsers: []string{"user:will"},
+		},
+		{
+			name: "intersection_multiple",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define required_1: [user]
+						define required_2: [user]
+						define required_3: [user]
+						define viewer: [user] and required_1 and required_2 and required_3`,
+
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKey("document:1", "required_1", "user:will"),
+				tuple.NewTupleKey("document:1", "required_2", "user:will"),
+				tuple.NewTupleKey("document:1", "required_3", "user:will"),
+
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "required_1", "user:jon"),
+				tuple.NewTupleKey("document:1", "required_2", "user:jon"),
+
+				tuple.NewTupleKey("document:1", "viewer", "user:maria"),
+				tuple.NewTupleKey("document:1", "required_1", "user:maria"),
+
+				tuple.NewTupleKey("document:1", "viewer", "user:poovam"),
+			},
+			expectedUsers: []string{"user:will"},
+		},
+		{
+			name: "intersection_at_multiple_levels",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define required: [user]
+						define owner: [user] and required
+						define editor: [user] and owner
+						define viewer: [user] and editor`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "required", "user:will"),
+				tuple.NewTupleKey("document:1", "owner", "user:will"),
+				tuple.NewTupleKey("document:1", "editor", "user:will"),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "owner", "user:jon"),
+				tuple.NewTupleKey("document:1", "editor", "user:jon"),
+
+				tuple.NewTupleKey("document:1", "viewer", "user:maria"),
+				tuple.NewTupleKey("document:1", "owner", "user:maria"),
+				tuple.NewTupleKey("document:1", "required", "user:maria"),
+			},
+			expectedUsers: []string{"user:will"},
+		},
+		{
+			name: "intersection_and_ttu",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type folder
+					relations
+						define viewer: [user]
+				type document
+					relations
+						define required: [user]
+						define parent: [folder]
+						define viewer: (viewer from parent) and required`,
+
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "required", "user:will"),
+				tuple.NewTupleKey("folder:x", "viewer", "user:will"),
+				tuple.NewTupleKey("document:1", "parent", "folder:x"),
+
+				tuple.NewTupleKey("document:1", "required", "user:maria"),
+				tuple.NewTupleKey("folder:x", "viewer", "user:jon"),
+			},
+			expectedUsers: []string{"user:will"},
+		},
+		{
+			name: "excluded_subjects_of_subtracted_branches_propagate",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+
+				type document
+					relations
+						define viewer: viewer1 and viewer2
+						define viewer1: [user,user:*] but not blocked
 						define viewer2: [user,user:*] but not blocked
 						define blocked: [user,user:*]`,
 
@@ -1579,20 +2020,128 @@ func TestListUsersUnion(t *testing.T) {
 	tests.runListUsersTestCases(t)
 }
 
-func TestListUsersExclusion(t *testing.T) {
+func TestListUsersNestedUnion(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
 	})
-	tests := ListUsersTests{
-		{
-			name: "exclusion",
-			req: &openfgav1.ListUsersRequest{
-				Object:   &openfgav1.Object{Type: "document", Id: "1"},
-				Relation: "viewer",
-				UserFilters: []*openfgav1.UserTypeFilter{
-					{
-						Type: "user",
-					},
+
+	const nestingDepth = 50
+
+	var relations, rewrite strings.Builder
+	tuples := make([]*openfgav1.TupleKey, 0, nestingDepth)
+	expectedUsers := make([]string, 0, nestingDepth)
+	for i := 0; i < nestingDepth; i++ {
+		relations.WriteString(fmt.Sprintf("\n\t\t\t\tdefine r%d: [user]", i))
+		if i < nestingDepth-1 {
+			rewrite.WriteString(fmt.Sprintf("r%d or (", i))
+		} else {
+			rewrite.WriteString(fmt.Sprintf("r%d", i))
+		}
+		tuples = append(tuples, tuple.NewTupleKey("document:1", fmt.Sprintf("r%d", i), fmt.Sprintf("user:%d", i)))
+		expectedUsers = append(expectedUsers, fmt.Sprintf("user:%d", i))
+	}
+	rewrite.WriteString(strings.Repeat(")", nestingDepth-1))
+
+	model := fmt.Sprintf(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations%s
+				define viewer: %s`, relations.String(), rewrite.String())
+
+	t.Run("flatten_union", func(t *testing.T) {
+		typesys := typesystem.New(testutils.MustTransformDSLToProtoWithID(model))
+		relation, err := typesys.GetRelation("document", "viewer")
+		require.NoError(t, err)
+
+		union := relation.GetRewrite().GetUnion()
+		require.Len(t, union.GetChild(), 2)
+
+		flattened := flattenUnion(union)
+		require.Len(t, flattened, nestingDepth)
+		for i, child := range flattened {
+			require.Equal(t, fmt.Sprintf("r%d", i), child.GetComputedUserset().GetRelation())
+		}
+	})
+
+	t.Run("flatten_union_keeps_non_union_operands", func(t *testing.T) {
+		typesys := typesystem.New(testutils.MustTransformDSLToProtoWithID(`
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define a: [user]
+					define b: [user]
+					define c: [user]
+					define viewer: a or (b and c) or (b or (c but not a))`))
+		relation, err := typesys.GetRelation("document", "viewer")
+		require.NoError(t, err)
+
+		flattened := flattenUnion(relation.GetRewrite().GetUnion())
+		require.Len(t, flattened, 4)
+		require.NotNil(t, flattened[1].GetIntersection())
+		require.NotNil(t, flattened[3].GetDifference())
+	})
+
+	tests := ListUsersTests{
+		{
+			name: "deeply_nested_union",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:         model,
+			tuples:        tuples,
+			expectedUsers: expectedUsers,
+		},
+	}
+	tests.runListUsersTestCases(t)
+
+	t.Run("deeply_nested_union_with_breadth_limit_of_one", func(t *testing.T) {
+		ds := memory.New()
+		t.Cleanup(ds.Close)
+
+		storeID, authModel := storagetest.BootstrapFGAStore(t, ds, model, nil)
+		err := ds.Write(context.Background(), storeID, nil, tuples)
+		require.NoError(t, err)
+
+		typesys, err := typesystem.NewAndValidate(context.Background(), authModel)
+		require.NoError(t, err)
+		ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+		resp, err := NewListUsersQuery(ds, WithResolveNodeBreadthLimit(1)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+
+		actualUsers := make([]string, 0, len(resp.GetUsers()))
+		for _, u := range resp.GetUsers() {
+			actualUsers = append(actualUsers, tuple.UserProtoToString(u))
+		}
+		require.ElementsMatch(t, expectedUsers, actualUsers)
+	})
+}
+
+func TestListUsersExclusion(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+	tests := ListUsersTests{
+		{
+			name: "exclusion",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
 				},
 			},
 			model: `
@@ -1820,6 +2369,11 @@ func TestListUsersExclusion(t *testing.T) {
 		},
 	}
 	tests.runListUsersTestCases(t)
+
+	// streaming the base of exclusions must yield the same users
+	t.Run("streaming_exclusion", func(t *testing.T) {
+		tests.runListUsersTestCases(t, WithStreamingExclusion(math.MaxUint32))
+	})
 }
 
 func TestListUsersExclusionWildcards(t *testing.T) {
@@ -1963,8 +2517,137 @@ func TestListUsersExclusionWildcards(t *testing.T) {
 			},
 			expectedUsers: []string{"user:*", "user:maria"},
 		},
+		{
+			name: "exclusion_multiple_filter_types_subtract_wildcard_of_second_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define blocked: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] but not blocked`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "viewer", "group:fga"),
+				tuple.NewTupleKey("document:1", "blocked", "group:*"),
+			},
+			expectedUsers: []string{"user:jon"},
+		},
+		{
+			name: "exclusion_multiple_filter_types_subtract_wildcard_of_first_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define blocked: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] but not blocked`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "blocked", "user:*"),
+			},
+			expectedUsers: []string{"group:eng"},
+		},
+		{
+			name: "exclusion_multiple_filter_types_base_wildcards_per_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define blocked: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] but not blocked`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "viewer", "group:fga"),
+				tuple.NewTupleKey("document:1", "blocked", "user:jon"),
+				tuple.NewTupleKey("document:1", "blocked", "group:fga"),
+			},
+			expectedUsers: []string{"user:*", "group:eng"},
+		},
+		{
+			name: "exclusion_multiple_filter_types_base_and_subtract_wildcards_of_different_types",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define blocked: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] but not blocked`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "group:*"),
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "blocked", "user:*"),
+			},
+			expectedUsers: []string{"group:*"},
+		},
 	}
 	tests.runListUsersTestCases(t)
+
+	// streaming the base of exclusions must yield the same users
+	t.Run("streaming_exclusion", func(t *testing.T) {
+		tests.runListUsersTestCases(t, WithStreamingExclusion(math.MaxUint32))
+	})
 }
 
 func TestListUsersWildcards(t *testing.T) {
@@ -2255,6 +2938,98 @@ func TestListUsersEdgePruning(t *testing.T) {
 	tests.runListUsersTestCases(t)
 }
 
+type staticPruner struct {
+	hasPossibleEdges bool
+}
+
+func (p staticPruner) HasPossibleEdges(_ *typesystem.TypeSystem, _, _ *openfgav1.RelationReference) (bool, []*openfgav1.RelationReference, error) {
+	return p.hasPossibleEdges, nil, nil
+}
+
+func TestListUsersCustomPruner(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	modelStr := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define viewer: [user]`
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, modelStr, []string{
+		"document:1#viewer@user:maria",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	t.Run("pruner_suppresses_expansion", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithPruner(staticPruner{hasPossibleEdges: false})).
+			ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+		require.Equal(t, uint32(0), resp.GetMetadata().DatastoreQueryCount)
+		require.True(t, resp.GetMetadata().NoPossibleEdges)
+	})
+
+	t.Run("pruner_forces_expansion", func(t *testing.T) {
+		// the default pruner would prune this request since 'folder' can never be a viewer
+		resp, err := NewListUsersQuery(ds, WithPruner(staticPruner{hasPossibleEdges: true})).
+			ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "folder"}},
+			})
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+		require.Equal(t, uint32(1), resp.GetMetadata().DatastoreQueryCount)
+		require.False(t, resp.GetMetadata().NoPossibleEdges)
+	})
+
+	t.Run("default_pruner_prunes", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).
+			ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "folder"}},
+			})
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+		require.Equal(t, uint32(0), resp.GetMetadata().DatastoreQueryCount)
+		require.True(t, resp.GetMetadata().NoPossibleEdges)
+	})
+
+	t.Run("possible_but_no_users", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).
+			ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "2"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+		require.Equal(t, uint32(1), resp.GetMetadata().DatastoreQueryCount)
+		require.False(t, resp.GetMetadata().NoPossibleEdges)
+	})
+}
+
 func TestListUsersWildcardsAndIntersection(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
@@ -2321,7 +3096,7 @@ func TestListUsersWildcardsAndIntersection(t *testing.T) {
 			expectedUsers: []string{"user:maria", "user:*", "user:jon"},
 		},
 		{
-			name: "with_multiple_wildcards_2",
+			name: "user_only_through_wildcards_in_some_operands",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "can_view",
@@ -2337,18 +3112,22 @@ func TestListUsersWildcardsAndIntersection(t *testing.T) {
 				type user
 				type document
 					relations
-						define viewer: [user:*,user]
-						define this_is_not_assigned_to_any_user: [user]
-						define can_view: viewer and this_is_not_assigned_to_any_user`,
+						define a: [user:*,user]
+						define b: [user:*,user]
+						define c: [user:*,user]
+						define can_view: a and b and c`,
 
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "user:*"),
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKey("document:1", "a", "user:*"),
+				tuple.NewTupleKey("document:1", "a", "user:jon"),
+				tuple.NewTupleKey("document:1", "b", "user:*"),
+				tuple.NewTupleKey("document:1", "c", "user:jon"),
+				tuple.NewTupleKey("document:1", "c", "user:will"),
 			},
-			expectedUsers: []string{},
+			expectedUsers: []string{"user:jon", "user:will"},
 		},
 		{
-			name: "with_multiple_wildcards_3",
+			name: "user_only_through_wildcards_in_all_but_one_operand",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "can_view",
@@ -2364,20 +3143,22 @@ func TestListUsersWildcardsAndIntersection(t *testing.T) {
 				type user
 				type document
 					relations
-						define viewer: [user:*,user]
-						define required: [user:*,user]
-						define can_view: viewer and required`,
+						define a: [user:*,user]
+						define b: [user:*,user]
+						define c: [user]
+						define can_view: a and b and c`,
 
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "viewer", "user:*"),
-				tuple.NewTupleKey("document:1", "required", "user:*"),
-				tuple.NewTupleKey("document:1", "viewer", "user:will"),
-				tuple.NewTupleKey("document:1", "required", "user:will"),
+				tuple.NewTupleKey("document:1", "a", "user:*"),
+				tuple.NewTupleKey("document:1", "a", "user:jon"),
+				tuple.NewTupleKey("document:1", "b", "user:*"),
+				tuple.NewTupleKey("document:1", "b", "user:jon"),
+				tuple.NewTupleKey("document:1", "b", "user:maria"),
 			},
-			expectedUsers: []string{"user:*", "user:will"},
+			expectedUsers: []string{},
 		},
 		{
-			name: "with_multiple_wildcards_4",
+			name: "with_multiple_wildcards_2",
 			req: &openfgav1.ListUsersRequest{
 				Object:   &openfgav1.Object{Type: "document", Id: "1"},
 				Relation: "can_view",
@@ -2393,17 +3174,73 @@ func TestListUsersWildcardsAndIntersection(t *testing.T) {
 				type user
 				type document
 					relations
-						define required_1: [user]
-						define required_2: [user]
-						define can_view: required_1 and required_2`,
+						define viewer: [user:*,user]
+						define this_is_not_assigned_to_any_user: [user]
+						define can_view: viewer and this_is_not_assigned_to_any_user`,
 
 			tuples: []*openfgav1.TupleKey{
-				tuple.NewTupleKey("document:1", "required_1", "user:*"), // Invalid tuple, wildcard not allowed
-				tuple.NewTupleKey("document:1", "required_2", "user:*"), // Invalid tuple, wildcard not allowed
-				tuple.NewTupleKey("document:1", "required_1", "user:maria"),
-				tuple.NewTupleKey("document:1", "required_2", "user:maria"),
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
 			},
-			expectedUsers: []string{"user:maria"},
+			expectedUsers: []string{},
+		},
+		{
+			name: "with_multiple_wildcards_3",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "can_view",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define viewer: [user:*,user]
+						define required: [user:*,user]
+						define can_view: viewer and required`,
+
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "required", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "user:will"),
+				tuple.NewTupleKey("document:1", "required", "user:will"),
+			},
+			expectedUsers: []string{"user:*", "user:will"},
+		},
+		{
+			name: "with_multiple_wildcards_4",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "can_view",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define required_1: [user]
+						define required_2: [user]
+						define can_view: required_1 and required_2`,
+
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "required_1", "user:*"), // Invalid tuple, wildcard not allowed
+				tuple.NewTupleKey("document:1", "required_2", "user:*"), // Invalid tuple, wildcard not allowed
+				tuple.NewTupleKey("document:1", "required_1", "user:maria"),
+				tuple.NewTupleKey("document:1", "required_2", "user:maria"),
+			},
+			expectedUsers: []string{"user:maria"},
 		},
 
 		{
@@ -2530,8 +3367,138 @@ func TestListUsersWildcardsAndIntersection(t *testing.T) {
 			},
 			expectedUsers: []string{"user:jon"},
 		},
+		{
+			name: "intersection_multiple_filter_types_wildcard_of_second_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define allowed: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] and allowed`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "allowed", "user:jon"),
+				tuple.NewTupleKey("document:1", "allowed", "group:*"),
+			},
+			expectedUsers: []string{"user:jon", "group:eng"},
+		},
+		{
+			name: "intersection_multiple_filter_types_wildcard_does_not_cover_other_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define allowed: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] and allowed`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "allowed", "user:*"),
+			},
+			expectedUsers: []string{"user:jon"},
+		},
+		{
+			name: "intersection_multiple_filter_types_wildcards_of_each_type_in_different_operands",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define allowed: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] and allowed`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "group:eng"),
+				tuple.NewTupleKey("document:1", "allowed", "user:maria"),
+				tuple.NewTupleKey("document:1", "allowed", "group:*"),
+			},
+			expectedUsers: []string{"user:maria", "group:eng"},
+		},
+		{
+			name: "intersection_multiple_filter_types_wildcards_of_each_type_in_all_operands",
+			req: &openfgav1.ListUsersRequest{
+				Object:   &openfgav1.Object{Type: "document", Id: "1"},
+				Relation: "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{
+					{
+						Type: "user",
+					},
+					{
+						Type: "group",
+					},
+				},
+			},
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				type document
+					relations
+						define allowed: [user, user:*, group, group:*]
+						define viewer: [user, user:*, group, group:*] and allowed`,
+			tuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+				tuple.NewTupleKey("document:1", "viewer", "group:*"),
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "allowed", "user:*"),
+				tuple.NewTupleKey("document:1", "allowed", "group:*"),
+				tuple.NewTupleKey("document:1", "allowed", "group:eng"),
+			},
+			expectedUsers: []string{"user:*", "group:*", "user:jon", "group:eng"},
+		},
 	}
 	tests.runListUsersTestCases(t)
+
+	// streaming the base of exclusions must yield the same users
+	t.Run("streaming_exclusion", func(t *testing.T) {
+		tests.runListUsersTestCases(t, WithStreamingExclusion(math.MaxUint32))
+	})
 }
 
 func TestListUsersCycleDetection(t *testing.T) {
@@ -2780,6 +3747,11 @@ func TestListUsersChainedNegation(t *testing.T) {
 	}
 
 	tests.runListUsersTestCases(t)
+
+	// streaming the base of exclusions must yield the same users
+	t.Run("streaming_exclusion", func(t *testing.T) {
+		tests.runListUsersTestCases(t, WithStreamingExclusion(math.MaxUint32))
+	})
 }
 
 func TestListUsersDepthExceeded(t *testing.T) {
@@ -2933,7 +3905,7 @@ func TestListUsersStorageErrors(t *testing.T) {
 	}
 }
 
-func (testCases ListUsersTests) runListUsersTestCases(t *testing.T) {
+func (testCases ListUsersTests) runListUsersTestCases(t *testing.T, opts ...ListUsersQueryOption) {
 	storeID := ulid.Make().String()
 
 	for _, test := range testCases {
@@ -2953,7 +3925,7 @@ func (testCases ListUsersTests) runListUsersTestCases(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			l := NewListUsersQuery(ds, WithResolveNodeLimit(maximumRecursiveDepth))
+			l := NewListUsersQuery(ds, append([]ListUsersQueryOption{WithResolveNodeLimit(maximumRecursiveDepth)}, opts...)...)
 
 			ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
 
@@ -3050,37 +4022,1786 @@ func TestListUsersReadFails_NoLeaks_TTU(t *testing.T) {
 	mockController := gomock.NewController(t)
 	defer mockController.Finish()
 
-	mockDatastore := mocks.NewMockOpenFGADatastore(mockController)
-	gomock.InOrder(
-		mockDatastore.EXPECT().Read(gomock.Any(), store, &openfgav1.TupleKey{
-			Object:   "document:1",
-			Relation: "parent",
-		}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ *openfgav1.TupleKey, _ storage.ReadOptions) (storage.TupleIterator, error) {
-			return mocks.NewErrorTupleIterator([]*openfgav1.Tuple{
-				{Key: tuple.NewTupleKey("document:1", "parent", "folder:1")},
-				{Key: tuple.NewTupleKey("document:1", "parent", "folder:2")},
-			}), nil
-		}),
-		mockDatastore.EXPECT().Read(gomock.Any(), store, &openfgav1.TupleKey{
-			Object:   "folder:1",
-			Relation: "viewer",
-		}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ *openfgav1.TupleKey, _ storage.ReadOptions) (storage.TupleIterator, error) {
-			return storage.NewStaticTupleIterator([]*openfgav1.Tuple{}), nil
-		}),
-	)
+	mockDatastore := mocks.NewMockOpenFGADatastore(mockController)
+	gomock.InOrder(
+		mockDatastore.EXPECT().Read(gomock.Any(), store, &openfgav1.TupleKey{
+			Object:   "document:1",
+			Relation: "parent",
+		}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ *openfgav1.TupleKey, _ storage.ReadOptions) (storage.TupleIterator, error) {
+			return mocks.NewErrorTupleIterator([]*openfgav1.Tuple{
+				{Key: tuple.NewTupleKey("document:1", "parent", "folder:1")},
+				{Key: tuple.NewTupleKey("document:1", "parent", "folder:2")},
+			}), nil
+		}),
+		mockDatastore.EXPECT().Read(gomock.Any(), store, &openfgav1.TupleKey{
+			Object:   "folder:1",
+			Relation: "viewer",
+		}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ *openfgav1.TupleKey, _ storage.ReadOptions) (storage.TupleIterator, error) {
+			return storage.NewStaticTupleIterator([]*openfgav1.Tuple{}), nil
+		}),
+	)
+
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+	resp, err := NewListUsersQuery(mockDatastore).ListUsers(ctx, &openfgav1.ListUsersRequest{
+		StoreId:     store,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	})
+
+	require.ErrorContains(t, err, "simulated errors")
+	require.Nil(t, resp)
+}
+
+func TestListUsersReadInterceptor(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [group#member] or viewer from parent`, []string{
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:fga#member",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:jon",
+		"group:fga#member@user:maria",
+		"folder:x#viewer@user:will",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("invoked_before_each_read", func(t *testing.T) {
+		var mu sync.Mutex
+		var reads []string
+		resp, err := NewListUsersQuery(ds, WithReadInterceptor(func(_ context.Context, store string, tk *openfgav1.TupleKey) error {
+			require.Equal(t, storeID, store)
+			mu.Lock()
+			defer mu.Unlock()
+			reads = append(reads, tk.GetObject()+"#"+tk.GetRelation())
+			return nil
+		})).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 3)
+		require.ElementsMatch(t, []string{
+			"document:1#viewer",
+			"document:1#parent",
+			"group:eng#member",
+			"group:fga#member",
+			"folder:x#viewer",
+		}, reads)
+	})
+
+	t.Run("injected_latency", func(t *testing.T) {
+		start := time.Now()
+		resp, err := NewListUsersQuery(ds, WithReadInterceptor(func(_ context.Context, _ string, _ *openfgav1.TupleKey) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 3)
+		// the reads on document:1 and the reads they lead to happen one after the other
+		require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("injected_fault_mid_expansion", func(t *testing.T) {
+		for _, failingRead := range []string{"document:1#viewer", "document:1#parent", "group:fga#member", "folder:x#viewer"} {
+			t.Run(failingRead, func(t *testing.T) {
+				resp, err := NewListUsersQuery(ds, WithReadInterceptor(func(_ context.Context, _ string, tk *openfgav1.TupleKey) error {
+					if tk.GetObject()+"#"+tk.GetRelation() == failingRead {
+						return fmt.Errorf("injected fault")
+					}
+					return nil
+				})).ListUsers(ctx, req)
+				require.ErrorContains(t, err, "injected fault")
+				require.Nil(t, resp)
+			})
+		}
+	})
+}
+
+func TestListUsersResultPredicate(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*]
+		type document
+			relations
+				define viewer: [user, user:*, group#member] but not blocked
+				define blocked: [user]
+				define editor: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@user:will",
+		"document:1#viewer@group:eng#member",
+		"document:1#blocked@user:will",
+		"document:1#editor@user:maria",
+		"document:1#editor@group:eng#member",
+		"group:eng#member@user:poovam",
+		"group:eng#member@user:jon",
+		"group:admins#member@user:maria",
+		"group:admins#member@user:will",
+		"group:admins#member@user:poovam",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	checker := graph.NewLocalChecker()
+	t.Cleanup(checker.Close)
+
+	isAdmin := func(ctx context.Context, user *openfgav1.User) (bool, error) {
+		resp, err := checker.ResolveCheck(
+			storage.ContextWithRelationshipTupleReader(ctx, ds),
+			&graph.ResolveCheckRequest{
+				StoreID:              storeID,
+				AuthorizationModelID: model.GetId(),
+				TupleKey:             tuple.NewTupleKey("group:admins", "member", tuple.UserProtoToString(user)),
+				RequestMetadata:      graph.NewCheckRequestMetadata(25),
+			})
+		if err != nil {
+			return false, err
+		}
+		return resp.GetAllowed(), nil
+	}
+
+	t.Run("viewers_who_are_admins", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithResultPredicate(isAdmin)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria", "user:poovam"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("evaluated_once_per_user", func(t *testing.T) {
+		var mu sync.Mutex
+		evaluated := make(map[string]int)
+		resp, err := NewListUsersQuery(ds, WithResultPredicate(func(ctx context.Context, user *openfgav1.User) (bool, error) {
+			mu.Lock()
+			evaluated[tuple.UserProtoToString(user)]++
+			mu.Unlock()
+			return isAdmin(ctx, user)
+		})).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 2)
+		// user:jon is a viewer both directly and through group:eng, and user:will is never
+		// evaluated since it is blocked
+		require.Equal(t, map[string]int{"user:jon": 1, "user:maria": 1, "user:poovam": 1}, evaluated)
+	})
+
+	t.Run("max_results_counts_matching_users", func(t *testing.T) {
+		editorsReq := proto.Clone(req).(*openfgav1.ListUsersRequest)
+		editorsReq.Relation = "editor"
+
+		resp, err := NewListUsersQuery(ds,
+			WithListUsersMaxResults(2),
+			WithResultPredicate(isAdmin),
+		).ListUsers(ctx, editorsReq)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria", "user:poovam"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("predicate_error", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithResultPredicate(func(context.Context, *openfgav1.User) (bool, error) {
+			return false, fmt.Errorf("predicate failed")
+		})).ListUsers(ctx, req)
+		require.ErrorContains(t, err, "predicate failed")
+		require.Nil(t, resp)
+	})
+}
+
+func userStrings(users []*openfgav1.User) []string {
+	strs := make([]string, 0, len(users))
+	for _, user := range users {
+		strs = append(strs, tuple.UserProtoToString(user))
+	}
+	return strs
+}
+
+func TestListUsersConfig_ZeroBreadthLimit(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define viewer: [user, group#member]
+				define editor: [user]
+				define can_view: viewer or editor`, []string{
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:fga#member",
+		"document:1#editor@user:will",
+		"group:eng#member@user:jon",
+		"group:fga#member@user:maria",
+		"group:fga#member@group:eng#member",
+	})
+
+	observerLogger, logs := observer.New(zap.WarnLevel)
+	l := NewListUsersQuery(ds,
+		WithListUsersQueryLogger(&logger.ZapLogger{Logger: zap.New(observerLogger)}),
+		WithResolveNodeBreadthLimit(0),
+	)
+	require.Equal(t, uint32(1), l.resolveNodeBreadthLimit)
+	require.Equal(t, 1, logs.Len())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "can_view",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+	resp, err := l.ListUsers(ctx, req)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"user:jon", "user:maria", "user:will"}, userStrings(resp.GetUsers()))
+
+	// the options splitting the request share the clamped limit between their branches
+	tests := []struct {
+		name string
+		opts []ListUsersQueryOption
+	}{
+		{
+			name: "fair_type_scheduling",
+			opts: []ListUsersQueryOption{WithFairTypeScheduling(true)},
+		},
+		{
+			name: "stop_on_wildcard",
+			opts: []ListUsersQueryOption{WithStopOnWildcard(true)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]ListUsersQueryOption{WithResolveNodeBreadthLimit(0)}, test.opts...)
+			resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      req.GetObject(),
+				Relation:    req.GetRelation(),
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group", Relation: "member"}},
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{
+				"user:jon",
+				"user:maria",
+				"user:will",
+				"group:eng#member",
+				"group:fga#member",
+			}, userStrings(resp.GetUsers()))
+		})
+	}
+}
+
+func TestListUsersCallback(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent
+				define blocked: [user]
+				define can_view: viewer but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"document:1#blocked@user:jon",
+		"folder:x#viewer@user:maria",
+		"folder:x#viewer@group:fga#member",
+		"group:eng#member@user:jon",
+		"group:eng#member@user:will",
+		"group:eng#member@group:fga#member",
+		"group:fga#member@user:maria",
+		"group:fga#member@user:poovam",
+		"group:fga#member@user:*",
+	})
+
+	for _, relation := range []string{"viewer", "can_view"} {
+		t.Run("matches_list_users_"+relation, func(t *testing.T) {
+			req := &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    relation,
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			}
+
+			var users []string
+			err := NewListUsersQuery(ds).ListUsersCallback(ctx, req, func(user *openfgav1.User) error {
+				users = append(users, tuple.UserProtoToString(user))
+				return nil
+			})
+			require.NoError(t, err)
+
+			resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.NotEmpty(t, users)
+			// ElementsMatch also asserts that every user is only passed once
+			require.ElementsMatch(t, userStrings(resp.GetUsers()), users)
+		})
+	}
+
+	t.Run("callback_error_stops_expansion", func(t *testing.T) {
+		for _, relation := range []string{"viewer", "can_view"} {
+			calls := 0
+			err := NewListUsersQuery(ds).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    relation,
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			}, func(*openfgav1.User) error {
+				calls++
+				return fmt.Errorf("callback failed")
+			})
+			require.ErrorContains(t, err, "callback failed")
+			require.Equal(t, 1, calls)
+		}
+	})
+
+	t.Run("users_passed_before_expansion_completes", func(t *testing.T) {
+		errStop := fmt.Errorf("stop")
+		err := NewListUsersQuery(ds,
+			WithReadInterceptor(func(ctx context.Context, _ string, tk *openfgav1.TupleKey) error {
+				if tk.GetRelation() != "parent" {
+					return nil
+				}
+				// the parent branch only finishes once the expansion is cancelled
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+		).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, func(*openfgav1.User) error {
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+	})
+}
+
+type countingPruner struct {
+	relationshipGraphPruner
+	calls atomic.Uint32
+}
+
+func (p *countingPruner) HasPossibleEdges(typesys *typesystem.TypeSystem, target, source *openfgav1.RelationReference) (bool, []*openfgav1.RelationReference, error) {
+	p.calls.Add(1)
+	return p.relationshipGraphPruner.HasPossibleEdges(typesys, target, source)
+}
+
+func TestListUsersRedundantUserFilters(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@group:fga#member",
+		"group:fga#member@user:will",
+	})
+
+	listUsers := func(filters []*openfgav1.UserTypeFilter) (*listUsersResponse, uint32) {
+		pruner := &countingPruner{}
+		resp, err := NewListUsersQuery(ds, WithFairTypeScheduling(true), WithPruner(pruner)).
+			ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: filters,
+			})
+		require.NoError(t, err)
+		return resp, pruner.calls.Load()
+	}
+
+	redundantResp, redundantPrunerCalls := listUsers([]*openfgav1.UserTypeFilter{
+		{Type: "user"},
+		{Type: "group"},
+		{Type: "user"},
+		{Type: "group"},
+		{Type: "group", Relation: "member"},
+		{Type: "group", Relation: "member"},
+	})
+	dedupedResp, dedupedPrunerCalls := listUsers([]*openfgav1.UserTypeFilter{
+		{Type: "user"},
+		{Type: "group"},
+		{Type: "group", Relation: "member"},
+	})
+
+	// a type-only filter and a userset filter on the same type are not merged
+	expected := []string{"user:jon", "user:maria", "user:will", "group:eng#member", "group:fga#member"}
+	require.ElementsMatch(t, expected, userStrings(redundantResp.GetUsers()))
+	require.ElementsMatch(t, expected, userStrings(dedupedResp.GetUsers()))
+	require.Equal(t, dedupedResp.GetMetadata().DatastoreQueryCount, redundantResp.GetMetadata().DatastoreQueryCount)
+	require.Equal(t, dedupedPrunerCalls, redundantPrunerCalls)
+
+	require.Equal(t, []*openfgav1.UserTypeFilter{
+		{Type: "user"},
+		{Type: "group", Relation: "member"},
+		{Type: "group"},
+	}, normalizeUserFilters([]*openfgav1.UserTypeFilter{
+		{Type: "user"},
+		{Type: "group", Relation: "member"},
+		{Type: "user"},
+		{Type: "group"},
+		{Type: "group", Relation: "member"},
+	}))
+}
+
+func TestListUsersConfig_TraversalBudget(t *testing.T) {
+	const numGroups = 100
+	tuples := []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@group:0#member",
+	}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+			fmt.Sprintf("group:%d#member@group:%d#member", i, i+1),
+		)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+
+	t.Run("pathological_request_aborted", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithTraversalBudget(50),
+			WithResolveNodeLimit(1000),
+		).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.ErrorIs(t, err, ErrTraversalBudgetExceeded)
+		require.Nil(t, resp)
+	})
+
+	t.Run("request_within_budget", func(t *testing.T) {
+		for _, budget := range []uint64{0, 1000} {
+			resp, err := NewListUsersQuery(ds,
+				WithTraversalBudget(budget),
+				WithResolveNodeLimit(1000),
+				WithListUsersMaxResults(0),
+			).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+			require.Len(t, resp.GetUsers(), numGroups+2)
+		}
+	})
+
+	t.Run("cost_model", func(t *testing.T) {
+		// document:1#viewer reads 3 tuples and dispatches to group:0#member, which reads 2
+		// tuples and dispatches to group:1#member, which reads 2 tuples and dispatches to
+		// group:2#member, which exceeds the resolution depth
+		req := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}
+		_, err := NewListUsersQuery(ds, WithTraversalBudget(3+1+2+1+2+1), WithResolveNodeLimit(3)).ListUsers(ctx, req)
+		require.ErrorIs(t, err, graph.ErrResolutionDepthExceeded)
+
+		_, err = NewListUsersQuery(ds, WithTraversalBudget(3+1+2+1+2), WithResolveNodeLimit(3)).ListUsers(ctx, req)
+		require.ErrorIs(t, err, ErrTraversalBudgetExceeded)
+	})
+}
+
+func TestListUsersConfig_MaxExpansionSteps(t *testing.T) {
+	// every level doubles the number of rewrites to expand
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [user]
+				define b: [user]
+				define level1: a or b
+				define other1: b or a
+				define level2: level1 and other1
+				define other2: other1 and level1
+				define level3: level2 or other2
+				define other3: other2 or level2
+				define level4: level3 and other3
+				define other4: other3 and level3`, []string{
+		"document:1#a@user:jon",
+		"document:1#b@user:maria",
+	})
+
+	listUsers := func(relation string, opts ...ListUsersQueryOption) ([]string, error) {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return userStrings(resp.GetUsers()), nil
+	}
+
+	t.Run("step_count", func(t *testing.T) {
+		// a relation and each of its operands is a step: level1 is its union, the two computed
+		// usersets and their direct relations, and each level adds itself and twice the previous
+		// level plus the computed usersets that lead to it
+		for relation, steps := range map[string]uint32{
+			"level1": 1 + 2*(1+1),
+			"level2": 1 + 2*(1+5),
+			"level3": 1 + 2*(1+13),
+			"level4": 1 + 2*(1+29),
+		} {
+			users, err := listUsers(relation, WithMaxExpansionSteps(steps))
+			require.NoError(t, err, relation)
+			require.NotEmpty(t, users, relation)
+
+			_, err = listUsers(relation, WithMaxExpansionSteps(steps-1))
+			require.ErrorIs(t, err, ErrMaxExpansionStepsExceeded, relation)
+		}
+	})
+
+	t.Run("combinatorial_request_aborted", func(t *testing.T) {
+		_, err := listUsers("level4", WithMaxExpansionSteps(30))
+		require.ErrorIs(t, err, ErrMaxExpansionStepsExceeded)
+	})
+
+	t.Run("no_limit", func(t *testing.T) {
+		users, err := listUsers("level4", WithMaxExpansionSteps(0))
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, users)
+	})
+}
+
+func TestListUsersConfig_RedundantUsersAnnotation(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [user, user:*]
+		type document
+			relations
+				define viewer: [user, user:*, employee, group#member]`, []string{
+		"document:1#viewer@user:*",
+		"document:1#viewer@user:anne",
+		"document:1#viewer@employee:bob",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:  storeID,
+		Object:   &openfgav1.Object{Type: "document", Id: "1"},
+		Relation: "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{
+			{Type: "user"},
+			{Type: "employee"},
+			{Type: "group", Relation: "member"},
+		},
+	}
+
+	t.Run("wildcard_returned_as_distinct_entry", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithRedundantUsersAnnotation(true)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"user:*",
+			"user:anne",
+			"user:maria",
+			"employee:bob",
+			"group:eng#member",
+		}, userStrings(resp.GetUsers()))
+
+		var wildcards []*openfgav1.TypedWildcard
+		for _, user := range resp.GetUsers() {
+			if wildcard := user.GetWildcard(); wildcard != nil {
+				wildcards = append(wildcards, wildcard)
+			}
+		}
+		require.Len(t, wildcards, 1)
+		require.Equal(t, "user", wildcards[0].GetType())
+
+		// employee:bob has no wildcard of its type and group:eng#member is a userset
+		require.ElementsMatch(t, []string{"user:anne", "user:maria"}, userStrings(resp.GetMetadata().RedundantUsers))
+	})
+
+	t.Run("without_wildcard", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithRedundantUsersAnnotation(true)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "group", Id: "eng"},
+			Relation:    "member",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria"}, userStrings(resp.GetUsers()))
+		require.Empty(t, resp.GetMetadata().RedundantUsers)
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 5)
+		require.Nil(t, resp.GetMetadata().RedundantUsers)
+	})
+}
+
+func TestListUsersConfig_ProfilerLabels(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [group#member] or viewer from parent`, []string{
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:jon",
+		"folder:x#viewer@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	// the reads of the dispatched subproblems run on the goroutines spawned to expand them
+	readLabels := func(enabled bool) map[string]map[string]string {
+		var mu sync.Mutex
+		labelsByRead := make(map[string]map[string]string)
+		resp, err := NewListUsersQuery(ds,
+			WithProfilerLabels(enabled),
+			WithReadInterceptor(func(ctx context.Context, _ string, tk *openfgav1.TupleKey) error {
+				labels := make(map[string]string)
+				pprof.ForLabels(ctx, func(key, value string) bool {
+					labels[key] = value
+					return true
+				})
+
+				mu.Lock()
+				defer mu.Unlock()
+				labelsByRead[tk.GetObject()+"#"+tk.GetRelation()] = labels
+				return nil
+			}),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 2)
+		return labelsByRead
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		labels := readLabels(true)
+		require.Equal(t, map[string]string{
+			"store_id":    storeID,
+			"object_type": "document",
+			"relation":    "viewer",
+			"rewrite":     "direct",
+		}, labels["group:eng#member"])
+		require.Equal(t, map[string]string{
+			"store_id":    storeID,
+			"object_type": "document",
+			"relation":    "viewer",
+			"rewrite":     "tuple_to_userset",
+		}, labels["folder:x#viewer"])
+		require.Equal(t, "union", labels["document:1#parent"]["rewrite"])
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		for read, labels := range readLabels(false) {
+			require.Empty(t, labels, read)
+		}
+	})
+}
+
+func TestListUsersConfig_ReservoirSample(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]
+				define blocked: [user]
+				define can_view: viewer but not blocked`, nil)
+
+	const numUsers = 2000
+	var contextualTuples []*openfgav1.TupleKey
+	for i := 0; i < numUsers; i++ {
+		// half of the users are found both directly and through group:eng
+		contextualTuples = append(contextualTuples, tuple.NewTupleKey("document:1", "viewer", fmt.Sprintf("user:%d", i)))
+		if i%2 == 0 {
+			contextualTuples = append(contextualTuples, tuple.NewTupleKey("group:eng", "member", fmt.Sprintf("user:%d", i)))
+		}
+	}
+	contextualTuples = append(contextualTuples, tuple.NewTupleKey("document:1", "viewer", "group:eng#member"))
+
+	listUsers := func(relation string, contextualTuples []*openfgav1.TupleKey, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:          storeID,
+			Object:           &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:         relation,
+			UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}},
+			ContextualTuples: contextualTuples,
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	sample := listUsers("viewer", contextualTuples, WithReservoirSample(50), WithReservoirSampleSeed(7))
+	require.Len(t, sample, 50)
+	for _, user := range sample {
+		var id int
+		_, err := fmt.Sscanf(user, "user:%d", &id)
+		require.NoError(t, err)
+		require.Less(t, id, numUsers)
+	}
+
+	t.Run("deterministic_given_seed", func(t *testing.T) {
+		for _, breadth := range []uint32{1, 3, 100} {
+			require.Equal(t, sample, listUsers("viewer", contextualTuples,
+				WithReservoirSample(50),
+				WithReservoirSampleSeed(7),
+				WithResolveNodeBreadthLimit(breadth),
+			))
+		}
+		require.NotEqual(t, sample, listUsers("viewer", contextualTuples, WithReservoirSample(50), WithReservoirSampleSeed(8)))
+	})
+
+	t.Run("limits_do_not_apply", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			limit ListUsersQueryOption
+		}{
+			{name: "max_results", limit: WithListUsersMaxResults(10)},
+			{name: "max_response_bytes", limit: WithListUsersMaxResponseBytes(100)},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				require.Equal(t, sample, listUsers("viewer", contextualTuples,
+					WithReservoirSample(50),
+					WithReservoirSampleSeed(7),
+					test.limit,
+				))
+			})
+		}
+	})
+
+	t.Run("sampled_after_exclusion", func(t *testing.T) {
+		// the same users are sampled whether or not they are found under an exclusion
+		require.Equal(t, sample, listUsers("can_view", contextualTuples, WithReservoirSample(50), WithReservoirSampleSeed(7)))
+
+		blockedUser := sample[0]
+		blocked := append(slices.Clone(contextualTuples), tuple.NewTupleKey("document:1", "blocked", blockedUser))
+		sampleWithBlocked := listUsers("can_view", blocked, WithReservoirSample(50), WithReservoirSampleSeed(7))
+		require.Len(t, sampleWithBlocked, 50)
+		require.NotContains(t, sampleWithBlocked, blockedUser)
+		require.Equal(t, sample[1:], sampleWithBlocked[:49])
+	})
+}
+
+func TestListUsersConfig_DirectOnly(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define blocked: [user]
+				define viewer: [user, user:*, group#member] or owner or viewer from parent
+				define can_view: viewer
+				define restricted: [user] but not blocked
+				define shared: [user] and owner`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#owner@user:will",
+		"document:1#parent@folder:x",
+		"document:2#viewer@user:*",
+		"document:1#restricted@user:jon",
+		"document:1#restricted@user:anne",
+		"document:1#blocked@user:jon",
+		"document:1#shared@user:jon",
+		"document:1#shared@user:will",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:poovam",
+	})
+
+	tests := []struct {
+		name           string
+		objectID       string
+		relation       string
+		userFilters    []*openfgav1.UserTypeFilter
+		expected       []string
+		expectedDirect []string
+	}{
+		{
+			name:           "direct_and_inherited_users",
+			objectID:       "1",
+			relation:       "viewer",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:       []string{"user:jon", "user:maria", "user:will", "user:poovam"},
+			expectedDirect: []string{"user:jon"},
+		},
+		{
+			name:           "directly_assigned_userset",
+			objectID:       "1",
+			relation:       "viewer",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			expected:       []string{"group:eng#member"},
+			expectedDirect: []string{"group:eng#member"},
+		},
+		{
+			name:           "directly_assigned_wildcard",
+			objectID:       "2",
+			relation:       "viewer",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:       []string{"user:*"},
+			expectedDirect: []string{"user:*"},
+		},
+		{
+			name:           "relation_not_directly_assignable",
+			objectID:       "1",
+			relation:       "can_view",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:       []string{"user:jon", "user:maria", "user:will", "user:poovam"},
+			expectedDirect: nil,
+		},
+		{
+			name:           "direct_assignments_denied_by_exclusion",
+			objectID:       "1",
+			relation:       "restricted",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:       []string{"user:anne"},
+			expectedDirect: []string{"user:anne"},
+		},
+		{
+			name:           "direct_assignments_denied_by_intersection",
+			objectID:       "1",
+			relation:       "shared",
+			userFilters:    []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:       []string{"user:will"},
+			expectedDirect: []string{"user:will"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listUsers := func(opts ...ListUsersQueryOption) []string {
+				resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+					StoreId:     storeID,
+					Object:      &openfgav1.Object{Type: "document", Id: test.objectID},
+					Relation:    test.relation,
+					UserFilters: test.userFilters,
+				})
+				require.NoError(t, err)
+				return userStrings(resp.GetUsers())
+			}
+
+			require.ElementsMatch(t, test.expected, listUsers())
+			require.ElementsMatch(t, test.expectedDirect, listUsers(WithDirectOnly(true)))
+		})
+	}
+
+	t.Run("no_dispatches", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithDirectOnly(true)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.Zero(t, resp.GetMetadata().DispatchCounter.Load())
+		require.Equal(t, uint32(1), resp.GetMetadata().DatastoreQueryCount)
+	})
+}
+
+func TestListUsersBranchPruning(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [group]
+				define editor: [user]
+				define viewer: [group#member] or editor or owner or viewer from parent`, []string{
+		"document:1#viewer@group:eng#member",
+		"document:1#editor@user:jon",
+		"document:1#owner@group:fga",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:will",
+	})
+
+	tests := []struct {
+		name               string
+		userFilters        []*openfgav1.UserTypeFilter
+		expectedUsers      []string
+		expectedPruned     []string
+		expectedDispatches uint32
+	}{
+		{
+			name:               "only_owner_branch_pruned",
+			userFilters:        []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers:      []string{"user:jon", "user:maria", "user:will"},
+			expectedPruned:     []string{"document#viewer: owner"},
+			expectedDispatches: 3,
+		},
+		{
+			name:          "only_owner_branch_reachable",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "group"}},
+			expectedUsers: []string{"group:fga"},
+			expectedPruned: []string{
+				"document#viewer: [group#member]",
+				"document#viewer: editor",
+				"document#viewer: viewer from parent",
+			},
+			expectedDispatches: 1,
+		},
+		{
+			name:               "no_branch_pruned",
+			userFilters:        []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group"}},
+			expectedUsers:      []string{"user:jon", "user:maria", "user:will", "group:fga"},
+			expectedPruned:     nil,
+			expectedDispatches: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: test.userFilters,
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+			require.Equal(t, test.expectedPruned, resp.GetMetadata().PrunedBranches)
+			require.Equal(t, test.expectedDispatches, resp.GetMetadata().DispatchCounter.Load())
+		})
+	}
+}
+
+func TestListUsersBranchPruningMemoized(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	// the union of each folder of the chain is pruned the same way, so the pruner is called for
+	// each pair of relation references once, however long the chain
+	prunerCalls := func(chainLength int) uint32 {
+		ds := memory.New()
+		t.Cleanup(ds.Close)
+
+		tuples := []string{fmt.Sprintf("folder:%d#viewer@user:jon", chainLength-1)}
+		for f := 1; f < chainLength; f++ {
+			tuples = append(tuples, fmt.Sprintf("folder:%d#parent@folder:%d", f-1, f))
+		}
+		storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+			model
+				schema 1.1
+			type user
+			type group
+				relations
+					define member: [user]
+			type folder
+				relations
+					define parent: [folder]
+					define owner: [group]
+					define viewer: [user] or owner or viewer from parent`, tuples)
+		typesys, err := typesystem.NewAndValidate(context.Background(), model)
+		require.NoError(t, err)
+		ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+		pruner := &countingPruner{}
+		resp, err := NewListUsersQuery(ds, WithPruner(pruner)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "folder", Id: "0"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"user:jon"}, userStrings(resp.GetUsers()))
+		require.Equal(t, []string{"folder#viewer: owner"}, resp.GetMetadata().PrunedBranches)
+		return pruner.calls.Load()
+	}
+
+	require.Equal(t, prunerCalls(2), prunerCalls(15))
+}
+
+func TestListUsersConfig_UsersetsOnly(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type team
+			relations
+				define member: [user]
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user, team#member]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user, group#member]
+				define viewer: [user, user:*, group#member] or editor or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:*",
+		"document:1#viewer@group:eng#member",
+		"document:1#editor@group:admins#member",
+		"document:1#parent@folder:x",
+		"folder:x#viewer@team:a#member",
+		"group:eng#member@group:fga#member",
+		"group:eng#member@user:maria",
+		"group:fga#member@user:will",
+		"group:admins#member@user:poovam",
+		"team:a#member@user:andres",
+	})
+
+	tests := []struct {
+		name        string
+		userFilters []*openfgav1.UserTypeFilter
+		expected    []string
+	}{
+		{
+			name:        "usersets_granting_users",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:    []string{"group:eng#member", "group:admins#member", "team:a#member"},
+		},
+		{
+			name:        "usersets_granting_usersets",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			expected:    []string{"group:eng#member", "group:admins#member"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var readObjects []string
+			resp, err := NewListUsersQuery(ds,
+				WithUsersetsOnly(true),
+				WithReadInterceptor(func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error {
+					mu.Lock()
+					defer mu.Unlock()
+					readObjects = append(readObjects, tupleKey.GetObject())
+					return nil
+				}),
+			).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: test.userFilters,
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+
+			// the members of the usersets are never read
+			for _, object := range readObjects {
+				require.NotContains(t, []string{"group", "team"}, tuple.GetType(object))
+			}
+			require.Equal(t, uint32(len(readObjects)), resp.GetMetadata().DatastoreQueryCount)
+		})
+	}
+}
+
+func TestParseTupleUser(t *testing.T) {
+	tests := []struct {
+		user       string
+		objectType string
+		objectID   string
+		relation   string
+		ok         bool
+	}{
+		{user: "user:jon", objectType: "user", objectID: "jon", ok: true},
+		{user: "user:*", objectType: "user", objectID: "*", ok: true},
+		{user: "group:eng#member", objectType: "group", objectID: "eng", relation: "member", ok: true},
+		{user: "jon"},
+		{user: "*"},
+		{user: ""},
+		{user: ":jon"},
+		{user: "user:"},
+		{user: "user:a:b"},
+		{user: "group:eng#"},
+		{user: "group:#member"},
+		{user: "group:eng#member#owner"},
+		{user: "user:j on"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.user, func(t *testing.T) {
+			objectType, objectID, relation, ok := parseTupleUser(test.user)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.objectType, objectType)
+			require.Equal(t, test.objectID, objectID)
+			require.Equal(t, test.relation, relation)
+		})
+	}
+}
+
+func TestListUsersMalformedStoredUsers(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:will",
+	})
+
+	// the datastore doesn't validate what is written to it
+	err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKey("document:1", "viewer", "user:a:b"),
+		tuple.NewTupleKey("document:1", "viewer", ":jon"),
+		tuple.NewTupleKey("document:1", "viewer", "user:"),
+		tuple.NewTupleKey("document:1", "viewer", "group:#member"),
+		tuple.NewTupleKey("document:1", "viewer", "group:eng#"),
+		tuple.NewTupleKey("document:1", "viewer", "group:eng#member#owner"),
+		tuple.NewTupleKey("document:1", "viewer", "group:eng:x#member"),
+		tuple.NewTupleKey("document:1", "viewer", "user:j on"),
+		tuple.NewTupleKey("document:1", "viewer", "USER:jon"),
+		tuple.NewTupleKey("document:1", "parent", "folder:"),
+		tuple.NewTupleKey("document:1", "parent", "folder:x#viewer"),
+		tuple.NewTupleKey("document:1", "parent", "folder:x:y"),
+	})
+	require.NoError(t, err)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("malformed_users_skipped", func(t *testing.T) {
+		skipped := promtestutil.ToFloat64(invalidTupleUsersSkippedCounter)
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria", "user:will"}, userStrings(resp.GetUsers()))
+		require.Greater(t, promtestutil.ToFloat64(invalidTupleUsersSkippedCounter), skipped)
+	})
+
+	t.Run("malformed_users_not_folded_into_valid_ones", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithCaseInsensitiveMatching(true)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria", "user:will"}, userStrings(resp.GetUsers()))
+	})
+}
+
+func TestListUsersUndefinedTuplesetTypes(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#parent@folder:x",
+		"folder:x#viewer@user:will",
+		// written while the model still defined the team type
+		"document:1#parent@team:x",
+		"document:1#parent@team:y",
+		"team:x#viewer@user:maria",
+	})
+
+	skippedBefore := promtestutil.ToFloat64(invalidTuplesetTuplesSkippedCounter)
+
+	resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"user:jon", "user:will"}, userStrings(resp.GetUsers()))
+	require.InDelta(t, 2, promtestutil.ToFloat64(invalidTuplesetTuplesSkippedCounter)-skippedBefore, 0)
+}
+
+func TestListUsersEmptyTargetRelation(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`, []string{
+		"document:1#viewer@user:jon",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+	requireInvalidArgument := func(t *testing.T, err error) {
+		require.Equal(t, codes.Code(openfgav1.ErrorCode_validation_error), status.Code(err))
+		require.ErrorContains(t, err, "the 'relation' field cannot be empty")
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		requireInvalidArgument(t, ValidateListUsersRequest(ctx, req, typesys))
+	})
+
+	t.Run("list_users", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		requireInvalidArgument(t, err)
+		require.Nil(t, resp)
+	})
+
+	t.Run("list_users_for_object_type", func(t *testing.T) {
+		err := NewListUsersQuery(ds).ListUsersForObjectType(ctx, req, func(ObjectUsers) error {
+			return nil
+		})
+		requireInvalidArgument(t, err)
+	})
+}
+
+func TestListUsersConfig_MaxExpansionDuration(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	const numGroups = 10
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+
+	// each group's members are read one at a time after a delay, so the expansion takes about a second
+	slowReads := WithReadInterceptor(func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error {
+		if tupleKey.GetRelation() != "member" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	})
+
+	listUsers := func(clientDeadline time.Duration, opts ...ListUsersQueryOption) (*listUsersResponse, error) {
+		ctx, cancel := context.WithTimeout(typesystem.ContextWithTypesystem(context.Background(), typesys), clientDeadline)
+		defer cancel()
+		opts = append([]ListUsersQueryOption{slowReads, WithResolveNodeBreadthLimit(1)}, opts...)
+		return NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+	}
+
+	t.Run("server_cap_shorter_than_client_deadline_fails", func(t *testing.T) {
+		start := time.Now()
+		_, err := listUsers(time.Minute, WithMaxExpansionDuration(250*time.Millisecond))
+		require.ErrorIs(t, err, ErrMaxExpansionDurationExceeded)
+		require.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("server_cap_shorter_than_client_deadline_returns_partial_results", func(t *testing.T) {
+		resp, err := listUsers(time.Minute,
+			WithMaxExpansionDuration(250*time.Millisecond),
+			WithMaxExpansionDurationPartialResults(true),
+		)
+		require.NoError(t, err)
+		require.True(t, resp.GetMetadata().ExpansionDurationExceeded)
+		require.NotEmpty(t, resp.GetUsers())
+		require.Less(t, len(resp.GetUsers()), numGroups)
+	})
+
+	t.Run("client_deadline_shorter_than_server_cap", func(t *testing.T) {
+		resp, err := listUsers(250*time.Millisecond, WithMaxExpansionDuration(time.Minute))
+		require.NoError(t, err)
+		require.False(t, resp.GetMetadata().ExpansionDurationExceeded)
+		require.Less(t, len(resp.GetUsers()), numGroups)
+	})
+
+	t.Run("server_cap_not_reached", func(t *testing.T) {
+		resp, err := listUsers(time.Minute, WithMaxExpansionDuration(time.Minute), WithResolveNodeBreadthLimit(numGroups))
+		require.NoError(t, err)
+		require.False(t, resp.GetMetadata().ExpansionDurationExceeded)
+		require.Len(t, resp.GetUsers(), numGroups)
+	})
+}
+
+func TestListUsersConfig_StreamingExclusion(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user]
+				define viewer: [user, group#member] but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:will",
+		"document:1#viewer@group:eng#member",
+		"document:1#blocked@user:will",
+		"document:1#blocked@user:maria",
+		"group:eng#member@user:maria",
+		"group:eng#member@user:poovam",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	relation, err := typesys.GetRelation("document", "viewer")
+	require.NoError(t, err)
+	rewrite := relation.GetRewrite().GetUserset().(*openfgav1.Userset_Difference)
+
+	// expandExclusion expands document:1#viewer, with the read of the group's members blocked
+	// until release is closed
+	expandExclusion := func(release <-chan struct{}, opts ...ListUsersQueryOption) (<-chan foundUser, <-chan expandResponse) {
+		blockGroupRead := WithReadInterceptor(func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error {
+			if tupleKey.GetObject() == "group:eng" {
+				<-release
+			}
+			return nil
+		})
+		l := NewListUsersQuery(ds, append([]ListUsersQueryOption{blockGroupRead}, opts...)...)
+
+		foundUsersCh := make(chan foundUser, 10)
+		respCh := make(chan expandResponse, 1)
+		go func() {
+			req := fromListUsersRequest(&openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			}, nil, nil)
+			respCh <- l.expandExclusion(ctx, req, rewrite, foundUsersCh)
+			close(foundUsersCh)
+		}()
+		return foundUsersCh, respCh
+	}
+
+	// collect returns the users that have the relation once the expansion is complete
+	collect := func(foundUsersCh <-chan foundUser, respCh <-chan expandResponse) []string {
+		users := map[string]userRelationshipStatus{}
+		for fu := range foundUsersCh {
+			users[tuple.UserProtoToString(fu.user)] = fu.relationshipStatus
+		}
+		require.NoError(t, (<-respCh).err)
+
+		var hasRelationship []string
+		for user, status := range users {
+			if status == HasRelationship {
+				hasRelationship = append(hasRelationship, user)
+			}
+		}
+		return hasRelationship
+	}
+
+	t.Run("base_users_sent_before_the_base_is_fully_expanded", func(t *testing.T) {
+		release := make(chan struct{})
+		foundUsersCh, respCh := expandExclusion(release, WithStreamingExclusion(10))
+
+		// jon is confirmed while the group's members are still being read
+	WaitForJon:
+		for {
+			select {
+			case fu := <-foundUsersCh:
+				if tuple.UserProtoToString(fu.user) == "user:jon" {
+					require.Equal(t, HasRelationship, fu.relationshipStatus)
+					break WaitForJon
+				}
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "expected jon before the base was fully expanded")
+			}
+		}
+
+		close(release)
+		// jon was already received
+		require.ElementsMatch(t, []string{"user:poovam"}, collect(foundUsersCh, respCh))
+	})
+
+	t.Run("base_buffered_by_default", func(t *testing.T) {
+		release := make(chan struct{})
+		foundUsersCh, respCh := expandExclusion(release)
+
+		select {
+		case fu := <-foundUsersCh:
+			require.FailNow(t, "unexpected user before the base was fully expanded", tuple.UserProtoToString(fu.user))
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		require.ElementsMatch(t, []string{"user:jon", "user:poovam"}, collect(foundUsersCh, respCh))
+	})
+
+	t.Run("base_buffered_when_subtract_exceeds_threshold", func(t *testing.T) {
+		release := make(chan struct{})
+		foundUsersCh, respCh := expandExclusion(release, WithStreamingExclusion(1))
+
+		select {
+		case fu := <-foundUsersCh:
+			require.FailNow(t, "unexpected user before the base was fully expanded", tuple.UserProtoToString(fu.user))
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		require.ElementsMatch(t, []string{"user:jon", "user:poovam"}, collect(foundUsersCh, respCh))
+	})
+}
+
+func TestListUsersConfig_MaxSubtractSetSize(t *testing.T) {
+	tuples := []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#blocked@group:banned#member",
+	}
+	for i := 0; i < 10; i++ {
+		tuples = append(tuples, fmt.Sprintf("group:banned#member@user:%d", i))
+	}
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user, group#member]
+				define viewer: [user] but not blocked`, tuples)
+
+	listUsers := func(opts ...ListUsersQueryOption) (*listUsersResponse, error) {
+		return NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+	}
+
+	t.Run("no_limit_by_default", func(t *testing.T) {
+		resp, err := listUsers()
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("subtract_within_limit", func(t *testing.T) {
+		resp, err := listUsers(WithMaxSubtractSetSize(10))
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("subtract_over_limit_fails", func(t *testing.T) {
+		_, err := listUsers(WithMaxSubtractSetSize(9))
+		require.ErrorIs(t, err, ErrMaxSubtractSetSizeExceeded)
+	})
+
+	t.Run("subtract_over_limit_fails_when_streaming", func(t *testing.T) {
+		_, err := listUsers(WithMaxSubtractSetSize(9), WithStreamingExclusion(math.MaxUint32))
+		require.ErrorIs(t, err, ErrMaxSubtractSetSizeExceeded)
+	})
+}
+
+func TestListUsersSelfReferentialComputedUserset(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID := ulid.Make().String()
+	err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKey("document:1", "y", "user:jon"),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		model    string
+		expected []string
+	}{
+		{
+			name: "computed_userset_of_itself",
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define x: x`,
+			expected: []string{},
+		},
+		{
+			name: "union_with_itself",
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define y: [user]
+						define x: y or x`,
+			expected: []string{"user:jon"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the model validation rejects these models, but ListUsers must still terminate
+			// when given one
+			model := testutils.MustTransformDSLToProtoWithID(test.model)
+			_, err := typesystem.NewAndValidate(context.Background(), model)
+			require.Error(t, err)
+			typesys := typesystem.New(model)
+			ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+			req := &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "x",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			}
+
+			// the relation re-entered through the computed userset is detected as a cycle, before
+			// the resolution depth limit is reached
+			foundUsersCh := make(chan foundUser, 10)
+			resp := NewListUsersQuery(ds, WithResolveNodeLimit(math.MaxUint32)).expand(ctx, fromListUsersRequest(req, nil, nil), foundUsersCh)
+			close(foundUsersCh)
+			require.NoError(t, resp.err)
+			found := []string{}
+			for fu := range foundUsersCh {
+				found = append(found, tuple.UserProtoToString(fu.user))
+			}
+			require.ElementsMatch(t, test.expected, found)
+
+			listUsersResp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(listUsersResp.GetUsers()))
+		})
+	}
+}
+
+func TestListUsersConfig_AdditionalTupleFilters(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"document:1#parent@folder:deprecated",
+		"group:eng#member@user:will",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:poovam",
+		"folder:deprecated#viewer@user:andres",
+	})
+
+	listUsers := func(opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			ContextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:contextual-maria"),
+			},
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	dropUser := func(user string) storage.TupleKeyFilterFunc {
+		return func(tupleKey *openfgav1.TupleKey) bool {
+			return tupleKey.GetUser() != user
+		}
+	}
+
+	t.Run("no_additional_filters", func(t *testing.T) {
+		require.ElementsMatch(t,
+			[]string{"user:jon", "user:maria", "user:will", "user:poovam", "user:andres", "user:contextual-maria"},
+			listUsers(),
+		)
+	})
 
-	typesys, err := typesystem.NewAndValidate(context.Background(), model)
-	require.NoError(t, err)
-	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
-	resp, err := NewListUsersQuery(mockDatastore).ListUsers(ctx, &openfgav1.ListUsersRequest{
-		StoreId:     store,
-		Object:      &openfgav1.Object{Type: "document", Id: "1"},
-		Relation:    "viewer",
-		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	t.Run("users_dropped", func(t *testing.T) {
+		// maria is dropped wherever she is assigned, including through the group
+		require.ElementsMatch(t,
+			[]string{"user:jon", "user:will", "user:poovam", "user:andres"},
+			listUsers(WithAdditionalTupleFilters(dropUser("user:maria"), dropUser("user:contextual-maria"))),
+		)
 	})
 
-	require.ErrorContains(t, err, "simulated errors")
-	require.Nil(t, resp)
+	t.Run("tupleset_tuples_dropped", func(t *testing.T) {
+		require.ElementsMatch(t,
+			[]string{"user:jon", "user:maria", "user:will", "user:poovam", "user:contextual-maria"},
+			listUsers(WithAdditionalTupleFilters(dropUser("folder:deprecated"))),
+		)
+	})
+
+	t.Run("filters_accumulate", func(t *testing.T) {
+		require.ElementsMatch(t,
+			[]string{"user:jon", "user:maria", "user:will", "user:contextual-maria"},
+			listUsers(
+				WithAdditionalTupleFilters(dropUser("folder:deprecated")),
+				WithAdditionalTupleFilters(dropUser("user:poovam")),
+			),
+		)
+	})
 }
 
 func TestListUsersDatastoreQueryCountAndDispatchCount(t *testing.T) {
@@ -3499,6 +6220,69 @@ func TestListUsersConfig_MaxResults(t *testing.T) {
 	}
 }
 
+func TestListUsersConfig_MaxResponseBytes(t *testing.T) {
+	largeID := func(prefix string) string {
+		return prefix + strings.Repeat("x", 200)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type repo
+			relations
+				define admin: [user]`, []string{
+		"repo:target#admin@user:" + largeID("1"),
+		"repo:target#admin@user:" + largeID("2"),
+		"repo:target#admin@user:" + largeID("3"),
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "repo", Id: "target"},
+		Relation:    "admin",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+	userSize := uint64(proto.Size(tuple.StringToUserProto("user:" + largeID("1"))))
+
+	t.Run("byte_cap_trips_before_count_cap", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithListUsersMaxResults(100),
+			WithListUsersMaxResponseBytes(2*userSize+userSize/2),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 2)
+		require.True(t, resp.GetMetadata().WasTruncated)
+	})
+
+	t.Run("byte_cap_smaller_than_a_single_user", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithListUsersMaxResponseBytes(userSize-1),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+		require.True(t, resp.GetMetadata().WasTruncated)
+	})
+
+	t.Run("byte_cap_not_reached", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithListUsersMaxResponseBytes(3*userSize),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 3)
+		require.False(t, resp.GetMetadata().WasTruncated)
+	})
+
+	t.Run("zero_byte_cap_is_unbounded", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds,
+			WithListUsersMaxResponseBytes(0),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 3)
+		require.False(t, resp.GetMetadata().WasTruncated)
+	})
+}
+
 func TestListUsersConfig_Deadline(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
@@ -3734,6 +6518,307 @@ func TestListUsersConfig_MaxConcurrency(t *testing.T) {
 	}
 }
 
+func TestListUsersConfig_MaxConcurrencyReusedQuery(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type repo
+			relations
+				define admin: [user]`, []string{"repo:target#admin@user:1"})
+
+	// the reads are bounded per listing, without wrapping the datastore of the query again at
+	// each listing
+	q := NewListUsersQuery(ds, WithListUsersMaxConcurrentReads(1))
+	for i := 0; i < 3; i++ {
+		res, err := q.ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "repo", Id: "target"},
+			Relation:    "admin",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"user:1"}, userStrings(res.GetUsers()))
+		require.Same(t, ds, q.ds)
+	}
+}
+
+func TestListUsersConfig_FairTypeScheduling(t *testing.T) {
+	const numFolders = 6
+	const breadthLimit = 2
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define viewer: [user, group, folder#viewer]`, []string{
+		"document:1#viewer@group:x",
+	})
+
+	// contextual tuples are returned before the stored ones, so every expensive
+	// 'user' branch is found before the single 'group' result
+	var contextualTuples []*openfgav1.TupleKey
+	for i := 0; i < numFolders; i++ {
+		contextualTuples = append(contextualTuples,
+			tuple.NewTupleKey("document:1", "viewer", fmt.Sprintf("folder:%d#viewer", i)),
+			tuple.NewTupleKey(fmt.Sprintf("folder:%d", i), "viewer", fmt.Sprintf("user:%d", i)),
+		)
+	}
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:          storeID,
+		Object:           &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:         "viewer",
+		UserFilters:      []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group"}},
+		ContextualTuples: contextualTuples,
+	}
+
+	// foldersReadBeforeGroup expands the request with the reads of the folders held until either
+	// the group is found or as many of them as the breadth limit are held, which is when nothing
+	// else can be expanded without fair scheduling. It returns the number of folder reads made
+	// before the group was found.
+	foldersReadBeforeGroup := func(t *testing.T, fair bool) (int, []string) {
+		var mu sync.Mutex
+		heldReads := 0
+		release := make(chan struct{})
+		releaseOnce := sync.OnceFunc(func() { close(release) })
+		var foldersRead atomic.Int32
+
+		interceptor := func(ctx context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+			if tuple.GetType(tupleKey.GetObject()) != "folder" {
+				return nil
+			}
+			mu.Lock()
+			heldReads++
+			if heldReads >= breadthLimit {
+				releaseOnce()
+			}
+			mu.Unlock()
+
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			foldersRead.Add(1)
+			return nil
+		}
+
+		l := NewListUsersQuery(
+			storagewrappers.NewCombinedTupleReader(ds, contextualTuples),
+			WithResolveNodeBreadthLimit(breadthLimit),
+			WithFairTypeScheduling(fair),
+			WithReadInterceptor(interceptor),
+		)
+
+		foundUsersCh := make(chan foundUser)
+		done := make(chan expandResponse, 1)
+		go func() {
+			done <- l.expandRoot(ctx, fromListUsersRequest(req, nil, nil), foundUsersCh)
+			close(foundUsersCh)
+		}()
+
+		foldersReadBeforeGroup := -1
+		var users []string
+		for fu := range foundUsersCh {
+			user := tuple.UserProtoToString(fu.user)
+			if user == "group:x" {
+				foldersReadBeforeGroup = int(foldersRead.Load())
+				releaseOnce()
+			}
+			users = append(users, user)
+		}
+		require.NoError(t, (<-done).err)
+		return foldersReadBeforeGroup, users
+	}
+
+	expectedUsers := []string{"group:x"}
+	for i := 0; i < numFolders; i++ {
+		expectedUsers = append(expectedUsers, fmt.Sprintf("user:%d", i))
+	}
+
+	unfair, unfairUsers := foldersReadBeforeGroup(t, false)
+	fair, fairUsers := foldersReadBeforeGroup(t, true)
+
+	require.ElementsMatch(t, expectedUsers, unfairUsers)
+	require.ElementsMatch(t, expectedUsers, fairUsers)
+
+	// without fair scheduling the group waits on the branches of the users taking up the breadth
+	require.GreaterOrEqual(t, unfair, breadthLimit)
+	require.Zero(t, fair)
+
+	t.Run("reachability_memoized", func(t *testing.T) {
+		// every folder is dispatched, for the user filter only, with the same reachability
+		pruner := &countingPruner{}
+		resp, err := NewListUsersQuery(ds, WithFairTypeScheduling(true), WithPruner(pruner)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, expectedUsers, userStrings(resp.GetUsers()))
+		require.Less(t, pruner.calls.Load(), uint32(numFolders))
+	})
+
+	t.Run("same_results_as_list_users", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithFairTypeScheduling(true)).ListUsers(ctx, req)
+		require.NoError(t, err)
+
+		actualUsers := make([]string, 0, len(resp.GetUsers()))
+		for _, u := range resp.GetUsers() {
+			actualUsers = append(actualUsers, tuple.UserProtoToString(u))
+		}
+		require.ElementsMatch(t, expectedUsers, actualUsers)
+	})
+}
+
+func TestListUsersConfig_StopOnWildcard(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	listUsers := func(t *testing.T, l *listUsersQuery, storeID string, model *openfgav1.AuthorizationModel, req *openfgav1.ListUsersRequest) []string {
+		typesys, err := typesystem.NewAndValidate(context.Background(), model)
+		require.NoError(t, err)
+		ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+		req.StoreId = storeID
+		resp, err := l.ListUsers(ctx, req)
+		require.NoError(t, err)
+
+		actualUsers := make([]string, 0, len(resp.GetUsers()))
+		for _, u := range resp.GetUsers() {
+			actualUsers = append(actualUsers, tuple.UserProtoToString(u))
+		}
+		return actualUsers
+	}
+
+	t.Run("stops_expansion_once_wildcard_is_found", func(t *testing.T) {
+		const readDelay = 50 * time.Millisecond
+
+		var tuples []string
+		for i := 0; i < 5; i++ {
+			tuples = append(tuples,
+				fmt.Sprintf("document:1#viewer@folder:%d#viewer", i),
+				fmt.Sprintf("folder:%d#viewer@user:%d", i, i),
+			)
+		}
+		storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+			model
+				schema 1.1
+			type user
+			type folder
+				relations
+					define viewer: [user]
+			type document
+				relations
+					define viewer: [user, user:*, folder#viewer]`, tuples)
+
+		req := &openfgav1.ListUsersRequest{
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			// contextual tuples are returned before the stored ones
+			ContextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:*"),
+			},
+		}
+
+		start := time.Now()
+		actualUsers := listUsers(t, NewListUsersQuery(
+			mocks.NewMockSlowDataStorage(ds, readDelay),
+			WithResolveNodeBreadthLimit(1),
+			WithStopOnWildcard(true),
+		), storeID, model, req)
+		// the slow datastore doesn't honor cancellation, so reads in flight when
+		// the wildcard is found still complete
+		require.Less(t, time.Since(start), 4*readDelay)
+		require.Contains(t, actualUsers, "user:*")
+		require.Less(t, len(actualUsers), 6)
+
+		start = time.Now()
+		actualUsers = listUsers(t, NewListUsersQuery(
+			mocks.NewMockSlowDataStorage(ds, readDelay),
+			WithResolveNodeBreadthLimit(1),
+		), storeID, model, req)
+		require.GreaterOrEqual(t, time.Since(start), 6*readDelay)
+		require.ElementsMatch(t, []string{"user:*", "user:0", "user:1", "user:2", "user:3", "user:4"}, actualUsers)
+	})
+
+	t.Run("does_not_stop_on_wildcard_in_unsatisfied_intersection", func(t *testing.T) {
+		storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define allowed: [user]
+					define viewer: [user, user:*] and allowed`, []string{
+			"document:1#viewer@user:*",
+			"document:1#allowed@user:jon",
+			"document:1#allowed@user:maria",
+		})
+
+		actualUsers := listUsers(t, NewListUsersQuery(ds, WithStopOnWildcard(true)), storeID, model, &openfgav1.ListUsersRequest{
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, actualUsers)
+	})
+
+	t.Run("does_not_stop_on_subtracted_wildcard", func(t *testing.T) {
+		storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+			model
+				schema 1.1
+			type user
+			type document
+				relations
+					define blocked: [user, user:*]
+					define viewer: [user, user:*] but not blocked`, []string{
+			"document:1#viewer@user:*",
+			"document:1#viewer@user:jon",
+			"document:1#blocked@user:*",
+		})
+
+		actualUsers := listUsers(t, NewListUsersQuery(ds, WithStopOnWildcard(true)), storeID, model, &openfgav1.ListUsersRequest{
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.Empty(t, actualUsers)
+	})
+
+	t.Run("stops_per_filter_type", func(t *testing.T) {
+		storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+			model
+				schema 1.1
+			type user
+			type group
+			type document
+				relations
+					define viewer: [user, user:*, group]`, []string{
+			"document:1#viewer@user:*",
+			"document:1#viewer@group:eng",
+			"document:1#viewer@group:fga",
+		})
+
+		actualUsers := listUsers(t, NewListUsersQuery(ds, WithStopOnWildcard(true)), storeID, model, &openfgav1.ListUsersRequest{
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group"}},
+		})
+		require.Contains(t, actualUsers, "user:*")
+		require.Contains(t, actualUsers, "group:eng")
+		require.Contains(t, actualUsers, "group:fga")
+	})
+}
+
 func TestListUsers_ExpandExclusionHandler(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
@@ -3947,3 +7032,142 @@ func TestListUsers_CorrectContext(t *testing.T) {
 		require.ErrorContains(t, err, "typesystem missing in context")
 	})
 }
+
+type regionCtxKey struct{}
+
+// regionRecordingDatastore records the region that each read finds in its context, like a
+// datastore that routes reads to a replica by region would.
+type regionRecordingDatastore struct {
+	storage.OpenFGADatastore
+
+	mu      sync.Mutex
+	regions []any
+}
+
+func (r *regionRecordingDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	r.mu.Lock()
+	r.regions = append(r.regions, ctx.Value(regionCtxKey{}))
+	r.mu.Unlock()
+	return r.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+}
+
+func TestListUsersContextValuesReachReads(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID, model := storagetest.BootstrapFGAStore(t, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user]
+				define allowed: [user, group#member]
+				define editor: [user, group#member] or viewer from parent
+				define viewer: (editor and allowed) but not blocked`, []string{
+		"document:1#parent@folder:x",
+		"document:1#editor@user:jon",
+		"document:1#allowed@group:eng#member",
+		"document:1#blocked@user:will",
+		"folder:x#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@group:fga#member",
+		"group:fga#member@user:will",
+	})
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+	ctx = context.WithValue(ctx, regionCtxKey{}, "eu-west")
+
+	tests := map[string][]ListUsersQueryOption{
+		"default":                {},
+		"deadline":               {WithListUsersDeadline(time.Minute)},
+		"bounded_reads":          {WithListUsersMaxConcurrentReads(1)},
+		"fair_type_scheduling":   {WithFairTypeScheduling(true)},
+		"profiler_labels":        {WithProfilerLabels(true)},
+		"coarse_tracing":         {WithTraceSampling(0)},
+		"result_predicate":       {WithResultPredicate(func(context.Context, *openfgav1.User) (bool, error) { return true, nil })},
+		"dispatch_throttling":    {WithDispatchThrottlerConfig(threshold.Config{Enabled: true, Throttler: throttler.NewNoopThrottler(), Threshold: 1, MaxThreshold: 1})},
+		"concurrency_throttling": {WithResolveNodeBreadthLimit(1)},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := &regionRecordingDatastore{OpenFGADatastore: ds}
+			resp, err := NewListUsersQuery(recorder, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"user:maria"}, userStrings(resp.GetUsers()))
+
+			// the direct, userset, tuple to userset, intersection and exclusion reads
+			require.Len(t, recorder.regions, int(resp.GetMetadata().DatastoreQueryCount))
+			require.GreaterOrEqual(t, len(recorder.regions), 8)
+			for _, region := range recorder.regions {
+				require.Equal(t, "eu-west", region)
+			}
+		})
+	}
+}
+
+// BenchmarkListUsersSparseStore lists the users of objects in a store where most of them have no
+// tuples for the relation.
+func BenchmarkListUsersSparseStore(b *testing.B) {
+	ds := memory.New()
+	b.Cleanup(ds.Close)
+
+	const numObjects = 1000
+	tuples := []string{}
+	for i := 0; i < numObjects; i += 100 {
+		tuples = append(tuples,
+			fmt.Sprintf("document:%d#viewer@group:%d#member", i, i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+
+	storeID, model := storagetest.BootstrapFGAStore(b, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(b, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: strconv.Itoa(i % numObjects)},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,70 @@
+package listusers
+
+import (
+	"sync/atomic"
+)
+
+// estimatedUserEntryBytes is a rough estimate of the memory held for each user in a map of the
+// users found, counting the map entry, the key's string header and bytes, and the value.
+const estimatedUserEntryBytes = 128
+
+// memoryEstimateSampleInterval is how many unique users are collected between two samples of the
+// size of the set deduplicating them, so that the estimate costs next to nothing per user.
+const memoryEstimateSampleInterval = 64
+
+// memoryEstimate tracks a rough estimate of the memory held by the users of a request at once,
+// which is the set deduplicating the users collected plus the maps of users the intersections and
+// exclusions hold while they are evaluated, and the peak of it. The estimate is only updated
+// when the size of the set is sampled and when the maps are complete, so it may miss short-lived
+// spikes. It is shared by all the clones of a request, and its methods do nothing on a nil
+// memoryEstimate.
+type memoryEstimate struct {
+	foundUsers atomic.Int64 // the bytes of the deduplicated users at the last sample
+	held       atomic.Int64 // the bytes of the intersection and exclusion maps held
+	peak       atomic.Int64
+}
+
+func newMemoryEstimate() *memoryEstimate {
+	return &memoryEstimate{}
+}
+
+// sampleFoundUsers records that count unique users are collected.
+func (m *memoryEstimate) sampleFoundUsers(count int) {
+	if m == nil {
+		return
+	}
+	m.foundUsers.Store(int64(count) * estimatedUserEntryBytes)
+	m.observe()
+}
+
+// hold records that a map of the given number of users is held until the returned function is
+// called.
+func (m *memoryEstimate) hold(users int) (release func()) {
+	if m == nil || users == 0 {
+		return func() {}
+	}
+	bytes := int64(users) * estimatedUserEntryBytes
+	m.held.Add(bytes)
+	m.observe()
+	return func() {
+		m.held.Add(-bytes)
+	}
+}
+
+func (m *memoryEstimate) observe() {
+	current := m.foundUsers.Load() + m.held.Load()
+	for {
+		peak := m.peak.Load()
+		if current <= peak || m.peak.CompareAndSwap(peak, current) {
+			return
+		}
+	}
+}
+
+// peakBytes returns the peak of the estimate so far.
+func (m *memoryEstimate) peakBytes() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.peak.Load()
+}
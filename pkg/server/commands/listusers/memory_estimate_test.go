@@ -0,0 +1,73 @@
+package listusers
+
+import (
+	"strconv"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersPeakMemoryEstimate(t *testing.T) {
+	// document:1 has 1000 viewers, and document:2 has 500 users of each operand of its
+	// intersection, 250 of which are in both
+	var tuples []string
+	for i := 0; i < 1000; i++ {
+		tuples = append(tuples, "document:1#viewer@user:"+strconv.Itoa(i))
+	}
+	for i := 0; i < 500; i++ {
+		tuples = append(tuples,
+			"document:2#allowed@user:"+strconv.Itoa(i),
+			"document:2#viewer@user:"+strconv.Itoa(i+250),
+		)
+	}
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define allowed: [user]
+				define viewer: [user]
+				define allowed_viewer: viewer and allowed`, tuples)
+
+	listUsers := func(t *testing.T, objectID, relation string) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: objectID},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("deduplicated_users", func(t *testing.T) {
+		resp := listUsers(t, "1", "viewer")
+		require.Len(t, resp.GetUsers(), 1000)
+		require.Equal(t, int64(1000*estimatedUserEntryBytes), resp.Metadata.PeakMemoryEstimateBytes)
+	})
+
+	t.Run("intersection_maps", func(t *testing.T) {
+		resp := listUsers(t, "2", "allowed_viewer")
+		require.Len(t, resp.GetUsers(), 250)
+		// the intersection holds the 750 users of its operands while the 250 users returned are
+		// collected
+		require.GreaterOrEqual(t, resp.Metadata.PeakMemoryEstimateBytes, int64(750*estimatedUserEntryBytes))
+		require.LessOrEqual(t, resp.Metadata.PeakMemoryEstimateBytes, int64(1000*estimatedUserEntryBytes))
+	})
+
+	t.Run("held_maps_released", func(t *testing.T) {
+		m := newMemoryEstimate()
+		release := m.hold(10)
+		m.sampleFoundUsers(5)
+		release()
+		m.sampleFoundUsers(8)
+		require.Equal(t, int64(15*estimatedUserEntryBytes), m.peakBytes())
+
+		var nilEstimate *memoryEstimate
+		nilEstimate.hold(10)()
+		nilEstimate.sampleFoundUsers(10)
+		require.Zero(t, nilEstimate.peakBytes())
+	})
+}
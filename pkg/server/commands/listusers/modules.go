@@ -0,0 +1,29 @@
+package listusers
+
+import (
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// relationModule returns the module that defines the relation of the object type: the module
+// that extended the type with it, or else the module of the type itself. It returns an empty
+// string for relations of models that don't use modules.
+func relationModule(typesys *typesystem.TypeSystem, objectType, relation string) string {
+	typeDefinition, ok := typesys.GetTypeDefinition(objectType)
+	if !ok {
+		return ""
+	}
+	if module := typeDefinition.GetMetadata().GetRelations()[relation].GetModule(); module != "" {
+		return module
+	}
+	return typeDefinition.GetMetadata().GetModule()
+}
+
+// traversesRelation reports whether the expansion may follow an edge to the relation of the
+// object type, which is always the case unless it is scoped to modules with WithModules.
+func (l *listUsersQuery) traversesRelation(typesys *typesystem.TypeSystem, objectType, relation string) bool {
+	if len(l.modules) == 0 {
+		return true
+	}
+	_, ok := l.modules[relationModule(typesys, objectType, relation)]
+	return ok
+}
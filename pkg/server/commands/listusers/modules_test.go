@@ -0,0 +1,113 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/language/pkg/go/transformer"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersConfig_Modules(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	model, err := transformer.TransformModuleFilesToModel([]transformer.ModuleFile{
+		{
+			Name: "core.fga",
+			Contents: `module core
+type user
+type organization
+  relations
+    define member: [user]
+type folder
+  relations
+    define viewer: [user]`,
+		},
+		{
+			Name: "docs.fga",
+			Contents: `module docs
+extend type organization
+  relations
+    define reader: [user] or member
+type document
+  relations
+    define org: [organization]
+    define parent: [folder]
+    define owner: [user]
+    define viewer: [user] or owner or reader from org or member from org or viewer from parent`,
+		},
+	}, typesystem.SchemaVersion1_2)
+	require.NoError(t, err)
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	storeID := ulid.Make().String()
+	model.Id = ulid.Make().String()
+	require.NoError(t, ds.WriteAuthorizationModel(context.Background(), storeID, model))
+	require.NoError(t, ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+		tuple.NewTupleKey("document:1", "owner", "user:maria"),
+		tuple.NewTupleKey("document:1", "org", "organization:acme"),
+		tuple.NewTupleKey("document:1", "parent", "folder:x"),
+		tuple.NewTupleKey("organization:acme", "reader", "user:will"),
+		tuple.NewTupleKey("organization:acme", "member", "user:poovam"),
+		tuple.NewTupleKey("folder:x", "viewer", "user:andres"),
+	}))
+
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	require.Equal(t, "core", relationModule(typesys, "organization", "member"))
+	require.Equal(t, "docs", relationModule(typesys, "organization", "reader"))
+	require.Equal(t, "docs", relationModule(typesys, "document", "viewer"))
+
+	tests := []struct {
+		name     string
+		modules  []string
+		expected []string
+	}{
+		{
+			name:     "all_modules_by_default",
+			expected: []string{"user:jon", "user:maria", "user:will", "user:poovam", "user:andres"},
+		},
+		{
+			name:     "cross_module_edges_skipped",
+			modules:  []string{"docs"},
+			expected: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:     "edges_within_any_of_the_modules_followed",
+			modules:  []string{"docs", "core"},
+			expected: []string{"user:jon", "user:maria", "user:will", "user:poovam", "user:andres"},
+		},
+		{
+			name:     "requested_relation_expanded_outside_of_the_modules",
+			modules:  []string{"core"},
+			expected: []string{"user:jon"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, WithModules(test.modules...)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersNestedGroupUsersets(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	tests := []struct {
+		name     string
+		model    string
+		tuples   []string
+		object   string
+		relation string
+		expected []string
+	}{
+		{
+			name: "three_levels",
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define member: [user, group#member]
+				type document
+					relations
+						define viewer: [group#member]`,
+			tuples: []string{
+				"document:1#viewer@group:a#member",
+				"group:a#member@group:b#member",
+				"group:b#member@group:c#member",
+				"group:c#member@user:jon",
+			},
+			object:   "document:1",
+			relation: "viewer",
+			expected: []string{"group:a#member", "group:b#member", "group:c#member"},
+		},
+		{
+			name: "the_object_itself",
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define member: [user, group#member]`,
+			tuples: []string{
+				"group:a#member@group:b#member",
+				"group:b#member@group:c#member",
+				"group:c#member@user:jon",
+			},
+			object:   "group:a",
+			relation: "member",
+			expected: []string{"group:a#member", "group:b#member", "group:c#member"},
+		},
+		{
+			name: "through_a_computed_relation",
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define owner: [user, group#member]
+						define member: [user, group#member] or owner`,
+			tuples: []string{
+				"group:a#owner@group:b#member",
+				"group:b#member@group:c#member",
+				"group:c#owner@group:d#member",
+				"group:d#member@user:jon",
+			},
+			object:   "group:a",
+			relation: "member",
+			expected: []string{"group:a#member", "group:b#member", "group:c#member", "group:d#member"},
+		},
+		{
+			name: "through_parent_groups",
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define parent: [group]
+						define member: [user] or member from parent`,
+			tuples: []string{
+				"group:a#parent@group:b",
+				"group:b#parent@group:c",
+				"group:c#member@user:jon",
+			},
+			object:   "group:a",
+			relation: "member",
+			expected: []string{"group:a#member", "group:b#member", "group:c#member"},
+		},
+		{
+			name: "cycle",
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define member: [user, group#member]`,
+			tuples: []string{
+				"group:a#member@group:b#member",
+				"group:b#member@group:c#member",
+				"group:c#member@group:a#member",
+			},
+			object:   "group:a",
+			relation: "member",
+			expected: []string{"group:a#member", "group:b#member", "group:c#member"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := memory.New()
+			t.Cleanup(ds.Close)
+
+			storeID, model := storagetest.BootstrapFGAStore(t, ds, test.model, test.tuples)
+			typesys, err := typesystem.NewAndValidate(context.Background(), model)
+			require.NoError(t, err)
+			ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+			object := tuple.StringToUserProto(test.object).GetObject()
+			for _, opts := range [][]ListUsersQueryOption{
+				nil,
+				{WithFairTypeScheduling(true)},
+				{WithTypeGroupedStreaming(true)},
+			} {
+				resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+					StoreId:     storeID,
+					Object:      object,
+					Relation:    test.relation,
+					UserFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+				})
+				require.NoError(t, err)
+				require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package listusers
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// startNoProgressWatchdog cancels the expansion with ErrNoProgress once neither foundUsers nor
+// datastoreQueryCount change over the no progress timeout, until the returned function is called,
+// which waits for the watchdog to stop. See WithNoProgressTimeout.
+func (l *listUsersQuery) startNoProgressWatchdog(
+	cancel func(error),
+	foundUsers *atomic.Uint64,
+	datastoreQueryCount *atomic.Uint32,
+) func() {
+	if l.noProgressTimeout == 0 {
+		return func() {}
+	}
+
+	lastFoundUsers, lastQueries := foundUsers.Load(), datastoreQueryCount.Load()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			timer := l.clock.NewTimer(l.noProgressTimeout)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			found, queries := foundUsers.Load(), datastoreQueryCount.Load()
+			if found == lastFoundUsers && queries == lastQueries {
+				cancel(ErrNoProgress)
+				return
+			}
+			lastFoundUsers, lastQueries = found, queries
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,128 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_NoProgressTimeout(t *testing.T) {
+	const numGroups = 3
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [group#member]`, tuples)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	type result struct {
+		resp *listUsersResponse
+		err  error
+	}
+
+	// the reads of the groups are held until released, once the read of the document is done
+	heldReads := func(groupReads chan<- struct{}, release <-chan struct{}) ReadInterceptor {
+		return func(ctx context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+			if tupleKey.GetObject() == "document:1" {
+				return nil
+			}
+			groupReads <- struct{}{}
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	t.Run("stalled_datastore_aborted", func(t *testing.T) {
+		clock := newFakeClock()
+		groupReads := make(chan struct{}, numGroups)
+		done := make(chan result, 1)
+		go func() {
+			resp, err := NewListUsersQuery(ds,
+				WithClock(clock),
+				WithReadInterceptor(heldReads(groupReads, nil)),
+				WithNoProgressTimeout(time.Second),
+			).ListUsers(ctx, req)
+			done <- result{resp, err}
+		}()
+
+		clock.waitForTimer(t)
+		<-groupReads
+		// the read of the document is progress
+		clock.Advance(time.Second)
+
+		clock.waitForTimer(t)
+		clock.Advance(time.Second)
+
+		res := <-done
+		require.ErrorIs(t, res.err, ErrNoProgress)
+		require.Nil(t, res.resp)
+	})
+
+	t.Run("slow_datastore_making_progress", func(t *testing.T) {
+		clock := newFakeClock()
+		groupReads := make(chan struct{}, numGroups)
+		release := make(chan struct{})
+		done := make(chan result, 1)
+		go func() {
+			resp, err := NewListUsersQuery(ds,
+				WithClock(clock),
+				WithReadInterceptor(heldReads(groupReads, release)),
+				WithNoProgressTimeout(time.Second),
+				// the groups are read one after the other
+				WithResolveNodeBreadthLimit(1),
+			).ListUsers(ctx, req)
+			done <- result{resp, err}
+		}()
+
+		<-groupReads
+		clock.waitForTimer(t)
+		for i := 0; i < numGroups; i++ {
+			clock.Advance(time.Second)
+			// the next timer is started once the progress is checked
+			clock.waitForTimer(t)
+
+			// a read is released every timeout, and the next one starts once it's done
+			release <- struct{}{}
+			if i < numGroups-1 {
+				<-groupReads
+			}
+		}
+
+		res := <-done
+		require.NoError(t, res.err)
+		require.Len(t, res.resp.GetUsers(), numGroups)
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), numGroups)
+	})
+}
@@ -0,0 +1,188 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/sourcegraph/conc/pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/telemetry"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// ObjectUsers are the users that have the relation with an object. See ListUsersForObjectType.
+type ObjectUsers struct {
+	Object *openfgav1.Object
+	Users  []*openfgav1.User
+}
+
+// errObjectTypeResultsLimitReached stops ListUsersForObjectType once enough users are returned.
+var errObjectTypeResultsLimitReached = errors.New("object type results limit reached")
+
+// ListUsersForObjectType lists the users that have the relation with each object of the object
+// type of the request, and calls callback with the users of each object as soon as they are
+// listed. The ID of the object of the request is ignored. The objects are those of every tuple,
+// stored or contextual, of the type, since an object without any tuple has no users, and each of
+// them is listed once, in no particular order, even if it has no users.
+//
+// The objects are listed concurrently, up to the resolve node breadth limit at once, and limits
+// such as the max results apply to the users of each object. The users returned across all the
+// objects are limited with WithMaxObjectTypeResults. An error returned by the callback stops the
+// listing and is returned. Like ListUsers, it assumes that the typesystem is in the context and
+// that the request is valid for any object of the type.
+func (l *listUsersQuery) ListUsersForObjectType(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(ObjectUsers) error,
+) error {
+	objectType := req.GetObject().GetType()
+	ctx, span := tracer.Start(ctx, "ListUsersForObjectType", trace.WithAttributes(
+		attribute.String("object_type", objectType),
+	))
+	defer span.End()
+
+	if l.snapshotTokenErr != nil {
+		telemetry.TraceError(span, l.snapshotTokenErr)
+		return l.snapshotTokenErr
+	}
+
+	if err := validateTargetRelationNotEmpty(req); err != nil {
+		telemetry.TraceError(span, err)
+		return err
+	}
+
+	// the objects and the users of each of them are all read as of the same snapshot
+	snapshotToken, err := l.snapshotTokenFor(ctx, req.GetStoreId())
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return err
+	}
+
+	var datastoreQueryCount, dispatchCount atomic.Uint32
+	objectsReq := fromListUsersRequest(req, &datastoreQueryCount, &dispatchCount)
+	objectsReq.snapshotToken = snapshotToken
+	if l.sharedWorkerPool != nil {
+		objectsReq.workerQueue = l.sharedWorkerPool.queue()
+	}
+	iter, err := l.read(ctx, objectsReq, &openfgav1.TupleKey{
+		Object: tuple.BuildObject(objectType, ""),
+	}, storage.ReadOptions{
+		Consistency: storage.ConsistencyOptions{
+			Preference: req.GetConsistency(),
+		},
+	}, false)
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return err
+	}
+	defer iter.Stop()
+
+	var mu sync.Mutex
+	var returned uint32
+	var listed int
+	listObject := func(ctx context.Context, object *openfgav1.Object) error {
+		objectReq := &openfgav1.ListUsersRequest{
+			StoreId:              req.GetStoreId(),
+			AuthorizationModelId: req.GetAuthorizationModelId(),
+			Object:               object,
+			Relation:             req.GetRelation(),
+			UserFilters:          req.GetUserFilters(),
+			ContextualTuples:     req.GetContextualTuples(),
+			Context:              req.GetContext(),
+			Consistency:          req.GetConsistency(),
+		}
+
+		// ListUsers wraps the datastore of its query, so each object gets a query of its own
+		q := *l
+		q.pageSize = 0
+		q.snapshotToken = snapshotToken
+		resp, err := q.ListUsers(ctx, objectReq)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			// the users of a listing stopped early are partial
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		users := resp.GetUsers()
+		limitReached := false
+		if l.maxObjectTypeResults > 0 {
+			if returned >= l.maxObjectTypeResults {
+				return errObjectTypeResultsLimitReached
+			}
+			remaining := l.maxObjectTypeResults - returned
+			if uint32(len(users)) >= remaining {
+				users = users[:remaining]
+				limitReached = true
+			}
+		}
+		returned += uint32(len(users))
+		listed++
+		if err := callback(ObjectUsers{Object: object, Users: users}); err != nil {
+			return err
+		}
+		if limitReached {
+			return errObjectTypeResultsLimitReached
+		}
+		return nil
+	}
+
+	// stopped is set once the listing fails or reaches the limit, so that no more objects are read
+	var stopped atomic.Bool
+	p := pool.New().WithContext(ctx).WithCancelOnError().WithFirstError().WithMaxGoroutines(int(l.resolveNodeBreadthLimit))
+	seen := make(map[string]struct{})
+	list := func(objectID string) {
+		if _, ok := seen[objectID]; ok {
+			return
+		}
+		seen[objectID] = struct{}{}
+
+		object := &openfgav1.Object{Type: objectType, Id: objectID}
+		p.Go(func(ctx context.Context) error {
+			err := listObject(ctx, object)
+			if err != nil {
+				stopped.Store(true)
+			}
+			return err
+		})
+	}
+
+	var readErr error
+	for !stopped.Load() {
+		t, err := iter.Next(ctx)
+		if err != nil {
+			if !errors.Is(err, storage.ErrIteratorDone) {
+				readErr = err
+			}
+			break
+		}
+		_, objectID := tuple.SplitObject(t.GetKey().GetObject())
+		list(objectID)
+	}
+	for _, contextualTuple := range req.GetContextualTuples() {
+		contextualObjectType, objectID := tuple.SplitObject(contextualTuple.GetObject())
+		if contextualObjectType == objectType && !stopped.Load() {
+			list(objectID)
+		}
+	}
+
+	err = p.Wait()
+	span.SetAttributes(attribute.Int("object_count", listed), attribute.Int("result_count", int(returned)))
+	if errors.Is(err, errObjectTypeResultsLimitReached) {
+		err = nil
+	}
+	if err = errors.Join(readErr, err); err != nil {
+		telemetry.TraceError(span, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package listusers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersForObjectType(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:2#viewer@group:eng#member",
+		"group:eng#member@user:will",
+		"group:eng#member@user:poovam",
+		"document:3#parent@folder:x",
+		"folder:x#viewer@user:anne",
+		"document:4#owner@user:bob",
+		"folder:y#viewer@user:carl",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		ContextualTuples: []*openfgav1.TupleKey{
+			tuple.NewTupleKey("document:5", "viewer", "user:dana"),
+		},
+	}
+
+	listUsers := func(t *testing.T, opts ...ListUsersQueryOption) map[string][]string {
+		var mu sync.Mutex
+		usersByObject := map[string][]string{}
+		err := NewListUsersQuery(ds, opts...).ListUsersForObjectType(ctx, req, func(objectUsers ObjectUsers) error {
+			mu.Lock()
+			defer mu.Unlock()
+			object := tuple.ObjectKey(objectUsers.Object)
+			require.NotContains(t, usersByObject, object)
+			usersByObject[object] = userStrings(objectUsers.Users)
+			return nil
+		})
+		require.NoError(t, err)
+		return usersByObject
+	}
+
+	t.Run("every_object_listed", func(t *testing.T) {
+		usersByObject := listUsers(t)
+		require.Len(t, usersByObject, 5)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, usersByObject["document:1"])
+		require.ElementsMatch(t, []string{"user:will", "user:poovam"}, usersByObject["document:2"])
+		require.ElementsMatch(t, []string{"user:anne"}, usersByObject["document:3"])
+		require.Empty(t, usersByObject["document:4"])
+		require.Contains(t, usersByObject, "document:4")
+		require.ElementsMatch(t, []string{"user:dana"}, usersByObject["document:5"])
+	})
+
+	t.Run("per_object_limit", func(t *testing.T) {
+		usersByObject := listUsers(t, WithListUsersMaxResults(1))
+		require.Len(t, usersByObject, 5)
+		for object, users := range usersByObject {
+			require.LessOrEqual(t, len(users), 1, object)
+		}
+		require.Len(t, usersByObject["document:2"], 1)
+	})
+
+	t.Run("global_limit", func(t *testing.T) {
+		usersByObject := listUsers(t, WithMaxObjectTypeResults(3), WithResolveNodeBreadthLimit(1))
+		count := 0
+		for _, users := range usersByObject {
+			count += len(users)
+		}
+		require.Equal(t, 3, count)
+	})
+
+	t.Run("callback_error_returned", func(t *testing.T) {
+		callbackErr := errors.New("callback failed")
+		err := NewListUsersQuery(ds).ListUsersForObjectType(ctx, req, func(ObjectUsers) error {
+			return callbackErr
+		})
+		require.ErrorIs(t, err, callbackErr)
+	})
+}
@@ -0,0 +1,112 @@
+package listusers
+
+import (
+	"context"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.uber.org/zap"
+
+	"github.com/openfga/openfga/pkg/logger"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// ObservabilityInterceptor is notified of the events of the requests of a ListUsers query, so that
+// they can be routed to any logging, metrics or tracing system. Its methods are called from the
+// goroutines expanding the request, concurrently with one another, so they must be safe for
+// concurrent use and should return quickly. See WithObservabilityInterceptor.
+type ObservabilityInterceptor interface {
+	// OnRequestStart is called once a request starts, before anything is read.
+	OnRequestStart(ctx context.Context, event RequestStartEvent)
+
+	// OnExpand is called each time a relation of an object is expanded.
+	OnExpand(ctx context.Context, event ExpandEvent)
+
+	// OnDatastoreRead is called before each read of the tuples of the datastore.
+	OnDatastoreRead(ctx context.Context, event DatastoreReadEvent)
+
+	// OnRequestEnd is called once a request ends, whether it succeeded or not.
+	OnRequestEnd(ctx context.Context, event RequestEndEvent)
+}
+
+// RequestStartEvent describes a request that starts.
+type RequestStartEvent struct {
+	StoreID     string
+	Object      string
+	Relation    string
+	UserFilters []*openfgav1.UserTypeFilter
+}
+
+// ExpandEvent describes the expansion of the relation of an object. The relation of the request
+// is expanded at depth 1, and every relation followed from there one level deeper.
+type ExpandEvent struct {
+	Object   string
+	Relation string
+	Depth    uint32
+}
+
+// DatastoreReadEvent describes a read of the tuples of the datastore.
+type DatastoreReadEvent struct {
+	StoreID  string
+	TupleKey *openfgav1.TupleKey
+}
+
+// RequestEndEvent describes a request that ended, with the error it failed with, if any.
+type RequestEndEvent struct {
+	StoreID             string
+	Object              string
+	Relation            string
+	UserCount           int
+	DatastoreQueryCount uint32
+	Duration            time.Duration
+	Err                 error
+}
+
+// NewLoggingObservabilityInterceptor returns an ObservabilityInterceptor that logs every event at
+// the debug level, and the requests that fail at the error level.
+func NewLoggingObservabilityInterceptor(logger logger.Logger) ObservabilityInterceptor {
+	return &loggingInterceptor{logger: logger}
+}
+
+type loggingInterceptor struct {
+	logger logger.Logger
+}
+
+func (i *loggingInterceptor) OnRequestStart(ctx context.Context, event RequestStartEvent) {
+	i.logger.DebugWithContext(ctx, "ListUsers request started",
+		zap.String("store_id", event.StoreID),
+		zap.String("object", event.Object),
+		zap.String("relation", event.Relation),
+	)
+}
+
+func (i *loggingInterceptor) OnExpand(ctx context.Context, event ExpandEvent) {
+	i.logger.DebugWithContext(ctx, "ListUsers expanding relation",
+		zap.String("object", event.Object),
+		zap.String("relation", event.Relation),
+		zap.Uint32("depth", event.Depth),
+	)
+}
+
+func (i *loggingInterceptor) OnDatastoreRead(ctx context.Context, event DatastoreReadEvent) {
+	i.logger.DebugWithContext(ctx, "ListUsers reading tuples",
+		zap.String("store_id", event.StoreID),
+		zap.String("tuple_key", tuple.TupleKeyToString(event.TupleKey)),
+	)
+}
+
+func (i *loggingInterceptor) OnRequestEnd(ctx context.Context, event RequestEndEvent) {
+	fields := []zap.Field{
+		zap.String("store_id", event.StoreID),
+		zap.String("object", event.Object),
+		zap.String("relation", event.Relation),
+		zap.Int("user_count", event.UserCount),
+		zap.Uint32("datastore_query_count", event.DatastoreQueryCount),
+		zap.Duration("duration", event.Duration),
+	}
+	if event.Err != nil {
+		i.logger.ErrorWithContext(ctx, "ListUsers request failed", append(fields, zap.Error(event.Err))...)
+		return
+	}
+	i.logger.DebugWithContext(ctx, "ListUsers request ended", fields...)
+}
@@ -0,0 +1,127 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/openfga/openfga/pkg/logger"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+type recordingInterceptor struct {
+	mu     sync.Mutex
+	events []string
+	end    RequestEndEvent
+}
+
+var _ ObservabilityInterceptor = (*recordingInterceptor)(nil)
+
+func (r *recordingInterceptor) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingInterceptor) OnRequestStart(_ context.Context, event RequestStartEvent) {
+	r.record("start " + event.Object + "#" + event.Relation)
+}
+
+func (r *recordingInterceptor) OnExpand(_ context.Context, event ExpandEvent) {
+	r.record("expand " + event.Object + "#" + event.Relation)
+}
+
+func (r *recordingInterceptor) OnDatastoreRead(_ context.Context, event DatastoreReadEvent) {
+	r.record("read " + event.TupleKey.GetObject() + "#" + event.TupleKey.GetRelation())
+}
+
+func (r *recordingInterceptor) OnRequestEnd(_ context.Context, event RequestEndEvent) {
+	r.mu.Lock()
+	r.end = event
+	r.mu.Unlock()
+	r.record("end " + event.Object + "#" + event.Relation)
+}
+
+func TestListUsersConfig_ObservabilityInterceptor(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("events_in_order", func(t *testing.T) {
+		interceptor := &recordingInterceptor{}
+		resp, err := NewListUsersQuery(ds, WithObservabilityInterceptor(interceptor)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, userStrings(resp.GetUsers()))
+
+		require.Equal(t, []string{
+			"start document:1#viewer",
+			"expand document:1#viewer",
+			"read document:1#viewer",
+			"expand group:eng#member",
+			"read group:eng#member",
+			"end document:1#viewer",
+		}, interceptor.events)
+		require.Equal(t, 2, interceptor.end.UserCount)
+		require.Equal(t, resp.GetMetadata().DatastoreQueryCount, interceptor.end.DatastoreQueryCount)
+		require.NoError(t, interceptor.end.Err)
+	})
+
+	t.Run("failed_request_reported", func(t *testing.T) {
+		interceptor := &recordingInterceptor{}
+		_, err := NewListUsersQuery(ds,
+			WithObservabilityInterceptor(interceptor),
+			WithResolveNodeLimit(1),
+		).ListUsers(ctx, req)
+		require.Error(t, err)
+		require.Equal(t, "start document:1#viewer", interceptor.events[0])
+		require.Equal(t, "end document:1#viewer", interceptor.events[len(interceptor.events)-1])
+		require.ErrorIs(t, interceptor.end.Err, err)
+	})
+
+	t.Run("logging_interceptor", func(t *testing.T) {
+		observerLogger, logs := observer.New(zap.DebugLevel)
+		interceptor := NewLoggingObservabilityInterceptor(&logger.ZapLogger{Logger: zap.New(observerLogger)})
+
+		_, err := NewListUsersQuery(ds, WithObservabilityInterceptor(interceptor)).ListUsers(ctx, req)
+		require.NoError(t, err)
+
+		messages := []string{}
+		for _, entry := range logs.All() {
+			require.Equal(t, zapcore.DebugLevel, entry.Level)
+			messages = append(messages, entry.Message)
+		}
+		require.Equal(t, []string{
+			"ListUsers request started",
+			"ListUsers expanding relation",
+			"ListUsers reading tuples",
+			"ListUsers expanding relation",
+			"ListUsers reading tuples",
+			"ListUsers request ended",
+		}, messages)
+		require.Equal(t, tuple.TupleKeyToString(tuple.NewTupleKey("group:eng", "member", "")), logs.All()[4].ContextMap()["tuple_key"])
+	})
+}
@@ -0,0 +1,173 @@
+package listusers
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// UserPages holds, in memory, the users of ListUsers requests listed in pages that are yet to be
+// fetched. The same UserPages must be passed to the ListUsers queries of the first and of the
+// following pages of a request, see WithPaging. It is safe for concurrent use.
+type UserPages struct {
+	ttl      time.Duration
+	maxUsers int
+
+	mu      sync.Mutex
+	users   int                      // the number of users held across the pending pages
+	pending map[string]*list.Element // page handle to the users left, in order
+	order   *list.List               // the users left, oldest first, since they expire first
+}
+
+// pendingUsers are the users of a request left to be fetched.
+type pendingUsers struct {
+	handle     string
+	requestKey string
+	users      []*openfgav1.User
+	complete   bool // whether the listing the users are taken from is complete
+	expiresAt  time.Time
+}
+
+// NewUserPages holds the users left to be fetched for ttl after each page is fetched, and up to
+// maxUsers users across all the requests. A page handle not used within ttl expires along with
+// the users it leads to. Once maxUsers are held, the oldest pages are evicted to make room for
+// new ones, so their handles become invalid as if they expired, and a request with more than
+// maxUsers users left has the users past them dropped, so its following pages aren't complete.
+// A maxUsers of 0 holds any number of users.
+func NewUserPages(ttl time.Duration, maxUsers int) *UserPages {
+	return &UserPages{
+		ttl:      ttl,
+		maxUsers: maxUsers,
+		pending:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// put holds the users left to be fetched for the request, and returns the handle of the page
+// they start with.
+func (p *UserPages) put(clock Clock, requestKey string, users []*openfgav1.User, complete bool) string {
+	now := clock.Now()
+	handle := ulid.Make().String()
+	if p.maxUsers > 0 && len(users) > p.maxUsers {
+		users = users[:p.maxUsers]
+		complete = false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictExpired(now)
+	for p.maxUsers > 0 && p.users+len(users) > p.maxUsers {
+		p.remove(p.order.Front())
+	}
+	p.pending[handle] = p.order.PushBack(&pendingUsers{
+		handle:     handle,
+		requestKey: requestKey,
+		users:      users,
+		complete:   complete,
+		expiresAt:  now.Add(p.ttl),
+	})
+	p.users += len(users)
+	return handle
+}
+
+// take returns the users left to be fetched for the request from the page with the handle on,
+// and whether the listing they are taken from is complete, and forgets them. A handle can only be
+// used once.
+func (p *UserPages) take(clock Clock, requestKey, handle string) ([]*openfgav1.User, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictExpired(clock.Now())
+
+	element, ok := p.pending[handle]
+	if !ok || element.Value.(*pendingUsers).requestKey != requestKey {
+		return nil, false, ErrInvalidPageHandle
+	}
+	pending := p.remove(element)
+	return pending.users, pending.complete, nil
+}
+
+// evictExpired forgets the pages expired as of now. It must be called with p.mu held.
+func (p *UserPages) evictExpired(now time.Time) {
+	for element := p.order.Front(); element != nil; element = p.order.Front() {
+		if now.Before(element.Value.(*pendingUsers).expiresAt) {
+			return
+		}
+		p.remove(element)
+	}
+}
+
+// remove forgets the page of element and returns its users. It must be called with p.mu held.
+func (p *UserPages) remove(element *list.Element) *pendingUsers {
+	pending := p.order.Remove(element).(*pendingUsers)
+	delete(p.pending, pending.handle)
+	p.users -= len(pending.users)
+	return pending
+}
+
+// pageRequestKey identifies the request a page handle is for.
+func pageRequestKey(req *openfgav1.ListUsersRequest, typesys *typesystem.TypeSystem) string {
+	return fmt.Sprintf("%s|%s|%s#%s", req.GetStoreId(), typesys.GetAuthorizationModelID(), tuple.ObjectKey(req.GetObject()), req.GetRelation())
+}
+
+// paginate returns the first page of the users, and holds the users left along with the handle
+// of the next page if there are any.
+func (l *listUsersQuery) paginate(requestKey string, users []*openfgav1.User, complete bool) ([]*openfgav1.User, string) {
+	if l.userPages == nil || l.pageSize == 0 || len(users) <= int(l.pageSize) {
+		return users, ""
+	}
+	return users[:l.pageSize], l.userPages.put(l.clock, requestKey, users[l.pageSize:], complete)
+}
+
+// ListUsersNextPage returns the page of users of the request with the handle, taken from the
+// NextPageHandle of the previous page, without expanding the request again. The handle must be
+// used within the TTL of the UserPages, only once, and for the store, model, object and relation
+// of the request it was returned for, otherwise ErrInvalidPageHandle is returned. The users are
+// the ones found when the first page was listed, and only the first page carries the metadata of
+// the expansion, apart from whether the listing is complete.
+func (l *listUsersQuery) ListUsersNextPage(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	handle string,
+) (*listUsersResponse, error) {
+	_, span := tracer.Start(ctx, "ListUsersNextPage", trace.WithAttributes(
+		attribute.String("object", tuple.ObjectKey(req.GetObject())),
+		attribute.String("relation", req.GetRelation()),
+	))
+	defer span.End()
+
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+	if l.userPages == nil || l.pageSize == 0 {
+		return nil, ErrInvalidPageHandle
+	}
+
+	requestKey := pageRequestKey(req, typesys)
+	users, complete, err := l.userPages.take(l.clock, requestKey, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	page, nextPageHandle := l.paginate(requestKey, users, complete)
+	return &listUsersResponse{
+		Users: page,
+		Metadata: listUsersResponseMetadata{
+			DispatchCounter: new(atomic.Uint32),
+			Complete:        complete,
+			NextPageHandle:  nextPageHandle,
+		},
+	}, nil
+}
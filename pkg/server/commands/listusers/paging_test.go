@@ -0,0 +1,175 @@
+package listusers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_Paging(t *testing.T) {
+	const numUsers = 25
+	tuples := []string{"document:1#viewer@group:eng#member"}
+	for i := 0; i < numUsers; i++ {
+		if i%2 == 0 {
+			tuples = append(tuples, fmt.Sprintf("document:1#viewer@user:%d", i))
+		} else {
+			tuples = append(tuples, fmt.Sprintf("group:eng#member@user:%d", i))
+		}
+	}
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user, group#member]`, tuples)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("sequential_pages", func(t *testing.T) {
+		pages := NewUserPages(time.Minute, 0)
+		q := NewListUsersQuery(ds, WithPaging(pages, 10))
+
+		resp, err := q.ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 10)
+		found := userStrings(resp.GetUsers())
+
+		pageSizes := []int{}
+		handle := resp.GetMetadata().NextPageHandle
+		for handle != "" {
+			resp, err := NewListUsersQuery(ds, WithPaging(pages, 10)).ListUsersNextPage(ctx, req, handle)
+			require.NoError(t, err)
+			pageSizes = append(pageSizes, len(resp.GetUsers()))
+			found = append(found, userStrings(resp.GetUsers())...)
+			handle = resp.GetMetadata().NextPageHandle
+		}
+		require.Equal(t, []int{10, 5}, pageSizes)
+
+		// no duplicates nor gaps
+		expected := make([]string, 0, numUsers)
+		for i := 0; i < numUsers; i++ {
+			expected = append(expected, fmt.Sprintf("user:%d", i))
+		}
+		require.ElementsMatch(t, expected, found)
+	})
+
+	t.Run("single_page", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithPaging(NewUserPages(time.Minute, 0), numUsers)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), numUsers)
+		require.Empty(t, resp.GetMetadata().NextPageHandle)
+	})
+
+	t.Run("invalid_handles", func(t *testing.T) {
+		clock := newFakeClock()
+		pages := NewUserPages(time.Minute, 0)
+		q := NewListUsersQuery(ds, WithPaging(pages, 10), WithClock(clock))
+
+		firstPage := func() string {
+			resp, err := q.ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.NotEmpty(t, resp.GetMetadata().NextPageHandle)
+			return resp.GetMetadata().NextPageHandle
+		}
+
+		handle := firstPage()
+		_, err := q.ListUsersNextPage(ctx, req, handle)
+		require.NoError(t, err)
+		_, err = q.ListUsersNextPage(ctx, req, handle)
+		require.ErrorIs(t, err, ErrInvalidPageHandle, "a handle is used only once")
+
+		_, err = q.ListUsersNextPage(ctx, req, "unknown")
+		require.ErrorIs(t, err, ErrInvalidPageHandle)
+
+		handle = firstPage()
+		otherRelation := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "editor",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}
+		_, err = q.ListUsersNextPage(ctx, otherRelation, handle)
+		require.ErrorIs(t, err, ErrInvalidPageHandle, "a handle is tied to its request")
+
+		handle = firstPage()
+		clock.Advance(time.Minute)
+		_, err = q.ListUsersNextPage(ctx, req, handle)
+		require.ErrorIs(t, err, ErrInvalidPageHandle, "a handle expires")
+
+		_, err = NewListUsersQuery(ds).ListUsersNextPage(ctx, req, firstPage())
+		require.ErrorIs(t, err, ErrInvalidPageHandle, "paging is disabled")
+	})
+
+	t.Run("bounded_pages", func(t *testing.T) {
+		firstPage := func(q *listUsersQuery) string {
+			resp, err := q.ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.NotEmpty(t, resp.GetMetadata().NextPageHandle)
+			return resp.GetMetadata().NextPageHandle
+		}
+
+		t.Run("oldest_pages_evicted", func(t *testing.T) {
+			pages := NewUserPages(time.Minute, 20)
+			q := NewListUsersQuery(ds, WithPaging(pages, 10))
+
+			// each request leaves 15 users, so the second one evicts the first one
+			oldest := firstPage(q)
+			newest := firstPage(q)
+			require.Equal(t, 15, pages.users)
+
+			_, err := q.ListUsersNextPage(ctx, req, oldest)
+			require.ErrorIs(t, err, ErrInvalidPageHandle)
+			resp, err := q.ListUsersNextPage(ctx, req, newest)
+			require.NoError(t, err)
+			require.Len(t, resp.GetUsers(), 10)
+		})
+
+		t.Run("users_past_the_capacity_dropped", func(t *testing.T) {
+			pages := NewUserPages(time.Minute, 10)
+			q := NewListUsersQuery(ds, WithPaging(pages, 10))
+
+			resp, err := q.ListUsersNextPage(ctx, req, firstPage(q))
+			require.NoError(t, err)
+			require.Len(t, resp.GetUsers(), 10)
+			require.Empty(t, resp.GetMetadata().NextPageHandle)
+			require.False(t, resp.GetMetadata().Complete)
+			require.Zero(t, pages.users)
+		})
+
+		t.Run("expired_pages_evicted_on_take", func(t *testing.T) {
+			clock := newFakeClock()
+			pages := NewUserPages(time.Minute, 0)
+			q := NewListUsersQuery(ds, WithPaging(pages, 10), WithClock(clock))
+
+			firstPage(q)
+			clock.Advance(time.Minute)
+			_, err := q.ListUsersNextPage(ctx, req, "unknown")
+			require.ErrorIs(t, err, ErrInvalidPageHandle)
+			require.Empty(t, pages.pending)
+			require.Zero(t, pages.users)
+		})
+	})
+
+	t.Run("callback_not_paged", func(t *testing.T) {
+		count := 0
+		err := NewListUsersQuery(ds, WithPaging(NewUserPages(time.Minute, 0), 10)).ListUsersCallback(ctx, req, func(*openfgav1.User) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, numUsers, count)
+	})
+}
@@ -0,0 +1,30 @@
+package listusers
+
+import (
+	"context"
+	"runtime/debug"
+)
+
+// recoverPanic recovers the panic of the goroutine it is deferred in, if any, and sets err to a
+// *PanicError describing it. The expansion runs in background goroutines, where a panic would
+// otherwise take down the process rather than fail the request.
+func recoverPanic(err *error) {
+	if p := recover(); p != nil {
+		*err = &PanicError{Value: p, Stack: debug.Stack()}
+	}
+}
+
+// recoverPanics wraps fn so that a panic in it is returned as a *PanicError.
+func recoverPanics(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) (err error) {
+		defer recoverPanic(&err)
+		return fn(ctx)
+	}
+}
+
+// recoverExpansion runs expand, returning a panic in it as the error of the response. It is
+// meant for the goroutines expanding a rewrite outside of a pool.
+func recoverExpansion(expand func() expandResponse) (resp expandResponse) {
+	defer recoverPanic(&resp.err)
+	return expand()
+}
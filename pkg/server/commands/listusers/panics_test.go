@@ -0,0 +1,91 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/internal/mocks"
+	"github.com/openfga/openfga/pkg/logger"
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+func TestListUsersExpansionPanics(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user]
+				define editor: [user, group#member] or viewer from parent
+				define viewer: editor but not blocked`, []string{
+		"document:1#editor@user:jon",
+		"document:1#editor@group:eng#member",
+		"document:1#parent@folder:x",
+		"document:1#blocked@user:will",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:anne",
+	})
+
+	tests := []struct {
+		name     string
+		relation string
+		object   string
+	}{
+		{name: "root_read", relation: "editor", object: "document:1"},
+		{name: "read_dispatched_on_userset", relation: "editor", object: "group:eng"},
+		{name: "read_dispatched_on_tupleset", relation: "editor", object: "folder:x"},
+		{name: "read_under_exclusion", relation: "viewer", object: "document:1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+
+			// the reader panics on the reads of the object, and reads the store otherwise
+			mockDatastore := mocks.NewMockOpenFGADatastore(mockController)
+			mockDatastore.EXPECT().Read(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(ctx context.Context, store string, tupleKey *openfgav1.TupleKey, opts storage.ReadOptions) (storage.TupleIterator, error) {
+					if tupleKey.GetObject() == test.object {
+						var iter storage.TupleIterator
+						iter.Stop()
+					}
+					return ds.Read(ctx, store, tupleKey, opts)
+				})
+
+			observerLogger, logs := observer.New(zap.ErrorLevel)
+			resp, err := NewListUsersQuery(mockDatastore,
+				WithListUsersQueryLogger(&logger.ZapLogger{Logger: zap.New(observerLogger)}),
+			).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    test.relation,
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.Nil(t, resp)
+			require.ErrorIs(t, err, ErrExpansionPanicked)
+			require.ErrorIs(t, err, openfgaErrors.ErrUnknown)
+
+			var panicErr *PanicError
+			require.ErrorAs(t, err, &panicErr)
+			require.NotEmpty(t, panicErr.Stack)
+
+			require.Equal(t, 1, logs.FilterMessage("ListUsers expansion panicked").Len())
+		})
+	}
+}
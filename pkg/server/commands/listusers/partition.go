@@ -0,0 +1,72 @@
+package listusers
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// pinned returns ds pinned to the partition of the query and to snapshotToken, for the reads
+// made through it rather than through read, such as the reads of the checks. See WithPartition
+// and WithSnapshotToken.
+func (l *listUsersQuery) pinned(ds storage.RelationshipTupleReader, snapshotToken string) storage.RelationshipTupleReader {
+	if l.partition == "" && snapshotToken == "" {
+		return ds
+	}
+	return &pinnedTupleReader{RelationshipTupleReader: ds, partition: l.partition, snapshotToken: snapshotToken}
+}
+
+// pinnedTupleReader sets the partition and the snapshot token of every read of the wrapped reader.
+type pinnedTupleReader struct {
+	storage.RelationshipTupleReader
+	partition     string
+	snapshotToken string
+}
+
+var _ storage.RelationshipTupleReader = (*pinnedTupleReader)(nil)
+
+func (r *pinnedTupleReader) Read(
+	ctx context.Context,
+	store string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	options.SnapshotToken = r.snapshotToken
+	options.Partition = r.partition
+	return r.RelationshipTupleReader.Read(ctx, store, tupleKey, options)
+}
+
+func (r *pinnedTupleReader) ReadUserTuple(
+	ctx context.Context,
+	store string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadUserTupleOptions,
+) (*openfgav1.Tuple, error) {
+	options.SnapshotToken = r.snapshotToken
+	options.Partition = r.partition
+	return r.RelationshipTupleReader.ReadUserTuple(ctx, store, tupleKey, options)
+}
+
+func (r *pinnedTupleReader) ReadUsersetTuples(
+	ctx context.Context,
+	store string,
+	filter storage.ReadUsersetTuplesFilter,
+	options storage.ReadUsersetTuplesOptions,
+) (storage.TupleIterator, error) {
+	options.SnapshotToken = r.snapshotToken
+	options.Partition = r.partition
+	return r.RelationshipTupleReader.ReadUsersetTuples(ctx, store, filter, options)
+}
+
+func (r *pinnedTupleReader) ReadStartingWithUser(
+	ctx context.Context,
+	store string,
+	filter storage.ReadStartingWithUserFilter,
+	options storage.ReadStartingWithUserOptions,
+) (storage.TupleIterator, error) {
+	options.SnapshotToken = r.snapshotToken
+	options.Partition = r.partition
+	return r.RelationshipTupleReader.ReadStartingWithUser(ctx, store, filter, options)
+}
@@ -0,0 +1,180 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// partitionDatastore tags the tuples with a partition and only returns the tuples of the
+// partition read, if any.
+type partitionDatastore struct {
+	storage.OpenFGADatastore
+
+	partitions map[string]string // the partition of each tuple key, "us" if unlisted
+
+	mu             sync.Mutex
+	readPartitions map[string]int
+}
+
+func (s *partitionDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	s.mu.Lock()
+	s.readPartitions[options.Partition]++
+	s.mu.Unlock()
+
+	// the partition is applied below, as the wrapped datastore doesn't partition tuples
+	partition := options.Partition
+	options.Partition = ""
+	iter, err := s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+	if err != nil || partition == "" {
+		return iter, err
+	}
+	defer iter.Stop()
+
+	var tuples []*openfgav1.Tuple
+	for {
+		t, err := iter.Next(ctx)
+		if err != nil {
+			if errors.Is(err, storage.ErrIteratorDone) {
+				break
+			}
+			return nil, err
+		}
+		tuplePartition, ok := s.partitions[tuple.TupleKeyToString(t.GetKey())]
+		if !ok {
+			tuplePartition = "us"
+		}
+		if tuplePartition == partition {
+			tuples = append(tuples, t)
+		}
+	}
+	return storage.NewStaticTupleIterator(tuples), nil
+}
+
+func TestListUsersConfig_Partition(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:anne",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:x",
+		"group:eng#member@user:will",
+		"group:eng#member@user:maria",
+		"folder:x#viewer@user:poovam",
+	})
+
+	newDatastore := func() *partitionDatastore {
+		return &partitionDatastore{
+			OpenFGADatastore: ds,
+			partitions: map[string]string{
+				"document:1#viewer@user:anne":        "eu",
+				"group:eng#member@user:maria":        "eu",
+				"document:1#viewer@group:eng#member": "us",
+			},
+			readPartitions: make(map[string]int),
+		}
+	}
+	listUsers := func(ds storage.RelationshipTupleReader, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+
+	t.Run("other_partitions_excluded", func(t *testing.T) {
+		partitionDS := newDatastore()
+		require.ElementsMatch(t, []string{"user:jon", "user:will", "user:poovam"}, listUsers(partitionDS, WithPartition("us")))
+		require.Equal(t, []string{"us"}, keysOf(partitionDS.readPartitions))
+	})
+
+	t.Run("only_the_partition_read", func(t *testing.T) {
+		// the group is tagged for us, so its eu members aren't reached from an eu request
+		require.ElementsMatch(t, []string{"user:anne"}, listUsers(newDatastore(), WithPartition("eu")))
+	})
+
+	t.Run("all_partitions_by_default", func(t *testing.T) {
+		partitionDS := newDatastore()
+		require.ElementsMatch(t, []string{
+			"user:jon",
+			"user:anne",
+			"user:will",
+			"user:maria",
+			"user:poovam",
+		}, listUsers(partitionDS))
+		require.Equal(t, []string{""}, keysOf(partitionDS.readPartitions))
+	})
+
+	t.Run("not_supported", func(t *testing.T) {
+		_, err := NewListUsersQuery(ds, WithPartition("eu")).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.ErrorIs(t, err, storage.ErrPartitionsNotSupported)
+	})
+
+	t.Run("check_reads_pinned", func(t *testing.T) {
+		var options storage.ReadUsersetTuplesOptions
+		reader := NewListUsersQuery(ds, WithPartition("eu")).pinned(&usersetOptionsRecorder{options: &options}, "snapshot:1")
+		_, err := reader.ReadUsersetTuples(ctx, storeID, storage.ReadUsersetTuplesFilter{}, storage.ReadUsersetTuplesOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "eu", options.Partition)
+		require.Equal(t, "snapshot:1", options.SnapshotToken)
+
+		unpinned := NewListUsersQuery(ds).pinned(ds, "")
+		require.Same(t, ds, unpinned)
+	})
+}
+
+// usersetOptionsRecorder records the options of its last ReadUsersetTuples.
+type usersetOptionsRecorder struct {
+	storage.RelationshipTupleReader
+	options *storage.ReadUsersetTuplesOptions
+}
+
+func (r *usersetOptionsRecorder) ReadUsersetTuples(
+	_ context.Context,
+	_ string,
+	_ storage.ReadUsersetTuplesFilter,
+	options storage.ReadUsersetTuplesOptions,
+) (storage.TupleIterator, error) {
+	*r.options = options
+	return storage.NewStaticTupleIterator(nil), nil
+}
+
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
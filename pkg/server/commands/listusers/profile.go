@@ -0,0 +1,119 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// The kinds of rewrites that a ListUsersProfile breaks the expansion down by.
+const (
+	RewriteKindDirect          = "direct"
+	RewriteKindComputedUserset = "computed_userset"
+	RewriteKindTupleToUserset  = "tuple_to_userset"
+	RewriteKindUnion           = "union"
+	RewriteKindIntersection    = "intersection"
+	RewriteKindExclusion       = "exclusion"
+)
+
+// ListUsersProfile breaks down where the time of a ListUsers request went. See
+// ListUsersWithProfile.
+type ListUsersProfile struct {
+	// Duration is the time the whole request took.
+	Duration time.Duration
+
+	// RewriteKinds holds the profile of each kind of rewrite that was expanded, keyed by
+	// RewriteKindDirect, RewriteKindTupleToUserset and so on.
+	RewriteKinds map[string]RewriteKindProfile
+}
+
+// RewriteKindProfile profiles the expansions of one kind of rewrite.
+type RewriteKindProfile struct {
+	// Expansions is the number of rewrites of the kind that were expanded.
+	Expansions uint32
+
+	// Duration is the total time spent expanding the rewrites of the kind. A rewrite's time
+	// includes that of the rewrites nested in it, and rewrites expanded concurrently each count
+	// their own time, so the durations of the kinds don't add up to the request's.
+	Duration time.Duration
+
+	// DatastoreQueries is the number of datastore queries made by the rewrites of the kind
+	// themselves, excluding those made by the rewrites nested in them.
+	DatastoreQueries uint32
+}
+
+// expansionProfile accumulates the profile of a request. A nil *expansionProfile profiles
+// nothing, so that requests that aren't profiled don't pay for it. It is shared by all the clones
+// of a request.
+type expansionProfile struct {
+	clock Clock
+
+	mu           sync.Mutex
+	rewriteKinds map[string]RewriteKindProfile
+}
+
+func newExpansionProfile(clock Clock) *expansionProfile {
+	return &expansionProfile{
+		clock:        clock,
+		rewriteKinds: make(map[string]RewriteKindProfile),
+	}
+}
+
+// track starts timing the expansion of a rewrite of the kind, and returns the function that
+// stops it.
+func (p *expansionProfile) track(kind string) func() {
+	if p == nil {
+		return func() {}
+	}
+
+	start := p.clock.Now()
+	return func() {
+		elapsed := p.clock.Now().Sub(start)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		kindProfile := p.rewriteKinds[kind]
+		kindProfile.Expansions++
+		kindProfile.Duration += elapsed
+		p.rewriteKinds[kind] = kindProfile
+	}
+}
+
+// addDatastoreQuery records a datastore query made by a rewrite of the kind.
+func (p *expansionProfile) addDatastoreQuery(kind string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kindProfile := p.rewriteKinds[kind]
+	kindProfile.DatastoreQueries++
+	p.rewriteKinds[kind] = kindProfile
+}
+
+// ListUsersWithProfile lists the users like ListUsers does and also returns a profile of the
+// expansion, broken down by kind of rewrite, for debugging slow requests. Profiling has a cost, so
+// ListUsers itself never profiles.
+func (l *listUsersQuery) ListUsersWithProfile(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+) (*listUsersResponse, *ListUsersProfile, error) {
+	q := *l
+	q.profile = newExpansionProfile(l.clock)
+
+	start := l.clock.Now()
+	resp, err := q.ListUsers(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q.profile.mu.Lock()
+	defer q.profile.mu.Unlock()
+	return resp, &ListUsersProfile{
+		Duration:     l.clock.Now().Sub(start),
+		RewriteKinds: q.profile.rewriteKinds,
+	}, nil
+}
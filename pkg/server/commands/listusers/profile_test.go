@@ -0,0 +1,83 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersWithProfile(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define editor: [user]
+				define blocked: [user]
+				define viewer: [user] or owner or viewer from parent
+				define can_view: (viewer and editor) but not blocked`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#owner@user:maria",
+		"document:1#parent@folder:x",
+		"document:1#editor@user:jon",
+		"document:1#editor@user:will",
+		"document:1#blocked@user:maria",
+		"folder:x#viewer@user:will",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "can_view",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("profile_accounts_for_all_rewrite_kinds", func(t *testing.T) {
+		resp, profile, err := NewListUsersQuery(ds).ListUsersWithProfile(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon", "user:will"}, userStrings(resp.GetUsers()))
+
+		require.ElementsMatch(t, []string{
+			RewriteKindDirect,
+			RewriteKindComputedUserset,
+			RewriteKindTupleToUserset,
+			RewriteKindUnion,
+			RewriteKindIntersection,
+			RewriteKindExclusion,
+		}, keys(profile.RewriteKinds))
+		require.Positive(t, profile.Duration)
+
+		var datastoreQueries uint32
+		for kind, kindProfile := range profile.RewriteKinds {
+			require.Positive(t, kindProfile.Expansions, kind)
+			require.LessOrEqual(t, kindProfile.Duration, profile.Duration, kind)
+			datastoreQueries += kindProfile.DatastoreQueries
+		}
+		require.Equal(t, resp.GetMetadata().DatastoreQueryCount, datastoreQueries)
+		require.Positive(t, profile.RewriteKinds[RewriteKindDirect].DatastoreQueries)
+		require.Positive(t, profile.RewriteKinds[RewriteKindTupleToUserset].DatastoreQueries)
+		require.Zero(t, profile.RewriteKinds[RewriteKindUnion].DatastoreQueries)
+	})
+
+	t.Run("list_users_not_profiled", func(t *testing.T) {
+		q := NewListUsersQuery(ds)
+		_, _, err := q.ListUsersWithProfile(ctx, req)
+		require.NoError(t, err)
+		require.Nil(t, q.profile)
+	})
+}
+
+func keys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
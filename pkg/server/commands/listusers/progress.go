@@ -0,0 +1,73 @@
+package listusers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultProgressInterval is how often progress is reported unless set with WithProgressInterval.
+const defaultProgressInterval = time.Second
+
+// Progress is a snapshot of how far the expansion of a ListUsers request went. See
+// WithProgressChannel.
+type Progress struct {
+	// FoundUsers is the number of unique users found so far, including users that were found not
+	// to have the relation and won't be returned.
+	FoundUsers int
+
+	// DatastoreQueries is the number of datastore queries made so far.
+	DatastoreQueries uint32
+
+	// Elapsed is the time since the request started.
+	Elapsed time.Duration
+}
+
+// startProgressReports sends the progress of the request to the progress channel at each progress
+// interval until the returned function is called, which sends a last report and waits for the
+// reports to stop. Reports are dropped if the channel isn't ready to receive them, so that they
+// never hold up the expansion.
+func (l *listUsersQuery) startProgressReports(
+	foundUsers *uniqueUserSet,
+	datastoreQueryCount *atomic.Uint32,
+) func() {
+	if l.progress == nil {
+		return func() {}
+	}
+
+	start := l.clock.Now()
+	report := func() {
+		progress := Progress{
+			FoundUsers:       foundUsers.len(),
+			DatastoreQueries: datastoreQueryCount.Load(),
+			Elapsed:          l.clock.Now().Sub(start),
+		}
+		select {
+		case l.progress <- progress:
+		default:
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			timer := l.clock.NewTimer(l.progressInterval)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C():
+				report()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		report()
+	}
+}
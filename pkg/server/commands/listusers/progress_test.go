@@ -0,0 +1,112 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_ProgressChannel(t *testing.T) {
+	const numGroups = 5
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [group#member]`, tuples)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("progress_reported_during_slow_expansion", func(t *testing.T) {
+		clock := newFakeClock()
+		progress := make(chan Progress, 10)
+
+		// the reads of the groups are held until released, once the read of the document is done
+		groupReads := make(chan struct{}, numGroups)
+		release := make(chan struct{})
+		interceptor := func(ctx context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+			if tupleKey.GetObject() == "document:1" {
+				return nil
+			}
+			groupReads <- struct{}{}
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		type result struct {
+			resp *listUsersResponse
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resp, err := NewListUsersQuery(ds,
+				WithClock(clock),
+				WithReadInterceptor(interceptor),
+				WithProgressChannel(progress),
+				WithProgressInterval(100*time.Millisecond),
+			).ListUsers(ctx, req)
+			done <- result{resp, err}
+		}()
+
+		clock.waitForTimer(t)
+		<-groupReads
+		clock.Advance(100 * time.Millisecond)
+		require.Equal(t, Progress{
+			FoundUsers:       0,
+			DatastoreQueries: 1,
+			Elapsed:          100 * time.Millisecond,
+		}, <-progress)
+
+		clock.waitForTimer(t)
+		clock.Advance(100 * time.Millisecond)
+		require.Equal(t, 200*time.Millisecond, (<-progress).Elapsed)
+
+		close(release)
+		res := <-done
+		require.NoError(t, res.err)
+		require.Len(t, res.resp.GetUsers(), numGroups)
+
+		// a last report is sent once the expansion is over
+		var last Progress
+		for len(progress) > 0 {
+			last = <-progress
+		}
+		require.Equal(t, numGroups, last.FoundUsers)
+		require.Equal(t, uint32(numGroups+1), last.DatastoreQueries)
+	})
+
+	t.Run("reports_dropped_when_not_received", func(t *testing.T) {
+		progress := make(chan Progress)
+		resp, err := NewListUsersQuery(ds,
+			WithProgressChannel(progress),
+			WithProgressInterval(time.Nanosecond),
+		).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), numGroups)
+	})
+}
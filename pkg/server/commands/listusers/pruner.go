@@ -0,0 +1,344 @@
+package listusers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// EdgePruner decides, before any datastore reads are made, whether expanding the
+// target relation could possibly yield users of the source type (and relation).
+type EdgePruner interface {
+	// HasPossibleEdges reports whether expansion from target towards source is worthwhile.
+	// Implementations may optionally return the relation references reachable from the
+	// source along the way; a nil slice means the information is not available.
+	HasPossibleEdges(
+		typesys *typesystem.TypeSystem,
+		target *openfgav1.RelationReference,
+		source *openfgav1.RelationReference,
+	) (bool, []*openfgav1.RelationReference, error)
+}
+
+// relationshipGraphPruner is the default EdgePruner. It prunes based on the
+// relationship edges computed by graph.RelationshipGraph.
+type relationshipGraphPruner struct{}
+
+var _ EdgePruner = (*relationshipGraphPruner)(nil)
+
+func (relationshipGraphPruner) HasPossibleEdges(
+	typesys *typesystem.TypeSystem,
+	target *openfgav1.RelationReference,
+	source *openfgav1.RelationReference,
+) (bool, []*openfgav1.RelationReference, error) {
+	edges, err := graph.New(typesys).GetPrunedRelationshipEdges(target, source)
+	if err != nil {
+		return false, nil, err
+	}
+
+	reachable := make([]*openfgav1.RelationReference, 0, len(edges))
+	for _, edge := range edges {
+		reachable = append(reachable, edge.TargetReference)
+	}
+
+	return len(edges) > 0, reachable, nil
+}
+
+// possibleEdges memoizes whether the EdgePruner finds possible edges from a relation reference to
+// another, so that the relationship graph is walked once per pair of references in a request
+// rather than at each expansion step. It is shared by all the clones of a request.
+type possibleEdges struct {
+	mu    sync.Mutex
+	edges map[string]possibleEdgesResult
+
+	// reachableRewrites memoizes whether the rewrites of the intersections and the subtracts
+	// of the exclusions can yield users of the filters, by rewrite and filters.
+	reachableRewrites map[reachableRewriteKey]bool
+}
+
+type reachableRewriteKey struct {
+	rewrite any
+	filters string
+}
+
+type possibleEdgesResult struct {
+	hasPossibleEdges bool
+	err              error
+}
+
+func newPossibleEdges() *possibleEdges {
+	return &possibleEdges{
+		edges:             make(map[string]possibleEdgesResult),
+		reachableRewrites: make(map[reachableRewriteKey]bool),
+	}
+}
+
+// hasPossibleEdges reports whether the pruner of the query finds possible edges from target to
+// source, as memoized for req. The requests without a memo, such as those built by hand, call the
+// pruner every time.
+func (l *listUsersQuery) hasPossibleEdges(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	target *openfgav1.RelationReference,
+	source *openfgav1.RelationReference,
+) (bool, error) {
+	memo := req.possibleEdges
+	if memo == nil {
+		hasPossibleEdges, _, err := l.pruner.HasPossibleEdges(typesys, target, source)
+		return hasPossibleEdges, err
+	}
+
+	key := tuple.ToObjectRelationString(target.GetType(), target.GetRelation()) + "|" +
+		tuple.ToObjectRelationString(source.GetType(), source.GetRelation())
+	memo.mu.Lock()
+	result, ok := memo.edges[key]
+	memo.mu.Unlock()
+	if ok {
+		return result.hasPossibleEdges, result.err
+	}
+
+	result.hasPossibleEdges, _, result.err = l.pruner.HasPossibleEdges(typesys, target, source)
+	memo.mu.Lock()
+	memo.edges[key] = result
+	memo.mu.Unlock()
+	return result.hasPossibleEdges, result.err
+}
+
+// rewriteReachable returns whether rewrite, the subtract of an exclusion or the operands of an
+// intersection, can yield users of filters as found by canReach, as memoized for req. The
+// rewrites are expanded as many times as the objects they are reached from, but their relations
+// and the user filters don't change from an object to another.
+func rewriteReachable(req *internalListUsersRequest, rewrite any, filters []*openfgav1.UserTypeFilter, canReach func() bool) bool {
+	memo := req.possibleEdges
+	if memo == nil {
+		return canReach()
+	}
+
+	filterKeys := make([]string, 0, len(filters))
+	for _, f := range filters {
+		filterKeys = append(filterKeys, tuple.ToObjectRelationString(f.GetType(), f.GetRelation()))
+	}
+	key := reachableRewriteKey{rewrite: rewrite, filters: strings.Join(filterKeys, ",")}
+
+	memo.mu.Lock()
+	reachable, ok := memo.reachableRewrites[key]
+	memo.mu.Unlock()
+	if ok {
+		return reachable
+	}
+
+	reachable = canReach()
+	memo.mu.Lock()
+	memo.reachableRewrites[key] = reachable
+	memo.mu.Unlock()
+	return reachable
+}
+
+// prunedBranches records the rewrite operands that were skipped during an expansion because
+// they could not yield users matching the user filters. It is shared by all the clones of a
+// request.
+type prunedBranches struct {
+	mu       sync.Mutex
+	branches map[string]struct{}
+}
+
+func newPrunedBranches() *prunedBranches {
+	return &prunedBranches{
+		branches: make(map[string]struct{}),
+	}
+}
+
+// add records that the operand of objectType#relation was pruned.
+func (p *prunedBranches) add(typesys *typesystem.TypeSystem, objectType, relation string, operand *openfgav1.Userset) {
+	branch := fmt.Sprintf("%s: %s", tuple.ToObjectRelationString(objectType, relation), rewriteString(typesys, objectType, relation, operand))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.branches[branch] = struct{}{}
+}
+
+// list returns the pruned branches, sorted.
+func (p *prunedBranches) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.branches) == 0 {
+		return nil
+	}
+
+	branches := make([]string, 0, len(p.branches))
+	for branch := range p.branches {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	return branches
+}
+
+// rewriteCanReachUserFilters reports whether expanding the rewrite of the request's relation
+// could yield a user matching one of its user filters. Like the top level pruning it is based on
+// the relationship graph, through the EdgePruner, and it errs on the side of reporting true.
+func (l *listUsersQuery) rewriteCanReachUserFilters(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	rewrite *openfgav1.Userset,
+) bool {
+	return l.rewriteCanReachFilters(typesys, req, rewrite, req.GetUserFilters())
+}
+
+// rewriteCanReachFilters is rewriteCanReachUserFilters for the given filters instead of the user
+// filters of the request.
+func (l *listUsersQuery) rewriteCanReachFilters(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	rewrite *openfgav1.Userset,
+	filters []*openfgav1.UserTypeFilter,
+) bool {
+	objectType := req.GetObject().GetType()
+
+	switch rw := rewrite.GetUserset().(type) {
+	case *openfgav1.Userset_This:
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, req.GetRelation())
+		if err != nil {
+			return true
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if relatedType.GetRelation() == "" {
+				for _, f := range filters {
+					if f.GetType() == relatedType.GetType() && f.GetRelation() == "" {
+						return true
+					}
+				}
+				continue
+			}
+			if l.relationCanReachUserFilters(typesys, req, relatedType.GetType(), relatedType.GetRelation(), filters) {
+				return true
+			}
+		}
+		return false
+	case *openfgav1.Userset_ComputedUserset:
+		return l.relationCanReachUserFilters(typesys, req, objectType, rw.ComputedUserset.GetRelation(), filters)
+	case *openfgav1.Userset_TupleToUserset:
+		directlyRelatedTypes, err := typesys.GetDirectlyRelatedUserTypes(objectType, rw.TupleToUserset.GetTupleset().GetRelation())
+		if err != nil {
+			return true
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			if l.relationCanReachUserFilters(typesys, req, relatedType.GetType(), rw.TupleToUserset.GetComputedUserset().GetRelation(), filters) {
+				return true
+			}
+		}
+		return false
+	case *openfgav1.Userset_Union:
+		for _, child := range rw.Union.GetChild() {
+			if l.rewriteCanReachFilters(typesys, req, child, filters) {
+				return true
+			}
+		}
+		return false
+	case *openfgav1.Userset_Intersection:
+		return l.operandsCanReachCommonFilter(typesys, req, rw.Intersection.GetChild(), filters)
+	case *openfgav1.Userset_Difference:
+		return l.rewriteCanReachFilters(typesys, req, rw.Difference.GetBase(), filters)
+	}
+
+	return true
+}
+
+// operandsCanReachCommonFilter reports whether every operand of an intersection could yield users
+// matching one same filter. Operands that can only yield users of distinct types have no user in
+// common, so the intersection can't have any.
+func (l *listUsersQuery) operandsCanReachCommonFilter(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	operands []*openfgav1.Userset,
+	filters []*openfgav1.UserTypeFilter,
+) bool {
+	for _, f := range filters {
+		common := true
+		for _, operand := range operands {
+			if !l.rewriteCanReachFilters(typesys, req, operand, []*openfgav1.UserTypeFilter{f}) {
+				common = false
+				break
+			}
+		}
+		if common {
+			return true
+		}
+	}
+	return false
+}
+
+// relationCanReachUserFilters reports whether expanding objectType#relation could yield a user
+// matching one of the filters. Relations that objectType doesn't define have no users, and other
+// errors are reported as reachable.
+func (l *listUsersQuery) relationCanReachUserFilters(
+	typesys *typesystem.TypeSystem,
+	req *internalListUsersRequest,
+	objectType, relation string,
+	filters []*openfgav1.UserTypeFilter,
+) bool {
+	target := typesystem.DirectRelationReference(objectType, relation)
+	for _, f := range filters {
+		if f.GetType() == objectType && f.GetRelation() == relation {
+			return true
+		}
+
+		source := typesystem.DirectRelationReference(f.GetType(), f.GetRelation())
+		hasPossibleEdges, err := l.hasPossibleEdges(typesys, req, target, source)
+		if err != nil {
+			return !errors.Is(err, typesystem.ErrRelationUndefined)
+		}
+		if hasPossibleEdges {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteString renders the rewrite of objectType#relation in the modeling language.
+func rewriteString(typesys *typesystem.TypeSystem, objectType, relation string, rewrite *openfgav1.Userset) string {
+	switch rw := rewrite.GetUserset().(type) {
+	case *openfgav1.Userset_This:
+		directlyRelatedTypes, _ := typesys.GetDirectlyRelatedUserTypes(objectType, relation)
+		restrictions := make([]string, 0, len(directlyRelatedTypes))
+		for _, relatedType := range directlyRelatedTypes {
+			restriction := relatedType.GetType()
+			switch {
+			case relatedType.GetWildcard() != nil:
+				restriction = tuple.TypedPublicWildcard(relatedType.GetType())
+			case relatedType.GetRelation() != "":
+				restriction = tuple.ToObjectRelationString(relatedType.GetType(), relatedType.GetRelation())
+			}
+			if relatedType.GetCondition() != "" {
+				restriction += " with " + relatedType.GetCondition()
+			}
+			restrictions = append(restrictions, restriction)
+		}
+		return "[" + strings.Join(restrictions, ", ") + "]"
+	case *openfgav1.Userset_ComputedUserset:
+		return rw.ComputedUserset.GetRelation()
+	case *openfgav1.Userset_TupleToUserset:
+		return fmt.Sprintf("%s from %s", rw.TupleToUserset.GetComputedUserset().GetRelation(), rw.TupleToUserset.GetTupleset().GetRelation())
+	case *openfgav1.Userset_Union:
+		return childrenString(typesys, objectType, relation, rw.Union.GetChild(), " or ")
+	case *openfgav1.Userset_Intersection:
+		return childrenString(typesys, objectType, relation, rw.Intersection.GetChild(), " and ")
+	case *openfgav1.Userset_Difference:
+		return childrenString(typesys, objectType, relation, []*openfgav1.Userset{rw.Difference.GetBase(), rw.Difference.GetSubtract()}, " but not ")
+	}
+	return ""
+}
+
+func childrenString(typesys *typesystem.TypeSystem, objectType, relation string, children []*openfgav1.Userset, operator string) string {
+	operands := make([]string, 0, len(children))
+	for _, child := range children {
+		operands = append(operands, rewriteString(typesys, objectType, relation, child))
+	}
+	return "(" + strings.Join(operands, operator) + ")"
+}
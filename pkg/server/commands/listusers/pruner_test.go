@@ -0,0 +1,171 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersDisjointOperands(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [user, employee]
+		type document
+			relations
+				define editor: [user, group#member]
+				define staff: [employee]
+				define blocked: [employee]
+				define muted: [user, employee]
+				define editing_staff: editor and staff
+				define muted_editor: editor and muted
+				define unblocked_editor: editor but not blocked
+				define unmuted_editor: editor but not muted`, []string{
+		"document:1#editor@user:jon",
+		"document:1#editor@group:eng#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@employee:andres",
+		"document:1#staff@employee:andres",
+		"document:1#blocked@employee:andres",
+		"document:1#muted@user:maria",
+	})
+
+	tests := []struct {
+		name              string
+		relation          string
+		userFilters       []*openfgav1.UserTypeFilter
+		expectedUsers     []string
+		expectedReads     []string
+		unexpectedReads   []string
+		expectedNoQueries bool
+	}{
+		{
+			name:              "intersection_operands_reach_distinct_types",
+			relation:          "editing_staff",
+			userFilters:       []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers:     []string{},
+			expectedNoQueries: true,
+		},
+		{
+			name:              "intersection_operands_reach_no_common_type",
+			relation:          "editing_staff",
+			userFilters:       []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group", Relation: "member"}},
+			expectedUsers:     []string{},
+			expectedNoQueries: true,
+		},
+		{
+			name:          "intersection_operands_reach_a_common_type",
+			relation:      "editing_staff",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "employee"}},
+			expectedUsers: []string{"employee:andres"},
+			expectedReads: []string{"editor", "staff"},
+		},
+		{
+			name:          "intersection_operands_reach_a_common_type_among_several",
+			relation:      "muted_editor",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "employee"}},
+			expectedUsers: []string{"user:maria"},
+			expectedReads: []string{"editor", "muted"},
+		},
+		{
+			name:            "subtract_cannot_reach_the_filter_type",
+			relation:        "unblocked_editor",
+			userFilters:     []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers:   []string{"user:jon", "user:maria"},
+			expectedReads:   []string{"editor"},
+			unexpectedReads: []string{"blocked"},
+		},
+		{
+			name:          "subtract_reaches_the_filter_type",
+			relation:      "unblocked_editor",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "employee"}},
+			expectedUsers: []string{},
+			expectedReads: []string{"editor", "blocked"},
+		},
+		{
+			name:          "subtract_reaches_one_of_the_filter_types",
+			relation:      "unmuted_editor",
+			userFilters:   []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expectedUsers: []string{"user:jon"},
+			expectedReads: []string{"editor", "muted"},
+		},
+	}
+
+	for _, test := range tests {
+		for _, strategy := range []ExclusionStrategy{ExclusionStrategyExpand, ExclusionStrategyCheck} {
+			t.Run(fmt.Sprintf("%s/strategy_%d", test.name, strategy), func(t *testing.T) {
+				var mu sync.Mutex
+				reads := map[string]struct{}{}
+				interceptor := func(_ context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if tupleKey.GetObject() == "document:1" {
+						reads[tupleKey.GetRelation()] = struct{}{}
+					}
+					return nil
+				}
+
+				resp, err := NewListUsersQuery(ds,
+					WithReadInterceptor(interceptor),
+					WithExclusionStrategy(strategy),
+				).ListUsers(ctx, &openfgav1.ListUsersRequest{
+					StoreId:     storeID,
+					Object:      &openfgav1.Object{Type: "document", Id: "1"},
+					Relation:    test.relation,
+					UserFilters: test.userFilters,
+				})
+				require.NoError(t, err)
+				require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+
+				if test.expectedNoQueries {
+					require.Zero(t, resp.GetMetadata().DatastoreQueryCount)
+					require.Empty(t, reads)
+				}
+				if strategy == ExclusionStrategyExpand {
+					// with ExclusionStrategyCheck the subtract is checked rather than read
+					for _, relation := range test.expectedReads {
+						require.Contains(t, reads, relation)
+					}
+				}
+				for _, relation := range test.unexpectedReads {
+					require.NotContains(t, reads, relation)
+				}
+			})
+		}
+	}
+}
+
+func TestRewriteReachableMemoized(t *testing.T) {
+	req := fromListUsersRequest(&openfgav1.ListUsersRequest{}, nil, nil)
+	subtract := &openfgav1.Userset{}
+	users := []*openfgav1.UserTypeFilter{{Type: "user"}}
+	employees := []*openfgav1.UserTypeFilter{{Type: "employee"}}
+
+	var calls int
+	canReach := func(reachable bool) func() bool {
+		return func() bool {
+			calls++
+			return reachable
+		}
+	}
+
+	require.False(t, rewriteReachable(req, subtract, users, canReach(false)))
+	require.False(t, rewriteReachable(req, subtract, users, canReach(true)))
+	require.Equal(t, 1, calls)
+
+	// the same rewrite reached with other filters, such as with fair type scheduling
+	require.True(t, rewriteReachable(req, subtract, employees, canReach(true)))
+	require.Equal(t, 2, calls)
+
+	// the memo is shared by the clones of the request
+	require.True(t, rewriteReachable(req.clone(), subtract, employees, canReach(false)))
+	require.Equal(t, 2, calls)
+}
@@ -0,0 +1,57 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// StoreReadRateLimiter limits the rate of the datastore reads made by ListUsers for each store,
+// so that expensive requests against one store can't starve the other stores of a shared
+// datastore. The same StoreReadRateLimiter must be passed to every ListUsers query for the rate
+// to hold across concurrent requests. It is safe for concurrent use.
+type StoreReadRateLimiter struct {
+	readsPerSecond rate.Limit
+	burst          int
+	limiters       sync.Map // store ID to *rate.Limiter
+}
+
+// NewStoreReadRateLimiter allows each store readsPerSecond reads per second on average, with
+// bursts of up to burst reads. A burst lower than 1 is raised to 1, since no read could ever be
+// made otherwise.
+func NewStoreReadRateLimiter(readsPerSecond float64, burst int) *StoreReadRateLimiter {
+	return &StoreReadRateLimiter{
+		readsPerSecond: rate.Limit(readsPerSecond),
+		burst:          max(1, burst),
+	}
+}
+
+// wait blocks until a read is allowed for the store, or returns ctx.Err() if ctx is done first.
+// The rate is measured and waited for on clock.
+func (s *StoreReadRateLimiter) wait(ctx context.Context, clock Clock, storeID string) error {
+	limiter, ok := s.limiters.Load(storeID)
+	if !ok {
+		limiter, _ = s.limiters.LoadOrStore(storeID, rate.NewLimiter(s.readsPerSecond, s.burst))
+	}
+
+	// unlike rate.Limiter.Wait, which fails right away when the read wouldn't be allowed before
+	// the deadline, this reports the context's own error so that running out of time while
+	// throttled still returns partial results
+	now := clock.Now()
+	reservation := limiter.(*rate.Limiter).ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	timer := clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		reservation.CancelAt(clock.Now())
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListUsersPerStoreReadRate(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ds := memory.New()
+	t.Cleanup(ds.Close)
+
+	const numGroups = 9
+	tuples := []string{}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@group:%d#member", i),
+			fmt.Sprintf("group:%d#member@user:%d", i, i),
+		)
+	}
+
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`
+	storeID, authModel := storagetest.BootstrapFGAStore(t, ds, model, tuples)
+	otherStoreID, _ := storagetest.BootstrapFGAStore(t, ds, model, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), authModel)
+	require.NoError(t, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	// reading document:1#viewer and then each group's members
+	const readsPerRequest = 1 + numGroups
+	const readsPerSecond = 100
+
+	listUsers := func(storeID string, opts ...ListUsersQueryOption) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("reads_throttled_to_rate", func(t *testing.T) {
+		limiter := NewStoreReadRateLimiter(readsPerSecond, 1)
+
+		start := time.Now()
+		resp := listUsers(storeID, WithPerStoreReadRate(limiter))
+		require.Len(t, resp.GetUsers(), numGroups)
+		require.Equal(t, uint32(readsPerRequest), resp.GetMetadata().DatastoreQueryCount)
+		require.GreaterOrEqual(t, time.Since(start), (readsPerRequest-1)*time.Second/readsPerSecond)
+	})
+
+	t.Run("rate_shared_by_requests_for_the_same_store", func(t *testing.T) {
+		limiter := NewStoreReadRateLimiter(readsPerSecond, 1)
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				listUsers(storeID, WithPerStoreReadRate(limiter))
+			}()
+		}
+		wg.Wait()
+		require.GreaterOrEqual(t, time.Since(start), (2*readsPerRequest-1)*time.Second/readsPerSecond)
+
+		// another store has a rate of its own, so its first read is allowed right away
+		start = time.Now()
+		require.NoError(t, limiter.wait(context.Background(), realClock{}, otherStoreID))
+		require.Less(t, time.Since(start), time.Second/readsPerSecond)
+	})
+
+	t.Run("partial_results_when_out_of_time", func(t *testing.T) {
+		limiter := NewStoreReadRateLimiter(1, 1)
+
+		resp := listUsers(storeID, WithPerStoreReadRate(limiter), WithListUsersDeadline(100*time.Millisecond))
+		require.Less(t, len(resp.GetUsers()), numGroups)
+	})
+}
@@ -0,0 +1,29 @@
+package listusers
+
+import (
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// withReferenceTime returns a copy of req whose context sets parameter to the timestamp at, in
+// place of any value the request sets it to. See WithReferenceTime.
+func withReferenceTime(req *openfgav1.ListUsersRequest, parameter string, at time.Time) *openfgav1.ListUsersRequest {
+	fields := make(map[string]*structpb.Value, len(req.GetContext().GetFields())+1)
+	for name, value := range req.GetContext().GetFields() {
+		fields[name] = value
+	}
+	fields[parameter] = structpb.NewStringValue(at.UTC().Format(time.RFC3339Nano))
+
+	return &openfgav1.ListUsersRequest{
+		StoreId:              req.GetStoreId(),
+		AuthorizationModelId: req.GetAuthorizationModelId(),
+		Object:               req.GetObject(),
+		Relation:             req.GetRelation(),
+		UserFilters:          req.GetUserFilters(),
+		ContextualTuples:     req.GetContextualTuples(),
+		Context:              &structpb.Struct{Fields: fields},
+		Consistency:          req.GetConsistency(),
+	}
+}
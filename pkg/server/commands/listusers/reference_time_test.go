@@ -0,0 +1,116 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_ReferenceTime(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user, user with time_window]
+		type document
+			relations
+				define parent: [folder, folder with time_window]
+				define viewer: [user, user with time_window] or viewer from parent
+		condition time_window(current_time: timestamp, grant_start: timestamp, grant_end: timestamp) {
+			current_time >= grant_start && current_time < grant_end
+		}`, nil)
+
+	window := func(start, end string) *structpb.Struct {
+		window, err := structpb.NewStruct(map[string]interface{}{"grant_start": start, "grant_end": end})
+		require.NoError(t, err)
+		return window
+	}
+	err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+		tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+		tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:anne", "time_window",
+			window("2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z")),
+		tuple.NewTupleKeyWithCondition("document:1", "viewer", "user:maria", "time_window",
+			window("2024-02-01T00:00:00Z", "2024-03-01T00:00:00Z")),
+		tuple.NewTupleKeyWithCondition("document:1", "parent", "folder:x", "time_window",
+			window("2024-01-15T00:00:00Z", "2024-02-15T00:00:00Z")),
+		tuple.NewTupleKey("folder:x", "viewer", "user:will"),
+		tuple.NewTupleKeyWithCondition("folder:x", "viewer", "user:bob", "time_window",
+			window("2024-01-20T00:00:00Z", "2024-01-25T00:00:00Z")),
+	})
+	require.NoError(t, err)
+
+	// the request's own current time is in none of the windows
+	reqContext, err := structpb.NewStruct(map[string]interface{}{"current_time": "2023-01-01T00:00:00Z"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		referenceTime time.Time
+		expectedUsers []string
+	}{
+		{
+			name:          "before_every_window",
+			referenceTime: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+			expectedUsers: []string{"user:jon"},
+		},
+		{
+			name:          "first_window",
+			referenceTime: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+			expectedUsers: []string{"user:jon", "user:anne"},
+		},
+		{
+			name:          "overlapping_windows_along_ttu",
+			referenceTime: time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC),
+			expectedUsers: []string{"user:jon", "user:anne", "user:will", "user:bob"},
+		},
+		{
+			name:          "second_window",
+			referenceTime: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC),
+			expectedUsers: []string{"user:jon", "user:maria", "user:will"},
+		},
+		{
+			name:          "reference_time_in_another_zone",
+			referenceTime: time.Date(2024, 2, 1, 0, 30, 0, 0, time.FixedZone("UTC+1", 60*60)),
+			expectedUsers: []string{"user:jon", "user:anne", "user:will"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, WithReferenceTime("current_time", test.referenceTime)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+				Context:     reqContext,
+			})
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+		})
+	}
+
+	t.Run("request_context_unchanged", func(t *testing.T) {
+		req := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			Context:     reqContext,
+		}
+		_, err := NewListUsersQuery(ds, WithReferenceTime("current_time", time.Now())).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, "2023-01-01T00:00:00Z", req.GetContext().GetFields()["current_time"].GetStringValue())
+
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:jon"}, userStrings(resp.GetUsers()))
+	})
+}
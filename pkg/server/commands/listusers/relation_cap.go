@@ -0,0 +1,54 @@
+package listusers
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// relationRecursionCap returns the number of members of objectType#relation followed per object,
+// and whether it is capped at all. See WithRelationRecursionCap.
+func (l *listUsersQuery) relationRecursionCap(objectType, relation string) (uint32, bool) {
+	if len(l.relationRecursionCaps) == 0 {
+		return 0, false
+	}
+	membersCap, ok := l.relationRecursionCaps[tuple.ToObjectRelationString(objectType, relation)]
+	return membersCap, ok
+}
+
+// cappedRelations records the relations whose members weren't all followed during an expansion
+// because of their cap. It is safe for concurrent use.
+type cappedRelations struct {
+	mu        sync.Mutex
+	relations map[string]struct{}
+}
+
+func newCappedRelations() *cappedRelations {
+	return &cappedRelations{
+		relations: make(map[string]struct{}),
+	}
+}
+
+// add records that the members of objectType#relation were capped.
+func (c *cappedRelations) add(objectType, relation string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.relations[tuple.ToObjectRelationString(objectType, relation)] = struct{}{}
+}
+
+// list returns the capped relations, sorted.
+func (c *cappedRelations) list() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.relations) == 0 {
+		return nil
+	}
+
+	relations := make([]string, 0, len(c.relations))
+	for relation := range c.relations {
+		relations = append(relations, relation)
+	}
+	sort.Strings(relations)
+	return relations
+}
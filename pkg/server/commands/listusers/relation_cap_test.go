@@ -0,0 +1,105 @@
+package listusers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersConfig_RelationRecursionCap(t *testing.T) {
+	const numEmployees = 200
+	tuples := []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:all_employees#member",
+		"group:eng#member@user:maria",
+		"group:eng#member@user:will",
+		"document:1#parent@folder:a",
+		"document:1#parent@folder:b",
+		"folder:a#viewer@user:anne",
+		"folder:b#viewer@user:bob",
+	}
+	for i := 0; i < numEmployees; i++ {
+		tuples = append(tuples, fmt.Sprintf("group:all_employees#member@user:employee_%d", i))
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user, group#member] or viewer from parent`, tuples)
+
+	listUsers := func(t *testing.T, caps map[string]uint32) *listUsersResponse {
+		resp, err := NewListUsersQuery(ds, WithRelationRecursionCap(caps)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	countEmployees := func(users []string) int {
+		count := 0
+		for _, user := range users {
+			if strings.HasPrefix(user, "user:employee_") {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("uncapped", func(t *testing.T) {
+		resp := listUsers(t, nil)
+		require.Len(t, resp.GetUsers(), numEmployees+5)
+		require.Nil(t, resp.GetMetadata().CappedRelations)
+	})
+
+	t.Run("large_group_capped_while_others_expand_fully", func(t *testing.T) {
+		resp := listUsers(t, map[string]uint32{"group#member": 10})
+		users := userStrings(resp.GetUsers())
+		require.Equal(t, 10, countEmployees(users))
+		require.Subset(t, users, []string{"user:jon", "user:maria", "user:will", "user:anne", "user:bob"})
+		require.Len(t, users, 15)
+		require.Equal(t, []string{"group#member"}, resp.GetMetadata().CappedRelations)
+	})
+
+	t.Run("cap_above_the_number_of_members", func(t *testing.T) {
+		resp := listUsers(t, map[string]uint32{"group#member": numEmployees})
+		require.Len(t, resp.GetUsers(), numEmployees+5)
+		require.Nil(t, resp.GetMetadata().CappedRelations)
+	})
+
+	t.Run("zero_cap_skips_the_members", func(t *testing.T) {
+		resp := listUsers(t, map[string]uint32{"group#member": 0})
+		require.ElementsMatch(t, []string{"user:jon", "user:anne", "user:bob"}, userStrings(resp.GetUsers()))
+		require.Equal(t, []string{"group#member"}, resp.GetMetadata().CappedRelations)
+	})
+
+	t.Run("tupleset_relation_capped", func(t *testing.T) {
+		resp := listUsers(t, map[string]uint32{"document#parent": 1})
+		users := userStrings(resp.GetUsers())
+		require.Len(t, users, numEmployees+4)
+		require.Subset(t, users, []string{"user:jon", "user:maria", "user:will"})
+		require.Equal(t, []string{"document#parent"}, resp.GetMetadata().CappedRelations)
+	})
+
+	t.Run("several_relations_capped", func(t *testing.T) {
+		resp := listUsers(t, map[string]uint32{"group#member": 1, "document#parent": 0, "document#viewer": 2})
+		require.Len(t, resp.GetUsers(), 2)
+		require.Equal(t, []string{"document#parent", "document#viewer", "group#member"}, resp.GetMetadata().CappedRelations)
+	})
+}
@@ -0,0 +1,161 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync/atomic"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/openfga/openfga/internal/concurrency"
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	serverErrors "github.com/openfga/openfga/pkg/server/errors"
+	"github.com/openfga/openfga/pkg/telemetry"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// ListUsersForRelations lists the users that have any of the relations with the object of the
+// request, and reports in the UserRelations of the response metadata which of the relations each
+// of them has. The relation of the request is ignored. The relations are expanded concurrently,
+// up to the resolve node breadth limit at once, under a single deadline, and the max results
+// apply to the users of all of them: once the users of the relations, in the order they are
+// listed, reach the max results, the others are left out and the response isn't complete. The
+// users aren't paged. Like ListUsers, it assumes that the typesystem is in the context and that
+// the request is valid for each of the relations.
+func (l *listUsersQuery) ListUsersForRelations(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	relations ...string,
+) (*listUsersResponse, error) {
+	ctx, span := tracer.Start(ctx, "ListUsersForRelations", trace.WithAttributes(
+		attribute.StringSlice("relations", relations),
+	))
+	defer span.End()
+
+	if l.deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.deadline)
+		defer cancel()
+	}
+
+	unique := make([]string, 0, len(relations))
+	seenRelations := make(map[string]struct{}, len(relations))
+	for _, relation := range relations {
+		if _, seen := seenRelations[relation]; !seen {
+			seenRelations[relation] = struct{}{}
+			unique = append(unique, relation)
+		}
+	}
+
+	responses := make([]*listUsersResponse, len(unique))
+	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+	for i, relation := range unique {
+		relationReq := &openfgav1.ListUsersRequest{
+			StoreId:              req.GetStoreId(),
+			AuthorizationModelId: req.GetAuthorizationModelId(),
+			Object:               req.GetObject(),
+			Relation:             relation,
+			UserFilters:          req.GetUserFilters(),
+			ContextualTuples:     req.GetContextualTuples(),
+			Context:              req.GetContext(),
+			Consistency:          req.GetConsistency(),
+		}
+
+		// ListUsers wraps the datastore of its query, so each relation gets a query of its own,
+		// bounded by the deadline above rather than one of its own
+		q := *l
+		q.pageSize = 0
+		q.deadline = 0
+		pool.Go(func(ctx context.Context) error {
+			resp, err := q.ListUsers(ctx, relationReq)
+			responses[i] = resp
+			return err
+		})
+	}
+	if err := pool.Wait(); err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	var datastoreQueryCount uint32
+	var dispatchCount atomic.Uint32
+	var wasTruncated bool
+	complete := true
+	users := []*openfgav1.User{}
+	userRelations := make(map[string][]string)
+	for i, resp := range responses {
+		datastoreQueryCount += resp.Metadata.DatastoreQueryCount
+		dispatchCount.Add(resp.Metadata.DispatchCounter.Load())
+		wasTruncated = wasTruncated || resp.Metadata.WasTruncated
+		complete = complete && resp.Metadata.Complete
+		for _, user := range resp.GetUsers() {
+			key := tuple.UserProtoToString(user)
+			if _, found := userRelations[key]; !found {
+				if l.maxResults > 0 && uint32(len(users)) >= l.maxResults {
+					complete = false
+					continue
+				}
+				users = append(users, user)
+			}
+			userRelations[key] = append(userRelations[key], unique[i])
+		}
+	}
+
+	span.SetAttributes(attribute.Int("result_count", len(users)))
+
+	return &listUsersResponse{
+		Users: users,
+		Metadata: listUsersResponseMetadata{
+			DatastoreQueryCount: datastoreQueryCount,
+			DispatchCounter:     &dispatchCount,
+			Complete:            complete,
+			WasTruncated:        wasTruncated,
+			UserRelations:       userRelations,
+		},
+	}, nil
+}
+
+// ListUsersForRelationGlob lists the users that have any of the relations of the object type of the
+// request whose name matches pattern, such as "can_*", like ListUsersForRelations does for the
+// relations listed. The pattern has the syntax of path.Match. It fails with an InvalidArgument
+// error if the pattern is malformed or if no relation of the object type matches it.
+func (l *listUsersQuery) ListUsersForRelationGlob(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	pattern string,
+) (*listUsersResponse, error) {
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	objectType := req.GetObject().GetType()
+	relations, err := typesys.GetRelations(objectType)
+	if err != nil {
+		return nil, serverErrors.TypeNotFound(objectType)
+	}
+
+	matching := make([]string, 0, len(relations))
+	for relation := range relations {
+		matched, err := path.Match(pattern, relation)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid relation pattern '%s': %s", pattern, err))
+		}
+		if matched {
+			matching = append(matching, relation)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("no relation of type '%s' matches '%s'", objectType, pattern))
+	}
+	sort.Strings(matching)
+
+	return l.ListUsersForRelations(ctx, req, matching...)
+}
@@ -0,0 +1,197 @@
+package listusers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestListUsersForRelations(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define owner: [user]
+				define editor: [user, group#member] or owner
+				define viewer: [user, user:*] or editor`, []string{
+		"document:1#owner@user:anne",
+		"document:1#editor@group:eng#member",
+		"document:1#viewer@user:jon",
+		"group:eng#member@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	tests := []struct {
+		name      string
+		relations []string
+		expected  map[string][]string
+	}{
+		{
+			name:      "relations_attributed_to_each_user",
+			relations: []string{"viewer", "editor", "owner"},
+			expected: map[string][]string{
+				"user:anne":  {"viewer", "editor", "owner"},
+				"user:maria": {"viewer", "editor"},
+				"user:jon":   {"viewer"},
+			},
+		},
+		{
+			name:      "users_of_any_relation",
+			relations: []string{"owner", "owner", "editor"},
+			expected: map[string][]string{
+				"user:anne":  {"owner", "editor"},
+				"user:maria": {"editor"},
+			},
+		},
+		{
+			name:     "no_relations",
+			expected: map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds).ListUsersForRelations(ctx, req, test.relations...)
+			require.NoError(t, err)
+			require.ElementsMatch(t, keysOf(test.expected), userStrings(resp.GetUsers()))
+			if len(test.expected) == 0 {
+				require.Empty(t, resp.Metadata.UserRelations)
+				return
+			}
+			require.Equal(t, test.expected, resp.Metadata.UserRelations)
+			require.Positive(t, resp.Metadata.DatastoreQueryCount)
+		})
+	}
+
+	t.Run("max_results_shared_across_relations", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithListUsersMaxResults(2)).ListUsersForRelations(ctx, req, "viewer", "editor", "owner")
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 2)
+		require.False(t, resp.Metadata.Complete)
+		require.ElementsMatch(t, userStrings(resp.GetUsers()), keysOf(resp.Metadata.UserRelations))
+	})
+
+	t.Run("deadline_shared_across_relations", func(t *testing.T) {
+		slowReads := WithReadInterceptor(func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error {
+			select {
+			case <-time.After(time.Second):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+
+		start := time.Now()
+		resp, err := NewListUsersQuery(ds, slowReads, WithListUsersDeadline(100*time.Millisecond)).ListUsersForRelations(ctx, req, "viewer", "editor", "owner")
+		require.NoError(t, err)
+		require.False(t, resp.Metadata.Complete)
+		// the relations are expanded at once rather than each for a deadline of its own
+		require.Less(t, time.Since(start), 200*time.Millisecond)
+	})
+
+	t.Run("single_relation_request_unaffected", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:anne", "user:maria", "user:jon"}, userStrings(resp.GetUsers()))
+		require.Nil(t, resp.Metadata.UserRelations)
+	})
+}
+
+func TestListUsersForRelationGlob(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define editor: [user] or owner
+				define viewer: [user] or editor
+				define can_delete: owner
+				define can_edit: editor
+				define can_view: viewer
+				define can_share: [user] and editor`, []string{
+		"document:1#owner@user:anne",
+		"document:1#editor@user:maria",
+		"document:1#viewer@user:jon",
+		"document:1#can_share@user:jon",
+		"document:1#can_share@user:maria",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	tests := []struct {
+		name        string
+		pattern     string
+		expected    map[string][]string
+		expectedErr string
+	}{
+		{
+			name:    "prefix",
+			pattern: "can_*",
+			expected: map[string][]string{
+				"user:anne":  {"can_delete", "can_edit", "can_view"},
+				"user:maria": {"can_edit", "can_share", "can_view"},
+				"user:jon":   {"can_view"},
+			},
+		},
+		{
+			name:    "character_class",
+			pattern: "can_[de]*",
+			expected: map[string][]string{
+				"user:anne":  {"can_delete", "can_edit"},
+				"user:maria": {"can_edit"},
+			},
+		},
+		{
+			name:     "exact_name",
+			pattern:  "owner",
+			expected: map[string][]string{"user:anne": {"owner"}},
+		},
+		{
+			name:        "no_matching_relation",
+			pattern:     "may_*",
+			expectedErr: "no relation of type 'document' matches 'may_*'",
+		},
+		{
+			name:        "malformed_pattern",
+			pattern:     "can_[",
+			expectedErr: "invalid relation pattern 'can_['",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds).ListUsersForRelationGlob(ctx, req, test.pattern)
+			if test.expectedErr != "" {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.ElementsMatch(t, keysOf(test.expected), userStrings(resp.GetUsers()))
+			require.Equal(t, test.expected, resp.Metadata.UserRelations)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsersResultMetrics(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]
+				define editor: [user]`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:will",
+		"group:eng#member@user:jon",
+	})
+
+	req := func(relation string) *openfgav1.ListUsersRequest {
+		return &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}
+	}
+
+	// the store is new, so the metrics of its labels only reflect the requests below
+	resultSizes := func(t *testing.T, objectType, relation string) (uint64, float64) {
+		var metric dto.Metric
+		observer := resultSizeHistogram.WithLabelValues(storeID, objectType, relation)
+		require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+		return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+	}
+	truncatedResponses := func(relation string) float64 {
+		return promtestutil.ToFloat64(truncatedResponsesCounter.WithLabelValues(storeID, "document", relation))
+	}
+
+	t.Run("observes_unique_users_returned", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req("viewer"))
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 3)
+
+		count, sum := resultSizes(t, "document", "viewer")
+		require.Equal(t, uint64(1), count)
+		require.InDelta(t, 3, sum, 0)
+		require.InDelta(t, 0, truncatedResponses("viewer"), 0)
+	})
+
+	t.Run("counts_truncated_responses", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithListUsersMaxResults(1)).ListUsers(ctx, req("viewer"))
+		require.NoError(t, err)
+		require.Len(t, resp.GetUsers(), 1)
+
+		count, sum := resultSizes(t, "document", "viewer")
+		require.Equal(t, uint64(2), count)
+		require.InDelta(t, 4, sum, 0)
+		require.InDelta(t, 1, truncatedResponses("viewer"), 0)
+	})
+
+	t.Run("observes_empty_results", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds).ListUsers(ctx, req("editor"))
+		require.NoError(t, err)
+		require.Empty(t, resp.GetUsers())
+
+		count, sum := resultSizes(t, "document", "editor")
+		require.Equal(t, uint64(1), count)
+		require.InDelta(t, 0, sum, 0)
+	})
+
+	t.Run("nested_listings_not_observed", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithUsersetCover(true)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:  storeID,
+			Object:   &openfgav1.Object{Type: "document", Id: "1"},
+			Relation: "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{
+				{Type: "user"},
+				{Type: "group", Relation: "member"},
+			},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.GetUsers())
+
+		count, _ := resultSizes(t, "document", "viewer")
+		require.Equal(t, uint64(3), count)
+		// the cover lists the members of group:eng on its own
+		groupCount, _ := resultSizes(t, "group", "member")
+		require.Zero(t, groupCount)
+	})
+}
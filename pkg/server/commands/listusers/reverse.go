@@ -0,0 +1,400 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openfga/openfga/internal/concurrency"
+	"github.com/openfga/openfga/internal/condition"
+	"github.com/openfga/openfga/internal/condition/eval"
+	openfgaErrors "github.com/openfga/openfga/internal/errors"
+	"github.com/openfga/openfga/internal/graph"
+	"github.com/openfga/openfga/internal/validation"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/storagewrappers"
+	"github.com/openfga/openfga/pkg/telemetry"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// errRequiresTopDown is returned by the reverse walk when it reaches an edge it can't resolve
+// on its own.
+var errRequiresTopDown = errors.New("intersection or exclusion reached in reverse expansion")
+
+// reverseNode is a user, userset or wildcard reached while walking from a candidate user
+// towards the object. The relation is empty for users and wildcards.
+type reverseNode struct {
+	object   string
+	relation string
+}
+
+func (n reverseNode) sourceReference() *openfgav1.RelationReference {
+	objectType, objectID := tuple.SplitObject(n.object)
+	if objectID == tuple.Wildcard {
+		return typesystem.WildcardRelationReference(objectType)
+	}
+	return typesystem.DirectRelationReference(objectType, n.relation)
+}
+
+// ListCandidateUsers returns which of the candidate users have the relation with the object and
+// match one of the user filters.
+//
+// Rather than expanding the object top-down, it walks from each candidate towards the object the
+// same way ListObjects does: the tuples starting with the candidate are read with
+// ReadStartingWithUser and followed along the relationship graph until the object is reached.
+// That is much cheaper than ListUsers when the candidates relate to few objects but the object
+// relates to many users. The reverse walk can't resolve intersections nor exclusions, so requests
+// reaching one are expanded top-down instead and the results narrowed down to the candidates.
+func (l *listUsersQuery) ListCandidateUsers(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	candidates []*openfgav1.User,
+) (*listUsersResponse, error) {
+	ctx, span := tracer.Start(ctx, "ListCandidateUsers", trace.WithAttributes(
+		attribute.String("object", tuple.ObjectKey(req.GetObject())),
+		attribute.String("relation", req.GetRelation()),
+		attribute.Int("candidates", len(candidates)),
+	))
+	defer span.End()
+
+	typesys, ok := typesystem.TypesystemFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: typesystem missing in context", openfgaErrors.ErrUnknown)
+	}
+
+	if l.snapshotTokenErr != nil {
+		telemetry.TraceError(span, l.snapshotTokenErr)
+		return nil, l.snapshotTokenErr
+	}
+
+	if err := checkModelFeaturesOnce(typesys, req.GetObject().GetType(), req.GetRelation()); err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	if l.deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.deadline)
+		defer cancel()
+	}
+
+	snapshotToken, err := l.snapshotTokenFor(ctx, req.GetStoreId())
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+
+	var matching []*openfgav1.User
+	for _, candidate := range candidates {
+		if userMatchesFilters(candidate, req.GetUserFilters()) {
+			matching = append(matching, candidate)
+		}
+	}
+
+	resp, err := l.listCandidateUsersBottomUp(ctx, typesys, req, matching, snapshotToken)
+	if errors.Is(err, errRequiresTopDown) {
+		span.SetAttributes(attribute.Bool("top_down", true))
+		return l.listCandidateUsersTopDown(ctx, req, matching)
+	}
+	if err != nil {
+		telemetry.TraceError(span, err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *listUsersQuery) listCandidateUsersBottomUp(
+	ctx context.Context,
+	typesys *typesystem.TypeSystem,
+	req *openfgav1.ListUsersRequest,
+	candidates []*openfgav1.User,
+	snapshotToken string,
+) (*listUsersResponse, error) {
+	ds := storagewrappers.NewCombinedTupleReader(l.pinned(l.ds, snapshotToken), req.GetContextualTuples())
+	if l.sharedWorkerPool != nil {
+		ds = &sharedPoolTupleReader{RelationshipTupleReader: ds, queue: l.sharedWorkerPool.queue()}
+	}
+	ds = storagewrappers.NewBoundedConcurrencyTupleReader(ds, l.maxConcurrentReads)
+
+	var datastoreQueryCount, dispatchCount atomic.Uint32
+	found := make([]bool, len(candidates))
+
+	pool := concurrency.NewPool(ctx, int(l.resolveNodeBreadthLimit))
+	for i, candidate := range candidates {
+		pool.Go(recoverPanics(func(ctx context.Context) error {
+			reached, err := l.reachesObject(ctx, typesys, ds, req, candidate, &datastoreQueryCount, &dispatchCount)
+			found[i] = reached
+			return err
+		}))
+	}
+	if err := pool.Wait(); err != nil {
+		return nil, err
+	}
+
+	users := make([]*openfgav1.User, 0, len(candidates))
+	for i, candidate := range candidates {
+		if found[i] {
+			users = append(users, candidate)
+		}
+	}
+
+	return &listUsersResponse{
+		Users: users,
+		Metadata: listUsersResponseMetadata{
+			DatastoreQueryCount: datastoreQueryCount.Load(),
+			DispatchCounter:     &dispatchCount,
+			Complete:            true,
+		},
+	}, nil
+}
+
+// reachesObject walks breadth-first from the candidate towards the object of the request, and
+// reports whether the object's relation was reached.
+func (l *listUsersQuery) reachesObject(
+	ctx context.Context,
+	typesys *typesystem.TypeSystem,
+	ds storage.RelationshipTupleReader,
+	req *openfgav1.ListUsersRequest,
+	candidate *openfgav1.User,
+	datastoreQueryCount, dispatchCount *atomic.Uint32,
+) (bool, error) {
+	target := reverseNode{object: tuple.ObjectKey(req.GetObject()), relation: req.GetRelation()}
+	targetRef := typesystem.DirectRelationReference(req.GetObject().GetType(), req.GetRelation())
+
+	start := reverseNode{object: tuple.UserProtoToString(candidate)}
+	if userset := candidate.GetUserset(); userset != nil {
+		start = reverseNode{object: tuple.BuildObject(userset.GetType(), userset.GetId()), relation: userset.GetRelation()}
+	}
+	if start == target {
+		return true, nil
+	}
+
+	g := graph.New(typesys)
+	visited := map[reverseNode]struct{}{start: {}}
+	frontier := []reverseNode{start}
+	for depth := uint32(0); len(frontier) > 0; depth++ {
+		if depth >= l.resolveNodeLimit {
+			return false, graph.ErrResolutionDepthExceeded
+		}
+
+		var next []reverseNode
+		for _, node := range frontier {
+			dispatchCount.Add(1)
+			reached, err := l.reverseStep(ctx, typesys, g, ds, req, targetRef, node, datastoreQueryCount)
+			if err != nil {
+				return false, err
+			}
+			for _, n := range reached {
+				if n == target {
+					return true, nil
+				}
+				if _, ok := visited[n]; !ok {
+					visited[n] = struct{}{}
+					next = append(next, n)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return false, nil
+}
+
+// reverseStep returns the usersets that node is directly a part of, following the edges of the
+// relationship graph that lead towards targetRef.
+func (l *listUsersQuery) reverseStep(
+	ctx context.Context,
+	typesys *typesystem.TypeSystem,
+	g *graph.RelationshipGraph,
+	ds storage.RelationshipTupleReader,
+	req *openfgav1.ListUsersRequest,
+	targetRef *openfgav1.RelationReference,
+	node reverseNode,
+	datastoreQueryCount *atomic.Uint32,
+) ([]reverseNode, error) {
+	edges, err := g.GetPrunedRelationshipEdges(targetRef, node.sourceReference())
+	if err != nil {
+		return nil, err
+	}
+
+	var reached []reverseNode
+	for _, edge := range edges {
+		if edge.TargetReferenceInvolvesIntersectionOrExclusion {
+			return nil, errRequiresTopDown
+		}
+
+		edgeType := edge.TargetReference.GetType()
+		edgeRelation := edge.TargetReference.GetRelation()
+
+		switch edge.Type {
+		case graph.ComputedUsersetEdge:
+			reached = append(reached, reverseNode{object: node.object, relation: edgeRelation})
+		case graph.DirectEdge:
+			userFilter := []*openfgav1.ObjectRelation{{Object: node.object, Relation: node.relation}}
+			if nodeType, nodeID := tuple.SplitObject(node.object); node.relation == "" && nodeID != tuple.Wildcard {
+				publiclyAssignable, err := typesys.IsPubliclyAssignable(edge.TargetReference, nodeType)
+				if err != nil {
+					return nil, err
+				}
+				if publiclyAssignable {
+					userFilter = append(userFilter, &openfgav1.ObjectRelation{Object: tuple.TypedPublicWildcard(nodeType)})
+				}
+			}
+
+			objects, err := l.readStartingWithUser(ctx, typesys, ds, req, edgeType, edgeRelation, userFilter, datastoreQueryCount)
+			if err != nil {
+				return nil, err
+			}
+			for _, object := range objects {
+				reached = append(reached, reverseNode{object: object, relation: edgeRelation})
+			}
+		case graph.TupleToUsersetEdge:
+			userFilter := []*openfgav1.ObjectRelation{{Object: node.object}}
+			objects, err := l.readStartingWithUser(ctx, typesys, ds, req, edgeType, edge.TuplesetRelation, userFilter, datastoreQueryCount)
+			if err != nil {
+				return nil, err
+			}
+			for _, object := range objects {
+				reached = append(reached, reverseNode{object: object, relation: edgeRelation})
+			}
+		default:
+			panic("unsupported edge type")
+		}
+	}
+
+	return reached, nil
+}
+
+// readStartingWithUser returns the objects of objectType related to any of the users in
+// userFilter by relation, skipping the tuples the model doesn't allow or whose condition isn't
+// met.
+func (l *listUsersQuery) readStartingWithUser(
+	ctx context.Context,
+	typesys *typesystem.TypeSystem,
+	ds storage.RelationshipTupleReader,
+	req *openfgav1.ListUsersRequest,
+	objectType, relation string,
+	userFilter []*openfgav1.ObjectRelation,
+	datastoreQueryCount *atomic.Uint32,
+) ([]string, error) {
+	if l.storeReadRateLimiter != nil {
+		if err := l.storeReadRateLimiter.wait(ctx, l.clock, req.GetStoreId()); err != nil {
+			return nil, err
+		}
+	}
+
+	iter, err := ds.ReadStartingWithUser(ctx, req.GetStoreId(), storage.ReadStartingWithUserFilter{
+		ObjectType: objectType,
+		Relation:   relation,
+		UserFilter: userFilter,
+	}, storage.ReadStartingWithUserOptions{
+		Consistency: storage.ConsistencyOptions{
+			Preference: req.GetConsistency(),
+		},
+		Partition: l.partition,
+	})
+	if err != nil {
+		return nil, wrapDatastoreError(err)
+	}
+	datastoreQueryCount.Add(1)
+
+	filteredIter := storage.NewFilteredTupleKeyIterator(
+		storage.NewTupleKeyIteratorFromTupleIterator(&datastoreErrorIterator{TupleIterator: iter}),
+		validation.FilterInvalidTuples(typesys),
+	)
+	defer filteredIter.Stop()
+
+	var objects []string
+	for {
+		tk, err := filteredIter.Next(ctx)
+		if err != nil {
+			if errors.Is(err, storage.ErrIteratorDone) {
+				return objects, nil
+			}
+			return nil, err
+		}
+
+		condEvalResult, err := eval.EvaluateTupleCondition(ctx, tk, typesys, req.GetContext())
+		if err != nil {
+			return nil, err
+		}
+		if len(condEvalResult.MissingParameters) > 0 {
+			return nil, condition.NewEvaluationError(
+				tk.GetCondition().GetName(),
+				fmt.Errorf("context is missing parameters '%v'", condEvalResult.MissingParameters),
+			)
+		}
+		if !condEvalResult.ConditionMet {
+			continue
+		}
+
+		objects = append(objects, tk.GetObject())
+	}
+}
+
+// listCandidateUsersTopDown lists the users of the request top-down and returns the candidates
+// among them. A user is considered listed if a public wildcard of its type is.
+func (l *listUsersQuery) listCandidateUsersTopDown(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	candidates []*openfgav1.User,
+) (*listUsersResponse, error) {
+	q := *l
+	q.maxResults = 0
+	q.maxResponseBytes = 0
+	q.reservoirSampleSize = 0
+	q.requestCoalescing = false
+
+	resp, err := q.ListUsers(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]struct{}, len(resp.GetUsers()))
+	for _, user := range resp.GetUsers() {
+		listed[tuple.UserProtoToString(user)] = struct{}{}
+	}
+
+	users := make([]*openfgav1.User, 0, len(candidates))
+	for _, candidate := range candidates {
+		_, ok := listed[tuple.UserProtoToString(candidate)]
+		if !ok && candidate.GetObject() != nil {
+			_, ok = listed[tuple.TypedPublicWildcard(candidate.GetObject().GetType())]
+		}
+		if ok {
+			users = append(users, candidate)
+		}
+	}
+
+	resp.Users = users
+	return resp, nil
+}
+
+// userMatchesFilters reports whether the user matches one of the user filters. Users and
+// wildcards match type filters, and usersets match filters of the same type and relation, or of
+// the same type and AnyRelation.
+func userMatchesFilters(user *openfgav1.User, filters []*openfgav1.UserTypeFilter) bool {
+	for _, f := range filters {
+		switch u := user.GetUser().(type) {
+		case *openfgav1.User_Object:
+			if f.GetType() == u.Object.GetType() && f.GetRelation() == "" {
+				return true
+			}
+		case *openfgav1.User_Wildcard:
+			if f.GetType() == u.Wildcard.GetType() && f.GetRelation() == "" {
+				return true
+			}
+		case *openfgav1.User_Userset:
+			if f.GetType() == u.Userset.GetType() && filterMatchesUsersetRelation(f, u.Userset.GetRelation()) {
+				return true
+			}
+		}
+	}
+	return false
+}
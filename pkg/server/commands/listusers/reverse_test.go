@@ -0,0 +1,227 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+	storagetest "github.com/openfga/openfga/pkg/storage/test"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+func TestListCandidateUsers(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user with is_valid, group#member]
+		type folder
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define viewer: [user, user:*, group#member] or owner or viewer from parent
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user]
+				define editor: [user]
+				define viewer: [user, group#member] or editor or viewer from parent
+				define can_view: viewer but not blocked
+				define can_edit: editor and viewer
+		condition is_valid(valid: bool) {
+			valid
+		}`, []string{
+		"document:1#viewer@user:jon",
+		"document:1#viewer@group:eng#member",
+		"document:1#editor@user:poovam",
+		"document:1#parent@folder:x",
+		"document:1#blocked@user:maria",
+		"document:2#parent@folder:public",
+		"folder:x#parent@folder:y",
+		"folder:y#owner@user:will",
+		"folder:public#viewer@user:*",
+		"group:eng#member@user:maria",
+		"group:eng#member@group:fga#member",
+		"group:fga#member@user:andres",
+		"group:fga#member@user:jane",
+	})
+
+	candidates := []*openfgav1.User{
+		tuple.StringToUserProto("user:jon"),
+		tuple.StringToUserProto("user:maria"),
+		tuple.StringToUserProto("user:andres"),
+		tuple.StringToUserProto("user:poovam"),
+		tuple.StringToUserProto("user:will"),
+		tuple.StringToUserProto("user:nobody"),
+		tuple.StringToUserProto("user:*"),
+		tuple.StringToUserProto("group:eng#member"),
+		tuple.StringToUserProto("group:fga#member"),
+		tuple.StringToUserProto("group:other#member"),
+		tuple.StringToUserProto("folder:x"),
+	}
+
+	tests := []struct {
+		name             string
+		objectID         string
+		relation         string
+		userFilters      []*openfgav1.UserTypeFilter
+		contextualTuples []*openfgav1.TupleKey
+		expected         []string
+	}{
+		{
+			name:        "users_through_groups_and_parents",
+			objectID:    "1",
+			relation:    "viewer",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:    []string{"user:jon", "user:maria", "user:andres", "user:poovam", "user:will"},
+		},
+		{
+			name:        "usersets",
+			objectID:    "1",
+			relation:    "viewer",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			expected:    []string{"group:eng#member", "group:fga#member"},
+		},
+		{
+			name:        "public_wildcard",
+			objectID:    "2",
+			relation:    "viewer",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:    []string{"user:jon", "user:maria", "user:andres", "user:poovam", "user:will", "user:nobody", "user:*"},
+		},
+		{
+			name:        "contextual_tuples",
+			objectID:    "2",
+			relation:    "viewer",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "group", Relation: "member"}},
+			contextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("folder:public", "viewer", "group:other#member"),
+			},
+			expected: []string{"group:other#member"},
+		},
+		{
+			name:        "exclusion_falls_back_to_top_down",
+			objectID:    "1",
+			relation:    "can_view",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:    []string{"user:jon", "user:andres", "user:poovam", "user:will"},
+		},
+		{
+			name:        "intersection_falls_back_to_top_down",
+			objectID:    "1",
+			relation:    "can_edit",
+			userFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			expected:    []string{"user:poovam"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &openfgav1.ListUsersRequest{
+				StoreId:          storeID,
+				Object:           &openfgav1.Object{Type: "document", Id: test.objectID},
+				Relation:         test.relation,
+				UserFilters:      test.userFilters,
+				ContextualTuples: test.contextualTuples,
+			}
+
+			resp, err := NewListUsersQuery(ds).ListCandidateUsers(ctx, req, candidates)
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+
+			// the candidates must be the ones the top-down expansion lists
+			topDown, err := NewListUsersQuery(ds).listCandidateUsersTopDown(ctx, req, candidates)
+			require.NoError(t, err)
+			require.ElementsMatch(t, userStrings(topDown.GetUsers()), userStrings(resp.GetUsers()))
+		})
+	}
+
+	t.Run("conditions_evaluated", func(t *testing.T) {
+		err := ds.Write(context.Background(), storeID, nil, []*openfgav1.TupleKey{
+			tuple.NewTupleKeyWithCondition("group:eng", "member", "user:conditional", "is_valid", nil),
+		})
+		require.NoError(t, err)
+
+		req := &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}
+		conditional := []*openfgav1.User{tuple.StringToUserProto("user:conditional")}
+
+		_, err = NewListUsersQuery(ds).ListCandidateUsers(ctx, req, conditional)
+		require.ErrorContains(t, err, "missing parameters")
+
+		for valid, expected := range map[bool][]string{true: {"user:conditional"}, false: {}} {
+			req.Context, err = structpb.NewStruct(map[string]interface{}{"valid": valid})
+			require.NoError(t, err)
+			resp, err := NewListUsersQuery(ds).ListCandidateUsers(ctx, req, conditional)
+			require.NoError(t, err)
+			require.ElementsMatch(t, expected, userStrings(resp.GetUsers()))
+		}
+	})
+}
+
+// BenchmarkListCandidateUsers compares listing the users of an object with many users, through
+// many groups, to finding out whether a user that is a member of few groups is among them.
+func BenchmarkListCandidateUsers(b *testing.B) {
+	ds := memory.New()
+	b.Cleanup(ds.Close)
+
+	const numGroups, usersPerGroup = 100, 100
+	tuples := []string{"document:1#viewer@user:jon"}
+	for i := 0; i < numGroups; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#viewer@group:%d#member", i))
+		for j := 0; j < usersPerGroup; j++ {
+			tuples = append(tuples, fmt.Sprintf("group:%d#member@user:%d-%d", i, i, j))
+		}
+	}
+	tuples = append(tuples, "group:99#member@user:maria", "group:other#member@user:maria")
+
+	storeID, model := storagetest.BootstrapFGAStore(b, ds, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, tuples)
+	typesys, err := typesystem.NewAndValidate(context.Background(), model)
+	require.NoError(b, err)
+	ctx := typesystem.ContextWithTypesystem(context.Background(), typesys)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+	candidates := []*openfgav1.User{tuple.StringToUserProto("user:maria")}
+
+	b.Run("top_down", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resp, err := NewListUsersQuery(ds).listCandidateUsersTopDown(ctx, req, candidates)
+			require.NoError(b, err)
+			require.Len(b, resp.GetUsers(), 1)
+		}
+	})
+
+	b.Run("bottom_up", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resp, err := NewListUsersQuery(ds).ListCandidateUsers(ctx, req, candidates)
+			require.NoError(b, err)
+			require.Len(b, resp.GetUsers(), 1)
+		}
+	})
+}
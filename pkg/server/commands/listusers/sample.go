@@ -0,0 +1,114 @@
+package listusers
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// reservoirSampler retains a uniformly random sample of at most size users out of all the users
+// added to it, using O(size) memory.
+//
+// Rather than drawing random numbers as users are added, each user gets a pseudo-random priority
+// derived from the seed and the user, and the users with the lowest priorities are kept (bottom-k
+// sampling). The sample therefore only depends on the seed and the set of users added, not on the
+// order nor the number of times they were added, which matters because users are found in a
+// nondeterministic order and possibly more than once.
+type reservoirSampler struct {
+	size uint32
+	seed int64
+	heap sampleHeap
+	keys map[string]struct{}
+}
+
+func newReservoirSampler(size uint32, seed int64) *reservoirSampler {
+	return &reservoirSampler{
+		size: size,
+		seed: seed,
+		keys: make(map[string]struct{}, size),
+	}
+}
+
+// add offers the user, identified by key, to the sample.
+func (r *reservoirSampler) add(key string, user *openfgav1.User) {
+	if _, ok := r.keys[key]; ok {
+		return
+	}
+
+	priority := r.priority(key)
+	if uint32(len(r.heap)) < r.size {
+		heap.Push(&r.heap, sampledUser{priority: priority, key: key, user: user})
+		r.keys[key] = struct{}{}
+		return
+	}
+
+	if len(r.heap) == 0 || priority >= r.heap[0].priority {
+		return
+	}
+
+	delete(r.keys, r.heap[0].key)
+	r.heap[0] = sampledUser{priority: priority, key: key, user: user}
+	heap.Fix(&r.heap, 0)
+	r.keys[key] = struct{}{}
+}
+
+// users returns the sampled users, ordered by priority.
+func (r *reservoirSampler) users() []*openfgav1.User {
+	sampled := make([]sampledUser, len(r.heap))
+	copy(sampled, r.heap)
+	sort.Slice(sampled, func(i, j int) bool {
+		if sampled[i].priority != sampled[j].priority {
+			return sampled[i].priority < sampled[j].priority
+		}
+		return sampled[i].key < sampled[j].key
+	})
+
+	users := make([]*openfgav1.User, 0, len(sampled))
+	for _, s := range sampled {
+		users = append(users, s.user)
+	}
+	return users
+}
+
+func (r *reservoirSampler) priority(key string) uint64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, r.seed)
+	_, _ = h.Write([]byte(key))
+
+	// FNV alone mixes the last bytes of similar keys poorly, so finalize it with splitmix64
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type sampledUser struct {
+	priority uint64
+	key      string
+	user     *openfgav1.User
+}
+
+// sampleHeap is a max-heap on priority, so that the root is the sampled user to evict first.
+type sampleHeap []sampledUser
+
+func (h sampleHeap) Len() int { return len(h) }
+
+func (h sampleHeap) Less(i, j int) bool { return h[i].priority > h[j].priority }
+
+func (h sampleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *sampleHeap) Push(x any) { *h = append(*h, x.(sampledUser)) }
+
+func (h *sampleHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
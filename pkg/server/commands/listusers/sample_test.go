@@ -0,0 +1,71 @@
+package listusers
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestReservoirSampler(t *testing.T) {
+	const numUsers = 1000
+
+	keys := make([]string, 0, numUsers)
+	for i := 0; i < numUsers; i++ {
+		keys = append(keys, fmt.Sprintf("user:%d", i))
+	}
+
+	sample := func(size uint32, seed int64, keys []string) []string {
+		sampler := newReservoirSampler(size, seed)
+		for _, key := range keys {
+			sampler.add(key, tuple.StringToUserProto(key))
+		}
+		return userStrings(sampler.users())
+	}
+
+	t.Run("sample_size", func(t *testing.T) {
+		require.Len(t, sample(100, 1, keys), 100)
+		require.Len(t, sample(numUsers*2, 1, keys), numUsers)
+		require.Empty(t, sample(100, 1, nil))
+	})
+
+	t.Run("independent_of_order_and_duplicates", func(t *testing.T) {
+		shuffled := make([]string, 0, numUsers*2)
+		shuffled = append(shuffled, keys...)
+		shuffled = append(shuffled, keys...)
+		rand.New(rand.NewPCG(1, 2)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		expected := sample(100, 42, keys)
+		require.Equal(t, expected, sample(100, 42, shuffled))
+		require.NotEqual(t, expected, sample(100, 43, keys))
+	})
+
+	t.Run("uniform", func(t *testing.T) {
+		const (
+			size     = 100
+			numSeeds = 500
+		)
+
+		counts := make(map[string]int, numUsers)
+		for seed := int64(0); seed < numSeeds; seed++ {
+			for _, user := range sample(size, seed, keys) {
+				counts[user]++
+			}
+		}
+
+		// Pearson's chi-squared test against a uniform selection probability. With 999 degrees
+		// of freedom the statistic exceeds 1150 with a probability below 0.1%.
+		expected := float64(numSeeds*size) / numUsers
+		var chiSquared float64
+		for _, key := range keys {
+			diff := float64(counts[key]) - expected
+			chiSquared += diff * diff / expected
+		}
+		require.Less(t, chiSquared, 1150.0)
+	})
+}
@@ -0,0 +1,63 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// SequencedUser is a user passed on by ListUsersSequenced, along with its sequence number.
+type SequencedUser struct {
+	User *openfgav1.User
+
+	// Sequence is the position of the user in the stream of users, starting at 1. The users
+	// are passed on in the order of their sequence numbers, with no gap between them.
+	Sequence uint64
+}
+
+// ListUsersSequenced calls callback with each unique user that has the relation with the object,
+// like ListUsersCallback does, along with a sequence number assigned in the order the users are
+// passed on, so that clients streaming them can restore their order or detect the ones dropped
+// on the way. Once the expansion is complete, it returns the number of users passed on, which is
+// the sequence number of the last one, so that clients can check that they received them all. If
+// a limit such as the max results or the deadline cut the listing short, it returns that number
+// along with ErrIncompleteResults, so that a truncated stream isn't mistaken for a complete one.
+//
+// The sequence numbers are assigned and the callback is called under a lock, so the callback is
+// never called concurrently and the users are passed on in order, even though they are found by
+// concurrent expansions. An error returned by the callback stops the expansion and is returned,
+// along with the number of users passed on before it.
+func (l *listUsersQuery) ListUsersSequenced(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(SequencedUser) error,
+) (uint64, error) {
+	var (
+		mu          sync.Mutex
+		sequence    uint64
+		callbackErr error
+	)
+	complete, err := l.listUsersCallback(ctx, req, func(user *openfgav1.User) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// no user is passed on after the callback fails, so that its sequence number isn't reused
+		if callbackErr != nil {
+			return callbackErr
+		}
+		if err := callback(SequencedUser{User: user, Sequence: sequence + 1}); err != nil {
+			callbackErr = err
+			return err
+		}
+		sequence++
+		return nil
+	})
+
+	if err == nil && !complete {
+		err = ErrIncompleteResults
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return sequence, err
+}
@@ -0,0 +1,122 @@
+package listusers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersSequenced(t *testing.T) {
+	// the users are found by the concurrent expansions of the operands of the union and of the
+	// groups
+	tuples := []string{"document:1#blocked@user:0"}
+	for u := 0; u < 100; u++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#owner@user:%d", u),
+			fmt.Sprintf("document:1#editor@user:%d", u+50),
+			fmt.Sprintf("group:%d#member@user:%d", u%10, u+100),
+		)
+	}
+	for g := 0; g < 10; g++ {
+		tuples = append(tuples, fmt.Sprintf("document:1#viewer@group:%d#member", g))
+	}
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define blocked: [user]
+				define owner: [user]
+				define editor: [user]
+				define viewer: [user, group#member] or owner or editor
+				define allowed: viewer but not blocked`, tuples)
+
+	newRequest := func(relation string) *openfgav1.ListUsersRequest {
+		return &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}, {Type: "group", Relation: "member"}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		relation string
+		opts     []ListUsersQueryOption
+		expected int
+	}{
+		{
+			name:     "streamed",
+			relation: "viewer",
+			expected: 200 + 10,
+		},
+		{
+			name:     "streamed_by_type",
+			relation: "viewer",
+			opts:     []ListUsersQueryOption{WithTypeGroupedStreaming(true)},
+			expected: 200 + 10,
+		},
+		{
+			// the users of an exclusion are all found before they are passed on
+			name:     "collected",
+			relation: "allowed",
+			expected: 199 + 10,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sequences []uint64
+			users := make(map[string]struct{})
+			total, err := NewListUsersQuery(ds, test.opts...).ListUsersSequenced(ctx, newRequest(test.relation), func(user SequencedUser) error {
+				sequences = append(sequences, user.Sequence)
+				users[tuple.UserProtoToString(user.User)] = struct{}{}
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, uint64(test.expected), total)
+			require.Len(t, users, test.expected)
+
+			// the sequence numbers are contiguous, in the order the users are passed on
+			require.Len(t, sequences, test.expected)
+			for i, sequence := range sequences {
+				require.Equal(t, uint64(i+1), sequence)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		var last uint64
+		total, err := NewListUsersQuery(ds, WithListUsersMaxResults(5)).ListUsersSequenced(ctx, newRequest("viewer"), func(user SequencedUser) error {
+			last = user.Sequence
+			return nil
+		})
+		require.ErrorIs(t, err, ErrIncompleteResults)
+		require.Equal(t, last, total)
+		require.LessOrEqual(t, total, uint64(5))
+	})
+
+	t.Run("callback_error", func(t *testing.T) {
+		errStop := errors.New("stop")
+		var last uint64
+		total, err := NewListUsersQuery(ds).ListUsersSequenced(ctx, newRequest("viewer"), func(user SequencedUser) error {
+			if user.Sequence == 10 {
+				return errStop
+			}
+			last = user.Sequence
+			return nil
+		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, uint64(9), total)
+		require.Equal(t, uint64(9), last)
+	})
+}
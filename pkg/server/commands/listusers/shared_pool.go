@@ -0,0 +1,220 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// SharedWorkerPool bounds the number of datastore reads in flight across every ListUsers request
+// it is passed to, so that a burst of concurrent requests can't exhaust the datastore on its own.
+// Once every worker is busy, the reads wait for one to free up, and the requests waiting take
+// turns, so that a request with many reads waiting doesn't hold back those with few. A read
+// stops waiting once its request is done. The same SharedWorkerPool must be passed to every
+// ListUsers query for the bound to hold across them. It is safe for concurrent use.
+//
+// The pool bounds the reads rather than the expansion of the requests, since an expansion waits
+// on the expansions it dispatches, and a bounded pool running those across requests could
+// deadlock once all of its workers wait.
+type SharedWorkerPool struct {
+	mu      sync.Mutex
+	size    int
+	busy    int
+	waiting []*workerQueue // the queues with waiting reads, in the order they take turns
+}
+
+// NewSharedWorkerPool returns a SharedWorkerPool running up to size reads at once. A size lower
+// than 1 is raised to 1, since no read could ever be made otherwise.
+func NewSharedWorkerPool(size uint32) *SharedWorkerPool {
+	return &SharedWorkerPool{
+		size: max(1, int(size)),
+	}
+}
+
+// queue returns a queue for the reads of a single request.
+func (p *SharedWorkerPool) queue() *workerQueue {
+	return &workerQueue{pool: p}
+}
+
+// release frees the worker of a read that is done, handing it over to the next read waiting, if
+// any. It must be called with p.mu held.
+func (p *SharedWorkerPool) release() {
+	if len(p.waiting) == 0 {
+		p.busy--
+		return
+	}
+
+	q := p.waiting[0]
+	w := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	p.waiting = p.waiting[1:]
+	if len(q.waiters) > 0 {
+		// the request takes its next turn after the others waiting
+		p.waiting = append(p.waiting, q)
+	}
+	w.granted = true
+	close(w.ready)
+}
+
+// workerQueue queues the reads of a request for a worker of a SharedWorkerPool.
+type workerQueue struct {
+	pool    *SharedWorkerPool
+	waiters []*worker
+}
+
+type worker struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// acquire blocks until a worker is free for a read, or returns ctx.Err() if ctx is done first.
+// Every successful acquire must be followed by a release once the read is done.
+func (q *workerQueue) acquire(ctx context.Context) error {
+	p := q.pool
+	p.mu.Lock()
+	if p.busy < p.size && len(p.waiting) == 0 {
+		p.busy++
+		p.mu.Unlock()
+		return nil
+	}
+
+	w := &worker{ready: make(chan struct{})}
+	if len(q.waiters) == 0 {
+		p.waiting = append(p.waiting, q)
+	}
+	q.waiters = append(q.waiters, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if w.granted {
+			// the worker was handed over in the meantime, so it is passed on to the next read
+			p.release()
+			return ctx.Err()
+		}
+		q.remove(w)
+		return ctx.Err()
+	}
+}
+
+// release frees the worker acquired for a read.
+func (q *workerQueue) release() {
+	q.pool.mu.Lock()
+	defer q.pool.mu.Unlock()
+	q.pool.release()
+}
+
+// remove removes w, which gave up waiting, from the queue. It must be called with the pool's mu
+// held.
+func (q *workerQueue) remove(w *worker) {
+	for i, waiter := range q.waiters {
+		if waiter == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiters) > 0 {
+		return
+	}
+	for i, waiting := range q.pool.waiting {
+		if waiting == q {
+			q.pool.waiting = append(q.pool.waiting[:i], q.pool.waiting[i+1:]...)
+			break
+		}
+	}
+}
+
+// sharedPoolTupleReader makes the reads of a request through a SharedWorkerPool. A read keeps its
+// worker until the iterator of the datastore is stopped, since the datastore may still be
+// fetching the tuples while they are iterated, as SQL datastores do. The tuples are read to the
+// end before the worker is released, rather than as the expansion iterates them, since the
+// expansion dispatches reads of its own while iterating, which could otherwise wait on a worker
+// held by the read they were dispatched by.
+type sharedPoolTupleReader struct {
+	storage.RelationshipTupleReader
+	queue *workerQueue
+}
+
+// drain makes the read with a worker of the pool, and returns its tuples once they are all read
+// and its iterator is stopped.
+func (r *sharedPoolTupleReader) drain(
+	ctx context.Context,
+	read func() (storage.TupleIterator, error),
+) (storage.TupleIterator, error) {
+	if err := r.queue.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.queue.release()
+
+	iter, err := read()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Stop()
+
+	var tuples []*openfgav1.Tuple
+	for {
+		t, err := iter.Next(ctx)
+		if err != nil {
+			if errors.Is(err, storage.ErrIteratorDone) {
+				return storage.NewStaticTupleIterator(tuples), nil
+			}
+			return nil, err
+		}
+		tuples = append(tuples, t)
+	}
+}
+
+func (r *sharedPoolTupleReader) Read(
+	ctx context.Context,
+	store string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	return r.drain(ctx, func() (storage.TupleIterator, error) {
+		return r.RelationshipTupleReader.Read(ctx, store, tupleKey, options)
+	})
+}
+
+func (r *sharedPoolTupleReader) ReadUserTuple(
+	ctx context.Context,
+	store string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadUserTupleOptions,
+) (*openfgav1.Tuple, error) {
+	if err := r.queue.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.queue.release()
+	return r.RelationshipTupleReader.ReadUserTuple(ctx, store, tupleKey, options)
+}
+
+func (r *sharedPoolTupleReader) ReadUsersetTuples(
+	ctx context.Context,
+	store string,
+	filter storage.ReadUsersetTuplesFilter,
+	options storage.ReadUsersetTuplesOptions,
+) (storage.TupleIterator, error) {
+	return r.drain(ctx, func() (storage.TupleIterator, error) {
+		return r.RelationshipTupleReader.ReadUsersetTuples(ctx, store, filter, options)
+	})
+}
+
+func (r *sharedPoolTupleReader) ReadStartingWithUser(
+	ctx context.Context,
+	store string,
+	filter storage.ReadStartingWithUserFilter,
+	options storage.ReadStartingWithUserOptions,
+) (storage.TupleIterator, error) {
+	return r.drain(ctx, func() (storage.TupleIterator, error) {
+		return r.RelationshipTupleReader.ReadStartingWithUser(ctx, store, filter, options)
+	})
+}
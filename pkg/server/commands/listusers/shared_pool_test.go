@@ -0,0 +1,199 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// inFlightDatastore records the highest number of reads in flight at once. A read is in flight
+// from the time it is made until its iterator is stopped.
+type inFlightDatastore struct {
+	storage.OpenFGADatastore
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (s *inFlightDatastore) track(iter storage.TupleIterator, err error) (storage.TupleIterator, error) {
+	if err != nil {
+		return nil, err
+	}
+	inFlight := s.inFlight.Add(1)
+	for {
+		highest := s.maxInFlight.Load()
+		if inFlight <= highest || s.maxInFlight.CompareAndSwap(highest, inFlight) {
+			break
+		}
+	}
+	// leave the other reads time to pile up
+	time.Sleep(time.Millisecond)
+	return &inFlightIterator{TupleIterator: iter, done: func() { s.inFlight.Add(-1) }}, nil
+}
+
+func (s *inFlightDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	return s.track(s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options))
+}
+
+func (s *inFlightDatastore) ReadUsersetTuples(
+	ctx context.Context,
+	storeID string,
+	filter storage.ReadUsersetTuplesFilter,
+	options storage.ReadUsersetTuplesOptions,
+) (storage.TupleIterator, error) {
+	return s.track(s.OpenFGADatastore.ReadUsersetTuples(ctx, storeID, filter, options))
+}
+
+// inFlightIterator calls done once it is stopped.
+type inFlightIterator struct {
+	storage.TupleIterator
+	once sync.Once
+	done func()
+}
+
+func (i *inFlightIterator) Stop() {
+	i.once.Do(i.done)
+	i.TupleIterator.Stop()
+}
+
+func TestListUsersConfig_SharedWorkerPool(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:maria",
+		"document:1#viewer@group:eng#member",
+		"document:1#viewer@group:ops#member",
+		"group:eng#member@user:jon",
+		"group:eng#member@group:fga#member",
+		"group:fga#member@user:will",
+		"group:ops#member@user:poovam",
+	})
+
+	t.Run("reads_bounded_across_requests", func(t *testing.T) {
+		const poolSize = 2
+		inFlightDS := &inFlightDatastore{OpenFGADatastore: ds}
+		pool := NewSharedWorkerPool(poolSize)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := NewListUsersQuery(inFlightDS,
+					WithSharedWorkerPool(pool),
+					WithListUsersMaxConcurrentReads(10),
+				).ListUsers(ctx, &openfgav1.ListUsersRequest{
+					StoreId:     storeID,
+					Object:      &openfgav1.Object{Type: "document", Id: "1"},
+					Relation:    "viewer",
+					UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+				})
+				if err == nil && len(resp.GetUsers()) != 4 {
+					err = fmt.Errorf("expected 4 users, got %v", userStrings(resp.GetUsers()))
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		require.LessOrEqual(t, inFlightDS.maxInFlight.Load(), int32(poolSize))
+		require.Zero(t, pool.busy)
+		require.Empty(t, pool.waiting)
+	})
+
+	t.Run("nested_reads_with_a_single_worker", func(t *testing.T) {
+		// the reads of the groups are dispatched while the tuples of the document are iterated
+		inFlightDS := &inFlightDatastore{OpenFGADatastore: ds}
+		pool := NewSharedWorkerPool(1)
+		resp, err := NewListUsersQuery(inFlightDS, WithSharedWorkerPool(pool), WithResolveNodeBreadthLimit(1)).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria", "user:jon", "user:will", "user:poovam"}, userStrings(resp.GetUsers()))
+		require.Equal(t, int32(1), inFlightDS.maxInFlight.Load())
+		require.Zero(t, pool.busy)
+	})
+
+	t.Run("waiting_read_gives_up_once_done", func(t *testing.T) {
+		pool := NewSharedWorkerPool(1)
+		holder := pool.queue()
+		require.NoError(t, holder.acquire(context.Background()))
+
+		waitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := pool.queue().acquire(waitCtx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Empty(t, pool.waiting)
+
+		// the worker held is still handed over once released
+		holder.release()
+		require.NoError(t, pool.queue().acquire(context.Background()))
+		require.Equal(t, 1, pool.busy)
+	})
+
+	t.Run("requests_take_turns", func(t *testing.T) {
+		pool := NewSharedWorkerPool(1)
+		holder := pool.queue()
+		require.NoError(t, holder.acquire(context.Background()))
+
+		granted := make(chan string)
+		wait := func(q *workerQueue, name string) {
+			waiters := len(q.waiters)
+			go func() {
+				if err := q.acquire(context.Background()); err == nil {
+					granted <- name
+				}
+			}()
+			require.Eventually(t, func() bool {
+				pool.mu.Lock()
+				defer pool.mu.Unlock()
+				return len(q.waiters) == waiters+1
+			}, time.Second, time.Millisecond)
+		}
+
+		// the first request queues its reads before the second one does
+		first, second := pool.queue(), pool.queue()
+		wait(first, "first")
+		wait(first, "first")
+		wait(first, "first")
+		wait(second, "second")
+
+		holder.release()
+		var order []string
+		for range 4 {
+			name := <-granted
+			order = append(order, name)
+			holder.release()
+		}
+		require.Equal(t, []string{"first", "second", "first", "first"}, order)
+		require.Zero(t, pool.busy)
+	})
+}
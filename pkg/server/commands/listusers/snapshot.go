@@ -0,0 +1,35 @@
+package listusers
+
+import (
+	"context"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// validateSnapshotToken returns an error if reads as of the snapshot identified by token can't be
+// served by ds. See WithSnapshotToken.
+func validateSnapshotToken(ds storage.RelationshipTupleReader, token string) error {
+	snapshotReader, ok := ds.(storage.SnapshotReader)
+	if !ok {
+		return storage.ErrSnapshotsNotSupported
+	}
+	return snapshotReader.ValidateSnapshotToken(token)
+}
+
+// snapshotTokenFor returns the snapshot token every read of a request is pinned to: the token set
+// with WithSnapshotToken, or else the current snapshot of the store if reads are pinned with
+// WithSnapshotReads, or else the empty token, which reads the current tuples.
+func (l *listUsersQuery) snapshotTokenFor(ctx context.Context, storeID string) (string, error) {
+	if l.snapshotToken != "" || !l.snapshotReads {
+		return l.snapshotToken, nil
+	}
+	snapshotReader, ok := l.ds.(storage.SnapshotReader)
+	if !ok {
+		return "", storage.ErrSnapshotsNotSupported
+	}
+	token, err := snapshotReader.SnapshotToken(ctx, storeID)
+	if err != nil {
+		return "", wrapDatastoreError(err)
+	}
+	return token, nil
+}
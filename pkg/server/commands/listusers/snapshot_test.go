@@ -0,0 +1,198 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// revokedAccessDatastore serves the tuples of two revisions of a store: in the first, jon is a
+// viewer of document:1 but blocked from it, and in the second, both tuples are deleted. The store
+// moves to the second revision right after the viewers of document:1 are first read, so that an
+// unpinned request reads the viewers and the blocked users of different revisions.
+type revokedAccessDatastore struct {
+	storage.OpenFGADatastore
+
+	mu           sync.Mutex
+	revision     int
+	readsByToken map[string]int
+}
+
+var _ storage.SnapshotReader = (*revokedAccessDatastore)(nil)
+
+var revokedAccessRevisions = map[int][]*openfgav1.TupleKey{
+	1: {
+		tuple.NewTupleKey("document:1", "viewer", "user:maria"),
+		tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+		tuple.NewTupleKey("document:1", "blocked", "user:jon"),
+	},
+	2: {
+		tuple.NewTupleKey("document:1", "viewer", "user:maria"),
+	},
+}
+
+func (r *revokedAccessDatastore) SnapshotToken(context.Context, string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprintf("revision:%d", r.revision), nil
+}
+
+func (r *revokedAccessDatastore) ValidateSnapshotToken(token string) error {
+	revision, ok := strings.CutPrefix(token, "revision:")
+	if !ok {
+		return fmt.Errorf("%w: missing revision prefix", storage.ErrInvalidSnapshotToken)
+	}
+	if _, err := strconv.Atoi(revision); err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrInvalidSnapshotToken, err)
+	}
+	return nil
+}
+
+// tuples returns the tuples of the revision identified by token, or of the current revision if
+// token is empty, matching the object, relation and, if set, user of tupleKey.
+func (r *revokedAccessDatastore) tuples(tupleKey *openfgav1.TupleKey, token string) []*openfgav1.Tuple {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readsByToken[token]++
+	revision := r.revision
+	if token != "" {
+		revision, _ = strconv.Atoi(strings.TrimPrefix(token, "revision:"))
+	}
+
+	var tuples []*openfgav1.Tuple
+	for _, tk := range revokedAccessRevisions[revision] {
+		if tk.GetObject() == tupleKey.GetObject() && tk.GetRelation() == tupleKey.GetRelation() &&
+			(tupleKey.GetUser() == "" || tk.GetUser() == tupleKey.GetUser()) {
+			tuples = append(tuples, &openfgav1.Tuple{Key: tk})
+		}
+	}
+	if tupleKey.GetRelation() == "viewer" {
+		r.revision = 2
+	}
+	return tuples
+}
+
+func (r *revokedAccessDatastore) Read(
+	_ context.Context,
+	_ string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	return storage.NewStaticTupleIterator(r.tuples(tupleKey, options.SnapshotToken)), nil
+}
+
+func (r *revokedAccessDatastore) ReadUserTuple(
+	_ context.Context,
+	_ string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadUserTupleOptions,
+) (*openfgav1.Tuple, error) {
+	tuples := r.tuples(tupleKey, options.SnapshotToken)
+	if len(tuples) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return tuples[0], nil
+}
+
+func (r *revokedAccessDatastore) ReadUsersetTuples(
+	_ context.Context,
+	_ string,
+	filter storage.ReadUsersetTuplesFilter,
+	options storage.ReadUsersetTuplesOptions,
+) (storage.TupleIterator, error) {
+	// no revision assigns usersets
+	r.tuples(tuple.NewTupleKey(filter.Object, filter.Relation, ""), options.SnapshotToken)
+	return storage.NewStaticTupleIterator(nil), nil
+}
+
+func TestListUsersConfig_SnapshotReads(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define blocked: [user]
+				define viewer: [user] but not blocked`, nil)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	// the blocked users are read after the viewers, once the store moved to the second revision
+	delaySubtract := WithReadInterceptor(func(ctx context.Context, storeID string, tupleKey *openfgav1.TupleKey) error {
+		if tupleKey.GetRelation() == "blocked" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name          string
+		opts          []ListUsersQueryOption
+		expectedUsers []string
+		expectedReads []string
+	}{
+		{
+			// jon is a viewer as of the first revision and not blocked as of the second, which no
+			// revision of the store agrees with
+			name:          "unpinned_reads_mix_revisions",
+			opts:          []ListUsersQueryOption{delaySubtract},
+			expectedUsers: []string{"user:maria", "user:jon"},
+			expectedReads: []string{""},
+		},
+		{
+			name:          "unpinned_checks_mix_revisions",
+			opts:          []ListUsersQueryOption{WithExclusionStrategy(ExclusionStrategyCheck)},
+			expectedUsers: []string{"user:maria", "user:jon"},
+			expectedReads: []string{""},
+		},
+		{
+			name:          "pinned_reads_see_a_single_revision",
+			opts:          []ListUsersQueryOption{delaySubtract, WithSnapshotReads(true)},
+			expectedUsers: []string{"user:maria"},
+			expectedReads: []string{"revision:1"},
+		},
+		{
+			name:          "pinned_checks_see_a_single_revision",
+			opts:          []ListUsersQueryOption{WithExclusionStrategy(ExclusionStrategyCheck), WithSnapshotReads(true)},
+			expectedUsers: []string{"user:maria"},
+			expectedReads: []string{"revision:1"},
+		},
+		{
+			// the token set takes precedence over the snapshot taken for the request
+			name:          "pinned_to_the_token_set",
+			opts:          []ListUsersQueryOption{WithSnapshotToken("revision:2"), WithSnapshotReads(true)},
+			expectedUsers: []string{"user:maria"},
+			expectedReads: []string{"revision:2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revokedDS := &revokedAccessDatastore{OpenFGADatastore: ds, revision: 1, readsByToken: map[string]int{}}
+			resp, err := NewListUsersQuery(revokedDS, test.opts...).ListUsers(ctx, req)
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expectedUsers, userStrings(resp.GetUsers()))
+			require.ElementsMatch(t, test.expectedReads, keysOf(revokedDS.readsByToken))
+		})
+	}
+
+	t.Run("datastore_without_snapshots", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithSnapshotReads(true)).ListUsers(ctx, req)
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+		require.Nil(t, resp)
+	})
+}
@@ -0,0 +1,142 @@
+package listusers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// snapshotDatastore behaves as if group:eng#member@user:jon was deleted right after the first
+// snapshot was taken, and serves the reads as of that snapshot with the membership.
+type snapshotDatastore struct {
+	storage.OpenFGADatastore
+
+	mu             sync.Mutex
+	snapshots      int
+	readsByToken   map[string]int
+	membershipRead bool
+}
+
+var _ storage.SnapshotReader = (*snapshotDatastore)(nil)
+
+func (s *snapshotDatastore) SnapshotToken(context.Context, string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots++
+	return fmt.Sprintf("snapshot:%d", s.snapshots), nil
+}
+
+func (s *snapshotDatastore) ValidateSnapshotToken(token string) error {
+	revision, ok := strings.CutPrefix(token, "snapshot:")
+	if !ok {
+		return fmt.Errorf("%w: missing snapshot prefix", storage.ErrInvalidSnapshotToken)
+	}
+	if _, err := strconv.Atoi(revision); err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrInvalidSnapshotToken, err)
+	}
+	return nil
+}
+
+func (s *snapshotDatastore) Read(
+	ctx context.Context,
+	storeID string,
+	tupleKey *openfgav1.TupleKey,
+	options storage.ReadOptions,
+) (storage.TupleIterator, error) {
+	s.mu.Lock()
+	s.readsByToken[options.SnapshotToken]++
+	s.mu.Unlock()
+
+	// the snapshot is applied below, as the wrapped datastore doesn't serve snapshot reads
+	token := options.SnapshotToken
+	options.SnapshotToken = ""
+	if tupleKey.GetObject() != "group:eng" || tupleKey.GetRelation() != "member" {
+		return s.OpenFGADatastore.Read(ctx, storeID, tupleKey, options)
+	}
+	if token != "snapshot:1" {
+		return storage.NewStaticTupleIterator(nil), nil
+	}
+	return storage.NewStaticTupleIterator([]*openfgav1.Tuple{
+		{Key: tuple.NewTupleKey("group:eng", "member", "user:jon")},
+	}), nil
+}
+
+func TestListUsersConfig_SnapshotToken(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`, []string{
+		"document:1#viewer@user:maria",
+		"document:1#viewer@group:eng#member",
+	})
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     storeID,
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		Relation:    "viewer",
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	newSnapshotDatastore := func() *snapshotDatastore {
+		return &snapshotDatastore{OpenFGADatastore: ds, readsByToken: map[string]int{}}
+	}
+
+	t.Run("reads_observe_the_snapshot", func(t *testing.T) {
+		snapshotDS := newSnapshotDatastore()
+		token, err := snapshotDS.SnapshotToken(ctx, storeID)
+		require.NoError(t, err)
+
+		resp, err := NewListUsersQuery(snapshotDS, WithSnapshotToken(token)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria", "user:jon"}, userStrings(resp.GetUsers()))
+		// every read was made as of the snapshot
+		require.Equal(t, map[string]int{token: 2}, snapshotDS.readsByToken)
+
+		// a later query with the same token observes the same tuples
+		resp, err = NewListUsersQuery(snapshotDS, WithSnapshotToken(token)).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria", "user:jon"}, userStrings(resp.GetUsers()))
+	})
+
+	t.Run("latest_reads_without_token", func(t *testing.T) {
+		snapshotDS := newSnapshotDatastore()
+		resp, err := NewListUsersQuery(snapshotDS).ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"user:maria"}, userStrings(resp.GetUsers()))
+		require.Equal(t, map[string]int{"": 2}, snapshotDS.readsByToken)
+	})
+
+	t.Run("malformed_token", func(t *testing.T) {
+		snapshotDS := newSnapshotDatastore()
+		resp, err := NewListUsersQuery(snapshotDS, WithSnapshotToken("revision:1")).ListUsers(ctx, req)
+		require.ErrorIs(t, err, storage.ErrInvalidSnapshotToken)
+		require.Nil(t, resp)
+		require.Empty(t, snapshotDS.readsByToken)
+	})
+
+	t.Run("datastore_without_snapshots", func(t *testing.T) {
+		resp, err := NewListUsersQuery(ds, WithSnapshotToken("snapshot:1")).ListUsers(ctx, req)
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+		require.Nil(t, resp)
+
+		err = NewListUsersQuery(ds, WithSnapshotToken("snapshot:1")).ListUsersForObjectType(ctx, req, func(ObjectUsers) error {
+			return nil
+		})
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+	})
+}
@@ -0,0 +1,90 @@
+package listusers
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// Subject is the structured form of a user returned by the expansion, so that callers can use its
+// type, id and relation without parsing its string form. A wildcard has the ID tuple.Wildcard and
+// no relation, a userset has a relation, and an object has neither.
+type Subject struct {
+	Type     string
+	ID       string
+	Relation string
+}
+
+// SubjectFromKey returns the Subject of the string form of a user, such as "user:jon",
+// "group:eng#member" or "user:*", as used to deduplicate the users found. It is the opposite of
+// Subject.Key.
+func SubjectFromKey(key string) Subject {
+	object, relation := tuple.SplitObjectRelation(key)
+	objectType, objectID := tuple.SplitObject(object)
+	return Subject{Type: objectType, ID: objectID, Relation: relation}
+}
+
+// SubjectFromUser returns the Subject of user. It returns the zero Subject if user is nil or
+// holds none of the kinds of users.
+func SubjectFromUser(user *openfgav1.User) Subject {
+	switch u := user.GetUser().(type) {
+	case *openfgav1.User_Object:
+		return Subject{Type: u.Object.GetType(), ID: u.Object.GetId()}
+	case *openfgav1.User_Userset:
+		return Subject{Type: u.Userset.GetType(), ID: u.Userset.GetId(), Relation: u.Userset.GetRelation()}
+	case *openfgav1.User_Wildcard:
+		return Subject{Type: u.Wildcard.GetType(), ID: tuple.Wildcard}
+	default:
+		return Subject{}
+	}
+}
+
+// IsWildcard reports whether s stands for every object of its type.
+func (s Subject) IsWildcard() bool {
+	return s.ID == tuple.Wildcard && s.Relation == ""
+}
+
+// IsUserset reports whether s stands for the users with a relation to an object.
+func (s Subject) IsUserset() bool {
+	return s.Relation != ""
+}
+
+// Key returns the string form of s, as used to deduplicate the users found. It is the opposite of
+// SubjectFromKey.
+func (s Subject) Key() string {
+	object := tuple.BuildObject(s.Type, s.ID)
+	if s.Relation == "" {
+		return object
+	}
+	return tuple.ToObjectRelationString(object, s.Relation)
+}
+
+// String returns the string form of s. See Key.
+func (s Subject) String() string {
+	return s.Key()
+}
+
+// User returns s as the User of a ListUsers response.
+func (s Subject) User() *openfgav1.User {
+	switch {
+	case s.IsUserset():
+		return &openfgav1.User{User: &openfgav1.User_Userset{Userset: &openfgav1.UsersetUser{
+			Type:     s.Type,
+			Id:       s.ID,
+			Relation: s.Relation,
+		}}}
+	case s.IsWildcard():
+		return &openfgav1.User{User: &openfgav1.User_Wildcard{Wildcard: &openfgav1.TypedWildcard{Type: s.Type}}}
+	default:
+		return &openfgav1.User{User: &openfgav1.User_Object{Object: &openfgav1.Object{Type: s.Type, Id: s.ID}}}
+	}
+}
+
+// SubjectsOf returns the Subjects of users, in the same order.
+func SubjectsOf(users []*openfgav1.User) []Subject {
+	subjects := make([]Subject, 0, len(users))
+	for _, user := range users {
+		subjects = append(subjects, SubjectFromUser(user))
+	}
+	return subjects
+}
@@ -0,0 +1,78 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestSubjectRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		subject    Subject
+		isWildcard bool
+		isUserset  bool
+	}{
+		{
+			name:    "object",
+			key:     "user:jon",
+			subject: Subject{Type: "user", ID: "jon"},
+		},
+		{
+			name:      "userset",
+			key:       "group:eng#member",
+			subject:   Subject{Type: "group", ID: "eng", Relation: "member"},
+			isUserset: true,
+		},
+		{
+			name:       "wildcard",
+			key:        "user:*",
+			subject:    Subject{Type: "user", ID: "*"},
+			isWildcard: true,
+		},
+		{
+			name:    "id_with_colon",
+			key:     "document:2024:q1",
+			subject: Subject{Type: "document", ID: "2024:q1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject := SubjectFromKey(test.key)
+			require.Equal(t, test.subject, subject)
+			require.Equal(t, test.key, subject.Key())
+			require.Equal(t, test.key, subject.String())
+			require.Equal(t, test.isWildcard, subject.IsWildcard())
+			require.Equal(t, test.isUserset, subject.IsUserset())
+
+			user := subject.User()
+			require.True(t, proto.Equal(tuple.StringToUserProto(test.key), user))
+			require.Equal(t, test.key, tuple.UserProtoToString(user))
+			require.Equal(t, subject, SubjectFromUser(user))
+		})
+	}
+
+	t.Run("nil_user", func(t *testing.T) {
+		require.Equal(t, Subject{}, SubjectFromUser(nil))
+		require.Equal(t, Subject{}, SubjectFromUser(&openfgav1.User{}))
+	})
+
+	t.Run("subjects_of_users", func(t *testing.T) {
+		users := []*openfgav1.User{
+			tuple.StringToUserProto("user:jon"),
+			tuple.StringToUserProto("group:eng#member"),
+			tuple.StringToUserProto("user:*"),
+		}
+		require.Equal(t, []Subject{
+			{Type: "user", ID: "jon"},
+			{Type: "group", ID: "eng", Relation: "member"},
+			{Type: "user", ID: "*"},
+		}, SubjectsOf(users))
+	})
+}
@@ -0,0 +1,52 @@
+package listusers
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand/v2"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type coarseTracingCtxKey struct{}
+
+// noopSpan is returned for the expansion steps of requests that aren't traced in detail.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// detailedTracing decides whether the expansion steps of the request whose top level span is
+// in ctx get spans of their own. A request whose trace isn't sampled never does, and a sampled
+// request does with the probability given by WithTraceSampling. The decision is derived from the
+// trace ID when there is one, so that it is consistent for all the requests of a trace.
+func (l *listUsersQuery) detailedTracing(ctx context.Context) bool {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsValid() && !spanContext.IsSampled() {
+		return false
+	}
+
+	if l.traceSamplingRate >= 1 {
+		return true
+	}
+	if l.traceSamplingRate <= 0 {
+		return false
+	}
+
+	if spanContext.HasTraceID() {
+		// the same computation as the TraceIDRatioBased sampler
+		traceID := spanContext.TraceID()
+		return binary.BigEndian.Uint64(traceID[8:16])>>1 < uint64(l.traceSamplingRate*(1<<63))
+	}
+	return rand.Float64() < l.traceSamplingRate
+}
+
+// contextWithCoarseTracing returns a context in which the expansion steps don't start spans.
+func contextWithCoarseTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, coarseTracingCtxKey{}, struct{}{})
+}
+
+// startStepSpan starts the span of an expansion step, unless the request is only traced coarsely.
+func startStepSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if ctx.Value(coarseTracingCtxKey{}) != nil {
+		return ctx, noopSpan
+	}
+	return tracer.Start(ctx, name)
+}
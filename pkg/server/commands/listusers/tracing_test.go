@@ -0,0 +1,100 @@
+package listusers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanRecorder     *tracetest.SpanRecorder
+	spanRecorderOnce sync.Once
+)
+
+// recordSpans records the spans of the package tracer. The tracer delegates to the first global
+// provider set, so it is only set once and can't be restored.
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	return spanRecorder
+}
+
+func TestListUsersConfig_TraceSampling(t *testing.T) {
+	recorder := recordSpans()
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`, []string{
+		"document:1#viewer@user:jon",
+	})
+
+	// listUsers makes numRequests requests and returns how many of them were traced in detail
+	listUsers := func(ctx context.Context, numRequests int, opts ...ListUsersQueryOption) int {
+		before := len(recorder.Ended())
+		for i := 0; i < numRequests; i++ {
+			_, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+				StoreId:     storeID,
+				Object:      &openfgav1.Object{Type: "document", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			})
+			require.NoError(t, err)
+		}
+
+		topLevel, detailed := 0, 0
+		for _, span := range recorder.Ended()[before:] {
+			switch span.Name() {
+			case "ListUsers":
+				topLevel++
+			case "expand":
+				detailed++
+			}
+		}
+		require.Equal(t, numRequests, topLevel)
+		return detailed
+	}
+
+	t.Run("all_requests_traced_in_detail_by_default", func(t *testing.T) {
+		require.Equal(t, 10, listUsers(ctx, 10))
+	})
+
+	t.Run("no_request_traced_in_detail", func(t *testing.T) {
+		require.Zero(t, listUsers(ctx, 10, WithTraceSampling(0)))
+	})
+
+	t.Run("requests_traced_in_detail_at_rate", func(t *testing.T) {
+		// the expected count is 100, and a binomial draw falls outside of +-50 with a
+		// negligible probability
+		detailed := listUsers(ctx, 400, WithTraceSampling(0.25))
+		require.InDelta(t, 100, detailed, 50)
+	})
+
+	t.Run("unsampled_trace_not_traced_in_detail", func(t *testing.T) {
+		unsampled := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1},
+			SpanID:  trace.SpanID{1},
+		}))
+		before := len(recorder.Ended())
+		_, err := NewListUsersQuery(ds).ListUsers(unsampled, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		})
+		require.NoError(t, err)
+		require.Len(t, recorder.Ended(), before)
+	})
+}
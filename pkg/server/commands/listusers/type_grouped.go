@@ -0,0 +1,147 @@
+package listusers
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// listUsersGroupedByType streams the users of the request to callback grouped by type, in the
+// order of the types of the user filters. The types are expanded concurrently, as separate
+// requests, since users of different types never match one another. The users of the first type
+// whose expansion isn't complete are passed on as they are found, and those of the types after it
+// are held until every type before them is complete, then passed on sorted. It reports whether the
+// users of every type are complete.
+func (l *listUsersQuery) listUsersGroupedByType(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	callback func(*openfgav1.User) error,
+) (bool, error) {
+	filterTypes, filtersByType := groupUserFiltersByType(req.GetUserFilters())
+	for _, f := range l.compoundUserFilters {
+		if _, ok := filtersByType[f.UserFilter.GetType()]; !ok {
+			filterTypes = append(filterTypes, f.UserFilter.GetType())
+			filtersByType[f.UserFilter.GetType()] = nil
+		}
+	}
+	if len(filterTypes) <= 1 {
+		q := *l
+		q.onFoundUser = callback
+		resp, err := q.ListUsers(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		return resp.Metadata.Complete, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	current := 0
+	held := make([][]*openfgav1.User, len(filterTypes))
+	complete := make([]bool, len(filterTypes))
+	allComplete := true
+	var callbackErr error
+	emitted := 0
+	emit := func(user *openfgav1.User) {
+		if callbackErr != nil {
+			return
+		}
+		if err := callback(user); err != nil {
+			callbackErr = err
+			cancel()
+			return
+		}
+		emitted++
+	}
+
+	p := pool.New().WithContext(ctx).WithCancelOnError().WithFirstError()
+	for i, filterType := range filterTypes {
+		typeReq := &openfgav1.ListUsersRequest{
+			StoreId:              req.GetStoreId(),
+			AuthorizationModelId: req.GetAuthorizationModelId(),
+			Object:               req.GetObject(),
+			Relation:             req.GetRelation(),
+			UserFilters:          filtersByType[filterType],
+			ContextualTuples:     req.GetContextualTuples(),
+			Context:              req.GetContext(),
+			Consistency:          req.GetConsistency(),
+		}
+
+		q := *l
+		q.skipResultMetrics = true
+		q.compoundUserFilters = compoundUserFiltersOfType(l.compoundUserFilters, filterType)
+		q.onFoundUser = func(user *openfgav1.User) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if i == current {
+				emit(user)
+			} else {
+				held[i] = append(held[i], user)
+			}
+			return callbackErr
+		}
+
+		p.Go(func(ctx context.Context) error {
+			resp, err := q.ListUsers(ctx, typeReq)
+
+			mu.Lock()
+			defer mu.Unlock()
+			complete[i] = true
+			allComplete = allComplete && err == nil && resp.Metadata.Complete
+			for current < len(filterTypes) && complete[current] {
+				current++
+				if current < len(filterTypes) {
+					sortUsers(held[current])
+					for _, user := range held[current] {
+						emit(user)
+					}
+					held[current] = nil
+				}
+			}
+			return err
+		})
+	}
+
+	err := p.Wait()
+	if callbackErr != nil {
+		return false, callbackErr
+	}
+	if err != nil {
+		return false, err
+	}
+	l.observeResultSize(req, emitted, false)
+	return allComplete, nil
+}
+
+// groupUserFiltersByType returns the types of the filters, in the order they first appear, and
+// the filters of each of them.
+func groupUserFiltersByType(filters []*openfgav1.UserTypeFilter) ([]string, map[string][]*openfgav1.UserTypeFilter) {
+	var filterTypes []string
+	filtersByType := make(map[string][]*openfgav1.UserTypeFilter)
+	for _, f := range filters {
+		if _, ok := filtersByType[f.GetType()]; !ok {
+			filterTypes = append(filterTypes, f.GetType())
+		}
+		filtersByType[f.GetType()] = append(filtersByType[f.GetType()], f)
+	}
+	return filterTypes, filtersByType
+}
+
+// sortUsersByFilterType stably sorts users by the order of their types in the user filters.
+func sortUsersByFilterType(users []*openfgav1.User, filters []*openfgav1.UserTypeFilter) {
+	filterTypes, _ := groupUserFiltersByType(filters)
+	typeOrder := make(map[string]int, len(filterTypes))
+	for i, filterType := range filterTypes {
+		typeOrder[filterType] = i
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return typeOrder[tuple.GetType(tuple.UserProtoToString(users[i]))] < typeOrder[tuple.GetType(tuple.UserProtoToString(users[j]))]
+	})
+}
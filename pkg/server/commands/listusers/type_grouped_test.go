@@ -0,0 +1,125 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_TypeGroupedStreaming(t *testing.T) {
+	const numUsers = 20
+	tuples := []string{
+		"document:1#viewer@group:staff#member",
+		"document:1#blocked@user:0",
+	}
+	expectedUsers := []string{"group:staff#member"}
+	for i := 0; i < numUsers; i++ {
+		tuples = append(tuples,
+			fmt.Sprintf("document:1#viewer@user:%d", i),
+			fmt.Sprintf("group:staff#member@employee:%d", i),
+			fmt.Sprintf("group:staff#member@group:team%d#member", i),
+		)
+		expectedUsers = append(expectedUsers,
+			fmt.Sprintf("user:%d", i),
+			fmt.Sprintf("employee:%d", i),
+			fmt.Sprintf("group:team%d#member", i),
+		)
+	}
+
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [employee, group#member]
+		type document
+			relations
+				define blocked: [user]
+				define viewer: [user, group#member]
+				define allowed: viewer but not blocked`, tuples)
+
+	userFilters := []*openfgav1.UserTypeFilter{
+		{Type: "group", Relation: "member"},
+		{Type: "employee"},
+		{Type: "user"},
+	}
+	typeOrder := map[string]int{"group": 0, "employee": 1, "user": 2}
+
+	// the reads of the group are slowed down, so that the users of the types after it are found
+	// before it is complete
+	interceptor := func(ctx context.Context, _ string, tupleKey *openfgav1.TupleKey) error {
+		if tuple.GetType(tupleKey.GetObject()) == "group" {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	listUsers := func(t *testing.T, relation string, callback func(*openfgav1.User) error) error {
+		return NewListUsersQuery(ds,
+			WithTypeGroupedStreaming(true),
+			WithReadInterceptor(interceptor),
+		).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			Relation:    relation,
+			UserFilters: userFilters,
+		}, callback)
+	}
+
+	requireGroupedByType := func(t *testing.T, users []string) {
+		for i := 1; i < len(users); i++ {
+			previousType, currentType := tuple.GetType(users[i-1]), tuple.GetType(users[i])
+			require.LessOrEqual(t, typeOrder[previousType], typeOrder[currentType], "%s emitted after %s", users[i], users[i-1])
+		}
+	}
+
+	t.Run("streamed_grouped_by_type", func(t *testing.T) {
+		var mu sync.Mutex
+		var users []string
+		err := listUsers(t, "viewer", func(user *openfgav1.User) error {
+			mu.Lock()
+			defer mu.Unlock()
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, expectedUsers, users)
+		requireGroupedByType(t, users)
+	})
+
+	t.Run("grouped_by_type_when_not_streamed", func(t *testing.T) {
+		var users []string
+		err := listUsers(t, "allowed", func(user *openfgav1.User) error {
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, expectedUsers, append(users, "user:0"))
+		requireGroupedByType(t, users)
+	})
+
+	t.Run("callback_error_stops_the_expansion", func(t *testing.T) {
+		callbackErr := errors.New("callback failed")
+		calls := 0
+		err := listUsers(t, "viewer", func(*openfgav1.User) error {
+			calls++
+			return callbackErr
+		})
+		require.ErrorIs(t, err, callbackErr)
+		require.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,75 @@
+package listusers
+
+import (
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// uniqueUserSet deduplicates the users found by a request, keyed by their interned string, and
+// keeps the latest result found for each of them. It is safe for concurrent use.
+type uniqueUserSet struct {
+	interner *userKeyInterner
+
+	mu    sync.Mutex
+	users map[string]foundUser
+}
+
+func newUniqueUserSet(interner *userKeyInterner, sizeHint int) *uniqueUserSet {
+	return &uniqueUserSet{
+		interner: interner,
+		users:    make(map[string]foundUser, sizeHint),
+	}
+}
+
+// key returns the key of the user in the set.
+func (s *uniqueUserSet) key(user *openfgav1.User) string {
+	return s.interner.userKey(user)
+}
+
+// add adds the user, as having the relation, and reports whether it wasn't in the set yet. A user
+// already in the set is left as it is.
+func (s *uniqueUserSet) add(user *openfgav1.User) bool {
+	key := s.key(user)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[key]; ok {
+		return false
+	}
+	s.users[key] = foundUser{user: user}
+	return true
+}
+
+// put records the result found for the user with the key, replacing the one found before if any,
+// and reports whether the user wasn't in the set yet.
+func (s *uniqueUserSet) put(key string, fu foundUser) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[key]
+	s.users[key] = fu
+	return !ok
+}
+
+// contains reports whether the user with the key is in the set.
+func (s *uniqueUserSet) contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[key]
+	return ok
+}
+
+// len returns the number of users in the set.
+func (s *uniqueUserSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users)
+}
+
+// results returns the latest result found for each user, keyed by the user's key. The map is
+// the set's own, so it must only be called once no more users are added.
+func (s *uniqueUserSet) results() map[string]foundUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users
+}
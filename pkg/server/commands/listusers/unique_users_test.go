@@ -0,0 +1,55 @@
+package listusers
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestUniqueUserSet(t *testing.T) {
+	t.Run("concurrent_adds", func(t *testing.T) {
+		const numGoroutines, numUsers = 8, 100
+		set := newUniqueUserSet(newUserKeyInterner(), 0)
+
+		var added atomic.Uint32
+		var missing atomic.Bool
+		var wg sync.WaitGroup
+		for i := 0; i < numGoroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < numUsers; j++ {
+					if set.add(tuple.StringToUserProto(fmt.Sprintf("user:%d", j))) {
+						added.Add(1)
+					}
+					if !set.contains(fmt.Sprintf("user:%d", j)) {
+						missing.Store(true)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		// each user is reported as new exactly once
+		require.Equal(t, uint32(numUsers), added.Load())
+		require.Equal(t, numUsers, set.len())
+		require.False(t, missing.Load())
+	})
+
+	t.Run("put_keeps_latest_result", func(t *testing.T) {
+		set := newUniqueUserSet(newUserKeyInterner(), 0)
+		user := tuple.StringToUserProto("user:jon")
+		key := set.key(user)
+		require.Equal(t, "user:jon", key)
+
+		require.True(t, set.put(key, foundUser{user: user, relationshipStatus: HasRelationship}))
+		require.False(t, set.put(key, foundUser{user: user, relationshipStatus: NoRelationship}))
+		require.False(t, set.add(user))
+		require.Equal(t, NoRelationship, set.results()[key].relationshipStatus)
+	})
+}
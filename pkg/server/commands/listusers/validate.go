@@ -3,18 +3,24 @@ package listusers
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 
 	serverErrors "github.com/openfga/openfga/pkg/server/errors"
 
 	"github.com/openfga/openfga/internal/validation"
+	"github.com/openfga/openfga/pkg/tuple"
 	"github.com/openfga/openfga/pkg/typesystem"
 )
 
 func ValidateListUsersRequest(ctx context.Context, req *openfgav1.ListUsersRequest, typesys *typesystem.TypeSystem) error {
 	_, span := tracer.Start(ctx, "validateListUsersRequest")
 	defer span.End()
+	if err := validateTargetObject(req); err != nil {
+		return err
+	}
+
 	if err := validateContextualTuples(req, typesys); err != nil {
 		return err
 	}
@@ -26,6 +32,20 @@ func ValidateListUsersRequest(ctx context.Context, req *openfgav1.ListUsersReque
 	return validateTargetRelation(req, typesys)
 }
 
+// validateTargetObject validates the format of the object, whose type and id are expanded as is.
+func validateTargetObject(request *openfgav1.ListUsersRequest) error {
+	object := request.GetObject()
+	if object.GetType() == "" || object.GetId() == "" || !tuple.IsValidObject(tuple.ObjectKey(object)) {
+		return serverErrors.ValidationError(fmt.Errorf("invalid 'object' field format"))
+	}
+
+	if object.GetId() == tuple.Wildcard {
+		return serverErrors.ValidationError(fmt.Errorf("the 'object' field cannot reference a typed wildcard"))
+	}
+
+	return nil
+}
+
 func validateContextualTuples(request *openfgav1.ListUsersRequest, typeSystem *typesystem.TypeSystem) error {
 	for _, contextualTuple := range request.GetContextualTuples() {
 		if err := validation.ValidateTuple(typeSystem, contextualTuple); err != nil {
@@ -62,6 +82,17 @@ func validateUserFilterRelation(typeSystem *typesystem.TypeSystem, usersFilter *
 		return nil
 	}
 
+	if filterObjectRelation == AnyRelation {
+		relations, err := typeSystem.GetRelations(filterObjectType)
+		if err != nil {
+			return serverErrors.HandleError("", err)
+		}
+		if len(relations) == 0 {
+			return serverErrors.ValidationError(fmt.Errorf("user filter '%s#%s' matches no relation since type '%s' defines none", filterObjectType, AnyRelation, filterObjectType))
+		}
+		return nil
+	}
+
 	_, err := typeSystem.GetRelation(filterObjectType, filterObjectRelation)
 	if err == nil {
 		return nil
@@ -74,7 +105,21 @@ func validateUserFilterRelation(typeSystem *typesystem.TypeSystem, usersFilter *
 	return serverErrors.HandleError("", err)
 }
 
+// validateTargetRelationNotEmpty validates that a relation is given, since no type defines the empty
+// relation and listing its users is meaningless.
+func validateTargetRelationNotEmpty(request *openfgav1.ListUsersRequest) error {
+	if request.GetRelation() == "" {
+		return serverErrors.ValidationError(fmt.Errorf("the 'relation' field cannot be empty"))
+	}
+
+	return nil
+}
+
 func validateTargetRelation(request *openfgav1.ListUsersRequest, typeSystem *typesystem.TypeSystem) error {
+	if err := validateTargetRelationNotEmpty(request); err != nil {
+		return err
+	}
+
 	objectType := request.GetObject().GetType()
 	targetRelation := request.GetRelation()
 
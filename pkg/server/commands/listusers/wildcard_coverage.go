@@ -0,0 +1,30 @@
+package listusers
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// withoutWildcardCoveredUsers returns users without the concrete users of the types whose public
+// wildcard is among users. See WithCollapseWildcardCoverage.
+func withoutWildcardCoveredUsers(users []*openfgav1.User) []*openfgav1.User {
+	wildcardTypes := make(map[string]struct{})
+	for _, user := range users {
+		if wildcard := user.GetWildcard(); wildcard != nil {
+			wildcardTypes[wildcard.GetType()] = struct{}{}
+		}
+	}
+	if len(wildcardTypes) == 0 {
+		return users
+	}
+
+	kept := make([]*openfgav1.User, 0, len(users))
+	for _, user := range users {
+		if object := user.GetObject(); object != nil {
+			if _, ok := wildcardTypes[object.GetType()]; ok {
+				continue
+			}
+		}
+		kept = append(kept, user)
+	}
+	return kept
+}
@@ -0,0 +1,113 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_CollapseWildcardCoverage(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [user, employee]
+		type document
+			relations
+				define viewer: [user, user:*, employee, group#member]`, []string{
+		"document:1#viewer@user:*",
+		"document:1#viewer@user:jon",
+		"document:1#viewer@user:maria",
+		"document:1#viewer@employee:will",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:poovam",
+		"group:eng#member@employee:anne",
+		"document:2#viewer@user:jon",
+		"document:2#viewer@employee:will",
+	})
+
+	req := func(objectID string) *openfgav1.ListUsersRequest {
+		return &openfgav1.ListUsersRequest{
+			StoreId:  storeID,
+			Object:   &openfgav1.Object{Type: "document", Id: objectID},
+			Relation: "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{
+				{Type: "user"},
+				{Type: "employee"},
+				{Type: "group", Relation: "member"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		objectID string
+		opts     []ListUsersQueryOption
+		expected []string
+	}{
+		{
+			// the employees and the userset aren't covered by the wildcard of users
+			name:     "concrete_users_of_wildcard_type_dropped",
+			objectID: "1",
+			opts:     []ListUsersQueryOption{WithCollapseWildcardCoverage(true)},
+			expected: []string{"user:*", "employee:will", "employee:anne", "group:eng#member"},
+		},
+		{
+			name:     "nothing_dropped_without_wildcard",
+			objectID: "2",
+			opts:     []ListUsersQueryOption{WithCollapseWildcardCoverage(true)},
+			expected: []string{"user:jon", "employee:will"},
+		},
+		{
+			name:     "disabled_by_default",
+			objectID: "1",
+			expected: []string{
+				"user:*",
+				"user:jon",
+				"user:maria",
+				"user:poovam",
+				"employee:will",
+				"employee:anne",
+				"group:eng#member",
+			},
+		},
+		{
+			name:     "wildcard_left_out_by_allow_list",
+			objectID: "1",
+			opts: []ListUsersQueryOption{
+				WithCollapseWildcardCoverage(true),
+				WithUserAllowList("user:jon", "employee:will"),
+			},
+			expected: []string{"user:jon", "employee:will"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := NewListUsersQuery(ds, test.opts...).ListUsers(ctx, req(test.objectID))
+			require.NoError(t, err)
+			require.ElementsMatch(t, test.expected, userStrings(resp.GetUsers()))
+		})
+	}
+
+	t.Run("not_streamed", func(t *testing.T) {
+		var users []string
+		err := NewListUsersQuery(ds, WithCollapseWildcardCoverage(true)).ListUsersCallback(ctx, req("1"), func(user *openfgav1.User) error {
+			users = append(users, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"user:*",
+			"employee:will",
+			"employee:anne",
+			"group:eng#member",
+		}, users)
+	})
+}
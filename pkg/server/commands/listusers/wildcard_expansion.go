@@ -0,0 +1,116 @@
+package listusers
+
+import (
+	"context"
+	"errors"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// expandWildcards replaces the public wildcards among users, for the types the user filters ask
+// for without a relation, with the users of their type known to the store: those that are the
+// object or the user of a stored or contextual tuple. Users found not to have the relation, such
+// as those excluded from the wildcard, are left out. See WithExpandWildcard.
+func (l *listUsersQuery) expandWildcards(
+	ctx context.Context,
+	req *internalListUsersRequest,
+	results map[string]foundUser,
+	users []*openfgav1.User,
+) ([]*openfgav1.User, error) {
+	enumerable := make(map[string]struct{}, len(req.GetUserFilters()))
+	for _, filter := range req.GetUserFilters() {
+		if filter.GetRelation() == "" {
+			enumerable[filter.GetType()] = struct{}{}
+		}
+	}
+
+	wildcardTypes := make(map[string]struct{})
+	excluded := make(map[string]struct{})
+	expanded := make([]*openfgav1.User, 0, len(users))
+	seen := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		if wildcard := user.GetWildcard(); wildcard != nil {
+			if _, ok := enumerable[wildcard.GetType()]; ok {
+				wildcardTypes[wildcard.GetType()] = struct{}{}
+				for _, excludedUser := range results[tuple.UserProtoToString(user)].excludedUsers {
+					excluded[tuple.UserProtoToString(excludedUser)] = struct{}{}
+				}
+				continue
+			}
+		}
+		expanded = append(expanded, user)
+		seen[tuple.UserProtoToString(user)] = struct{}{}
+	}
+	if len(wildcardTypes) == 0 {
+		return users, nil
+	}
+
+	add := func(userKey string) bool {
+		if l.maxResults > 0 && uint32(len(expanded)) >= l.maxResults {
+			return false
+		}
+		if _, ok := wildcardTypes[tuple.GetType(userKey)]; !ok {
+			return true
+		}
+		if _, ok := seen[userKey]; ok {
+			return true
+		}
+		seen[userKey] = struct{}{}
+		if _, ok := excluded[userKey]; ok {
+			return true
+		}
+		if fu, ok := results[userKey]; ok && fu.relationshipStatus == NoRelationship {
+			return true
+		}
+		expanded = append(expanded, tuple.StringToUserProto(userKey))
+		return true
+	}
+	addTupleUsers := func(tk *openfgav1.TupleKey) bool {
+		if !add(tk.GetObject()) {
+			return false
+		}
+		if _, _, _, ok := parseTupleUser(tk.GetUser()); !ok {
+			invalidTupleUsersSkippedCounter.Inc()
+			return true
+		}
+		if tuple.GetUserTypeFromUser(tk.GetUser()) == tuple.User {
+			return add(tk.GetUser())
+		}
+		return true
+	}
+
+	for _, ctk := range req.GetContextualTuples() {
+		if !addTupleUsers(ctk) {
+			return expanded, nil
+		}
+	}
+
+	// there is no index of the users by type, so every tuple of the store is read
+	opts := storage.ReadOptions{
+		Consistency: storage.ConsistencyOptions{
+			Preference: req.GetConsistency(),
+		},
+	}
+	iter, err := l.read(ctx, req, &openfgav1.TupleKey{}, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Stop()
+	req.datastoreQueryCount.Add(1)
+
+	for {
+		t, err := iter.Next(ctx)
+		if err != nil {
+			if errors.Is(err, storage.ErrIteratorDone) {
+				return expanded, nil
+			}
+			return nil, err
+		}
+		if !addTupleUsers(t.GetKey()) {
+			return expanded, nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package listusers
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestListUsersConfig_ExpandWildcard(t *testing.T) {
+	ds, storeID, ctx := newTestStore(t, `
+		model
+			schema 1.1
+		type user
+		type employee
+		type group
+			relations
+				define member: [user, employee]
+		type document
+			relations
+				define blocked: [user]
+				define public: [user:*, employee:*]
+				define viewer: [user, group#member] or (public but not blocked)`, []string{
+		"document:1#public@user:*",
+		"document:1#blocked@user:will",
+		"document:1#viewer@group:eng#member",
+		"group:eng#member@user:jon",
+		"group:eng#member@user:maria",
+		"group:eng#member@employee:andres",
+		"document:2#viewer@user:jon",
+		"document:3#public@employee:*",
+	})
+
+	listUsers := func(object string, filters []*openfgav1.UserTypeFilter, opts ...ListUsersQueryOption) []string {
+		resp, err := NewListUsersQuery(ds, opts...).ListUsers(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: object},
+			Relation:    "viewer",
+			UserFilters: filters,
+			ContextualTuples: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("group:other", "member", "user:poovam"),
+			},
+		})
+		require.NoError(t, err)
+		return userStrings(resp.GetUsers())
+	}
+	users := []*openfgav1.UserTypeFilter{{Type: "user"}}
+
+	tests := []struct {
+		name     string
+		objectID string
+		filters  []*openfgav1.UserTypeFilter
+		opts     []ListUsersQueryOption
+		expected []string
+	}{
+		{
+			name:     "disabled_by_default",
+			objectID: "1",
+			filters:  users,
+			expected: []string{"user:*", "user:jon", "user:maria"},
+		},
+		{
+			name:     "wildcard_expanded_into_known_users",
+			objectID: "1",
+			filters:  users,
+			opts:     []ListUsersQueryOption{WithExpandWildcard(true)},
+			expected: []string{"user:jon", "user:maria", "user:poovam"},
+		},
+		{
+			name:     "only_wildcards_of_filter_types",
+			objectID: "3",
+			filters: []*openfgav1.UserTypeFilter{
+				{Type: "employee"},
+				{Type: "group", Relation: "member"},
+			},
+			opts:     []ListUsersQueryOption{WithExpandWildcard(true)},
+			expected: []string{"employee:andres"},
+		},
+		{
+			name:     "no_wildcard",
+			objectID: "2",
+			filters:  users,
+			opts:     []ListUsersQueryOption{WithExpandWildcard(true)},
+			expected: []string{"user:jon"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ElementsMatch(t, test.expected, listUsers(test.objectID, test.filters, test.opts...))
+		})
+	}
+
+	t.Run("max_results", func(t *testing.T) {
+		require.Len(t, listUsers("1", users, WithExpandWildcard(true), WithListUsersMaxResults(2)), 2)
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		var found []string
+		err := NewListUsersQuery(ds, WithExpandWildcard(true)).ListUsersCallback(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     storeID,
+			Object:      &openfgav1.Object{Type: "document", Id: "3"},
+			Relation:    "viewer",
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "employee"}},
+		}, func(user *openfgav1.User) error {
+			found = append(found, tuple.UserProtoToString(user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"employee:andres"}, found)
+	})
+}
@@ -27,6 +27,7 @@ var (
 	RequestCancelled                       = status.Error(codes.Code(openfgav1.InternalErrorCode_cancelled), "Request Cancelled")
 	RequestDeadlineExceeded                = status.Error(codes.Code(openfgav1.InternalErrorCode_deadline_exceeded), "Request Deadline Exceeded")
 	ThrottledTimeout                       = status.Error(codes.Code(openfgav1.UnprocessableContentErrorCode_throttled_timeout_error), "timeout due to throttling on complex request")
+	DatastoreUnavailable                   = status.Error(codes.Code(openfgav1.InternalErrorCode_unavailable), "Datastore Unavailable")
 )
 
 type InternalError struct {
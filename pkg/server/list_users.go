@@ -9,16 +9,19 @@ import (
 	"github.com/openfga/openfga/internal/throttler/threshold"
 	"github.com/openfga/openfga/internal/utils"
 
+	"github.com/cenkalti/backoff/v4"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/openfga/openfga/internal/condition"
 	"github.com/openfga/openfga/internal/graph"
 	"github.com/openfga/openfga/pkg/middleware/validator"
+	"github.com/openfga/openfga/pkg/storage"
 	"github.com/openfga/openfga/pkg/telemetry"
 	"github.com/openfga/openfga/pkg/tuple"
 
@@ -32,6 +35,92 @@ import (
 func (s *Server) ListUsers(
 	ctx context.Context,
 	req *openfgav1.ListUsersRequest,
+) (*openfgav1.ListUsersResponse, error) {
+	// the typesystem is resolved once, and the same one is used throughout the expansion even if
+	// the latest model of the store changes in the meantime
+	return s.listUsers(ctx, req, func(ctx context.Context) (*typesystem.TypeSystem, error) {
+		resolver := retryTransientResolution(s.typesystemResolver, listUsersTypesystemResolutionRetryDuration)
+		return s.resolveTypesystemWith(ctx, resolver, req.GetStoreId(), req.GetAuthorizationModelId())
+	})
+}
+
+// listUsersTypesystemResolutionRetryDuration is how long ListUsers retries resolving its
+// typesystem for when resolution fails transiently.
+const listUsersTypesystemResolutionRetryDuration = 500 * time.Millisecond
+
+// retryTransientResolution returns a resolver that retries resolver with an exponential backoff
+// for up to maxElapsedTime while it fails transiently, such as while a model is being written.
+// Any other error, such as a model that doesn't exist or is invalid, is not retried.
+func retryTransientResolution(resolver typesystem.TypesystemResolverFunc, maxElapsedTime time.Duration) typesystem.TypesystemResolverFunc {
+	return func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+		policy := backoff.NewExponentialBackOff()
+		policy.InitialInterval = 10 * time.Millisecond
+		policy.MaxElapsedTime = maxElapsedTime
+
+		var typesys *typesystem.TypeSystem
+		err := backoff.Retry(func() error {
+			var err error
+			typesys, err = resolver(ctx, storeID, modelID)
+			if err != nil && !isTransientResolutionError(err) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}, backoff.WithContext(policy, ctx))
+		if err != nil {
+			return nil, err
+		}
+		return typesys, nil
+	}
+}
+
+// isTransientResolutionError reports whether resolving a typesystem failed with an error that may
+// not recur, such as a write conflicting with the read of the model or an unavailable datastore.
+func isTransientResolutionError(err error) bool {
+	var datastoreErr *listusers.DatastoreError
+	if errors.Is(err, storage.ErrTransactionalWriteFailed) || errors.As(err, &datastoreErr) {
+		return true
+	}
+	st, ok := status.FromError(err)
+	return ok && (st.Code() == codes.Unavailable || st.Code() == codes.Aborted)
+}
+
+// ListUsersWithInlineModel returns the users matching the request like ListUsers, but evaluates
+// them against the given model instead of one stored for the store. The model is validated but
+// never written, which allows evaluating what-if models. The request's AuthorizationModelId is
+// ignored, while the tuples are still read from the request's store.
+func (s *Server) ListUsersWithInlineModel(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	model *openfgav1.AuthorizationModel,
+) (*openfgav1.ListUsersResponse, error) {
+	return s.listUsers(ctx, req, func(ctx context.Context) (*typesystem.TypeSystem, error) {
+		return inlineTypesystem(ctx, model)
+	})
+}
+
+// inlineTypesystem builds a transient TypeSystem for a model that was supplied inline rather
+// than resolved from storage.
+func inlineTypesystem(ctx context.Context, model *openfgav1.AuthorizationModel) (*typesystem.TypeSystem, error) {
+	if model == nil {
+		return nil, serverErrors.InvalidAuthorizationModelInput(typesystem.ErrInvalidModel)
+	}
+
+	if !typesystem.IsSchemaVersionSupported(model.GetSchemaVersion()) {
+		return nil, serverErrors.ValidationError(typesystem.ErrInvalidSchemaVersion)
+	}
+
+	typesys, err := typesystem.NewAndValidate(ctx, model)
+	if err != nil {
+		return nil, serverErrors.InvalidAuthorizationModelInput(err)
+	}
+
+	return typesys, nil
+}
+
+func (s *Server) listUsers(
+	ctx context.Context,
+	req *openfgav1.ListUsersRequest,
+	resolveTypesystem func(ctx context.Context) (*typesystem.TypeSystem, error),
 ) (*openfgav1.ListUsersResponse, error) {
 	err := s.validateConsistencyRequest(req.GetConsistency())
 	if err != nil {
@@ -56,7 +145,7 @@ func (s *Server) ListUsers(
 
 	const methodName = "listusers"
 
-	typesys, err := s.resolveTypesystem(ctx, req.GetStoreId(), req.GetAuthorizationModelId())
+	typesys, err := resolveTypesystem(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -73,8 +162,11 @@ func (s *Server) ListUsers(
 		listusers.WithResolveNodeBreadthLimit(s.resolveNodeBreadthLimit),
 		listusers.WithListUsersQueryLogger(s.logger),
 		listusers.WithListUsersMaxResults(s.listUsersMaxResults),
+		listusers.WithListUsersMaxResponseBytes(s.listUsersMaxResponseBytes),
 		listusers.WithListUsersDeadline(s.listUsersDeadline),
 		listusers.WithListUsersMaxConcurrentReads(s.maxConcurrentReadsForListUsers),
+		listusers.WithSharedWorkerPool(s.listUsersSharedWorkerPool),
+		listusers.WithRequestCoalescing(s.listUsersRequestCoalescing),
 		listusers.WithDispatchThrottlerConfig(threshold.Config{
 			Throttler:    s.listUsersDispatchThrottler,
 			Enabled:      s.listUsersDispatchThrottlingEnabled,
@@ -87,11 +179,32 @@ func (s *Server) ListUsers(
 	if err != nil {
 		telemetry.TraceError(span, err)
 
+		var modelErr *listusers.ModelError
+		var datastoreErr *listusers.DatastoreError
 		switch {
 		case errors.Is(err, graph.ErrResolutionDepthExceeded):
 			return nil, serverErrors.AuthorizationModelResolutionTooComplex
-		case errors.Is(err, condition.ErrEvaluationFailed):
+		case errors.Is(err, condition.ErrEvaluationFailed),
+			errors.Is(err, listusers.ErrUnsupportedModelFeature),
+			errors.Is(err, listusers.ErrRelationNotEnumerable),
+			errors.As(err, &modelErr):
+			return nil, serverErrors.ValidationError(err)
+		case errors.Is(err, listusers.ErrTraversalBudgetExceeded),
+			errors.Is(err, listusers.ErrMaxExpansionStepsExceeded),
+			errors.Is(err, listusers.ErrMaxSubtractSetSizeExceeded):
+			// like the resolution depth, the limits on the expansion reject the request as too complex
+			return nil, serverErrors.ValidationError(err)
+		case errors.Is(err, listusers.ErrNoProgress):
+			// a stalled expansion is given up on like one running past its deadline
+			return nil, serverErrors.RequestDeadlineExceeded
+		case errors.Is(err, storage.ErrInvalidSnapshotToken):
 			return nil, serverErrors.ValidationError(err)
+		case errors.Is(err, storage.ErrSnapshotsNotSupported),
+			errors.Is(err, storage.ErrPartitionsNotSupported):
+			return nil, status.Error(codes.Unimplemented, err.Error())
+		case errors.As(err, &datastoreErr):
+			s.logger.ErrorWithContext(ctx, "ListUsers datastore read failed", zap.Error(err))
+			return nil, serverErrors.DatastoreUnavailable
 		default:
 			return nil, serverErrors.HandleError("", err)
 		}
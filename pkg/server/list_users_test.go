@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -105,6 +106,56 @@ func TestListUsersValidation(t *testing.T) {
 			model:             model,
 			expectedErrorCode: codes.Code(2022),
 		},
+		{
+			name: "empty_target_object_id",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "document", Id: ""},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:             model,
+			expectedErrorCode: codes.InvalidArgument,
+		},
+		{
+			name: "empty_target_object_type",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "", Id: "1"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:             model,
+			expectedErrorCode: codes.InvalidArgument,
+		},
+		{
+			name: "target_object_id_with_colon",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "document", Id: "1:2"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:             model,
+			expectedErrorCode: codes.Code(2000),
+		},
+		{
+			name: "target_object_id_with_hash",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "document", Id: "1#viewer"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:             model,
+			expectedErrorCode: codes.Code(2000),
+		},
+		{
+			name: "target_object_wildcard",
+			req: &openfgav1.ListUsersRequest{
+				Object:      &openfgav1.Object{Type: "document", Id: "*"},
+				Relation:    "viewer",
+				UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+			},
+			model:             model,
+			expectedErrorCode: codes.Code(2000),
+		},
 		{
 			name: "contextual_tuple_invalid_object_type",
 			req: &openfgav1.ListUsersRequest{
@@ -364,6 +415,241 @@ func TestListUsers_ErrorCases(t *testing.T) {
 	})
 }
 
+func TestListUsersWithInlineModel(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ctx := context.Background()
+	store := ulid.Make().String()
+
+	s := MustNewServerWithOpts(
+		WithDatastore(memory.New()),
+	)
+	t.Cleanup(s.Close)
+
+	model := testutils.MustTransformDSLToProtoWithID(`
+		model
+			schema 1.1
+		type user
+
+		type group
+			relations
+				define member: [user]
+
+		type document
+			relations
+				define viewer: [group#member]`)
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:  store,
+		Relation: "viewer",
+		Object: &openfgav1.Object{
+			Type: "document",
+			Id:   "1",
+		},
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		ContextualTuples: []*openfgav1.TupleKey{
+			tuple.NewTupleKey("document:1", "viewer", "group:eng#member"),
+			tuple.NewTupleKey("group:eng", "member", "user:jon"),
+			tuple.NewTupleKey("group:eng", "member", "user:maria"),
+		},
+	}
+
+	t.Run("with_contextual_tuples_against_empty_store", func(t *testing.T) {
+		res, err := s.ListUsersWithInlineModel(ctx, req, model)
+		require.NoError(t, err)
+
+		users := make([]string, 0, len(res.GetUsers()))
+		for _, u := range res.GetUsers() {
+			users = append(users, tuple.UserProtoToString(u))
+		}
+		require.ElementsMatch(t, []string{"user:jon", "user:maria"}, users)
+	})
+
+	t.Run("model_is_not_written", func(t *testing.T) {
+		_, err := s.ListUsers(ctx, req)
+		require.ErrorIs(t, err, serverErrors.LatestAuthorizationModelNotFound(store))
+	})
+
+	t.Run("invalid_request_for_model", func(t *testing.T) {
+		_, err := s.ListUsersWithInlineModel(ctx, &openfgav1.ListUsersRequest{
+			StoreId:     store,
+			Relation:    "editor",
+			Object:      &openfgav1.Object{Type: "document", Id: "1"},
+			UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+		}, model)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid_model", func(t *testing.T) {
+		_, err := s.ListUsersWithInlineModel(ctx, req, &openfgav1.AuthorizationModel{
+			Id:            ulid.Make().String(),
+			SchemaVersion: typesystem.SchemaVersion1_1,
+			TypeDefinitions: []*openfgav1.TypeDefinition{
+				{
+					Type: "document",
+					Relations: map[string]*openfgav1.Userset{
+						"viewer": typesystem.ComputedUserset("editor"),
+					},
+				},
+			},
+		})
+		e, ok := status.FromError(err)
+		require.True(t, ok)
+		require.Equal(t, codes.Code(openfgav1.ErrorCode_invalid_authorization_model), e.Code())
+	})
+
+	t.Run("missing_model", func(t *testing.T) {
+		_, err := s.ListUsersWithInlineModel(ctx, req, nil)
+		e, ok := status.FromError(err)
+		require.True(t, ok)
+		require.Equal(t, codes.Code(openfgav1.ErrorCode_invalid_authorization_model), e.Code())
+	})
+
+	t.Run("unsupported_schema_version", func(t *testing.T) {
+		_, err := s.ListUsersWithInlineModel(ctx, req, &openfgav1.AuthorizationModel{
+			Id:              ulid.Make().String(),
+			SchemaVersion:   typesystem.SchemaVersion1_0,
+			TypeDefinitions: model.GetTypeDefinitions(),
+		})
+		require.ErrorIs(t, err, serverErrors.ValidationError(typesystem.ErrInvalidSchemaVersion))
+	})
+}
+
+func TestListUsersTypesystemResolution(t *testing.T) {
+	t.Cleanup(func() {
+		goleak.VerifyNone(t)
+	})
+
+	ctx := context.Background()
+	store := ulid.Make().String()
+
+	s := MustNewServerWithOpts(
+		WithDatastore(memory.New()),
+	)
+	t.Cleanup(s.Close)
+
+	writeModelResp, err := s.WriteAuthorizationModel(ctx, &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:       store,
+		SchemaVersion: typesystem.SchemaVersion1_1,
+		TypeDefinitions: language.MustTransformDSLToProto(`
+			model
+				schema 1.1
+			type user
+
+			type document
+				relations
+					define editor: [user]
+					define viewer: [user]`).GetTypeDefinitions(),
+	})
+	require.NoError(t, err)
+
+	_, err = s.Write(ctx, &openfgav1.WriteRequest{
+		StoreId: store,
+		Writes: &openfgav1.WriteRequestWrites{
+			TupleKeys: []*openfgav1.TupleKey{
+				tuple.NewTupleKey("document:1", "viewer", "user:jon"),
+				tuple.NewTupleKey("document:1", "editor", "user:maria"),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	modelA, err := s.resolveTypesystem(ctx, store, writeModelResp.GetAuthorizationModelId())
+	require.NoError(t, err)
+	// modelB grants viewer to the editors too, so the users listed show which model was used
+	modelB := typesystem.New(testutils.MustTransformDSLToProtoWithID(`
+		model
+			schema 1.1
+		type user
+
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user] or editor`))
+
+	req := &openfgav1.ListUsersRequest{
+		StoreId:     store,
+		Relation:    "viewer",
+		Object:      &openfgav1.Object{Type: "document", Id: "1"},
+		UserFilters: []*openfgav1.UserTypeFilter{{Type: "user"}},
+	}
+
+	t.Run("transient_error_retried_and_snapshot_kept_across_model_swap", func(t *testing.T) {
+		var calls int
+		s.typesystemResolver = func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+			calls++
+			switch calls {
+			case 1:
+				return nil, fmt.Errorf("failed to FindLatestAuthorizationModel: %w", storage.ErrTransactionalWriteFailed)
+			case 2:
+				// the model is swapped as soon as it is resolved, before the expansion starts
+				return modelA, nil
+			default:
+				return modelB, nil
+			}
+		}
+
+		res, err := s.ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, res.GetUsers(), 1)
+		require.Equal(t, "user:jon", tuple.UserProtoToString(res.GetUsers()[0]))
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("missing_model_not_retried", func(t *testing.T) {
+		var calls int
+		s.typesystemResolver = func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+			calls++
+			return nil, typesystem.ErrModelNotFound
+		}
+
+		_, err := s.ListUsers(ctx, req)
+		require.ErrorIs(t, err, serverErrors.LatestAuthorizationModelNotFound(store))
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("unavailable_datastore_retried", func(t *testing.T) {
+		var calls int
+		s.typesystemResolver = func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+			calls++
+			if calls == 1 {
+				return nil, status.Error(codes.Unavailable, "datastore unavailable")
+			}
+			return modelA, nil
+		}
+
+		_, err := s.ListUsers(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("non_transient_error_not_retried", func(t *testing.T) {
+		var calls int
+		s.typesystemResolver = func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+			calls++
+			return nil, errors.New("malformed model row")
+		}
+
+		_, err := s.ListUsers(ctx, req)
+		require.Error(t, err)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("persistent_error_returned", func(t *testing.T) {
+		var calls int
+		s.typesystemResolver = func(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+			calls++
+			return nil, fmt.Errorf("failed to FindLatestAuthorizationModel: %w", storage.ErrTransactionalWriteFailed)
+		}
+
+		_, err := s.ListUsers(ctx, req)
+		require.Error(t, err)
+		require.Greater(t, calls, 1)
+	})
+}
+
 func TestListUsers_Deadline(t *testing.T) {
 	t.Cleanup(func() {
 		goleak.VerifyNone(t)
@@ -472,9 +758,10 @@ func TestListUsers_Deadline(t *testing.T) {
 		})
 		require.Nil(t, resp)
 
+		// a datastore failure is told apart from an internal error
 		st, ok := status.FromError(err)
 		require.True(t, ok)
-		require.Equal(t, codes.Code(openfgav1.InternalErrorCode_internal_error), st.Code())
+		require.Equal(t, codes.Code(openfgav1.InternalErrorCode_unavailable), st.Code())
 	})
 
 	t.Run("internal_storage_error_after_deadline", func(t *testing.T) {
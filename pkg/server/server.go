@@ -39,6 +39,7 @@ import (
 	httpmiddleware "github.com/openfga/openfga/pkg/middleware/http"
 	"github.com/openfga/openfga/pkg/middleware/validator"
 	"github.com/openfga/openfga/pkg/server/commands"
+	"github.com/openfga/openfga/pkg/server/commands/listusers"
 	serverErrors "github.com/openfga/openfga/pkg/server/errors"
 	"github.com/openfga/openfga/pkg/storage"
 	"github.com/openfga/openfga/pkg/storage/storagewrappers"
@@ -112,6 +113,9 @@ type Server struct {
 	listObjectsMaxResults            uint32
 	listUsersDeadline                time.Duration
 	listUsersMaxResults              uint32
+	listUsersMaxResponseBytes        uint64
+	listUsersSharedWorkerPoolSize    uint32
+	listUsersRequestCoalescing       bool
 	maxConcurrentReadsForListObjects uint32
 	maxConcurrentReadsForCheck       uint32
 	maxConcurrentReadsForListUsers   uint32
@@ -151,6 +155,7 @@ type Server struct {
 
 	listObjectsDispatchThrottler throttler.Throttler
 	listUsersDispatchThrottler   throttler.Throttler
+	listUsersSharedWorkerPool    *listusers.SharedWorkerPool
 
 	ctx                 context.Context
 	checkTrackerEnabled bool
@@ -294,6 +299,36 @@ func WithListUsersMaxResults(limit uint32) OpenFGAServiceV1Option {
 	}
 }
 
+// WithListUsersMaxResponseBytes affects the ListUsers API only.
+// It sets the maximum estimated size, in bytes, of the users that this API will return.
+// The size of each user is estimated using its protobuf wire size. If it's zero,
+// the response size is only bounded by WithListUsersMaxResults.
+func WithListUsersMaxResponseBytes(limit uint64) OpenFGAServiceV1Option {
+	return func(s *Server) {
+		s.listUsersMaxResponseBytes = limit
+	}
+}
+
+// WithListUsersSharedWorkerPoolSize affects the ListUsers API only.
+// It sets the maximum number of datastore reads that can be in flight across all the ListUsers calls served by
+// the server at once, as opposed to WithMaxConcurrentReadsForListUsers, which bounds the reads of each call.
+// Once the limit is reached, the calls take turns making their reads until their deadline.
+// If it's zero, the reads are only bounded for each call.
+func WithListUsersSharedWorkerPoolSize(size uint32) OpenFGAServiceV1Option {
+	return func(s *Server) {
+		s.listUsersSharedWorkerPoolSize = size
+	}
+}
+
+// WithListUsersRequestCoalescing affects the ListUsers API only.
+// If enabled, the identical ListUsers calls served concurrently share a single expansion, whose response
+// they each get a copy of. Calls with contextual tuples, a context or higher consistency are never coalesced.
+func WithListUsersRequestCoalescing(enabled bool) OpenFGAServiceV1Option {
+	return func(s *Server) {
+		s.listUsersRequestCoalescing = enabled
+	}
+}
+
 // WithMaxConcurrentReadsForListObjects sets a limit on the number of datastore reads that can be in flight for a given ListObjects call.
 // This number should be set depending on the RPS expected for Check and ListObjects APIs, the number of OpenFGA replicas running,
 // and the number of connections the datastore allows.
@@ -528,6 +563,7 @@ func NewServerWithOpts(opts ...OpenFGAServiceV1Option) (*Server, error) {
 		listObjectsMaxResults:            serverconfig.DefaultListObjectsMaxResults,
 		listUsersDeadline:                serverconfig.DefaultListUsersDeadline,
 		listUsersMaxResults:              serverconfig.DefaultListUsersMaxResults,
+		listUsersMaxResponseBytes:        serverconfig.DefaultListUsersMaxResponseBytes,
 		maxConcurrentReadsForCheck:       serverconfig.DefaultMaxConcurrentReadsForCheck,
 		maxConcurrentReadsForListObjects: serverconfig.DefaultMaxConcurrentReadsForListObjects,
 		maxConcurrentReadsForListUsers:   serverconfig.DefaultMaxConcurrentReadsForListUsers,
@@ -632,6 +668,10 @@ func NewServerWithOpts(opts ...OpenFGAServiceV1Option) (*Server, error) {
 		s.listUsersDispatchThrottler = throttler.NewConstantRateThrottler(s.listUsersDispatchThrottlingFrequency, "list_users_dispatch_throttle")
 	}
 
+	if s.listUsersSharedWorkerPoolSize > 0 {
+		s.listUsersSharedWorkerPool = listusers.NewSharedWorkerPool(s.listUsersSharedWorkerPoolSize)
+	}
+
 	s.datastore = storagewrappers.NewCachedOpenFGADatastore(storagewrappers.NewContextWrapper(s.datastore), s.maxAuthorizationModelCacheSize)
 
 	s.typesystemResolver, s.typesystemResolverStop = typesystem.MemoizedTypesystemResolverFunc(s.datastore)
@@ -1373,10 +1413,19 @@ func (s *Server) IsReady(ctx context.Context) (bool, error) {
 // resolveTypesystem resolves the underlying TypeSystem given the storeID and modelID and
 // it sets some response metadata based on the model resolution.
 func (s *Server) resolveTypesystem(ctx context.Context, storeID, modelID string) (*typesystem.TypeSystem, error) {
+	return s.resolveTypesystemWith(ctx, s.typesystemResolver, storeID, modelID)
+}
+
+// resolveTypesystemWith is resolveTypesystem with the given resolver.
+func (s *Server) resolveTypesystemWith(
+	ctx context.Context,
+	resolver typesystem.TypesystemResolverFunc,
+	storeID, modelID string,
+) (*typesystem.TypeSystem, error) {
 	ctx, span := tracer.Start(ctx, "resolveTypesystem")
 	defer span.End()
 
-	typesys, err := s.typesystemResolver(ctx, storeID, modelID)
+	typesys, err := resolver(ctx, storeID, modelID)
 	if err != nil {
 		if errors.Is(err, typesystem.ErrModelNotFound) {
 			if modelID == "" {
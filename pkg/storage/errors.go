@@ -38,6 +38,17 @@ var (
 
 	// ErrNotFound is returned when the object does not exist.
 	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidSnapshotToken is returned when the snapshot token of a read is malformed.
+	ErrInvalidSnapshotToken = errors.New("invalid snapshot token")
+
+	// ErrSnapshotsNotSupported is returned when reads are requested as of a snapshot from a
+	// datastore that doesn't implement SnapshotReader.
+	ErrSnapshotsNotSupported = errors.New("datastore does not support snapshot reads")
+
+	// ErrPartitionsNotSupported is returned when reads are restricted to a partition by a
+	// datastore that doesn't partition tuples.
+	ErrPartitionsNotSupported = errors.New("datastore does not support partitioned reads")
 )
 
 // ExceededMaxTypeDefinitionsLimitError constructs an error indicating that
@@ -174,10 +174,17 @@ func WithMaxTypesPerAuthorizationModel(n int) StorageOption {
 func (s *MemoryBackend) Close() {}
 
 // Read see [storage.RelationshipTupleReader].Read.
-func (s *MemoryBackend) Read(ctx context.Context, store string, key *openfgav1.TupleKey, _ storage.ReadOptions) (storage.TupleIterator, error) {
+func (s *MemoryBackend) Read(ctx context.Context, store string, key *openfgav1.TupleKey, options storage.ReadOptions) (storage.TupleIterator, error) {
 	ctx, span := tracer.Start(ctx, "memory.Read")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	return s.read(ctx, store, key, nil)
 }
 
@@ -415,10 +422,17 @@ func find(records []*storage.TupleRecord, tupleKey *openfgav1.TupleKey) bool {
 }
 
 // ReadUserTuple see [storage.RelationshipTupleReader].ReadUserTuple.
-func (s *MemoryBackend) ReadUserTuple(ctx context.Context, store string, key *openfgav1.TupleKey, _ storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
+func (s *MemoryBackend) ReadUserTuple(ctx context.Context, store string, key *openfgav1.TupleKey, options storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
 	_, span := tracer.Start(ctx, "memory.ReadUserTuple")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	s.mutexTuples.RLock()
 	defer s.mutexTuples.RUnlock()
 
@@ -437,11 +451,18 @@ func (s *MemoryBackend) ReadUsersetTuples(
 	ctx context.Context,
 	store string,
 	filter storage.ReadUsersetTuplesFilter,
-	_ storage.ReadUsersetTuplesOptions,
+	options storage.ReadUsersetTuplesOptions,
 ) (storage.TupleIterator, error) {
 	_, span := tracer.Start(ctx, "memory.ReadUsersetTuples")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	s.mutexTuples.RLock()
 	defer s.mutexTuples.RUnlock()
 
@@ -481,6 +502,13 @@ func (s *MemoryBackend) ReadStartingWithUser(
 	_, span := tracer.Start(ctx, "memory.ReadStartingWithUser")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	s.mutexTuples.RLock()
 	defer s.mutexTuples.RUnlock()
 
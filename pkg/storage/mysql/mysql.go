@@ -133,6 +133,13 @@ func (m *MySQL) Read(ctx context.Context, store string, tupleKey *openfgav1.Tupl
 	ctx, span := tracer.Start(ctx, "mysql.Read")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	return m.read(ctx, store, tupleKey, nil)
 }
 
@@ -211,10 +218,17 @@ func (m *MySQL) Write(ctx context.Context, store string, deletes storage.Deletes
 }
 
 // ReadUserTuple see [storage.RelationshipTupleReader].ReadUserTuple.
-func (m *MySQL) ReadUserTuple(ctx context.Context, store string, tupleKey *openfgav1.TupleKey, _ storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
+func (m *MySQL) ReadUserTuple(ctx context.Context, store string, tupleKey *openfgav1.TupleKey, options storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
 	ctx, span := tracer.Start(ctx, "mysql.ReadUserTuple")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	objectType, objectID := tupleUtils.SplitObject(tupleKey.GetObject())
 	userType := tupleUtils.GetUserTypeFromUser(tupleKey.GetUser())
 
@@ -268,11 +282,18 @@ func (m *MySQL) ReadUsersetTuples(
 	ctx context.Context,
 	store string,
 	filter storage.ReadUsersetTuplesFilter,
-	_ storage.ReadUsersetTuplesOptions,
+	options storage.ReadUsersetTuplesOptions,
 ) (storage.TupleIterator, error) {
 	ctx, span := tracer.Start(ctx, "mysql.ReadUsersetTuples")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	sb := m.stbl.
 		Select(
 			"store", "object_type", "object_id", "relation", "_user",
@@ -317,11 +338,18 @@ func (m *MySQL) ReadStartingWithUser(
 	ctx context.Context,
 	store string,
 	opts storage.ReadStartingWithUserFilter,
-	_ storage.ReadStartingWithUserOptions,
+	options storage.ReadStartingWithUserOptions,
 ) (storage.TupleIterator, error) {
 	ctx, span := tracer.Start(ctx, "mysql.ReadStartingWithUser")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	var targetUsersArg []string
 	for _, u := range opts.UserFilter {
 		targetUser := u.GetObject()
@@ -146,6 +146,13 @@ func (p *Postgres) Read(ctx context.Context, store string, tupleKey *openfgav1.T
 	ctx, span := tracer.Start(ctx, "postgres.Read")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	return p.read(ctx, store, tupleKey, nil)
 }
 
@@ -224,10 +231,17 @@ func (p *Postgres) Write(ctx context.Context, store string, deletes storage.Dele
 }
 
 // ReadUserTuple see [storage.RelationshipTupleReader].ReadUserTuple.
-func (p *Postgres) ReadUserTuple(ctx context.Context, store string, tupleKey *openfgav1.TupleKey, _ storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
+func (p *Postgres) ReadUserTuple(ctx context.Context, store string, tupleKey *openfgav1.TupleKey, options storage.ReadUserTupleOptions) (*openfgav1.Tuple, error) {
 	ctx, span := tracer.Start(ctx, "postgres.ReadUserTuple")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	objectType, objectID := tupleUtils.SplitObject(tupleKey.GetObject())
 	userType := tupleUtils.GetUserTypeFromUser(tupleKey.GetUser())
 
@@ -278,10 +292,17 @@ func (p *Postgres) ReadUserTuple(ctx context.Context, store string, tupleKey *op
 }
 
 // ReadUsersetTuples see [storage.RelationshipTupleReader].ReadUsersetTuples.
-func (p *Postgres) ReadUsersetTuples(ctx context.Context, store string, filter storage.ReadUsersetTuplesFilter, _ storage.ReadUsersetTuplesOptions) (storage.TupleIterator, error) {
+func (p *Postgres) ReadUsersetTuples(ctx context.Context, store string, filter storage.ReadUsersetTuplesFilter, options storage.ReadUsersetTuplesOptions) (storage.TupleIterator, error) {
 	ctx, span := tracer.Start(ctx, "postgres.ReadUsersetTuples")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	sb := p.stbl.
 		Select(
 			"store", "object_type", "object_id", "relation", "_user",
@@ -322,10 +343,17 @@ func (p *Postgres) ReadUsersetTuples(ctx context.Context, store string, filter s
 }
 
 // ReadStartingWithUser see [storage.RelationshipTupleReader].ReadStartingWithUser.
-func (p *Postgres) ReadStartingWithUser(ctx context.Context, store string, opts storage.ReadStartingWithUserFilter, _ storage.ReadStartingWithUserOptions) (storage.TupleIterator, error) {
+func (p *Postgres) ReadStartingWithUser(ctx context.Context, store string, opts storage.ReadStartingWithUserFilter, options storage.ReadStartingWithUserOptions) (storage.TupleIterator, error) {
 	ctx, span := tracer.Start(ctx, "postgres.ReadStartingWithUser")
 	defer span.End()
 
+	if options.SnapshotToken != "" {
+		return nil, storage.ErrSnapshotsNotSupported
+	}
+	if options.Partition != "" {
+		return nil, storage.ErrPartitionsNotSupported
+	}
+
 	var targetUsersArg []string
 	for _, u := range opts.UserFilter {
 		targetUser := u.GetObject()
@@ -109,24 +109,70 @@ type ConsistencyOptions struct {
 // be used with the Read method.
 type ReadOptions struct {
 	Consistency ConsistencyOptions
+
+	// SnapshotToken, if set, makes the read observe the tuples as of the snapshot it identifies,
+	// as returned by a SnapshotReader. Datastores that don't implement SnapshotReader return
+	// ErrSnapshotsNotSupported rather than read the current tuples.
+	SnapshotToken string
+
+	// Partition, if set, restricts the read to the tuples tagged for the partition, such as the
+	// region they must reside in. Datastores that don't partition tuples return
+	// ErrPartitionsNotSupported rather than read the tuples of every partition.
+	Partition string
+}
+
+// SnapshotReader is implemented by the datastores that can serve reads as of a snapshot, so that
+// a series of related queries all observe the same tuples.
+type SnapshotReader interface {
+	// SnapshotToken returns a token identifying the current snapshot of the store, to be passed in
+	// ReadOptions.
+	SnapshotToken(ctx context.Context, store string) (string, error)
+
+	// ValidateSnapshotToken returns an error wrapping ErrInvalidSnapshotToken if token isn't a
+	// well-formed snapshot token of the datastore.
+	ValidateSnapshotToken(token string) error
 }
 
 // ReadUserTupleOptions represents the options that can
 // be used with the ReadUserTuple method.
 type ReadUserTupleOptions struct {
 	Consistency ConsistencyOptions
+
+	// SnapshotToken, if set, makes the read observe the tuples as of the snapshot it identifies.
+	// See ReadOptions.
+	SnapshotToken string
+
+	// Partition, if set, restricts the read to the tuples tagged for the partition. See
+	// ReadOptions.
+	Partition string
 }
 
 // ReadUsersetTuplesOptions represents the options that can
 // be used with the ReadUsersetTuples method.
 type ReadUsersetTuplesOptions struct {
 	Consistency ConsistencyOptions
+
+	// SnapshotToken, if set, makes the read observe the tuples as of the snapshot it identifies.
+	// See ReadOptions.
+	SnapshotToken string
+
+	// Partition, if set, restricts the read to the tuples tagged for the partition. See
+	// ReadOptions.
+	Partition string
 }
 
 // ReadStartingWithUserOptions represents the options that can
 // be used with the ReadStartingWithUser method.
 type ReadStartingWithUserOptions struct {
 	Consistency ConsistencyOptions
+
+	// SnapshotToken, if set, makes the read observe the tuples as of the snapshot it identifies.
+	// See ReadOptions.
+	SnapshotToken string
+
+	// Partition, if set, restricts the read to the tuples tagged for the partition. See
+	// ReadOptions.
+	Partition string
 }
 
 // Writes is a typesafe alias for Write arguments.
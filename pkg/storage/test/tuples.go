@@ -1636,3 +1636,63 @@ func writeTuplesConcurrently(t *testing.T, store string, datastore storage.OpenF
 
 	wg.Wait()
 }
+
+// UnsupportedReadOptionsTest checks that the datastore rejects the reads it can't serve as
+// requested, rather than serve them from the current tuples of every partition.
+func UnsupportedReadOptionsTest(t *testing.T, datastore storage.OpenFGADatastore) {
+	ctx := context.Background()
+	storeID := ulid.Make().String()
+	tk := tuple.NewTupleKey("document:1", "viewer", "user:jon")
+	err := datastore.Write(ctx, storeID, nil, []*openfgav1.TupleKey{tk})
+	require.NoError(t, err)
+
+	t.Run("snapshot_token", func(t *testing.T) {
+		if _, ok := datastore.(storage.SnapshotReader); ok {
+			t.Skip("the datastore serves snapshot reads")
+		}
+		_, err := datastore.Read(ctx, storeID, tk, storage.ReadOptions{SnapshotToken: "snapshot"})
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+
+		_, err = datastore.ReadUserTuple(ctx, storeID, tk, storage.ReadUserTupleOptions{SnapshotToken: "snapshot"})
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+
+		_, err = datastore.ReadUsersetTuples(ctx, storeID, storage.ReadUsersetTuplesFilter{
+			Object:   "document:1",
+			Relation: "viewer",
+		}, storage.ReadUsersetTuplesOptions{SnapshotToken: "snapshot"})
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+
+		_, err = datastore.ReadStartingWithUser(ctx, storeID, storage.ReadStartingWithUserFilter{
+			ObjectType: "document",
+			Relation:   "viewer",
+			UserFilter: []*openfgav1.ObjectRelation{{Object: "user:jon"}},
+		}, storage.ReadStartingWithUserOptions{SnapshotToken: "snapshot"})
+		require.ErrorIs(t, err, storage.ErrSnapshotsNotSupported)
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		_, err := datastore.Read(ctx, storeID, tk, storage.ReadOptions{Partition: "eu"})
+		require.ErrorIs(t, err, storage.ErrPartitionsNotSupported)
+
+		_, err = datastore.ReadUserTuple(ctx, storeID, tk, storage.ReadUserTupleOptions{Partition: "eu"})
+		require.ErrorIs(t, err, storage.ErrPartitionsNotSupported)
+
+		_, err = datastore.ReadUsersetTuples(ctx, storeID, storage.ReadUsersetTuplesFilter{
+			Object:   "document:1",
+			Relation: "viewer",
+		}, storage.ReadUsersetTuplesOptions{Partition: "eu"})
+		require.ErrorIs(t, err, storage.ErrPartitionsNotSupported)
+
+		_, err = datastore.ReadStartingWithUser(ctx, storeID, storage.ReadStartingWithUserFilter{
+			ObjectType: "document",
+			Relation:   "viewer",
+			UserFilter: []*openfgav1.ObjectRelation{{Object: "user:jon"}},
+		}, storage.ReadStartingWithUserOptions{Partition: "eu"})
+		require.ErrorIs(t, err, storage.ErrPartitionsNotSupported)
+	})
+
+	t.Run("current", func(t *testing.T) {
+		_, err := datastore.ReadUserTuple(ctx, storeID, tk, storage.ReadUserTupleOptions{})
+		require.NoError(t, err)
+	})
+}
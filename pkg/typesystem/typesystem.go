@@ -169,6 +169,9 @@ type TypeSystem struct {
 
 	modelID       string
 	schemaVersion string
+
+	// [objectType#relationName] of the relations flagged as not safe to enumerate.
+	nonEnumerableRelations map[string]struct{}
 }
 
 // New creates a *TypeSystem from an *openfgav1.AuthorizationModel.
@@ -233,6 +236,29 @@ func (t *TypeSystem) GetSchemaVersion() string {
 	return t.schemaVersion
 }
 
+// WithNonEnumerableRelations returns a copy of the TypeSystem in which the given relations, of
+// the form "objectType#relation", are flagged as not safe to enumerate, such as relations granted
+// to a huge public set. The authorization model has no field to annotate relations with, so the
+// flag is set on the TypeSystem. Flagged relations can still be checked, but not listed.
+func (t *TypeSystem) WithNonEnumerableRelations(relations ...string) *TypeSystem {
+	typesys := *t
+	typesys.nonEnumerableRelations = make(map[string]struct{}, len(t.nonEnumerableRelations)+len(relations))
+	for relation := range t.nonEnumerableRelations {
+		typesys.nonEnumerableRelations[relation] = struct{}{}
+	}
+	for _, relation := range relations {
+		typesys.nonEnumerableRelations[relation] = struct{}{}
+	}
+	return &typesys
+}
+
+// IsRelationEnumerable reports whether the users of the relation of the object type may be
+// listed, which is the case unless the relation was flagged with WithNonEnumerableRelations.
+func (t *TypeSystem) IsRelationEnumerable(objectType, relation string) bool {
+	_, flagged := t.nonEnumerableRelations[tuple.ToObjectRelationString(objectType, relation)]
+	return !flagged
+}
+
 // GetAllRelations returns a map [objectType] => [relationName] => relation.
 func (t *TypeSystem) GetAllRelations() map[string]map[string]*openfgav1.Relation {
 	return t.relations